@@ -0,0 +1,61 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// stsAPI holds the STS calls the connector makes itself
+type stsAPI interface {
+	GetCallerIdentity(*sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error)
+}
+
+// stsClient returns an STS client for the event region and credentials
+func stsClient(r request) stsAPI {
+	client := sts.New(sessions.get(r, r.DatacenterAccessKey, r.DatacenterAccessToken))
+	client.Handlers.Build.PushBack(userAgentHandler(r))
+	client.Handlers.Build.PushBack(timeoutHandler(cfg))
+	client.Handlers.Complete.PushBack(debugHandler(r))
+	client.Handlers.Complete.PushBack(sdkRetryHandler(r))
+	client.Handlers.Complete.PushBack(awsErrorHandler)
+	client.Handlers.Complete.PushBack(awsCallHandler)
+	return client
+}
+
+// checkAccount refuses to mutate a network when the event credentials
+// belong to another account than the one owning its VPC, which otherwise
+// fails deep inside ernestaws with a bare authorization error. Events
+// carrying routing credentials target shared VPCs and are not checked.
+func checkAccount(identity stsAPI, client ec2API, r request) error {
+	if r.VPCID == "" || r.RoutingAccessKey != "" || r.RoutingRoleARN != "" {
+		return nil
+	}
+
+	caller, err := identity.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{
+		VpcIds: []*string{aws.String(r.VPCID)},
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Vpcs) == 0 {
+		return newFieldError(errNotFound, "vpc_id", "VPC "+r.VPCID+" does not exist")
+	}
+
+	account := aws.StringValue(caller.Account)
+	owner := aws.StringValue(resp.Vpcs[0].OwnerId)
+	if owner != "" && account != owner {
+		return newFieldError(errMismatch, "vpc_id", "Credentials belong to account "+account+" but VPC "+r.VPCID+" is owned by account "+owner)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sts"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type mockSTS struct {
+	account string
+}
+
+func (m *mockSTS) GetCallerIdentity(in *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Account: aws.String(m.account)}, nil
+}
+
+func TestCheckAccount(t *testing.T) {
+	Convey("Given a VPC owned by an account", t, func() {
+		client := &mockEC2{vpcs: []*ec2.Vpc{{VpcId: aws.String("vpc-00000000"), OwnerId: aws.String("111111111111")}}}
+		r := request{VPCID: "vpc-00000000"}
+
+		Convey("When the credentials belong to the same account", func() {
+			err := checkAccount(&mockSTS{account: "111111111111"}, client, r)
+
+			Convey("It should accept the event", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the credentials belong to another account", func() {
+			err := checkAccount(&mockSTS{account: "222222222222"}, client, r)
+
+			Convey("It should refuse it with a mismatch on the VPC", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errMismatch)
+				So(err.(*connectorError).field, ShouldEqual, "vpc_id")
+				So(err.Error(), ShouldContainSubstring, "222222222222")
+				So(err.Error(), ShouldContainSubstring, "111111111111")
+			})
+		})
+
+		Convey("When the event carries routing credentials for a shared VPC", func() {
+			r.RoutingRoleARN = "arn:aws:iam::111111111111:role/routing"
+			err := checkAccount(&mockSTS{account: "222222222222"}, client, r)
+
+			Convey("It should not check it", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
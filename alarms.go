@@ -0,0 +1,97 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	alarmNamespace = "Ernest/Network"
+	alarmMetric    = "AvailableIpAddressCount"
+
+	// reservedIPs are the addresses AWS keeps in every subnet
+	reservedIPs = 5
+)
+
+func alarmName(id string) string {
+	return "ernest-" + id + "-ip-exhaustion"
+}
+
+// alarmThreshold returns the available ip count under which a network of
+// the given range is nearly exhausted
+func alarmThreshold(subnet string, percent int) float64 {
+	_, n, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return 0
+	}
+
+	ones, bits := n.Mask.Size()
+	usable := 1<<uint(bits-ones) - reservedIPs
+
+	return float64(usable * percent / 100)
+}
+
+// alarmIPs tracks the available ips of a created or updated network
+func alarmIPs(r request, id string) error {
+	subnet, err := describeSubnet(readClient(r), id)
+	if err != nil || subnet == nil {
+		return err
+	}
+
+	return trackIPs(cloudWatchClient(r), subnet, cfg)
+}
+
+// trackIPs publishes the available ip count of the network as a custom
+// metric, and creates the alarm raised when it falls under the threshold
+func trackIPs(client *cloudwatch.CloudWatch, subnet *ec2.Subnet, c config) error {
+	id := aws.StringValue(subnet.SubnetId)
+	dimensions := []*cloudwatch.Dimension{
+		{Name: aws.String("SubnetId"), Value: aws.String(id)},
+	}
+
+	_, err := client.PutMetricData(&cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(alarmNamespace),
+		MetricData: []*cloudwatch.MetricDatum{{
+			MetricName: aws.String(alarmMetric),
+			Dimensions: dimensions,
+			Timestamp:  aws.Time(time.Now()),
+			Unit:       aws.String("Count"),
+			Value:      aws.Float64(float64(aws.Int64Value(subnet.AvailableIpAddressCount))),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
+		AlarmName:          aws.String(alarmName(id)),
+		AlarmDescription:   aws.String("Network " + id + " is running out of ip addresses"),
+		Namespace:          aws.String(alarmNamespace),
+		MetricName:         aws.String(alarmMetric),
+		Dimensions:         dimensions,
+		Statistic:          aws.String("Minimum"),
+		Period:             aws.Int64(300),
+		EvaluationPeriods:  aws.Int64(1),
+		Threshold:          aws.Float64(alarmThreshold(aws.StringValue(subnet.CidrBlock), c.IPAlarmThreshold)),
+		ComparisonOperator: aws.String("LessThanOrEqualToThreshold"),
+		TreatMissingData:   aws.String("notBreaching"),
+		AlarmActions:       aws.StringSlice(c.IPAlarmActions),
+	})
+	return err
+}
+
+// deleteIPAlarm removes the alarm of a deleted network
+func deleteIPAlarm(client *cloudwatch.CloudWatch, id string) error {
+	_, err := client.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{
+		AlarmNames: []*string{aws.String(alarmName(id))},
+	})
+	return err
+}
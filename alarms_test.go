@@ -0,0 +1,27 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAlarmThreshold(t *testing.T) {
+	Convey("Given a network alarming at 10% of its addresses", t, func() {
+		Convey("With a /24 range", func() {
+			Convey("It should alarm under 25 available ips", func() {
+				So(alarmThreshold("10.0.1.0/24", 10), ShouldEqual, float64(25))
+			})
+		})
+
+		Convey("With an invalid range", func() {
+			Convey("It should never alarm", func() {
+				So(alarmThreshold("10.0.1.0", 10), ShouldEqual, float64(0))
+			})
+		})
+	})
+}
@@ -0,0 +1,50 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AnalyticsEvent : completed network change published on EVENTS_SUBJECT,
+// for the pipelines keeping the history of the networks
+type AnalyticsEvent struct {
+	Subject   string                 `json:"subject"`
+	UUID      string                 `json:"_uuid"`
+	BatchID   string                 `json:"_batch_id"`
+	Service   string                 `json:"service"`
+	Region    string                 `json:"datacenter_region"`
+	Version   string                 `json:"connector_version"`
+	Timestamp time.Time              `json:"timestamp"`
+	Network   map[string]interface{} `json:"network"`
+}
+
+// analyticsEvent returns the done response of the event as published for
+// analytics, without credentials and in the field names of schema 1
+func analyticsEvent(subject string, r request, data []byte, now time.Time) AnalyticsEvent {
+	return AnalyticsEvent{
+		Subject:   subject,
+		UUID:      r.UUID,
+		BatchID:   r.BatchID,
+		Service:   r.Service,
+		Region:    r.DatacenterRegion,
+		Version:   version,
+		Timestamp: now,
+		Network:   sanitize(data),
+	}
+}
+
+// publishAnalytics publishes the done response of the event on the
+// analytics subject. Nothing reads it back, so it isn't kept in the
+// outbox when NATS is unavailable.
+func publishAnalytics(subject string, e AnalyticsEvent) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	nc.Publish(subject, data)
+}
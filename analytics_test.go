@@ -0,0 +1,40 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAnalyticsEvent(t *testing.T) {
+	Convey("Given a network created", t, func() {
+		data := []byte(`{"_uuid":"uuid","_batch_id":"batch","service":"svc","datacenter_region":"eu-west-1","datacenter_secret":"key","datacenter_token":"token","range":"10.1.0.0/24","network_aws_id":"subnet-00000000"}`)
+		r := parseRequest(data)
+		now := time.Now()
+
+		Convey("When publishing it for analytics", func() {
+			e := analyticsEvent("network.create.aws", r, data, now)
+
+			Convey("It should identify the change", func() {
+				So(e.Subject, ShouldEqual, "network.create.aws")
+				So(e.UUID, ShouldEqual, "uuid")
+				So(e.BatchID, ShouldEqual, "batch")
+				So(e.Service, ShouldEqual, "svc")
+				So(e.Region, ShouldEqual, "eu-west-1")
+				So(e.Timestamp, ShouldEqual, now)
+			})
+
+			Convey("It should carry the network without credentials", func() {
+				So(e.Network["network_aws_id"], ShouldEqual, "subnet-00000000")
+				So(e.Network["range"], ShouldEqual, "10.1.0.0/24")
+				So(e.Network, ShouldNotContainKey, "datacenter_secret")
+				So(e.Network, ShouldNotContainKey, "datacenter_token")
+			})
+		})
+	})
+}
@@ -0,0 +1,212 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// ec2API holds the EC2 calls the connector makes itself, so its flows can
+// run against a mock in tests
+type ec2API interface {
+	AssociateRouteTable(*ec2.AssociateRouteTableInput) (*ec2.AssociateRouteTableOutput, error)
+	AssociateSubnetCidrBlock(*ec2.AssociateSubnetCidrBlockInput) (*ec2.AssociateSubnetCidrBlockOutput, error)
+	CreateRoute(*ec2.CreateRouteInput) (*ec2.CreateRouteOutput, error)
+	CreateRouteTable(*ec2.CreateRouteTableInput) (*ec2.CreateRouteTableOutput, error)
+	CreateTags(*ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error)
+	DeleteFlowLogs(*ec2.DeleteFlowLogsInput) (*ec2.DeleteFlowLogsOutput, error)
+	DeleteInternetGateway(*ec2.DeleteInternetGatewayInput) (*ec2.DeleteInternetGatewayOutput, error)
+	DeleteNatGateway(*ec2.DeleteNatGatewayInput) (*ec2.DeleteNatGatewayOutput, error)
+	DeleteRoute(*ec2.DeleteRouteInput) (*ec2.DeleteRouteOutput, error)
+	DeleteRouteTable(*ec2.DeleteRouteTableInput) (*ec2.DeleteRouteTableOutput, error)
+	DeleteSubnet(*ec2.DeleteSubnetInput) (*ec2.DeleteSubnetOutput, error)
+	DeleteVpcEndpoints(*ec2.DeleteVpcEndpointsInput) (*ec2.DeleteVpcEndpointsOutput, error)
+	DescribeAvailabilityZones(*ec2.DescribeAvailabilityZonesInput) (*ec2.DescribeAvailabilityZonesOutput, error)
+	DescribeFlowLogs(*ec2.DescribeFlowLogsInput) (*ec2.DescribeFlowLogsOutput, error)
+	DescribeInternetGateways(*ec2.DescribeInternetGatewaysInput) (*ec2.DescribeInternetGatewaysOutput, error)
+	DescribeManagedPrefixLists(*ec2.DescribeManagedPrefixListsInput) (*ec2.DescribeManagedPrefixListsOutput, error)
+	DescribeNatGateways(*ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error)
+	DescribeNetworkInterfaces(*ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error)
+	DescribeRouteTables(*ec2.DescribeRouteTablesInput) (*ec2.DescribeRouteTablesOutput, error)
+	DescribeSubnets(*ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error)
+	DescribeVpcEndpoints(*ec2.DescribeVpcEndpointsInput) (*ec2.DescribeVpcEndpointsOutput, error)
+	DescribeVpcs(*ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error)
+	DetachInternetGateway(*ec2.DetachInternetGatewayInput) (*ec2.DetachInternetGatewayOutput, error)
+	DisassociateRouteTable(*ec2.DisassociateRouteTableInput) (*ec2.DisassociateRouteTableOutput, error)
+	DisassociateSubnetCidrBlock(*ec2.DisassociateSubnetCidrBlockInput) (*ec2.DisassociateSubnetCidrBlockOutput, error)
+	ModifyManagedPrefixList(*ec2.ModifyManagedPrefixListInput) (*ec2.ModifyManagedPrefixListOutput, error)
+	ModifySubnetAttribute(*ec2.ModifySubnetAttributeInput) (*ec2.ModifySubnetAttributeOutput, error)
+	ReplaceRoute(*ec2.ReplaceRouteInput) (*ec2.ReplaceRouteOutput, error)
+}
+
+// ec2Client returns an EC2 client for the event region and credentials
+func ec2Client(r request) ec2API {
+	return newEC2Client(r, r.DatacenterAccessKey, r.DatacenterAccessToken)
+}
+
+// readClient returns an EC2 client for read only calls, using the event
+// read credentials when it carries them
+func readClient(r request) ec2API {
+	if r.ReadAccessKey != "" && r.ReadAccessToken != "" {
+		return newEC2Client(r, r.ReadAccessKey, r.ReadAccessToken)
+	}
+	return ec2Client(r)
+}
+
+// routingClient returns an EC2 client for route table and internet gateway
+// calls, using the event routing credentials or role when it carries
+// them. In shared VPCs the routing is owned by another account than the
+// networks.
+func routingClient(r request) ec2API {
+	if r.RoutingAccessKey == "" && r.RoutingRoleARN == "" {
+		return ec2Client(r)
+	}
+
+	key, token := r.RoutingAccessKey, r.RoutingAccessToken
+	if key == "" {
+		key, token = r.DatacenterAccessKey, r.DatacenterAccessToken
+	}
+
+	routing := r
+	routing.RoleARN = r.RoutingRoleARN
+	return newEC2Client(routing, key, token)
+}
+
+func newEC2Client(r request, key, token string) ec2API {
+	if r.ProviderType == providerFake {
+		return fake.aws
+	}
+
+	client := ec2.New(sessions.get(r, key, token))
+	client.Handlers.Build.PushBack(userAgentHandler(r))
+	client.Handlers.Build.PushBack(timeoutHandler(cfg))
+	client.Handlers.Complete.PushBack(debugHandler(r))
+	client.Handlers.Complete.PushBack(sdkRetryHandler(r))
+	client.Handlers.Complete.PushBack(eventCallHandler(r))
+	client.Handlers.Complete.PushBack(awsErrorHandler)
+	client.Handlers.Complete.PushBack(awsCallHandler)
+	return withCassette(withRoutingCache(client, r.DatacenterRegion, sessionKey(r, key, token), routings), r, cfg)
+}
+
+// cloudWatchClient returns a CloudWatch client for the event region and
+// credentials
+func cloudWatchClient(r request) *cloudwatch.CloudWatch {
+	client := cloudwatch.New(sessions.get(r, r.DatacenterAccessKey, r.DatacenterAccessToken))
+	client.Handlers.Build.PushBack(userAgentHandler(r))
+	client.Handlers.Build.PushBack(timeoutHandler(cfg))
+	client.Handlers.Complete.PushBack(debugHandler(r))
+	client.Handlers.Complete.PushBack(sdkRetryHandler(r))
+	client.Handlers.Complete.PushBack(eventCallHandler(r))
+	client.Handlers.Complete.PushBack(awsErrorHandler)
+	client.Handlers.Complete.PushBack(awsCallHandler)
+	return client
+}
+
+func awsConfig(r request, key, token string) *aws.Config {
+	config := &aws.Config{
+		Region:      aws.String(r.DatacenterRegion),
+		Credentials: eventCredentials(r, key, token),
+		MaxRetries:  aws.Int(cfg.SDKRetries),
+	}
+
+	// a custom endpoint, such as LocalStack, serves every service on the
+	// same host, which S3 can only address by path
+	if endpoint := r.endpoint(cfg); endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	return config
+}
+
+// eventCredentials returns the static credentials of the event or, when
+// it names a role, temporary credentials of that role
+func eventCredentials(r request, key, token string) *credentials.Credentials {
+	if r.RoleARN == "" {
+		return credentials.NewStaticCredentials(key, token, "")
+	}
+
+	// events reach here past checkRoles, this only guards the handlers
+	// that would skip it
+	if err := checkRole(cfg, "datacenter_role_arn", r.RoleARN, r.ExternalID); err != nil {
+		return credentials.NewCredentials(refusedRole{err})
+	}
+
+	// events without credentials assume the role with the connector's own,
+	// from its environment or instance profile
+	config := &aws.Config{Region: aws.String(r.DatacenterRegion)}
+	if endpoint := r.endpoint(cfg); endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	if key != "" {
+		config.Credentials = credentials.NewStaticCredentials(key, token, "")
+	}
+
+	return stscreds.NewCredentials(session.New(config), r.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = "ernest-" + r.UUID
+		p.ExternalID = aws.String(r.ExternalID)
+	})
+}
+
+// refusedRole fails every call made with a role the connector may not
+// assume
+type refusedRole struct {
+	err error
+}
+
+func (p refusedRole) Retrieve() (credentials.Value, error) {
+	return credentials.Value{}, p.err
+}
+
+func (p refusedRole) IsExpired() bool {
+	return true
+}
+
+func userAgentHandler(r request) func(*awsrequest.Request) {
+	return awsrequest.MakeAddToUserAgentHandler(cfg.UserAgent, version, userAgentExtra(r)...)
+}
+
+// userAgentExtra identifies the event an AWS call is made for, so it can
+// be traced in CloudTrail
+func userAgentExtra(r request) []string {
+	if r.UUID == "" {
+		return nil
+	}
+	return []string{"event/" + r.UUID}
+}
+
+// describeSubnet returns the subnet with the given id, or nil if it
+// doesn't exist
+func describeSubnet(client ec2API, id string) (*ec2.Subnet, error) {
+	resp, err := client.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		SubnetIds: []*string{aws.String(id)},
+	})
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Subnets) == 0 {
+		return nil, nil
+	}
+
+	return resp.Subnets[0], nil
+}
+
+func isNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == "InvalidSubnetID.NotFound"
+	}
+	return false
+}
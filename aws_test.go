@@ -0,0 +1,79 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReadClient(t *testing.T) {
+	Convey("Given an event describing a network", t, func() {
+		cached := sessions
+		sessions = newSessionCache()
+		defer func() { sessions = cached }()
+
+		r := request{DatacenterRegion: "eu-west-1", DatacenterAccessKey: "write", DatacenterAccessToken: "write-token"}
+
+		Convey("When it carries read credentials", func() {
+			r.ReadAccessKey, r.ReadAccessToken = "read", "read-token"
+			readClient(r)
+
+			Convey("It should describe it with the read credentials", func() {
+				So(sessions.sessions, ShouldContainKey, sessionKey(r, "read", "read-token"))
+				So(sessions.sessions, ShouldNotContainKey, sessionKey(r, "write", "write-token"))
+			})
+		})
+
+		Convey("When it carries a read key without its token", func() {
+			r.ReadAccessKey = "read"
+			readClient(r)
+
+			Convey("It should describe it with the datacenter credentials", func() {
+				So(sessions.sessions, ShouldContainKey, sessionKey(r, "write", "write-token"))
+				So(len(sessions.sessions), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When it carries no read credentials", func() {
+			readClient(r)
+
+			Convey("It should describe it with the datacenter credentials", func() {
+				So(sessions.sessions, ShouldContainKey, sessionKey(r, "write", "write-token"))
+				So(len(sessions.sessions), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestUserAgentHandler(t *testing.T) {
+	Convey("Given an AWS call", t, func() {
+		agent := cfg.UserAgent
+		cfg.UserAgent = "network-all-aws-connector"
+		defer func() { cfg.UserAgent = agent }()
+
+		req := &awsrequest.Request{HTTPRequest: &http.Request{Header: http.Header{}}}
+
+		Convey("When it is made for an event", func() {
+			userAgentHandler(request{UUID: "event-1"})(req)
+
+			Convey("It should name the connector, its version and the event", func() {
+				So(req.HTTPRequest.Header.Get("User-Agent"), ShouldEqual, "network-all-aws-connector/dev (event/event-1)")
+			})
+		})
+
+		Convey("When it is made outside of an event", func() {
+			userAgentHandler(request{})(req)
+
+			Convey("It should name the connector and its version only", func() {
+				So(req.HTTPRequest.Header.Get("User-Agent"), ShouldEqual, "network-all-aws-connector/dev")
+			})
+		})
+	})
+}
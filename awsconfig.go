@@ -0,0 +1,98 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// ConfigurationItem : subnet descriptor following the AWS Config
+// configuration item schema, for compliance pipelines
+type ConfigurationItem struct {
+	ResourceType                 string            `json:"resourceType"`
+	ResourceID                   string            `json:"resourceId"`
+	ARN                          string            `json:"ARN,omitempty"`
+	AWSAccountID                 string            `json:"awsAccountId,omitempty"`
+	AWSRegion                    string            `json:"awsRegion"`
+	AvailabilityZone             string            `json:"availabilityZone"`
+	ConfigurationItemCaptureTime time.Time         `json:"configurationItemCaptureTime"`
+	ConfigurationItemStatus      string            `json:"configurationItemStatus"`
+	Tags                         map[string]string `json:"tags"`
+	Configuration                SubnetDescriptor  `json:"configuration"`
+}
+
+// SubnetDescriptor : the configuration of a subnet configuration item
+type SubnetDescriptor struct {
+	SubnetID                    string `json:"subnetId"`
+	VPCID                       string `json:"vpcId"`
+	CIDRBlock                   string `json:"cidrBlock"`
+	AvailabilityZone            string `json:"availabilityZone"`
+	AvailableIPAddressCount     int64  `json:"availableIpAddressCount"`
+	DefaultForAZ                bool   `json:"defaultForAz"`
+	MapPublicIPOnLaunch         bool   `json:"mapPublicIpOnLaunch"`
+	AssignIPv6AddressOnCreation bool   `json:"assignIpv6AddressOnCreation"`
+	State                       string `json:"state"`
+}
+
+func configurationItem(region string, s *ec2.Subnet, now time.Time) ConfigurationItem {
+	item := ConfigurationItem{
+		ResourceType:                 "AWS::EC2::Subnet",
+		ResourceID:                   aws.StringValue(s.SubnetId),
+		ARN:                          aws.StringValue(s.SubnetArn),
+		AWSAccountID:                 aws.StringValue(s.OwnerId),
+		AWSRegion:                    region,
+		AvailabilityZone:             aws.StringValue(s.AvailabilityZone),
+		ConfigurationItemCaptureTime: now,
+		ConfigurationItemStatus:      "ResourceDiscovered",
+		Tags:                         tagMap(s.Tags),
+		Configuration: SubnetDescriptor{
+			SubnetID:                    aws.StringValue(s.SubnetId),
+			VPCID:                       aws.StringValue(s.VpcId),
+			CIDRBlock:                   aws.StringValue(s.CidrBlock),
+			AvailabilityZone:            aws.StringValue(s.AvailabilityZone),
+			AvailableIPAddressCount:     aws.Int64Value(s.AvailableIpAddressCount),
+			DefaultForAZ:                aws.BoolValue(s.DefaultForAz),
+			MapPublicIPOnLaunch:         aws.BoolValue(s.MapPublicIpOnLaunch),
+			AssignIPv6AddressOnCreation: aws.BoolValue(s.AssignIpv6AddressOnCreation),
+			State:                       aws.StringValue(s.State),
+		},
+	}
+
+	if item.ARN == "" && item.AWSAccountID != "" {
+		item.ARN = fmt.Sprintf("arn:aws:ec2:%s:%s:subnet/%s", region, item.AWSAccountID, item.ResourceID)
+	}
+
+	return item
+}
+
+// publishConfigurationItem describes a newly created network and publishes
+// its configuration item on the configured subject
+func publishConfigurationItem(subject string, r request, id string) {
+	s, err := describeSubnet(readClient(r), id)
+	if err != nil || s == nil {
+		fmt.Println("could not describe network " + id + " for its configuration item")
+		return
+	}
+
+	data, err := json.Marshal(configurationItem(r.DatacenterRegion, s, time.Now()))
+	if err != nil {
+		return
+	}
+
+	nc.Publish(subject, data)
+}
+
+func tagMap(tags []*ec2.Tag) map[string]string {
+	m := make(map[string]string)
+	for _, t := range tags {
+		m[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return m
+}
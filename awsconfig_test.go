@@ -0,0 +1,42 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfigurationItem(t *testing.T) {
+	Convey("Given a created subnet", t, func() {
+		s := &ec2.Subnet{
+			SubnetId:                aws.String("subnet-00000000"),
+			VpcId:                   aws.String("vpc-0000000"),
+			OwnerId:                 aws.String("123456789012"),
+			CidrBlock:               aws.String("10.0.0.0/24"),
+			AvailabilityZone:        aws.String("eu-west-1a"),
+			AvailableIpAddressCount: aws.Int64(251),
+			State:                   aws.String("available"),
+			Tags:                    []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web")}},
+		}
+
+		Convey("When building its configuration item", func() {
+			item := configurationItem("eu-west-1", s, time.Now())
+
+			Convey("It should follow the AWS Config subnet schema", func() {
+				So(item.ResourceType, ShouldEqual, "AWS::EC2::Subnet")
+				So(item.ResourceID, ShouldEqual, "subnet-00000000")
+				So(item.ARN, ShouldEqual, "arn:aws:ec2:eu-west-1:123456789012:subnet/subnet-00000000")
+				So(item.Tags["Name"], ShouldEqual, "web")
+				So(item.Configuration.CIDRBlock, ShouldEqual, "10.0.0.0/24")
+				So(item.Configuration.AvailableIPAddressCount, ShouldEqual, int64(251))
+			})
+		})
+	})
+}
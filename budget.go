@@ -0,0 +1,121 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// budgetIdle is how long the budget of a batch without events is kept
+const budgetIdle = 24 * time.Hour
+
+// budgetProgress is what a batch has done within its current budget
+type budgetProgress struct {
+	Window    int    `json:"window"`
+	Mutations int    `json:"mutations"`
+	Elapsed   string `json:"elapsed"`
+}
+
+// budgets tracks the mutations of the batches carrying a _max_mutations
+// or _max_duration budget. Once a batch exhausts its budget its events
+// are turned away with a continuation token; the first event carrying it
+// opens a new budget for the batch.
+type budgets struct {
+	mu      sync.Mutex
+	batches map[string]*batchBudget
+}
+
+type batchBudget struct {
+	window    int
+	mutations int
+	started   time.Time
+	seen      time.Time
+	token     string
+}
+
+func newBudgets() *budgets {
+	return &budgets{batches: make(map[string]*batchBudget)}
+}
+
+// admit counts a mutation of the batch against its budget, or returns the
+// continuation token to resume the batch with once it is exhausted
+func (b *budgets) admit(r request, now time.Time) (string, budgetProgress, bool) {
+	maxDuration, _ := time.ParseDuration(r.MaxDuration)
+	if r.BatchID == "" || (r.MaxMutations <= 0 && maxDuration <= 0) {
+		return "", budgetProgress{}, true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, batch := range b.batches {
+		if now.Sub(batch.seen) > budgetIdle {
+			delete(b.batches, id)
+		}
+	}
+
+	batch, ok := b.batches[r.BatchID]
+	if !ok {
+		batch = &batchBudget{window: 1, started: now}
+		b.batches[r.BatchID] = batch
+	}
+	batch.seen = now
+
+	if batch.token != "" && r.Continuation == batch.token {
+		batch.window++
+		batch.mutations = 0
+		batch.started = now
+		batch.token = ""
+	}
+
+	progress := budgetProgress{Window: batch.window, Mutations: batch.mutations, Elapsed: now.Sub(batch.started).String()}
+
+	exhausted := r.MaxMutations > 0 && batch.mutations >= r.MaxMutations
+	exhausted = exhausted || (maxDuration > 0 && now.Sub(batch.started) >= maxDuration)
+	if exhausted {
+		if batch.token == "" {
+			batch.token = continuationToken()
+		}
+		return batch.token, progress, false
+	}
+
+	batch.mutations++
+	return "", progress, true
+}
+
+func continuationToken() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var batchBudgets = newBudgets()
+
+// budget turns away the mutations of a batch past its budget, reporting
+// its progress and the continuation token to resume it with
+func budget(next eventFunc) eventFunc {
+	return func(e *event) {
+		if !mutating(e.msg.Subject) || e.req.DryRun {
+			next(e)
+			return
+		}
+
+		token, progress, ok := batchBudgets.admit(e.req, time.Now())
+		if !ok {
+			err := newError(errBudget, "Batch "+e.req.BatchID+" exhausted its budget after "+strconv.Itoa(progress.Mutations)+" mutations in "+progress.Elapsed)
+			respond(e.msg, e.req, e.msg.Subject+".error", setFields(errorResponse(e.msg.Data, err), map[string]interface{}{
+				"continuation": token,
+				"progress":     progress,
+			}))
+			return
+		}
+
+		next(e)
+	}
+}
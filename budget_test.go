@@ -0,0 +1,75 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBudgets(t *testing.T) {
+	Convey("Given a batch allowed two mutations", t, func() {
+		b := newBudgets()
+		now := time.Now()
+		r := request{BatchID: "batch-1", MaxMutations: 2}
+
+		_, _, first := b.admit(r, now)
+		_, _, second := b.admit(r, now)
+		token, progress, third := b.admit(r, now)
+
+		Convey("It should admit the first two", func() {
+			So(first, ShouldBeTrue)
+			So(second, ShouldBeTrue)
+		})
+
+		Convey("It should pause the batch with a continuation token", func() {
+			So(third, ShouldBeFalse)
+			So(token, ShouldNotEqual, "")
+			So(progress.Mutations, ShouldEqual, 2)
+			So(progress.Window, ShouldEqual, 1)
+		})
+
+		Convey("When an event carries another token", func() {
+			r.Continuation = "not-the-token"
+			_, _, ok := b.admit(r, now)
+
+			Convey("It should keep the batch paused", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When an event carries the continuation token", func() {
+			r.Continuation = token
+			_, progress, ok := b.admit(r, now)
+
+			Convey("It should open a new budget", func() {
+				So(ok, ShouldBeTrue)
+				So(progress.Window, ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given a batch allowed to mutate for a minute", t, func() {
+		b := newBudgets()
+		now := time.Now()
+		r := request{BatchID: "batch-1", MaxDuration: "1m"}
+		b.admit(r, now)
+
+		Convey("It should pause it once the minute is over", func() {
+			_, _, ok := b.admit(r, now.Add(2*time.Minute))
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given an event without a budget", t, func() {
+		_, _, ok := newBudgets().admit(request{BatchID: "batch-1"}, time.Now())
+
+		Convey("It should be admitted", func() {
+			So(ok, ShouldBeTrue)
+		})
+	})
+}
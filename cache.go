@@ -0,0 +1,78 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// describeCache shares the results of describe calls made for reporting
+// for a short while, and spaces out the calls it does make, so reporting
+// features don't multiply EC2 read traffic
+type describeCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	entries  map[string]cacheEntry
+	limit    sync.Mutex
+	interval time.Duration
+	last     time.Time
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newDescribeCache(ttl, interval time.Duration) *describeCache {
+	return &describeCache{
+		ttl:      ttl,
+		interval: interval,
+		entries:  make(map[string]cacheEntry),
+	}
+}
+
+// get returns the cached value for the key, or fetches it once the rate
+// limit allows. Failed fetches are not cached.
+func (c *describeCache) get(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+
+	c.wait()
+
+	value, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ttl > 0 {
+		c.mu.Lock()
+		c.entries[key] = cacheEntry{value: value, expires: time.Now().Add(c.ttl)}
+		c.mu.Unlock()
+	}
+
+	return value, nil
+}
+
+func (c *describeCache) wait() {
+	c.limit.Lock()
+	defer c.limit.Unlock()
+
+	if d := c.interval - time.Since(c.last); d > 0 {
+		time.Sleep(d)
+	}
+	c.last = time.Now()
+}
+
+// cacheKey scopes cached results to the account and region they were read
+// from
+func cacheKey(r request, kind, id string) string {
+	return r.DatacenterRegion + "/" + r.DatacenterAccessKey + "/" + kind + "/" + id
+}
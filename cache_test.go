@@ -0,0 +1,71 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDescribeCache(t *testing.T) {
+	Convey("Given a describe cache", t, func() {
+		c := newDescribeCache(time.Minute, 0)
+
+		var calls int
+		fetch := func() (interface{}, error) {
+			calls++
+			return calls, nil
+		}
+
+		Convey("When the same resources are described twice", func() {
+			first, _ := c.get("eu-west-1/key/subnets/vpc-0000000", fetch)
+			second, _ := c.get("eu-west-1/key/subnets/vpc-0000000", fetch)
+
+			Convey("It should only call AWS once", func() {
+				So(calls, ShouldEqual, 1)
+				So(second, ShouldEqual, first)
+			})
+		})
+
+		Convey("When other resources are described", func() {
+			c.get("eu-west-1/key/subnets/vpc-0000000", fetch)
+			c.get("eu-west-1/key/subnets/vpc-1111111", fetch)
+
+			Convey("It should call AWS for each of them", func() {
+				So(calls, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When describing fails", func() {
+			c.get("eu-west-1/key/subnets/vpc-0000000", func() (interface{}, error) {
+				return nil, errors.New("throttled")
+			})
+			c.get("eu-west-1/key/subnets/vpc-0000000", fetch)
+
+			Convey("It should not cache the failure", func() {
+				So(calls, ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a rate limited describe cache", t, func() {
+		c := newDescribeCache(0, 50*time.Millisecond)
+		fetch := func() (interface{}, error) { return nil, nil }
+
+		Convey("When describing in a row", func() {
+			started := time.Now()
+			c.get("a", fetch)
+			c.get("b", fetch)
+			c.get("c", fetch)
+
+			Convey("It should space out the calls", func() {
+				So(time.Since(started), ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+			})
+		})
+	})
+}
@@ -0,0 +1,66 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sync"
+
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+)
+
+// callCounter tallies, per operation, the AWS requests the connector's
+// own clients sent for the events being handled
+type callCounter struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int
+}
+
+func newCallCounter() *callCounter {
+	return &callCounter{counts: make(map[string]map[string]int)}
+}
+
+// watch starts counting the AWS calls of the event
+func (c *callCounter) watch(uuid string) {
+	if uuid == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[uuid] = make(map[string]int)
+}
+
+// add counts calls to an operation for the event, when watched
+func (c *callCounter) add(uuid, operation string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if calls, ok := c.counts[uuid]; ok {
+		calls[operation] += n
+	}
+}
+
+// take returns the AWS calls of the event by operation and stops
+// counting them
+func (c *callCounter) take(uuid string) map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	calls := c.counts[uuid]
+	delete(c.counts, uuid)
+	return calls
+}
+
+// eventCallHandler counts each AWS call of the event against its
+// operation, each retry of the SDK included
+func eventCallHandler(r request) func(*awsrequest.Request) {
+	return func(req *awsrequest.Request) {
+		if req.Operation == nil {
+			return
+		}
+		eventCalls.add(r.UUID, req.Operation.Name, 1+req.RetryCount)
+	}
+}
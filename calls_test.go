@@ -0,0 +1,48 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventCalls(t *testing.T) {
+	Convey("Given an event being handled", t, func() {
+		r := request{UUID: "calls-1"}
+		eventCalls.watch(r.UUID)
+		defer eventCalls.take(r.UUID)
+
+		describe := &awsrequest.Request{Operation: &awsrequest.Operation{Name: "DescribeSubnets"}}
+		throttled := &awsrequest.Request{Operation: &awsrequest.Operation{Name: "CreateTags"}, RetryCount: 2}
+
+		Convey("When its AWS calls complete", func() {
+			eventCallHandler(r)(describe)
+			eventCallHandler(r)(describe)
+			eventCallHandler(r)(throttled)
+
+			Convey("It should tally them by operation, SDK retries included", func() {
+				So(eventCalls.take(r.UUID), ShouldResemble, map[string]int{"DescribeSubnets": 2, "CreateTags": 3})
+			})
+
+			Convey("It should stop counting once taken", func() {
+				eventCalls.take(r.UUID)
+				eventCallHandler(r)(describe)
+				So(eventCalls.take(r.UUID), ShouldBeNil)
+			})
+		})
+
+		Convey("When another event makes calls", func() {
+			eventCallHandler(request{UUID: "calls-2"})(describe)
+
+			Convey("It should not count them against this one", func() {
+				So(eventCalls.take(r.UUID), ShouldBeEmpty)
+				So(eventCalls.take("calls-2"), ShouldBeNil)
+			})
+		})
+	})
+}
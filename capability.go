@@ -0,0 +1,60 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/nats-io/nats"
+)
+
+// supportedVerbs are the network verbs this connector version handles
+var supportedVerbs = []string{"create", "update", "delete", "get", "find", "compare", "inventory", "history"}
+
+// verbVersions are the released connector versions known to handle each
+// supported verb, so senders can tell which instances of a mixed version
+// fleet handle them. 1.7.0 is the earliest release this is known for;
+// verbs no release handles yet are left out.
+var verbVersions = map[string]string{
+	"create": "1.7.0",
+	"update": "1.7.0",
+	"delete": "1.7.0",
+}
+
+// handledVerbs are the verbs ernestaws is handed events for
+var handledVerbs = []string{"create", "update", "delete", "get"}
+
+// connectorVerbs are used by the connector itself on network.*.aws
+// subjects, for anything but events
+var connectorVerbs = []string{"control", "replay", "schema", "monitor"}
+
+// unsupportedHandler answers events for verbs this connector version
+// doesn't handle with a capability_missing error, instead of leaving them
+// unanswered, so mixed version fleets degrade gracefully
+func unsupportedHandler(m *nats.Msg) {
+	v := verb(m.Subject)
+	if contains(supportedVerbs, v) || contains(connectorVerbs, v) || ownSubject(cfg, m.Subject) {
+		return
+	}
+
+	publishError(m.Subject, capabilityMissing(m.Data, v))
+}
+
+// capabilityMissing builds the error response for an unsupported verb,
+// naming the connector version, the verbs it supports and the versions
+// which introduced them
+func capabilityMissing(data []byte, v string) []byte {
+	err := newError(errCapability, "Connector version "+version+" does not support "+v)
+
+	return setFields(errorResponse(data, err), map[string]interface{}{
+		"connector_version": version,
+		"supported_verbs":   supportedVerbs,
+		"verb_versions":     verbVersions,
+	})
+}
+
+// ownSubject reports whether the connector publishes on the subject
+func ownSubject(c config, subject string) bool {
+	own := []string{c.MonitorSubject, c.ShutdownSubject, c.DiagnosticsSubject, c.ConfigSubject, c.EventsSubject, c.MessagesSubject, c.ErrorsSubject}
+	return subject != "" && contains(own, subject)
+}
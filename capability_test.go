@@ -0,0 +1,63 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nats-io/nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCapabilityMissing(t *testing.T) {
+	Convey("Given an event for a verb the connector doesn't support", t, func() {
+		data := capabilityMissing([]byte(`{"_uuid":"test"}`), "resize")
+
+		var body map[string]interface{}
+		json.Unmarshal(data, &body)
+
+		Convey("It should report the missing capability", func() {
+			So(body["_uuid"], ShouldEqual, "test")
+			So(body["error_code"], ShouldEqual, errCapability)
+			So(body["error"], ShouldEqual, "Connector version "+version+" does not support resize")
+			So(body["connector_version"], ShouldEqual, version)
+			So(body["supported_verbs"], ShouldContain, "get")
+		})
+
+		Convey("It should tell which released versions handle each verb", func() {
+			versions := body["verb_versions"].(map[string]interface{})
+			So(versions["update"], ShouldEqual, "1.7.0")
+			So(versions, ShouldNotContainKey, "inventory")
+			for v := range versions {
+				So(supportedVerbs, ShouldContain, v)
+			}
+		})
+	})
+}
+
+func TestHandleUnsupportedVerb(t *testing.T) {
+	Convey("Given an event for a verb ernestaws doesn't handle", t, func() {
+		subject, data := handle(&nats.Msg{Subject: "network.resize.aws", Data: []byte(`{"_uuid":"test","_type":"fake"}`)}, nil)
+
+		var body map[string]interface{}
+		json.Unmarshal(data, &body)
+
+		Convey("It should respond with an error instead of a done", func() {
+			So(subject, ShouldEqual, "network.resize.aws.error")
+			So(body["error_code"], ShouldEqual, errCapability)
+			So(body["_uuid"], ShouldEqual, "test")
+		})
+	})
+
+	Convey("Given an event on a malformed subject", t, func() {
+		subject, data := handle(&nats.Msg{Subject: "network", Data: []byte(`{}`)}, nil)
+
+		Convey("It should respond with an error", func() {
+			So(subject, ShouldEqual, "network.error")
+			So(string(data), ShouldContainSubstring, errPayload)
+		})
+	})
+}
@@ -0,0 +1,110 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// capacitySignal is published by the instance connectors when a launch
+// fails for lack of capacity in a zone
+type capacitySignal struct {
+	AvailabilityZone string    `json:"availability_zone"`
+	ErrorCode        string    `json:"error_code"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// capacitySignals remembers the zones recently short of capacity, so
+// networks are placed where their instances can be launched
+type capacitySignals struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+}
+
+func newCapacitySignals(window time.Duration) *capacitySignals {
+	return &capacitySignals{window: window, seen: make(map[string]time.Time)}
+}
+
+// record notes a capacity failure in the zone at the given time
+func (c *capacitySignals) record(az string, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if at.After(c.seen[az]) {
+		c.seen[az] = at
+	}
+}
+
+// constrained reports whether the zone failed for capacity within the
+// signal window
+func (c *capacitySignals) constrained(az string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	at, ok := c.seen[az]
+	if ok && now.Sub(at) > c.window {
+		delete(c.seen, az)
+		return false
+	}
+	return ok
+}
+
+// deprioritize moves the constrained zones after the others, keeping
+// their order otherwise
+func (c *capacitySignals) deprioritize(zones []string, now time.Time) []string {
+	var free, constrained []string
+	for _, az := range zones {
+		if c.constrained(az, now) {
+			constrained = append(constrained, az)
+		} else {
+			free = append(free, az)
+		}
+	}
+	return append(free, constrained...)
+}
+
+// unconstrained returns the zones without recent capacity failures, or
+// all of them when every zone has some
+func (c *capacitySignals) unconstrained(zones []string, now time.Time) []string {
+	var free []string
+	for _, az := range zones {
+		if !c.constrained(az, now) {
+			free = append(free, az)
+		}
+	}
+	if len(free) == 0 {
+		return zones
+	}
+	return free
+}
+
+// capacityHandler records the capacity signals published on
+// CAPACITY_SUBJECT. Only capacity failures are kept.
+func capacityHandler(m *nats.Msg) {
+	var s capacitySignal
+	if err := json.Unmarshal(m.Data, &s); err != nil || s.AvailabilityZone == "" {
+		return
+	}
+	if s.ErrorCode != "" && !capacityError(s.ErrorCode) {
+		return
+	}
+	if s.Timestamp.IsZero() {
+		s.Timestamp = time.Now()
+	}
+
+	capacity.record(s.AvailabilityZone, s.Timestamp)
+}
+
+// capacityError reports whether an AWS error code means a zone is out of
+// capacity, such as InsufficientInstanceCapacity
+func capacityError(code string) bool {
+	return strings.HasPrefix(code, "Insufficient")
+}
@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCapacitySignals(t *testing.T) {
+	Convey("Given a zone recently short of capacity", t, func() {
+		now := time.Now()
+		c := newCapacitySignals(30 * time.Minute)
+		c.record("eu-west-1b", now.Add(-10*time.Minute))
+		zones := []string{"eu-west-1a", "eu-west-1b", "eu-west-1c"}
+
+		Convey("When picking a zone", func() {
+			Convey("It should leave it out", func() {
+				So(c.unconstrained(zones, now), ShouldResemble, []string{"eu-west-1a", "eu-west-1c"})
+			})
+		})
+
+		Convey("When failing over", func() {
+			Convey("It should try it last", func() {
+				So(c.deprioritize(zones, now), ShouldResemble, []string{"eu-west-1a", "eu-west-1c", "eu-west-1b"})
+			})
+		})
+
+		Convey("When every zone is short of capacity", func() {
+			c.record("eu-west-1a", now)
+			c.record("eu-west-1c", now)
+
+			Convey("It should still pick among them", func() {
+				So(c.unconstrained(zones, now), ShouldResemble, zones)
+			})
+		})
+
+		Convey("When the signal is older than the window", func() {
+			Convey("It should be forgotten", func() {
+				So(c.constrained("eu-west-1b", now.Add(30*time.Minute)), ShouldBeFalse)
+				So(c.constrained("eu-west-1b", now), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given signals published by the instance connectors", t, func() {
+		saved := capacity
+		capacity = newCapacitySignals(time.Hour)
+		defer func() { capacity = saved }()
+
+		capacityHandler(&nats.Msg{Data: []byte(`{"availability_zone":"eu-west-1a","error_code":"InsufficientInstanceCapacity"}`)})
+		capacityHandler(&nats.Msg{Data: []byte(`{"availability_zone":"eu-west-1b","error_code":"InvalidParameterValue"}`)})
+		capacityHandler(&nats.Msg{Data: []byte(`{"availability_zone":"eu-west-1c"}`)})
+		capacityHandler(&nats.Msg{Data: []byte(`not json`)})
+
+		Convey("It should only record capacity failures", func() {
+			So(capacity.constrained("eu-west-1a", time.Now()), ShouldBeTrue)
+			So(capacity.constrained("eu-west-1b", time.Now()), ShouldBeFalse)
+			So(capacity.constrained("eu-west-1c", time.Now()), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,80 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// errorsComponent identifies the connector among the ernest AWS
+// connectors publishing on the central errors subject
+const errorsComponent = "network"
+
+// CentralError : failure published on ERRORS_SUBJECT, shared by every
+// ernest AWS connector so a single pipeline can alert on all of them
+type CentralError struct {
+	Component  string                 `json:"component"`
+	Connector  string                 `json:"connector"`
+	Version    string                 `json:"connector_version"`
+	Subject    string                 `json:"subject"`
+	UUID       string                 `json:"_uuid"`
+	BatchID    string                 `json:"_batch_id"`
+	Service    string                 `json:"service"`
+	Region     string                 `json:"datacenter_region"`
+	Error      string                 `json:"error"`
+	ErrorCode  string                 `json:"error_code,omitempty"`
+	ErrorField string                 `json:"error_field,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+	Event      map[string]interface{} `json:"event"`
+}
+
+// centralError returns the error response of the event as published on
+// the central errors subject, without credentials
+func centralError(subject string, data []byte, now time.Time) CentralError {
+	var failure struct {
+		Error      string `json:"error"`
+		ErrorCode  string `json:"error_code"`
+		ErrorField string `json:"error_field"`
+	}
+	json.Unmarshal(data, &failure)
+	r := parseRequest(data)
+
+	return CentralError{
+		Component:  errorsComponent,
+		Connector:  cfg.UserAgent,
+		Version:    version,
+		Subject:    subject,
+		UUID:       r.UUID,
+		BatchID:    r.BatchID,
+		Service:    r.Service,
+		Region:     r.DatacenterRegion,
+		Error:      failure.Error,
+		ErrorCode:  failure.ErrorCode,
+		ErrorField: failure.ErrorField,
+		Timestamp:  now,
+		Event:      sanitize(data),
+	}
+}
+
+// publishError publishes the error response of the event on
+// original_subject.error and on the central errors subject
+func publishError(subject string, data []byte) {
+	nc.Publish(subject+".error", data)
+	publishCentralError(subject, data)
+}
+
+func publishCentralError(subject string, data []byte) {
+	if cfg.ErrorsSubject == "" {
+		return
+	}
+
+	body, err := json.Marshal(centralError(subject, data, time.Now()))
+	if err != nil {
+		return
+	}
+
+	nc.Publish(cfg.ErrorsSubject, body)
+}
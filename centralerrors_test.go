@@ -0,0 +1,45 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCentralError(t *testing.T) {
+	Convey("Given an event that failed", t, func() {
+		body := []byte(`{"_uuid":"uuid","_batch_id":"batch","service":"svc","datacenter_region":"eu-west-1","datacenter_secret":"key","datacenter_token":"token","range":"10.1.0.0"}`)
+		data := errorResponse(body, newFieldError(errPayload, "range", "Network range is not valid"))
+		now := time.Now()
+
+		Convey("When publishing it on the central errors subject", func() {
+			e := centralError("network.create.aws", data, now)
+
+			Convey("It should identify the connector and the event", func() {
+				So(e.Component, ShouldEqual, errorsComponent)
+				So(e.Subject, ShouldEqual, "network.create.aws")
+				So(e.UUID, ShouldEqual, "uuid")
+				So(e.BatchID, ShouldEqual, "batch")
+				So(e.Service, ShouldEqual, "svc")
+				So(e.Region, ShouldEqual, "eu-west-1")
+				So(e.Timestamp, ShouldEqual, now)
+			})
+
+			Convey("It should classify the failure", func() {
+				So(e.Error, ShouldEqual, "Network range is not valid")
+				So(e.ErrorCode, ShouldEqual, errPayload)
+				So(e.ErrorField, ShouldEqual, "range")
+			})
+
+			Convey("It should leave the credentials out", func() {
+				So(e.Event, ShouldNotContainKey, "datacenter_secret")
+				So(e.Event, ShouldNotContainKey, "datacenter_token")
+			})
+		})
+	})
+}
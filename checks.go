@@ -0,0 +1,161 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// checkNetwork describes the network before it is mutated, refusing to
+// touch a network living in another VPC than the event claims or outside
+// of the environment scope. It reports whether the network is already
+// gone, which is only an error on update.
+func checkNetwork(client ec2API, subject string, r request) (bool, error) {
+	subnet, err := describeSubnet(client, r.NetworkAWSID)
+	if err != nil {
+		return false, err
+	}
+
+	if subnet == nil {
+		if verb(subject) == "update" {
+			return true, newError(errNotFound, "Network "+r.NetworkAWSID+" does not exist")
+		}
+		return true, nil
+	}
+
+	if vpc := aws.StringValue(subnet.VpcId); vpc != r.VPCID {
+		return false, newError(errMismatch, "Network "+r.NetworkAWSID+" belongs to "+vpc+", not to "+r.VPCID)
+	}
+
+	if err := checkScope(subnet, cfg.Scope); err != nil {
+		return false, err
+	}
+
+	if verb(subject) == "update" {
+		if changed := changedFields(diffNetwork(r, subnet), changeRecreate); len(changed) > 0 {
+			return false, newError(errRecreate, "Network "+r.NetworkAWSID+" must be recreated to change its "+strings.Join(changed, ", "))
+		}
+	}
+
+	return false, nil
+}
+
+// checkStaticCredentials refuses creates, updates and deletes naming a
+// role without static credentials. ernestaws, which makes their subnet
+// calls, only takes datacenter_secret and datacenter_token, so they would
+// otherwise fail late, after the connector's own calls.
+func checkStaticCredentials(subject string, r request) error {
+	if !mutating(subject) || r.DryRun || r.ProviderType == providerFake || r.RoleARN == "" {
+		return nil
+	}
+	if r.DatacenterAccessKey != "" && r.DatacenterAccessToken != "" {
+		return nil
+	}
+	return newFieldError(errCapability, "datacenter_secret", "Networks are "+verb(subject)+"d through ernestaws, which needs datacenter_secret and datacenter_token: datacenter_role_arn only covers the connector's own calls")
+}
+
+// checkVPCRange refuses to create a network outside of its VPC, which may
+// have been extended with secondary CIDR blocks
+func checkVPCRange(client ec2API, r request) error {
+	resp, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{
+		VpcIds: []*string{aws.String(r.VPCID)},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Vpcs) == 0 {
+		return newFieldError(errNotFound, "vpc_id", "VPC "+r.VPCID+" does not exist")
+	}
+
+	_, n, err := net.ParseCIDR(r.Subnet)
+	if err != nil {
+		// invalid ranges are refused by checkFields
+		return nil
+	}
+
+	if !withinAny(n, vpcCIDRs(resp.Vpcs[0])) {
+		return newFieldError(errRange, "range", "Network range "+r.Subnet+" is outside of the CIDR blocks of "+r.VPCID)
+	}
+
+	return nil
+}
+
+// checkFields refuses events whose range or availability zone AWS would
+// reject, naming the offending field rather than failing deep inside the
+// AWS call
+func checkFields(subject string, r request) error {
+	if r.Subnet != "" || verb(subject) == "create" {
+		ip, n, err := net.ParseCIDR(r.Subnet)
+		if err != nil || ip.To4() == nil {
+			return newFieldError(errPayload, "range", "Network range "+r.Subnet+" is not a valid IPv4 CIDR block")
+		}
+		if !ip.Equal(n.IP) {
+			return newFieldError(errPayload, "range", "Network range "+r.Subnet+" should start at "+n.String())
+		}
+	}
+
+	if r.AvailabilityZone != "" && !strings.HasPrefix(r.AvailabilityZone, r.DatacenterRegion) {
+		return newFieldError(errPayload, "availability_zone", "Availability zone "+r.AvailabilityZone+" is not in "+r.DatacenterRegion)
+	}
+
+	if err := validWaitFor(r); err != nil {
+		return err
+	}
+
+	return validReplicas(r)
+}
+
+// checkZoneExists refuses to create a network in an availability zone its
+// region doesn't have, or that isn't available
+func checkZoneExists(client ec2API, r request) error {
+	if r.AvailabilityZone == "" {
+		return nil
+	}
+
+	resp, err := client.DescribeAvailabilityZones(&ec2.DescribeAvailabilityZonesInput{})
+	if err != nil {
+		return err
+	}
+
+	for _, z := range resp.AvailabilityZones {
+		if aws.StringValue(z.ZoneName) != r.AvailabilityZone {
+			continue
+		}
+		if state := aws.StringValue(z.State); state != "available" {
+			return newFieldError(errPayload, "availability_zone", "Availability zone "+r.AvailabilityZone+" is "+state)
+		}
+		return nil
+	}
+
+	return newFieldError(errPayload, "availability_zone", "Availability zone "+r.AvailabilityZone+" does not exist in "+r.DatacenterRegion)
+}
+
+// vpcCIDRs returns every IPv4 CIDR block associated to the VPC
+func vpcCIDRs(vpc *ec2.Vpc) []*net.IPNet {
+	var blocks []string
+	for _, a := range vpc.CidrBlockAssociationSet {
+		if a.CidrBlockState == nil || aws.StringValue(a.CidrBlockState.State) == "associated" {
+			blocks = append(blocks, aws.StringValue(a.CidrBlock))
+		}
+	}
+
+	if len(vpc.CidrBlockAssociationSet) == 0 {
+		blocks = append(blocks, aws.StringValue(vpc.CidrBlock))
+	}
+
+	var cidrs []*net.IPNet
+	for _, b := range blocks {
+		if _, n, err := net.ParseCIDR(b); err == nil {
+			cidrs = append(cidrs, n)
+		}
+	}
+
+	return cidrs
+}
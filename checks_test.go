@@ -0,0 +1,260 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func vpcBlock(cidr, state string) *ec2.VpcCidrBlockAssociation {
+	return &ec2.VpcCidrBlockAssociation{
+		CidrBlock:      aws.String(cidr),
+		CidrBlockState: &ec2.VpcCidrBlockState{State: aws.String(state)},
+	}
+}
+
+func TestVPCCIDRs(t *testing.T) {
+	Convey("Given a VPC extended with secondary CIDR blocks", t, func() {
+		vpc := &ec2.Vpc{
+			CidrBlock: aws.String("10.0.0.0/16"),
+			CidrBlockAssociationSet: []*ec2.VpcCidrBlockAssociation{
+				vpcBlock("10.0.0.0/16", "associated"),
+				vpcBlock("100.64.0.0/16", "associated"),
+				vpcBlock("172.16.0.0/16", "disassociated"),
+			},
+		}
+		cidrs := vpcCIDRs(vpc)
+
+		Convey("It should accept ranges in any associated block", func() {
+			_, primary, _ := net.ParseCIDR("10.0.1.0/24")
+			_, secondary, _ := net.ParseCIDR("100.64.1.0/24")
+			So(withinAny(primary, cidrs), ShouldBeTrue)
+			So(withinAny(secondary, cidrs), ShouldBeTrue)
+		})
+
+		Convey("It should refuse ranges in disassociated blocks", func() {
+			_, n, _ := net.ParseCIDR("172.16.1.0/24")
+			So(withinAny(n, cidrs), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a VPC without CIDR block associations", t, func() {
+		vpc := &ec2.Vpc{CidrBlock: aws.String("10.0.0.0/16")}
+
+		Convey("It should use its primary block", func() {
+			So(len(vpcCIDRs(vpc)), ShouldEqual, 1)
+			So(vpcCIDRs(vpc)[0].String(), ShouldEqual, "10.0.0.0/16")
+		})
+	})
+}
+
+func TestCheckNetworkWithClient(t *testing.T) {
+	Convey("Given an account holding one network", t, func() {
+		client := &mockEC2{subnets: []*ec2.Subnet{
+			{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000"), CidrBlock: aws.String("10.0.0.0/24")},
+		}}
+
+		Convey("When deleting it from its VPC", func() {
+			gone, err := checkNetwork(client, "network.delete.aws", request{NetworkAWSID: "subnet-00000000", VPCID: "vpc-0000000"})
+
+			Convey("It should let the delete through", func() {
+				So(err, ShouldBeNil)
+				So(gone, ShouldBeFalse)
+			})
+		})
+
+		Convey("When deleting a network that is already gone", func() {
+			gone, err := checkNetwork(client, "network.delete.aws", request{NetworkAWSID: "subnet-11111111", VPCID: "vpc-0000000"})
+
+			Convey("It should report it gone without error", func() {
+				So(err, ShouldBeNil)
+				So(gone, ShouldBeTrue)
+			})
+		})
+
+		Convey("When deleting it from another VPC", func() {
+			_, err := checkNetwork(client, "network.delete.aws", request{NetworkAWSID: "subnet-00000000", VPCID: "vpc-1111111"})
+
+			Convey("It should refuse to", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errMismatch)
+			})
+		})
+
+		Convey("When AWS fails to describe the network it deletes", func() {
+			gone, err := checkNetwork(throttledEC2{client}, "network.delete.aws", request{NetworkAWSID: "subnet-00000000", VPCID: "vpc-0000000"})
+
+			Convey("It should fail without reporting it gone", func() {
+				So(err, ShouldNotBeNil)
+				So(gone, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+// throttledEC2 fails every subnet description
+type throttledEC2 struct {
+	*mockEC2
+}
+
+func (m throttledEC2) DescribeSubnets(in *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	return nil, awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil)
+}
+
+func TestCheckUpdate(t *testing.T) {
+	Convey("Given an account holding one network", t, func() {
+		client := &mockEC2{subnets: []*ec2.Subnet{
+			{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000"), CidrBlock: aws.String("10.0.0.0/24")},
+		}}
+
+		Convey("When updating it in its VPC", func() {
+			gone, err := checkNetwork(client, "network.update.aws", request{NetworkAWSID: "subnet-00000000", VPCID: "vpc-0000000", Subnet: "10.0.0.0/24"})
+
+			Convey("It should let the update through", func() {
+				So(err, ShouldBeNil)
+				So(gone, ShouldBeFalse)
+				So(client.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When updating a copy of it from another VPC", func() {
+			_, err := checkNetwork(client, "network.update.aws", request{NetworkAWSID: "subnet-00000000", VPCID: "vpc-1111111", Subnet: "10.0.0.0/24"})
+
+			Convey("It should refuse to", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errMismatch)
+				So(client.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When updating a network that no longer exists", func() {
+			gone, err := checkNetwork(client, "network.update.aws", request{NetworkAWSID: "subnet-11111111", VPCID: "vpc-0000000", Subnet: "10.0.0.0/24"})
+
+			Convey("It should report it not found", func() {
+				So(gone, ShouldBeTrue)
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errNotFound)
+				So(client.calls, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestCheckFields(t *testing.T) {
+	Convey("Given a network created in eu-west-1", t, func() {
+		r := request{DatacenterRegion: "eu-west-1", Subnet: "10.0.0.0/24", AvailabilityZone: "eu-west-1a"}
+
+		Convey("When its fields are valid", func() {
+			Convey("It should accept them", func() {
+				So(checkFields("network.create.aws", r), ShouldBeNil)
+			})
+		})
+
+		Convey("When its range has an invalid prefix length", func() {
+			r.Subnet = "10.0.0.0/33"
+
+			Convey("It should name the range field", func() {
+				err := checkFields("network.create.aws", r)
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).field, ShouldEqual, "range")
+			})
+		})
+
+		Convey("When its range doesn't start at a network address", func() {
+			r.Subnet = "10.0.0.10/24"
+
+			Convey("It should name the range field", func() {
+				err := checkFields("network.create.aws", r)
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).field, ShouldEqual, "range")
+			})
+		})
+
+		Convey("When its availability zone belongs to another region", func() {
+			r.AvailabilityZone = "us-east-1a"
+
+			Convey("It should name the availability zone field", func() {
+				err := checkFields("network.create.aws", r)
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).field, ShouldEqual, "availability_zone")
+			})
+		})
+
+		Convey("When an update doesn't carry a range", func() {
+			r.Subnet = ""
+
+			Convey("It should accept it", func() {
+				So(checkFields("network.update.aws", r), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestCheckZoneExists(t *testing.T) {
+	Convey("Given a region with an impaired availability zone", t, func() {
+		client := &mockEC2{zones: []*ec2.AvailabilityZone{
+			{ZoneName: aws.String("eu-west-1a"), State: aws.String("available")},
+			{ZoneName: aws.String("eu-west-1b"), State: aws.String("impaired")},
+		}}
+
+		Convey("It should accept available zones", func() {
+			So(checkZoneExists(client, request{AvailabilityZone: "eu-west-1a"}), ShouldBeNil)
+		})
+
+		Convey("It should refuse impaired zones", func() {
+			So(checkZoneExists(client, request{AvailabilityZone: "eu-west-1b"}), ShouldNotBeNil)
+		})
+
+		Convey("It should refuse zones the region doesn't have", func() {
+			So(checkZoneExists(client, request{AvailabilityZone: "eu-west-1z"}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestStaticCredentials(t *testing.T) {
+	Convey("Given an event naming a role", t, func() {
+		r := request{RoleARN: "arn:aws:iam::123456789012:role/ernest"}
+
+		Convey("When it creates, updates or deletes with the role only", func() {
+			Convey("It should refuse them upfront", func() {
+				for _, subject := range []string{"network.create.aws", "network.update.aws", "network.delete.aws"} {
+					err := checkStaticCredentials(subject, r)
+
+					So(err, ShouldNotBeNil)
+					So(err.(*connectorError).code, ShouldEqual, errCapability)
+					So(err.(*connectorError).field, ShouldEqual, "datacenter_secret")
+				}
+			})
+		})
+
+		Convey("When it carries static credentials too", func() {
+			r.DatacenterAccessKey, r.DatacenterAccessToken = "key", "secret"
+
+			Convey("It should let a create through", func() {
+				So(checkStaticCredentials("network.create.aws", r), ShouldBeNil)
+			})
+		})
+
+		Convey("When it is a dry run", func() {
+			r.DryRun = true
+
+			Convey("It should let a delete through", func() {
+				So(checkStaticCredentials("network.delete.aws", r), ShouldBeNil)
+			})
+		})
+
+		Convey("When it only reads", func() {
+			Convey("It should let a get through", func() {
+				So(checkStaticCredentials("network.get.aws", r), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,114 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/nats-io/nats"
+)
+
+// terraformAttributes maps the aws_subnet attributes the connector knows
+// about to the fields of its own view of the network
+var terraformAttributes = map[string]string{
+	"vpc_id":                  "vpc_id",
+	"cidr_block":              "range",
+	"availability_zone":       "availability_zone",
+	"availability_zone_id":    "availability_zone_id",
+	"map_public_ip_on_launch": "map_public_ip_on_launch",
+	"tags":                    "tags",
+}
+
+// Difference : an attribute on which terraform and the connector disagree
+type Difference struct {
+	Attribute string      `json:"attribute"`
+	Terraform interface{} `json:"terraform"`
+	Connector interface{} `json:"connector"`
+}
+
+// compareHandler checks a terraform managed subnet, given as its id and
+// state attributes, against the connector's view of it, for teams running
+// ernest and terraform side by side
+func compareHandler(m *nats.Msg) {
+	req, data, err := decodeStandalone(m)
+	if err != nil {
+		publishError(m.Subject, errorResponse(nil, err))
+		return
+	}
+
+	var event struct {
+		Terraform struct {
+			ID         string                 `json:"id"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"terraform"`
+	}
+	json.Unmarshal(data, &event)
+
+	if event.Terraform.ID == "" {
+		err := newFieldError(errPayload, "terraform", "Network compare needs the terraform id of the subnet")
+		publishError(m.Subject, errorResponse(m.Data, err))
+		return
+	}
+
+	req.NetworkAWSID = event.Terraform.ID
+	networks, err := lookupNetworks(readClient(req), req)
+	if err == nil && len(networks) == 0 {
+		err = newError(errNotFound, "Network "+event.Terraform.ID+" not found")
+	}
+	if err != nil {
+		publishError(m.Subject, errorResponse(m.Data, err))
+		return
+	}
+
+	differences, unchecked := compareAttributes(event.Terraform.Attributes, networks[0])
+
+	nc.Publish(m.Subject+".done", setFields(m.Data, map[string]interface{}{
+		"matches":     len(differences) == 0,
+		"differences": differences,
+		"unchecked":   unchecked,
+	}))
+}
+
+// compareAttributes returns the terraform attributes differing from the
+// state of the network, and those the connector has no view of
+func compareAttributes(attributes map[string]interface{}, state map[string]interface{}) ([]Difference, []string) {
+	differences := []Difference{}
+	unchecked := []string{}
+
+	var names []string
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field, ok := terraformAttributes[name]
+		if !ok {
+			unchecked = append(unchecked, name)
+			continue
+		}
+
+		if !sameValue(attributes[name], state[field]) {
+			differences = append(differences, Difference{Attribute: name, Terraform: attributes[name], Connector: state[field]})
+		}
+	}
+
+	return differences, unchecked
+}
+
+// sameValue compares values by their JSON encoding, which sorts map keys
+// and ignores how numbers and maps are typed
+func sameValue(a, b interface{}) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(x) == string(y)
+}
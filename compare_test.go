@@ -0,0 +1,51 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompareAttributes(t *testing.T) {
+	Convey("Given the connector's view of a network", t, func() {
+		state := map[string]interface{}{
+			"vpc_id":                  "vpc-0000000",
+			"range":                   "10.0.1.0/24",
+			"map_public_ip_on_launch": false,
+			"tags":                    map[string]string{"Name": "web", "ernest.service": "shop"},
+		}
+
+		Convey("When terraform holds the same attributes", func() {
+			var attributes map[string]interface{}
+			json.Unmarshal([]byte(`{"cidr_block":"10.0.1.0/24","map_public_ip_on_launch":false,"tags":{"ernest.service":"shop","Name":"web"}}`), &attributes)
+			differences, unchecked := compareAttributes(attributes, state)
+
+			Convey("It should find no differences", func() {
+				So(len(differences), ShouldEqual, 0)
+				So(len(unchecked), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When terraform disagrees on some attributes", func() {
+			var attributes map[string]interface{}
+			json.Unmarshal([]byte(`{"cidr_block":"10.0.2.0/24","map_public_ip_on_launch":false,"arn":"arn:aws:ec2:eu-west-1:123456789012:subnet/subnet-00000000"}`), &attributes)
+			differences, unchecked := compareAttributes(attributes, state)
+
+			Convey("It should report them", func() {
+				So(len(differences), ShouldEqual, 1)
+				So(differences[0].Attribute, ShouldEqual, "cidr_block")
+				So(differences[0].Terraform, ShouldEqual, "10.0.2.0/24")
+				So(differences[0].Connector, ShouldEqual, "10.0.1.0/24")
+			})
+
+			Convey("It should list the attributes it can't check", func() {
+				So(unchecked, ShouldResemble, []string{"arn"})
+			})
+		})
+	})
+}
@@ -0,0 +1,119 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// updateGolden rewrites the golden responses of the compatibility suite,
+// go test -run TestCompatibility -args -update
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the compatibility suite")
+
+// compatCase is an event recorded from ernest-core, stored under the
+// schema version it was published with
+type compatCase struct {
+	Subject string          `json:"subject"`
+	Event   json.RawMessage `json:"event"`
+}
+
+// compatGolden is how the connector reads and answers a recorded event
+type compatGolden struct {
+	Version  string                 `json:"version"`
+	Request  map[string]interface{} `json:"request"`
+	Done     json.RawMessage        `json:"done"`
+	Errored  json.RawMessage        `json:"errored"`
+	Problems []string               `json:"schema_problems"`
+}
+
+// compatRequest returns the request fields the connector read from the
+// event, leaving out the empty ones so adding fields doesn't break the
+// golden files
+func compatRequest(data []byte) map[string]interface{} {
+	raw, _ := json.Marshal(parseRequest(data))
+	fields := make(map[string]interface{})
+	json.Unmarshal(raw, &fields)
+
+	for f, v := range fields {
+		switch v {
+		case nil, "", false, float64(0):
+			delete(fields, f)
+		}
+	}
+	return fields
+}
+
+// compatResponses returns the done and error responses the connector would
+// publish for the event, in the field names of its schema version
+func compatResponses(subject string, legacy []byte, version string) ([]byte, []byte) {
+	done := legacy
+	if verb(subject) == "create" {
+		done = setField(done, "network_aws_id", "subnet-00000000")
+	}
+	errored := errorResponse(legacy, newFieldError(errPayload, "range", "Network range is not valid"))
+
+	if version == schemaGeneric {
+		return toGenericFields(done), toGenericFields(errored)
+	}
+	return done, errored
+}
+
+func TestCompatibility(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "compat", "*", "*.json"))
+
+	Convey("Given events recorded from every schema version", t, func() {
+		So(files, ShouldNotBeEmpty)
+
+		for _, file := range files {
+			raw, err := ioutil.ReadFile(file)
+			So(err, ShouldBeNil)
+
+			var c compatCase
+			So(json.Unmarshal(raw, &c), ShouldBeNil)
+
+			Convey("When handling "+file, func() {
+				legacy, version := fromGenericFields(c.Event)
+				fields := make(map[string]interface{})
+				json.Unmarshal(legacy, &fields)
+
+				golden := compatGolden{
+					Version:  version,
+					Request:  compatRequest(legacy),
+					Problems: schemaProblems(eventSchema(), fields),
+				}
+				golden.Done, golden.Errored = compatResponses(c.Subject, legacy, version)
+
+				Convey("It should be read with the schema version it was recorded with", func() {
+					So("schema-"+version, ShouldEqual, filepath.Base(filepath.Dir(file)))
+				})
+
+				Convey("It should pass the payload checks, the schema and ernestaws validation", func() {
+					So(checkPayload(c.Event, cfg.MaxMessageSize, cfg.MaxJSONDepth), ShouldBeNil)
+					So(golden.Problems, ShouldBeEmpty)
+					So(validate(c.Subject, legacy), ShouldBeNil)
+				})
+
+				Convey("It should be read and answered as recorded", func() {
+					actual, _ := json.MarshalIndent(golden, "", "  ")
+					path := strings.TrimSuffix(file, ".json") + ".golden"
+					if *updateGolden {
+						ioutil.WriteFile(path, append(actual, '\n'), 0644)
+					}
+
+					expected, err := ioutil.ReadFile(path)
+					So(err, ShouldBeNil)
+					So(string(actual)+"\n", ShouldEqual, string(expected))
+				})
+			})
+		}
+	})
+}
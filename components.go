@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// component is a resource making up a network, as reported in done
+// responses
+type component struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	State string `json:"state,omitempty"`
+}
+
+// gatewayTypes names the route targets reported as components, by id
+// prefix
+var gatewayTypes = map[string]string{
+	"igw-": "internet_gateway",
+	"nat-": "nat_gateway",
+	"pcx-": "peering_connection",
+}
+
+// networkComponents describes the subnet, the route table it uses and the
+// gateways that route table sends traffic to
+func networkComponents(client ec2API, id string) ([]component, error) {
+	subnet, err := describeSubnet(client, id)
+	if err != nil || subnet == nil {
+		return nil, err
+	}
+
+	tables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{subnet.VpcId}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return subnetComponents(subnet, subnetRouteTable(subnet, tables.RouteTables)), nil
+}
+
+func subnetComponents(subnet *ec2.Subnet, table *ec2.RouteTable) []component {
+	components := []component{{Type: "subnet", ID: aws.StringValue(subnet.SubnetId), State: aws.StringValue(subnet.State)}}
+	if table == nil {
+		return components
+	}
+
+	components = append(components, component{Type: "route_table", ID: aws.StringValue(table.RouteTableId)})
+
+	seen := make(map[string]bool)
+	for _, route := range table.Routes {
+		target := routeTarget(route)
+		for prefix, kind := range gatewayTypes {
+			if strings.HasPrefix(target, prefix) && !seen[target] {
+				seen[target] = true
+				components = append(components, component{Type: kind, ID: target})
+			}
+		}
+	}
+
+	return components
+}
+
+// deletedComponents lists the resources a delete removed, as planned
+func deletedComponents(plan []plannedResource) []component {
+	var components []component
+	for _, p := range plan {
+		if p.Action == actionDelete && p.Type != "route" {
+			components = append(components, component{Type: p.Type, ID: p.ID, State: "deleted"})
+		}
+	}
+	return components
+}
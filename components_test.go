@@ -0,0 +1,55 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubnetComponents(t *testing.T) {
+	Convey("Given a public network peered with another VPC", t, func() {
+		subnet := &ec2.Subnet{SubnetId: aws.String("subnet-00000000"), State: aws.String("available")}
+		table := routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")
+		table.Routes = append(table.Routes,
+			&ec2.Route{DestinationCidrBlock: aws.String("10.20.0.0/16"), VpcPeeringConnectionId: aws.String("pcx-00000000")},
+			&ec2.Route{DestinationIpv6CidrBlock: aws.String("::/0"), GatewayId: aws.String("igw-00000000")},
+		)
+
+		Convey("When listing its components", func() {
+			components := subnetComponents(subnet, table)
+
+			Convey("It should report the subnet state, route table and each gateway once", func() {
+				So(components, ShouldResemble, []component{
+					{Type: "subnet", ID: "subnet-00000000", State: "available"},
+					{Type: "route_table", ID: "rtb-00000000"},
+					{Type: "internet_gateway", ID: "igw-00000000"},
+					{Type: "peering_connection", ID: "pcx-00000000"},
+				})
+			})
+		})
+	})
+}
+
+func TestDeletedComponents(t *testing.T) {
+	Convey("Given the plan of a delete", t, func() {
+		plan := []plannedResource{
+			{Type: "subnet", ID: "subnet-00000000", Action: actionDelete},
+			{Type: "route_table", ID: "rtb-00000000", Action: actionDelete},
+			{Type: "route", ID: "rtb-00000000:0.0.0.0/0", Action: actionDelete},
+			{Type: "internet_gateway", ID: "igw-00000000", Action: actionKeep},
+		}
+
+		Convey("It should report the resources removed", func() {
+			So(deletedComponents(plan), ShouldResemble, []component{
+				{Type: "subnet", ID: "subnet-00000000", State: "deleted"},
+				{Type: "route_table", ID: "rtb-00000000", State: "deleted"},
+			})
+		})
+	})
+}
@@ -0,0 +1,372 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config holds the connector settings read from the environment
+type config struct {
+	UserAgent       string
+	LogLevel        string
+	MonitorSubject  string
+	MonitorInterval time.Duration
+	ShutdownSubject string
+	DrainTimeout    time.Duration
+	MetricsAddr     string
+	ReadOnly        bool
+	AllowedRegions  []string
+	AllowedRoles    []string
+	AllowedAccounts []string
+	AllowedCIDRs    []*net.IPNet
+	ReservedCIDRs   []*net.IPNet
+	AllowedAZs      []string
+	ExcludedAZs     []string
+	DefaultAZs      []string
+	ResponseProfile string
+	MaxEventAge     time.Duration
+	MinPrefixLength int
+	MaxPrefixLength int
+	MaxMessageSize  int
+	MaxJSONDepth    int
+	MaxResponseSize int
+	CorrelationTags bool
+	LastOpTags      bool
+	AccountCheck    bool
+	NamePattern     string
+
+	DescribeCacheTTL time.Duration
+	RoutingCacheTTL  time.Duration
+	InterfaceTimeout time.Duration
+	NATWaitTimeout   time.Duration
+	CallTimeout      time.Duration
+	APITimeouts      map[string]time.Duration
+	WaitForTimeout   time.Duration
+	StabilizeDelay   time.Duration
+	StabilizeChecks  int
+	IPAlarmThreshold int
+	RetryAttempts    int
+	RegionLimits     map[string]int
+	RetryBackoff     time.Duration
+	SDKRetries       int
+	IPAlarmActions   []string
+	DescribeInterval time.Duration
+	QueueGroup       string
+	Workers          int
+	WorkerQueue      int
+	MaxWaits         int
+	InventoryPage    int
+	FindPage         int
+	FindConcurrency  int
+	AZFailover       bool
+	ZoneErrors       string
+	CapacityWindow   time.Duration
+	SyncTimeout      time.Duration
+
+	DiagnosticsSubject string
+	DiagnosticsDir     string
+	EventStoreDir      string
+	JournalDir         string
+	ConfigSubject      string
+	CapacitySubject    string
+	EventsSubject      string
+	MessagesSubject    string
+	ErrorsSubject      string
+	OutboxDir          string
+	CryptoKey          string
+	AWSEndpoint        string
+	ImportFormat       string
+	VCRMode            string
+	VCRDir             string
+
+	Standalone         bool
+	NATSURL            string
+	DefaultRegion      string
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+
+	FreezeWindows []freezeWindow
+	FreezeMode    string
+
+	Scope     environmentScope
+	Templates map[string]map[string]interface{}
+}
+
+func loadConfig() config {
+	return config{
+		UserAgent:       envString("USER_AGENT", "network-all-aws-connector"),
+		LogLevel:        envString("LOG_LEVEL", levelInfo),
+		MonitorSubject:  envString("MONITOR_SUBJECT", "network.monitor.aws"),
+		MonitorInterval: envDuration("MONITOR_INTERVAL", 30*time.Second),
+		ShutdownSubject: envString("SHUTDOWN_SUBJECT", "network.monitor.aws.shutdown"),
+		DrainTimeout:    envDuration("DRAIN_TIMEOUT", 10*time.Minute),
+		MetricsAddr:     os.Getenv("METRICS_ADDR"),
+		ReadOnly:        envBool("READ_ONLY"),
+		AllowedRegions:  envList("ALLOWED_REGIONS"),
+		AllowedRoles:    envList("ALLOWED_ROLE_ARNS"),
+		AllowedAccounts: envList("ALLOWED_ROLE_ACCOUNTS"),
+		AllowedCIDRs:    envCIDRs("ALLOWED_CIDRS"),
+		ReservedCIDRs:   envCIDRs("RESERVED_CIDRS"),
+		AllowedAZs:      envList("ALLOWED_AZS"),
+		ExcludedAZs:     envList("EXCLUDED_AZS"),
+		DefaultAZs:      envList("DEFAULT_AZS"),
+		ResponseProfile: envString("RESPONSE_PROFILE", profileLegacy),
+		MaxEventAge:     envDuration("MAX_EVENT_AGE", 0),
+		MinPrefixLength: envInt("MIN_PREFIX_LENGTH", 0),
+		MaxPrefixLength: envInt("MAX_PREFIX_LENGTH", 0),
+		MaxMessageSize:  envInt("MAX_MESSAGE_SIZE", 256*1024),
+		MaxJSONDepth:    envInt("MAX_JSON_DEPTH", 16),
+		MaxResponseSize: envInt("MAX_RESPONSE_SIZE", 1024*1024),
+		CorrelationTags: envBool("CORRELATION_TAGS"),
+		LastOpTags:      envBool("LAST_OP_TAGS"),
+		AccountCheck:    envBool("ACCOUNT_CHECK"),
+		NamePattern:     os.Getenv("NAME_PATTERN"),
+
+		DescribeCacheTTL: envDuration("DESCRIBE_CACHE_TTL", 30*time.Second),
+		RoutingCacheTTL:  envDuration("ROUTING_CACHE_TTL", 5*time.Second),
+		InterfaceTimeout: envDuration("INTERFACE_WAIT_TIMEOUT", 10*time.Minute),
+		NATWaitTimeout:   envDuration("NAT_GATEWAY_WAIT_TIMEOUT", 15*time.Minute),
+		CallTimeout:      envDuration("CALL_TIMEOUT", 0),
+		APITimeouts:      envTimeouts("OPERATION_TIMEOUTS"),
+		WaitForTimeout:   envDuration("WAIT_FOR_TIMEOUT", 15*time.Minute),
+		StabilizeDelay:   envDuration("STABILIZATION_DELAY", 0),
+		StabilizeChecks:  envInt("STABILIZATION_CHECKS", 0),
+		IPAlarmThreshold: envInt("IP_ALARM_THRESHOLD", 0),
+		RetryAttempts:    envInt("RETRY_ATTEMPTS", 3),
+		RegionLimits:     envLimits("MAX_REGION_OPERATIONS"),
+		RetryBackoff:     envDuration("RETRY_BACKOFF", 2*time.Second),
+		SDKRetries:       envInt("SDK_MAX_RETRIES", 1),
+		IPAlarmActions:   envList("IP_ALARM_ACTIONS"),
+		DescribeInterval: envDuration("DESCRIBE_INTERVAL", 200*time.Millisecond),
+		QueueGroup:       envString("QUEUE_GROUP", "network-all-aws-connector"),
+		Workers:          envInt("WORKERS", 10),
+		WorkerQueue:      envInt("WORKER_QUEUE", 100),
+		MaxWaits:         envInt("MAX_WAITS", 0),
+		InventoryPage:    envInt("INVENTORY_PAGE_SIZE", 100),
+		FindPage:         envInt("FIND_PAGE_SIZE", 100),
+		FindConcurrency:  envInt("FIND_CONCURRENCY", 4),
+		AZFailover:       envBool("AZ_FAILOVER"),
+		ZoneErrors:       envString("AZ_CONSTRAINT_ERRORS", zoneErrorsStructured),
+		CapacityWindow:   envDuration("CAPACITY_SIGNAL_WINDOW", 30*time.Minute),
+		SyncTimeout:      envDuration("SYNC_TIMEOUT", 30*time.Minute),
+
+		DiagnosticsSubject: os.Getenv("DIAGNOSTICS_SUBJECT"),
+		DiagnosticsDir:     os.Getenv("DIAGNOSTICS_DIR"),
+		EventStoreDir:      os.Getenv("EVENT_STORE_DIR"),
+		JournalDir:         os.Getenv("JOURNAL_DIR"),
+		ConfigSubject:      os.Getenv("CONFIG_SUBJECT"),
+		CapacitySubject:    os.Getenv("CAPACITY_SUBJECT"),
+		EventsSubject:      os.Getenv("EVENTS_SUBJECT"),
+		MessagesSubject:    os.Getenv("USER_MESSAGES_SUBJECT"),
+		ErrorsSubject:      os.Getenv("ERRORS_SUBJECT"),
+		OutboxDir:          os.Getenv("OUTBOX_DIR"),
+		CryptoKey:          os.Getenv("ERNEST_CRYPTO_KEY"),
+		AWSEndpoint:        os.Getenv("AWS_ENDPOINT"),
+		ImportFormat:       os.Getenv("IMPORT_FORMAT"),
+		VCRMode:            os.Getenv("VCR_MODE"),
+		VCRDir:             os.Getenv("VCR_DIR"),
+
+		Standalone:         envBool("STANDALONE"),
+		NATSURL:            envString("NATS_URL", envString("NATS_URI", "nats://127.0.0.1:4222")),
+		DefaultRegion:      envString("AWS_REGION", os.Getenv("AWS_DEFAULT_REGION")),
+		AWSAccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		AWSSecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+
+		FreezeWindows: envFreezeWindows("FREEZE_WINDOWS"),
+		FreezeMode:    envString("FREEZE_MODE", freezeReject),
+
+		Scope:     envScope("ENVIRONMENT_TAG"),
+		Templates: envTemplates("NETWORK_TEMPLATES"),
+	}
+}
+
+// features reports which optional subsystems are enabled, so ernest can
+// adapt to the capabilities of the connector
+func (c config) features() map[string]bool {
+	return map[string]bool{
+		"read_only":             c.ReadOnly,
+		"standalone":            c.Standalone,
+		"policies":              len(c.AllowedRegions) > 0 || len(c.AllowedRoles) > 0 || len(c.AllowedAccounts) > 0 || len(c.AllowedAZs) > 0 || len(c.ExcludedAZs) > 0 || c.rangeRules() || c.NamePattern != "",
+		"correlation_tags":      c.CorrelationTags,
+		"last_op_tags":          c.LastOpTags,
+		"account_check":         c.AccountCheck,
+		"openmetrics":           c.MetricsAddr != "",
+		"aws_config":            c.ConfigSubject != "",
+		"analytics_events":      c.EventsSubject != "",
+		"user_messages":         c.MessagesSubject != "",
+		"central_errors":        c.ErrorsSubject != "",
+		"diagnostics":           c.diagnostics(),
+		"replay":                c.EventStoreDir != "",
+		"history":               c.JournalDir != "",
+		"durable_outbox":        c.OutboxDir != "",
+		"encrypted_credentials": c.CryptoKey != "",
+		"ip_alarms":             c.IPAlarmThreshold > 0,
+		"freeze_windows":        len(c.FreezeWindows) > 0,
+		"az_failover":           c.AZFailover,
+		"capacity_signals":      c.CapacitySubject != "",
+		"environment_scope":     c.Scope.enabled(),
+		"templates":             len(c.Templates) > 0,
+		"subnet_purposes":       true,
+		"delete_dry_run":        true,
+		"import":                true,
+		"prefix_lists":          true,
+		"ipv6":                  true,
+		"nat_gateways":          true,
+		"wait_for":              true,
+		"aws_error_stats":       true,
+		"wait_guard":            c.MaxWaits > 0,
+		"stabilization":         c.StabilizeDelay > 0 || c.StabilizeChecks > 0,
+		"call_timeouts":         c.CallTimeout > 0 || len(c.APITimeouts) > 0,
+		"drift":                 false,
+	}
+}
+
+// regionLimit returns how many mutating operations may run at once in a
+// region, 0 means no limit. The * entry applies to unlisted regions.
+func (c config) regionLimit(region string) int {
+	if limit, ok := c.RegionLimits[region]; ok {
+		return limit
+	}
+	return c.RegionLimits["*"]
+}
+
+// diagnostics reports whether diagnostic bundles should be gathered
+func (c config) diagnostics() bool {
+	return c.DiagnosticsSubject != "" || c.DiagnosticsDir != ""
+}
+
+// rangeRules reports whether any policy applies to network ranges
+func (c config) rangeRules() bool {
+	return len(c.AllowedCIDRs) > 0 || len(c.ReservedCIDRs) > 0 ||
+		c.MinPrefixLength > 0 || c.MaxPrefixLength > 0
+}
+
+// allowedZones returns the allowed availability zones for a region, an
+// empty list means any zone not excluded can be used
+func (c config) allowedZones(region string) []string {
+	var zones []string
+	for _, az := range c.AllowedAZs {
+		if strings.HasPrefix(az, region) && !contains(c.ExcludedAZs, az) {
+			zones = append(zones, az)
+		}
+	}
+	return zones
+}
+
+// defaultZones returns the availability zones networks of a region are
+// spread across when events don't set one: its default zones still
+// allowed, or else its allowed zones
+func (c config) defaultZones(region string) []string {
+	allowed := c.allowedZones(region)
+
+	var zones []string
+	for _, az := range c.DefaultAZs {
+		if !strings.HasPrefix(az, region) || contains(c.ExcludedAZs, az) {
+			continue
+		}
+		if len(allowed) > 0 && !contains(allowed, az) {
+			continue
+		}
+		zones = append(zones, az)
+	}
+
+	if len(zones) == 0 {
+		return allowed
+	}
+	return zones
+}
+
+func envString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// envList reads a comma separated list
+func envList(name string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// envCIDRs reads a comma separated list of CIDR blocks
+func envCIDRs(name string) []*net.IPNet {
+	var cidrs []*net.IPNet
+	for _, v := range envList(name) {
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			fmt.Println("invalid " + name + " entry " + v + ", ignoring it")
+			continue
+		}
+		cidrs = append(cidrs, n)
+	}
+	return cidrs
+}
+
+// envLimits reads a comma separated list of key=limit pairs
+func envLimits(name string) map[string]int {
+	limits := make(map[string]int)
+	for _, v := range envList(name) {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			fmt.Println("invalid " + name + " entry " + v + ", ignoring it")
+			continue
+		}
+
+		limit, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			fmt.Println("invalid " + name + " entry " + v + ", ignoring it")
+			continue
+		}
+		limits[strings.TrimSpace(parts[0])] = limit
+	}
+	return limits
+}
+
+func envBool(name string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(name))
+	return v
+}
+
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		fmt.Println("invalid " + name + " value, using default")
+		return def
+	}
+
+	return i
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		fmt.Println("invalid " + name + " value, using default")
+		return def
+	}
+
+	return d
+}
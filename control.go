@@ -0,0 +1,157 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// controller parks incoming events while the connector is paused and
+// replays them, in order, once it is resumed. Events already being
+// processed are not affected by a pause. It keeps track of when the
+// events not yet picked up by a worker arrived.
+type controller struct {
+	mu      sync.Mutex
+	handler nats.MsgHandler
+	paused  bool
+	parked  []*nats.Msg
+	waiting map[*nats.Msg]time.Time
+}
+
+// ControlState : state reported back on control requests
+type ControlState struct {
+	Version  string          `json:"version"`
+	Paused   bool            `json:"paused"`
+	Parked   int             `json:"parked"`
+	Features map[string]bool `json:"features"`
+
+	Locks          map[string][]LockHolder `json:"locks"`
+	Queued         map[string]int          `json:"queued"`
+	OldestQueuedMS int64                   `json:"oldest_queued_ms"`
+	ParkedDeletes  int                     `json:"parked_deletes"`
+
+	LogLevel      string `json:"log_level"`
+	LogLevelUntil string `json:"log_level_until,omitempty"`
+}
+
+func newController(h nats.MsgHandler) *controller {
+	return &controller{handler: h, waiting: make(map[*nats.Msg]time.Time)}
+}
+
+func (c *controller) handle(m *nats.Msg) {
+	c.mu.Lock()
+	c.waiting[m] = time.Now()
+	if c.paused {
+		c.parked = append(c.parked, m)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	c.dispatch(m)
+}
+
+// dispatch hands the event over, which blocks until a worker picks it up
+func (c *controller) dispatch(m *nats.Msg) {
+	c.handler(m)
+
+	c.mu.Lock()
+	delete(c.waiting, m)
+	c.mu.Unlock()
+}
+
+func (c *controller) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = true
+}
+
+// resume unpauses the controller and returns the parked events
+func (c *controller) resume() []*nats.Msg {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	parked := c.parked
+	c.paused = false
+	c.parked = nil
+
+	return parked
+}
+
+// state reports the controller state along with the network locks held
+// and the events waiting for a worker, by verb
+func (c *controller) state() ControlState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	state := ControlState{
+		Version:  version,
+		Paused:   c.paused,
+		Parked:   len(c.parked),
+		Features: cfg.features(),
+		Locks:    inflight.holders(now),
+		Queued:   make(map[string]int),
+	}
+	state.ParkedDeletes = waits.waiting()
+
+	level, until := logs.current(now)
+	state.LogLevel = level
+	if !until.IsZero() {
+		state.LogLevelUntil = until.Format(time.RFC3339)
+	}
+
+	for m, since := range c.waiting {
+		state.Queued[verb(m.Subject)]++
+		if age := milliseconds(now.Sub(since)); age > state.OldestQueuedMS {
+			state.OldestQueuedMS = age
+		}
+	}
+
+	return state
+}
+
+// command handles pause/resume and log level requests received on the
+// control subject
+func (c *controller) command(m *nats.Msg) {
+	var cmd struct {
+		Command string `json:"command"`
+		Level   string `json:"level"`
+		For     string `json:"for"`
+	}
+	json.Unmarshal(m.Data, &cmd)
+
+	switch cmd.Command {
+	case "pause":
+		fmt.Println("pausing, new events will be parked")
+		c.pause()
+	case "resume":
+		parked := c.resume()
+		fmt.Println(fmt.Sprintf("resuming, replaying %d parked events", len(parked)))
+		go func() {
+			for _, p := range parked {
+				c.dispatch(p)
+			}
+		}()
+	case "log_level":
+		d, _ := time.ParseDuration(cmd.For)
+		if err := logs.set(cmd.Level, d, time.Now()); err != nil {
+			fmt.Println("ignoring log level change: " + err.Error())
+			break
+		}
+		fmt.Println("logging at " + cmd.Level + " level")
+	}
+
+	if m.Reply != "" {
+		data, _ := json.Marshal(c.state())
+		nc.Publish(m.Reply, data)
+	}
+}
@@ -0,0 +1,94 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestController(t *testing.T) {
+	Convey("Given a controller", t, func() {
+		var handled []string
+		c := newController(func(m *nats.Msg) {
+			handled = append(handled, m.Subject)
+		})
+
+		Convey("When it is not paused", func() {
+			c.handle(&nats.Msg{Subject: "network.create.aws"})
+			Convey("It should process events straight away", func() {
+				So(handled, ShouldHaveLength, 1)
+				So(c.state().Parked, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When it is paused", func() {
+			c.pause()
+			c.handle(&nats.Msg{Subject: "network.create.aws"})
+			c.handle(&nats.Msg{Subject: "network.delete.aws"})
+
+			Convey("It should park events", func() {
+				So(handled, ShouldHaveLength, 0)
+				So(c.state().Paused, ShouldBeTrue)
+				So(c.state().Parked, ShouldEqual, 2)
+			})
+
+			Convey("And it is resumed", func() {
+				parked := c.resume()
+				Convey("It should release the parked events in order", func() {
+					So(parked, ShouldHaveLength, 2)
+					So(parked[0].Subject, ShouldEqual, "network.create.aws")
+					So(c.state().Paused, ShouldBeFalse)
+					So(c.state().Parked, ShouldEqual, 0)
+				})
+			})
+		})
+	})
+}
+
+func TestControlFeatures(t *testing.T) {
+	Convey("Given a connector in read only mode", t, func() {
+		c := config{ReadOnly: true, AllowedRegions: []string{"eu-west-1"}}
+
+		Convey("It should report its enabled features", func() {
+			features := c.features()
+			So(features["read_only"], ShouldBeTrue)
+			So(features["policies"], ShouldBeTrue)
+			So(features["replay"], ShouldBeFalse)
+		})
+	})
+}
+
+func TestControlQueueState(t *testing.T) {
+	Convey("Given a paused controller", t, func() {
+		c := newController(func(m *nats.Msg) {})
+		c.pause()
+
+		Convey("When events arrive", func() {
+			c.handle(&nats.Msg{Subject: "network.create.aws"})
+			c.handle(&nats.Msg{Subject: "network.create.aws"})
+			c.handle(&nats.Msg{Subject: "network.delete.aws"})
+
+			Convey("It should report them queued by verb", func() {
+				state := c.state()
+				So(state.Queued["create"], ShouldEqual, 2)
+				So(state.Queued["delete"], ShouldEqual, 1)
+				So(state.OldestQueuedMS, ShouldBeGreaterThanOrEqualTo, 0)
+			})
+
+			Convey("And they are replayed", func() {
+				for _, m := range c.resume() {
+					c.dispatch(m)
+				}
+
+				Convey("It should no longer report them", func() {
+					So(c.state().Queued, ShouldBeEmpty)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,68 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/ernestio/ernestaws"
+	"github.com/ernestio/ernestaws/network"
+	"github.com/nats-io/nats"
+)
+
+// handleCreate hands a create over to ernestaws. Some partitions and
+// proxies answer CreateSubnet without the subnet, its id or its zone,
+// which ernestaws either panics on or reports as done without them; the
+// subnet is then described by its VPC and range instead, unless the
+// handling was cancelled meanwhile.
+func handleCreate(client ec2API, m *nats.Msg, a *abandonment) (subject string, data []byte) {
+	defer func() {
+		if v := recover(); v != nil {
+			subject, data = m.Subject+".error", errorResponse(m.Data, recovered(v))
+			if !a.isCancelled() {
+				subject, data = describeCreated(client, m, m.Data, recovered(v))
+			}
+		}
+	}()
+
+	n := network.New(m.Subject, m.Data)
+	subject, data = ernestaws.Handle(&n)
+
+	if finalStatus(subject) == statusDone && incompleteCreate(data) && !a.isCancelled() {
+		err := newError(errNotFound, "Created network is missing from the CreateSubnet response")
+		subject, data = describeCreated(client, m, data, err)
+	}
+
+	return subject, data
+}
+
+// incompleteCreate reports whether a create response lacks the fields
+// taken from the CreateSubnet response
+func incompleteCreate(data []byte) bool {
+	r := parseRequest(data)
+	return r.NetworkAWSID == "" || r.AvailabilityZone == ""
+}
+
+// describeCreated completes the create response with the subnet found at
+// the range of the event, or reports cause if there is none
+func describeCreated(client ec2API, m *nats.Msg, data []byte, cause error) (string, []byte) {
+	r := parseRequest(m.Data)
+	if r.VPCID == "" || r.Subnet == "" {
+		return m.Subject + ".error", errorResponse(m.Data, cause)
+	}
+
+	networks, err := lookupNetworks(client, request{VPCID: r.VPCID, Subnet: r.Subnet})
+	if err != nil {
+		return m.Subject + ".error", errorResponse(m.Data, err)
+	}
+	if len(networks) == 0 {
+		return m.Subject + ".error", errorResponse(m.Data, cause)
+	}
+
+	data = setFields(data, map[string]interface{}{
+		"network_aws_id":       networks[0]["network_aws_id"],
+		"availability_zone":    networks[0]["availability_zone"],
+		"availability_zone_id": networks[0]["availability_zone_id"],
+	})
+	return m.Subject + ".done", warn(data, warnCreateDescribed, "CreateSubnet response was incomplete, the network was described at "+r.VPCID+" "+r.Subnet)
+}
@@ -0,0 +1,61 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDescribeCreated(t *testing.T) {
+	Convey("Given a create whose CreateSubnet response lacked the subnet", t, func() {
+		m := &nats.Msg{Subject: "network.create.aws", Data: []byte(`{"_uuid":"test","vpc_id":"vpc-0000000","range":"10.0.1.0/24"}`)}
+		cause := errors.New("runtime error: invalid memory address or nil pointer dereference")
+
+		Convey("When the subnet exists at the range of the event", func() {
+			client := &mockEC2{subnets: []*ec2.Subnet{{
+				SubnetId:           aws.String("subnet-00000000"),
+				VpcId:              aws.String("vpc-0000000"),
+				CidrBlock:          aws.String("10.0.1.0/24"),
+				AvailabilityZone:   aws.String("eu-west-1a"),
+				AvailabilityZoneId: aws.String("euw1-az1"),
+			}}}
+			subject, data := describeCreated(client, m, m.Data, cause)
+
+			var body map[string]interface{}
+			json.Unmarshal(data, &body)
+
+			Convey("It should complete the response from the subnet", func() {
+				So(subject, ShouldEqual, "network.create.aws.done")
+				So(body["network_aws_id"], ShouldEqual, "subnet-00000000")
+				So(body["availability_zone"], ShouldEqual, "eu-west-1a")
+				So(body["availability_zone_id"], ShouldEqual, "euw1-az1")
+				So(incompleteCreate(data), ShouldBeFalse)
+			})
+		})
+
+		Convey("When no subnet exists at the range of the event", func() {
+			subject, data := describeCreated(&mockEC2{}, m, m.Data, cause)
+
+			Convey("It should report the original failure", func() {
+				So(subject, ShouldEqual, "network.create.aws.error")
+				So(string(data), ShouldContainSubstring, "nil pointer dereference")
+			})
+		})
+	})
+
+	Convey("Given create responses", t, func() {
+		Convey("It should tell the incomplete ones apart", func() {
+			So(incompleteCreate([]byte(`{"network_aws_id":"subnet-00000000"}`)), ShouldBeTrue)
+			So(incompleteCreate([]byte(`{"network_aws_id":"subnet-00000000","availability_zone":"eu-west-1a"}`)), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,118 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+)
+
+// decrypt opens a credential encrypted by ernest: the base64 encoding of
+// an AES-CFB ciphertext prefixed with its IV. It reports false for values
+// that aren't encrypted with the key, which are used as they are.
+func decrypt(value, key string) (string, bool) {
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return "", false
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(ciphertext) <= aes.BlockSize {
+		return "", false
+	}
+
+	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+	cipher.NewCFBDecrypter(block, ciphertext[:aes.BlockSize]).XORKeyStream(plaintext, ciphertext[aes.BlockSize:])
+
+	// a plaintext credential decoding as base64 decrypts to garbage
+	if !credentialText(plaintext) {
+		return "", false
+	}
+
+	return string(plaintext), true
+}
+
+// credentialText reports whether every byte may appear in an AWS access
+// key id or secret access key
+func credentialText(b []byte) bool {
+	for _, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// maxCredentialLength is the length of an AWS secret access key, the
+// longest plaintext credential events carry
+const maxCredentialLength = 40
+
+// undecryptable returns the first credential field of the event that
+// looks encrypted, being base64 and longer than any plaintext credential,
+// but doesn't decrypt with the key
+func undecryptable(data []byte, key string) string {
+	if key == "" {
+		return ""
+	}
+
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(data, &body); err != nil {
+		return ""
+	}
+
+	for _, f := range credentialFields {
+		value, ok := body[f].(string)
+		if !ok || len(value) <= maxCredentialLength {
+			continue
+		}
+		if _, err := base64.StdEncoding.DecodeString(value); err != nil {
+			continue
+		}
+		if _, ok := decrypt(value, key); !ok {
+			return f
+		}
+	}
+
+	return ""
+}
+
+// openCredentials decrypts the credential fields of the event when a
+// crypto key is configured. It returns the event with plaintext
+// credentials, for the AWS calls only, and the encrypted values to put
+// back into the responses.
+func openCredentials(data []byte, key string) ([]byte, map[string]interface{}) {
+	if key == "" {
+		return data, nil
+	}
+
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(data, &body); err != nil {
+		return data, nil
+	}
+
+	sealed := make(map[string]interface{})
+	opened := make(map[string]interface{})
+	for _, f := range credentialFields {
+		value, ok := body[f].(string)
+		if !ok || value == "" {
+			continue
+		}
+		if plain, ok := decrypt(value, key); ok {
+			sealed[f] = value
+			opened[f] = plain
+		}
+	}
+
+	if len(opened) == 0 {
+		return data, nil
+	}
+
+	return setFields(data, opened), sealed
+}
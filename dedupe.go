@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sync"
+)
+
+// coalescer attaches events resent while an identical one is still being
+// processed to the outcome of the first, so a single AWS operation answers
+// all of them
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done    chan struct{}
+	subject string
+	data    []byte
+	err     error
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{calls: make(map[string]*call)}
+}
+
+// do runs fn for the key unless it is already running, in which case it
+// waits for that run and returns its outcome. shared reports whether the
+// outcome came from another run. When that run panicked, the waiters get
+// an internal error while the panic goes on up to the recovery
+// middleware.
+func (c *coalescer) do(key string, fn func() (string, []byte)) (subject string, data []byte, shared bool, err error) {
+	c.mu.Lock()
+	if running, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-running.done
+		return running.subject, running.data, true, running.err
+	}
+
+	current := &call{done: make(chan struct{})}
+	c.calls[key] = current
+	c.mu.Unlock()
+
+	completed := false
+	defer func() {
+		if !completed {
+			current.err = newError(errInternal, "Identical create being processed failed unexpectedly")
+		}
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(current.done)
+	}()
+
+	current.subject, current.data = fn()
+	completed = true
+
+	return current.subject, current.data, false, nil
+}
@@ -0,0 +1,99 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCoalescer(t *testing.T) {
+	Convey("Given a create being processed", t, func() {
+		c := newCoalescer()
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		var runs int
+		var wg sync.WaitGroup
+		var first, second []byte
+		var shared bool
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, first, _, _ = c.do("vpc-0000000/10.0.0.0/24", func() (string, []byte) {
+				runs++
+				close(started)
+				<-release
+				return "network.create.aws.done", []byte(`{"network_aws_id":"subnet-00000000"}`)
+			})
+		}()
+		<-started
+
+		Convey("When the same create is resent", func() {
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				close(release)
+			}()
+
+			_, second, shared, _ = c.do("vpc-0000000/10.0.0.0/24", func() (string, []byte) {
+				runs++
+				return "network.create.aws.done", []byte(`{"network_aws_id":"subnet-11111111"}`)
+			})
+			wg.Wait()
+
+			Convey("It should get the outcome of the first one", func() {
+				So(runs, ShouldEqual, 1)
+				So(string(second), ShouldEqual, string(first))
+				So(shared, ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given a create panicking while an identical one waits for it", t, func() {
+		c := newCoalescer()
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		go func() {
+			defer func() { recover() }()
+			c.do("vpc-0000000/10.0.0.0/24", func() (string, []byte) {
+				close(started)
+				<-release
+				panic("nil pointer")
+			})
+		}()
+		<-started
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+		}()
+		_, _, shared, err := c.do("vpc-0000000/10.0.0.0/24", func() (string, []byte) {
+			return "network.create.aws.done", nil
+		})
+
+		Convey("It should hand the waiter an internal error", func() {
+			So(shared, ShouldBeTrue)
+			So(err, ShouldNotBeNil)
+			So(err.(*connectorError).code, ShouldEqual, errInternal)
+		})
+
+		Convey("When the create is sent again", func() {
+			subject, _, shared, err := c.do("vpc-0000000/10.0.0.0/24", func() (string, []byte) {
+				return "network.create.aws.done", nil
+			})
+
+			Convey("It should run it rather than wait forever", func() {
+				So(subject, ShouldEqual, "network.create.aws.done")
+				So(shared, ShouldBeFalse)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
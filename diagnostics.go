@@ -0,0 +1,120 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Bundle : diagnostic data gathered when an event fails
+type Bundle struct {
+	UUID           string                 `json:"_uuid"`
+	BatchID        string                 `json:"_batch_id"`
+	Subject        string                 `json:"subject"`
+	Timestamp      time.Time              `json:"timestamp"`
+	Request        map[string]interface{} `json:"request"`
+	Error          string                 `json:"error"`
+	ErrorCode      string                 `json:"error_code,omitempty"`
+	VPCs           []*ec2.Vpc             `json:"vpcs,omitempty"`
+	Subnets        []*ec2.Subnet          `json:"subnets,omitempty"`
+	RouteTables    []*ec2.RouteTable      `json:"route_tables,omitempty"`
+	DescribeErrors []string               `json:"describe_errors,omitempty"`
+}
+
+// newBundle gathers the sanitized request, the error reported for it and,
+// for real AWS events, the current state of its VPC, subnet and route
+// tables
+func newBundle(subject string, r request, data, resp []byte) Bundle {
+	var failure struct {
+		Error     string `json:"error"`
+		ErrorCode string `json:"error_code"`
+	}
+	json.Unmarshal(resp, &failure)
+
+	b := Bundle{
+		UUID:      r.UUID,
+		BatchID:   r.BatchID,
+		Subject:   subject,
+		Timestamp: time.Now(),
+		Request:   sanitize(data),
+		Error:     failure.Error,
+		ErrorCode: failure.ErrorCode,
+	}
+
+	if r.ProviderType != providerFake && r.VPCID != "" {
+		b.describe(readClient(r), r)
+	}
+
+	return b
+}
+
+func (b *Bundle) describe(client ec2API, r request) {
+	vpcs, err := describes.get(cacheKey(r, "vpcs", r.VPCID), func() (interface{}, error) {
+		return client.DescribeVpcs(&ec2.DescribeVpcsInput{
+			VpcIds: []*string{aws.String(r.VPCID)},
+		})
+	})
+	if err != nil {
+		b.DescribeErrors = append(b.DescribeErrors, err.Error())
+	} else {
+		b.VPCs = vpcs.(*ec2.DescribeVpcsOutput).Vpcs
+	}
+
+	filter := &ec2.Filter{Name: aws.String("vpc-id"), Values: []*string{aws.String(r.VPCID)}}
+
+	subnets, err := describes.get(cacheKey(r, "subnets", r.VPCID), func() (interface{}, error) {
+		return client.DescribeSubnets(&ec2.DescribeSubnetsInput{
+			Filters: []*ec2.Filter{filter},
+		})
+	})
+	if err != nil {
+		b.DescribeErrors = append(b.DescribeErrors, err.Error())
+	} else {
+		for _, s := range subnets.(*ec2.DescribeSubnetsOutput).Subnets {
+			id := aws.StringValue(s.SubnetId)
+			if id == r.NetworkAWSID || aws.StringValue(s.CidrBlock) == r.Subnet {
+				b.Subnets = append(b.Subnets, s)
+			}
+		}
+	}
+
+	tables, err := describes.get(cacheKey(r, "route_tables", r.VPCID), func() (interface{}, error) {
+		return client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+			Filters: []*ec2.Filter{filter},
+		})
+	})
+	if err != nil {
+		b.DescribeErrors = append(b.DescribeErrors, err.Error())
+	} else {
+		b.RouteTables = tables.(*ec2.DescribeRouteTablesOutput).RouteTables
+	}
+}
+
+// publishBundle sends a diagnostic bundle to the diagnostics subject and/or
+// writes it to the diagnostics directory, whichever are configured
+func publishBundle(c config, b Bundle) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return
+	}
+
+	if c.DiagnosticsSubject != "" {
+		nc.Publish(c.DiagnosticsSubject, data)
+	}
+
+	if c.DiagnosticsDir != "" {
+		name := fmt.Sprintf("%s-%d.json", b.UUID, b.Timestamp.UnixNano())
+		if err := ioutil.WriteFile(filepath.Join(c.DiagnosticsDir, name), data, 0600); err != nil {
+			fmt.Println("could not write diagnostic bundle: " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiagnosticBundle(t *testing.T) {
+	Convey("Given a failed fake event", t, func() {
+		fakeEvent := testEvent
+		fakeEvent.ProviderType = providerFake
+		data, _ := json.Marshal(fakeEvent)
+		resp := []byte(`{"_uuid":"test","error":"Network subnet invalid","error_code":"policy"}`)
+
+		Convey("When gathering its diagnostic bundle", func() {
+			b := newBundle("network.create.aws", parseRequest(data), data, resp)
+
+			Convey("It should carry the error", func() {
+				So(b.UUID, ShouldEqual, "test")
+				So(b.Error, ShouldEqual, "Network subnet invalid")
+				So(b.ErrorCode, ShouldEqual, "policy")
+			})
+
+			Convey("It should not carry credentials", func() {
+				So(b.Request, ShouldNotContainKey, "datacenter_secret")
+				So(b.Request, ShouldNotContainKey, "datacenter_token")
+				So(b.Request["vpc_id"], ShouldEqual, "vpc-0000000")
+			})
+		})
+	})
+}
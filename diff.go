@@ -0,0 +1,60 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	changeInPlace  = "in_place"
+	changeRecreate = "recreate"
+	changeIgnored  = "ignored"
+)
+
+// FieldChange : a field of the event differing from the live network, and
+// how it can be reconciled
+type FieldChange struct {
+	Field   string `json:"field"`
+	Desired string `json:"desired"`
+	Actual  string `json:"actual"`
+	Kind    string `json:"kind"`
+}
+
+// diffNetwork compares the network described by the event with the live
+// one. Fields the event leaves empty keep their live value and are
+// ignored.
+func diffNetwork(r request, subnet *ec2.Subnet) []FieldChange {
+	var changes []FieldChange
+
+	compare := func(field, desired, actual, kind string) {
+		if desired == actual {
+			return
+		}
+		if desired == "" {
+			kind = changeIgnored
+		}
+		changes = append(changes, FieldChange{Field: field, Desired: desired, Actual: actual, Kind: kind})
+	}
+
+	compare("vpc_id", r.VPCID, aws.StringValue(subnet.VpcId), changeRecreate)
+	compare("range", r.Subnet, aws.StringValue(subnet.CidrBlock), changeRecreate)
+	compare("availability_zone", r.AvailabilityZone, aws.StringValue(subnet.AvailabilityZone), changeRecreate)
+	compare("name", r.Name, tagMap(subnet.Tags)["Name"], changeInPlace)
+
+	return changes
+}
+
+// changedFields returns the fields of the changes of the given kind
+func changedFields(changes []FieldChange, kind string) []string {
+	var fields []string
+	for _, c := range changes {
+		if c.Kind == kind {
+			fields = append(fields, c.Field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,60 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiffNetwork(t *testing.T) {
+	Convey("Given a live network", t, func() {
+		subnet := &ec2.Subnet{
+			VpcId:            aws.String("vpc-0000000"),
+			CidrBlock:        aws.String("10.0.1.0/24"),
+			AvailabilityZone: aws.String("eu-west-1a"),
+			Tags:             []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web")}},
+		}
+		r := request{VPCID: "vpc-0000000", Subnet: "10.0.1.0/24", AvailabilityZone: "eu-west-1a", Name: "web"}
+
+		Convey("When the event matches it", func() {
+			Convey("It should find no changes", func() {
+				So(diffNetwork(r, subnet), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the event omits its zone", func() {
+			r.AvailabilityZone = ""
+
+			Convey("It should ignore the zone", func() {
+				So(diffNetwork(r, subnet), ShouldResemble, []FieldChange{
+					{Field: "availability_zone", Actual: "eu-west-1a", Kind: changeIgnored},
+				})
+			})
+		})
+
+		Convey("When the event renames it", func() {
+			r.Name = "api"
+
+			Convey("It should be changed in place", func() {
+				So(diffNetwork(r, subnet), ShouldResemble, []FieldChange{
+					{Field: "name", Desired: "api", Actual: "web", Kind: changeInPlace},
+				})
+			})
+		})
+
+		Convey("When the event moves it", func() {
+			r.Subnet = "10.0.2.0/24"
+			r.AvailabilityZone = "eu-west-1b"
+
+			Convey("It should require recreating it", func() {
+				So(changedFields(diffNetwork(r, subnet), changeRecreate), ShouldResemble, []string{"range", "availability_zone"})
+			})
+		})
+	})
+}
@@ -0,0 +1,215 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	actionDelete = "delete"
+	actionKeep   = "keep"
+)
+
+// plannedResource is a resource a delete would touch, and what would
+// happen to it
+type plannedResource struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// planDelete describes everything around the network without mutating
+// any of it and lists what deleting it would remove, along with what an
+// interrupted delete left behind
+func planDelete(client ec2API, r request) ([]plannedResource, error) {
+	leftovers, err := teardownLeftovers(client, r)
+	if err != nil {
+		return nil, err
+	}
+
+	subnet, err := describeSubnet(client, r.NetworkAWSID)
+	if err != nil || subnet == nil {
+		return leftovers, err
+	}
+
+	vpc := &ec2.Filter{Name: aws.String("vpc-id"), Values: []*string{subnet.VpcId}}
+	id := &ec2.Filter{Name: aws.String("subnet-id"), Values: []*string{subnet.SubnetId}}
+
+	tables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{vpc},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	igws, err := client.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("attachment.vpc-id"), Values: []*string{subnet.VpcId}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gateways, err := client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{
+		Filter: []*ec2.Filter{id},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	flowLogs, err := client.DescribeFlowLogs(&ec2.DescribeFlowLogsInput{
+		Filter: []*ec2.Filter{
+			{Name: aws.String("resource-id"), Values: []*string{subnet.SubnetId}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := deletePlan(subnet, tables.RouteTables, igws.InternetGateways, gateways.NatGateways, flowLogs.FlowLogs)
+	for _, l := range leftovers {
+		if !planned(plan, l) {
+			plan = append(plan, l)
+		}
+	}
+
+	return plan, nil
+}
+
+func planned(plan []plannedResource, p plannedResource) bool {
+	for _, q := range plan {
+		if q.Type == p.Type && q.ID == p.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// deletePlan lists the subnet, its own route table and routes, the
+// internet gateway it routes through, its NAT gateways and flow logs.
+// Route tables and internet gateways also used by other networks, or
+// which ernest didn't create, are kept. NAT gateways are kept too, as
+// they may serve other networks: they block the delete until removed.
+func deletePlan(subnet *ec2.Subnet, tables []*ec2.RouteTable, igws []*ec2.InternetGateway, gateways []*ec2.NatGateway, flowLogs []*ec2.FlowLog) []plannedResource {
+	plan := companions(subnet, tables, igws, createdByErnest)
+
+	for _, g := range gateways {
+		if aws.StringValue(g.State) == "deleted" {
+			continue
+		}
+		plan = append(plan, plannedResource{Type: "nat_gateway", ID: aws.StringValue(g.NatGatewayId), Action: actionKeep, Reason: "blocks delete"})
+	}
+
+	for _, l := range flowLogs {
+		plan = append(plan, plannedResource{Type: "flow_log", ID: aws.StringValue(l.FlowLogId), Action: actionDelete})
+	}
+
+	return plan
+}
+
+// companions lists the subnet along with the route table and internet
+// gateway only it uses, keeping those whose tags owns rejects
+func companions(subnet *ec2.Subnet, tables []*ec2.RouteTable, igws []*ec2.InternetGateway, owns func([]*ec2.Tag) bool) []plannedResource {
+	id := aws.StringValue(subnet.SubnetId)
+	plan := []plannedResource{{Type: "subnet", ID: id, Action: actionDelete}}
+
+	for _, t := range tables {
+		if !associatedWith(t, id) {
+			continue
+		}
+
+		tableID := aws.StringValue(t.RouteTableId)
+		if others := len(t.Associations) - 1; others > 0 || isMain(t) {
+			plan = append(plan, plannedResource{Type: "route_table", ID: tableID, Action: actionKeep, Reason: "shared with other networks"})
+			continue
+		}
+		if !owns(t.Tags) {
+			plan = append(plan, plannedResource{Type: "route_table", ID: tableID, Action: actionKeep, Reason: "not created by ernest"})
+			continue
+		}
+
+		plan = append(plan, plannedResource{Type: "route_table", ID: tableID, Action: actionDelete})
+		for _, route := range t.Routes {
+			gateway := aws.StringValue(route.GatewayId)
+			if gateway == "local" {
+				continue
+			}
+
+			plan = append(plan, plannedResource{Type: "route", ID: tableID + ":" + routeDestination(route), Action: actionDelete})
+
+			if strings.HasPrefix(gateway, "igw-") {
+				plan = append(plan, gatewayDecision(gateway, tableID, tables, igws, owns))
+			}
+		}
+	}
+
+	return plan
+}
+
+// gatewayDecision keeps an internet gateway while any other route table
+// of the VPC still routes through it, or when ernest didn't create it
+func gatewayDecision(gateway, tableID string, tables []*ec2.RouteTable, igws []*ec2.InternetGateway, owns func([]*ec2.Tag) bool) plannedResource {
+	var users int
+	for _, t := range tables {
+		if aws.StringValue(t.RouteTableId) == tableID {
+			continue
+		}
+		for _, route := range t.Routes {
+			if aws.StringValue(route.GatewayId) == gateway {
+				users++
+				break
+			}
+		}
+	}
+
+	if users > 0 {
+		return plannedResource{Type: "internet_gateway", ID: gateway, Action: actionKeep, Reason: "used by other route tables"}
+	}
+
+	var tags []*ec2.Tag
+	for _, g := range igws {
+		if aws.StringValue(g.InternetGatewayId) == gateway {
+			tags = g.Tags
+		}
+	}
+	if !owns(tags) {
+		return plannedResource{Type: "internet_gateway", ID: gateway, Action: actionKeep, Reason: "not created by ernest"}
+	}
+	return plannedResource{Type: "internet_gateway", ID: gateway, Action: actionDelete}
+}
+
+func associatedWith(t *ec2.RouteTable, subnetID string) bool {
+	for _, a := range t.Associations {
+		if aws.StringValue(a.SubnetId) == subnetID {
+			return true
+		}
+	}
+	return false
+}
+
+func isMain(t *ec2.RouteTable) bool {
+	for _, a := range t.Associations {
+		if aws.BoolValue(a.Main) {
+			return true
+		}
+	}
+	return false
+}
+
+func routeDestination(route *ec2.Route) string {
+	if d := aws.StringValue(route.DestinationCidrBlock); d != "" {
+		return d
+	}
+	if d := aws.StringValue(route.DestinationIpv6CidrBlock); d != "" {
+		return d
+	}
+	return aws.StringValue(route.DestinationPrefixListId)
+}
@@ -0,0 +1,146 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func routeTable(id string, subnets []string, gateway string) *ec2.RouteTable {
+	t := &ec2.RouteTable{
+		RouteTableId: aws.String(id),
+		Routes: []*ec2.Route{
+			{DestinationCidrBlock: aws.String("10.0.0.0/16"), GatewayId: aws.String("local")},
+		},
+	}
+
+	for _, s := range subnets {
+		t.Associations = append(t.Associations, &ec2.RouteTableAssociation{
+			RouteTableAssociationId: aws.String("rtbassoc-" + strings.TrimPrefix(s, "subnet-")),
+			SubnetId:                aws.String(s),
+		})
+	}
+
+	if gateway != "" {
+		t.Routes = append(t.Routes, &ec2.Route{DestinationCidrBlock: aws.String("0.0.0.0/0"), GatewayId: aws.String(gateway)})
+	}
+
+	return t
+}
+
+// ernestTags are the tags the connector adds to the resources it creates
+func ernestTags() []*ec2.Tag {
+	return []*ec2.Tag{{Key: aws.String("ernest.service"), Value: aws.String("web")}}
+}
+
+func ernestGateway(id string) *ec2.InternetGateway {
+	return &ec2.InternetGateway{InternetGatewayId: aws.String(id), Tags: ernestTags()}
+}
+
+func TestDeletePlan(t *testing.T) {
+	Convey("Given a public network about to be deleted", t, func() {
+		subnet := &ec2.Subnet{SubnetId: aws.String("subnet-00000000")}
+		gateways := []*ec2.NatGateway{
+			{NatGatewayId: aws.String("nat-00000000"), State: aws.String("available")},
+			{NatGatewayId: aws.String("nat-11111111"), State: aws.String("deleted")},
+		}
+		flowLogs := []*ec2.FlowLog{{FlowLogId: aws.String("fl-00000000")}}
+		igws := []*ec2.InternetGateway{ernestGateway("igw-00000000")}
+
+		Convey("When it is the only network routing through the internet gateway", func() {
+			tables := []*ec2.RouteTable{
+				routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000"),
+				routeTable("rtb-11111111", []string{"subnet-11111111"}, ""),
+			}
+			tables[0].Tags = ernestTags()
+			plan := deletePlan(subnet, tables, igws, gateways, flowLogs)
+
+			Convey("It should list every resource the delete would touch", func() {
+				So(plan, ShouldResemble, []plannedResource{
+					{Type: "subnet", ID: "subnet-00000000", Action: actionDelete},
+					{Type: "route_table", ID: "rtb-00000000", Action: actionDelete},
+					{Type: "route", ID: "rtb-00000000:0.0.0.0/0", Action: actionDelete},
+					{Type: "internet_gateway", ID: "igw-00000000", Action: actionDelete},
+					{Type: "nat_gateway", ID: "nat-00000000", Action: actionKeep, Reason: "blocks delete"},
+					{Type: "flow_log", ID: "fl-00000000", Action: actionDelete},
+				})
+			})
+		})
+
+		Convey("When other networks use its route table and internet gateway", func() {
+			tables := []*ec2.RouteTable{
+				routeTable("rtb-00000000", []string{"subnet-00000000", "subnet-22222222"}, "igw-00000000"),
+			}
+			tables[0].Tags = ernestTags()
+			plan := deletePlan(subnet, tables, igws, nil, nil)
+
+			Convey("It should keep the route table", func() {
+				So(plan, ShouldResemble, []plannedResource{
+					{Type: "subnet", ID: "subnet-00000000", Action: actionDelete},
+					{Type: "route_table", ID: "rtb-00000000", Action: actionKeep, Reason: "shared with other networks"},
+				})
+			})
+		})
+
+		Convey("When another route table routes through the internet gateway", func() {
+			tables := []*ec2.RouteTable{
+				routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000"),
+				routeTable("rtb-11111111", []string{"subnet-11111111"}, "igw-00000000"),
+			}
+			tables[0].Tags = ernestTags()
+			plan := deletePlan(subnet, tables, igws, nil, nil)
+
+			Convey("It should keep the internet gateway", func() {
+				So(plan[len(plan)-1], ShouldResemble, plannedResource{Type: "internet_gateway", ID: "igw-00000000", Action: actionKeep, Reason: "used by other route tables"})
+			})
+		})
+	})
+
+	Convey("Given a network routed by tables and gateways ernest didn't create", t, func() {
+		subnet := &ec2.Subnet{SubnetId: aws.String("subnet-00000000")}
+
+		Convey("When its route table is the main one", func() {
+			tables := []*ec2.RouteTable{routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")}
+			tables[0].Tags = ernestTags()
+			tables[0].Associations = append(tables[0].Associations, &ec2.RouteTableAssociation{Main: aws.Bool(true)})
+			plan := deletePlan(subnet, tables, []*ec2.InternetGateway{ernestGateway("igw-00000000")}, nil, nil)
+
+			Convey("It should keep it", func() {
+				So(plan, ShouldResemble, []plannedResource{
+					{Type: "subnet", ID: "subnet-00000000", Action: actionDelete},
+					{Type: "route_table", ID: "rtb-00000000", Action: actionKeep, Reason: "shared with other networks"},
+				})
+			})
+		})
+
+		Convey("When its route table is untagged", func() {
+			tables := []*ec2.RouteTable{routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")}
+			plan := deletePlan(subnet, tables, []*ec2.InternetGateway{ernestGateway("igw-00000000")}, nil, nil)
+
+			Convey("It should keep it along with its routes and gateway", func() {
+				So(plan, ShouldResemble, []plannedResource{
+					{Type: "subnet", ID: "subnet-00000000", Action: actionDelete},
+					{Type: "route_table", ID: "rtb-00000000", Action: actionKeep, Reason: "not created by ernest"},
+				})
+			})
+		})
+
+		Convey("When its internet gateway is untagged", func() {
+			tables := []*ec2.RouteTable{routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")}
+			tables[0].Tags = ernestTags()
+			igws := []*ec2.InternetGateway{{InternetGatewayId: aws.String("igw-00000000")}}
+			plan := deletePlan(subnet, tables, igws, nil, nil)
+
+			Convey("It should keep the gateway", func() {
+				So(plan[len(plan)-1], ShouldResemble, plannedResource{Type: "internet_gateway", ID: "igw-00000000", Action: actionKeep, Reason: "not created by ernest"})
+			})
+		})
+	})
+}
@@ -0,0 +1,458 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats"
+)
+
+const (
+	resultDeleted = "deleted"
+	resultKept    = "kept"
+	resultFailed  = "failed"
+	resultSkipped = "skipped"
+)
+
+// environmentStages are the resource types of an environment teardown, in
+// the order their dependencies allow deleting them
+var environmentStages = []struct {
+	kind string
+	step string
+}{
+	{"nat_gateway", stepNATGatewaysDeleted},
+	{"vpc_endpoint", stepEndpointsDeleted},
+	{"subnet", stepSubnetsDeleted},
+	{"route_table", stepRouteTablesDeleted},
+	{"internet_gateway", stepInternetGatewaysDeleted},
+}
+
+// environmentResult is what happened to a resource of an environment
+// teardown
+type environmentResult struct {
+	plannedResource
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// environmentHandler deletes every ernest managed network of the VPC of
+// the event, given by vpc_id or vpc_tag and narrowed to a service when it
+// names one, along with their NAT gateways, endpoints, route tables and
+// internet gateway
+func environmentHandler(m *nats.Msg) {
+	req, _, err := decodeStandalone(m)
+	if err != nil {
+		publishError(m.Subject, errorResponse(nil, err))
+		return
+	}
+	body := sanitizedBody(m.Data)
+
+	fail := func(err error, resources interface{}) {
+		response := errorResponse(body, err)
+		if resources != nil {
+			response = setField(response, "resources", resources)
+		}
+		deliver(m.Subject+".error", response)
+	}
+
+	if err := checkPolicy(cfg, m.Subject, req); err != nil {
+		fail(err, nil)
+		return
+	}
+	if until, frozen := frozenUntil(cfg.FreezeWindows, req, time.Now()); frozen && !req.DryRun {
+		fail(newError(errFreeze, "Changes to "+req.DatacenterRegion+" are frozen until "+until.Format(time.RFC3339)), nil)
+		return
+	}
+
+	if req.VPCID == "" && req.VPCTag != "" {
+		id, err := resolveVPC(readClient(req), req.VPCTag)
+		if err != nil {
+			fail(err, nil)
+			return
+		}
+		req.VPCID = id
+	}
+	if req.VPCID == "" {
+		fail(newError(errPayload, "Environment teardown needs a vpc_id or vpc_tag"), nil)
+		return
+	}
+
+	plan, err := planEnvironment(readClient(req), req)
+	if err != nil {
+		fail(err, nil)
+		return
+	}
+
+	if req.DryRun {
+		deliver(m.Subject+".done", setFields(body, map[string]interface{}{
+			"dry_run":   true,
+			"vpc_id":    req.VPCID,
+			"resources": plan,
+		}))
+		return
+	}
+
+	// network events racing the teardown are turned away, as they would
+	// be by another batch deleting the same networks
+	keys := environmentLockKeys(req.VPCID, plan)
+	if err := inflight.acquire(keys, req.BatchID); err != nil {
+		fail(err, nil)
+		return
+	}
+	defer inflight.release(keys)
+
+	results, err := teardownEnvironment(ec2Client(req), routingClient(req), req, plan, func(step string) {
+		publishProgress(m.Subject, req, step)
+	})
+	if err != nil {
+		fail(err, results)
+		return
+	}
+
+	deliver(m.Subject+".done", setFields(body, map[string]interface{}{
+		"vpc_id":    req.VPCID,
+		"resources": results,
+	}))
+}
+
+// environmentLockKeys returns the keys of the networks the teardown
+// deletes and, when it deletes an internet gateway, of the internet
+// routing of the VPC public networks are created through
+func environmentLockKeys(vpc string, plan []plannedResource) []string {
+	var keys []string
+	for _, p := range plan {
+		if p.Action != actionDelete {
+			continue
+		}
+		switch p.Type {
+		case "subnet":
+			keys = append(keys, p.ID)
+		case "internet_gateway":
+			keys = append(keys, internetRoutingKey(vpc))
+		}
+	}
+	return keys
+}
+
+// planEnvironment describes the VPC of the event without mutating any of
+// it and lists what tearing its networks down would remove
+func planEnvironment(client ec2API, r request) ([]plannedResource, error) {
+	vpc := []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(r.VPCID)}}}
+
+	subnets, err := client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: vpc})
+	if err != nil {
+		return nil, err
+	}
+
+	gateways, err := client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{Filter: vpc})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints, err := client.DescribeVpcEndpoints(&ec2.DescribeVpcEndpointsInput{Filters: vpc})
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: vpc})
+	if err != nil {
+		return nil, err
+	}
+
+	igws, err := client.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+		Filters: []*ec2.Filter{{Name: aws.String("attachment.vpc-id"), Values: []*string{aws.String(r.VPCID)}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return environmentPlan(r.Service, subnets.Subnets, gateways.NatGateways, endpoints.VpcEndpoints, tables.RouteTables, igws.InternetGateways), nil
+}
+
+// environmentPlan lists, in the order they can be deleted, the NAT
+// gateways and endpoints of the managed networks, the networks, the route
+// tables only they use and the internet gateways only those route through.
+// Resources also serving networks ernest doesn't manage, and those ernest
+// didn't create, are kept.
+func environmentPlan(service string, subnets []*ec2.Subnet, gateways []*ec2.NatGateway, endpoints []*ec2.VpcEndpoint, tables []*ec2.RouteTable, igws []*ec2.InternetGateway) []plannedResource {
+	managed := make(map[string]bool)
+	var plan []plannedResource
+
+	for _, s := range subnets {
+		if createdForService(s.Tags, service) {
+			managed[aws.StringValue(s.SubnetId)] = true
+		}
+	}
+
+	removed := make(map[string]bool)
+	var tablePlan []plannedResource
+	for _, t := range tables {
+		var ours, others int
+		for _, a := range t.Associations {
+			if id := aws.StringValue(a.SubnetId); id != "" && managed[id] {
+				ours++
+			} else {
+				others++
+			}
+		}
+		if ours == 0 {
+			continue
+		}
+
+		id := aws.StringValue(t.RouteTableId)
+		if others > 0 || isMain(t) {
+			tablePlan = append(tablePlan, plannedResource{Type: "route_table", ID: id, Action: actionKeep, Reason: "shared with other networks"})
+			continue
+		}
+		if !createdByErnest(t.Tags) {
+			tablePlan = append(tablePlan, plannedResource{Type: "route_table", ID: id, Action: actionKeep, Reason: "not created by ernest"})
+			continue
+		}
+		removed[id] = true
+		tablePlan = append(tablePlan, plannedResource{Type: "route_table", ID: id, Action: actionDelete})
+	}
+
+	for _, g := range gateways {
+		if state := aws.StringValue(g.State); state == "deleting" || state == "deleted" {
+			continue
+		}
+		id := aws.StringValue(g.NatGatewayId)
+		if !managed[aws.StringValue(g.SubnetId)] {
+			continue
+		}
+
+		switch {
+		case usedByOtherTables(tables, removed, func(r *ec2.Route) bool { return aws.StringValue(r.NatGatewayId) == id }):
+			plan = append(plan, plannedResource{Type: "nat_gateway", ID: id, Action: actionKeep, Reason: "used by other route tables"})
+		case !createdByErnest(g.Tags):
+			plan = append(plan, plannedResource{Type: "nat_gateway", ID: id, Action: actionKeep, Reason: "not created by ernest"})
+		default:
+			plan = append(plan, plannedResource{Type: "nat_gateway", ID: id, Action: actionDelete})
+		}
+	}
+
+	for _, e := range endpoints {
+		if state := aws.StringValue(e.State); state == "deleting" || state == "deleted" {
+			continue
+		}
+
+		var ours, others int
+		for _, id := range aws.StringValueSlice(e.SubnetIds) {
+			if managed[id] {
+				ours++
+			} else {
+				others++
+			}
+		}
+		for _, id := range aws.StringValueSlice(e.RouteTableIds) {
+			if removed[id] {
+				ours++
+			} else {
+				others++
+			}
+		}
+		if ours == 0 {
+			continue
+		}
+
+		id := aws.StringValue(e.VpcEndpointId)
+		switch {
+		case others > 0:
+			plan = append(plan, plannedResource{Type: "vpc_endpoint", ID: id, Action: actionKeep, Reason: "used by other networks"})
+		case !createdByErnest(e.Tags):
+			plan = append(plan, plannedResource{Type: "vpc_endpoint", ID: id, Action: actionKeep, Reason: "not created by ernest"})
+		default:
+			plan = append(plan, plannedResource{Type: "vpc_endpoint", ID: id, Action: actionDelete})
+		}
+	}
+
+	for _, s := range subnets {
+		if id := aws.StringValue(s.SubnetId); managed[id] {
+			plan = append(plan, plannedResource{Type: "subnet", ID: id, Action: actionDelete})
+		}
+	}
+
+	plan = append(plan, tablePlan...)
+
+	for _, g := range igws {
+		id := aws.StringValue(g.InternetGatewayId)
+
+		var ours int
+		for _, t := range tables {
+			if routesThrough(t, id) && removed[aws.StringValue(t.RouteTableId)] {
+				ours++
+			}
+		}
+		if ours == 0 {
+			continue
+		}
+
+		switch {
+		case usedByOtherTables(tables, removed, func(r *ec2.Route) bool { return aws.StringValue(r.GatewayId) == id }):
+			plan = append(plan, plannedResource{Type: "internet_gateway", ID: id, Action: actionKeep, Reason: "used by other route tables"})
+		case !createdByErnest(g.Tags):
+			plan = append(plan, plannedResource{Type: "internet_gateway", ID: id, Action: actionKeep, Reason: "not created by ernest"})
+		default:
+			plan = append(plan, plannedResource{Type: "internet_gateway", ID: id, Action: actionDelete})
+		}
+	}
+
+	return plan
+}
+
+// usedByOtherTables reports whether a route table the teardown keeps has
+// a matching route, whose target deleting would cut its networks off
+func usedByOtherTables(tables []*ec2.RouteTable, removed map[string]bool, matches func(*ec2.Route) bool) bool {
+	for _, t := range tables {
+		if removed[aws.StringValue(t.RouteTableId)] {
+			continue
+		}
+		for _, r := range t.Routes {
+			if matches(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func routesThrough(t *ec2.RouteTable, gateway string) bool {
+	for _, route := range t.Routes {
+		if aws.StringValue(route.GatewayId) == gateway {
+			return true
+		}
+	}
+	return false
+}
+
+// teardownEnvironment deletes the planned resources stage by stage,
+// reporting progress after each. The first failure stops the teardown and
+// leaves the resources depending on it skipped.
+func teardownEnvironment(client, routing ec2API, r request, plan []plannedResource, progress func(string)) ([]environmentResult, error) {
+	results := make([]environmentResult, len(plan))
+	for i, p := range plan {
+		results[i] = environmentResult{plannedResource: p}
+		if p.Action == actionKeep {
+			results[i].Status = resultKept
+		}
+	}
+
+	var failed error
+	for _, stage := range environmentStages {
+		var deleted []string
+		for i := range results {
+			res := &results[i]
+			if res.Type != stage.kind || res.Action != actionDelete {
+				continue
+			}
+			if failed != nil {
+				res.Status = resultSkipped
+				continue
+			}
+
+			if err := deleteEnvironmentResource(client, routing, r, res.plannedResource); err != nil {
+				res.Status, res.Error = resultFailed, err.Error()
+				failed = err
+				continue
+			}
+			res.Status = resultDeleted
+			deleted = append(deleted, res.ID)
+		}
+
+		if failed != nil || len(deleted) == 0 {
+			continue
+		}
+
+		// subnets can only go once their NAT gateways are gone
+		if stage.kind == "nat_gateway" {
+			if err := waitForNATGateways(client, deleted, cfg.NATWaitTimeout); err != nil {
+				failed = err
+				continue
+			}
+		}
+
+		progress(stage.step)
+	}
+
+	return results, failed
+}
+
+func deleteEnvironmentResource(client, routing ec2API, r request, p plannedResource) error {
+	switch p.Type {
+	case "nat_gateway":
+		_, err := client.DeleteNatGateway(&ec2.DeleteNatGatewayInput{NatGatewayId: aws.String(p.ID)})
+		return err
+	case "vpc_endpoint":
+		resp, err := client.DeleteVpcEndpoints(&ec2.DeleteVpcEndpointsInput{VpcEndpointIds: []*string{aws.String(p.ID)}})
+		if err != nil {
+			return err
+		}
+		for _, u := range resp.Unsuccessful {
+			if u.Error != nil {
+				return newError(aws.StringValue(u.Error.Code), aws.StringValue(u.Error.Message))
+			}
+		}
+		return nil
+	case "subnet":
+		network := r
+		network.NetworkAWSID = p.ID
+		if err := waitForInterfaces(client, network, r.interfaceTimeout(cfg)); err != nil {
+			return err
+		}
+		_, err := client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: aws.String(p.ID)})
+		return err
+	case "route_table":
+		_, err := routing.DeleteRouteTable(&ec2.DeleteRouteTableInput{RouteTableId: aws.String(p.ID)})
+		return err
+	case "internet_gateway":
+		_, err := routing.DetachInternetGateway(&ec2.DetachInternetGatewayInput{
+			InternetGatewayId: aws.String(p.ID),
+			VpcId:             aws.String(r.VPCID),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = routing.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{InternetGatewayId: aws.String(p.ID)})
+		return err
+	}
+	return nil
+}
+
+// waitForNATGateways waits until the given NAT gateways are deleted,
+// releasing their interfaces
+func waitForNATGateways(client ec2API, ids []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := time.Second
+
+	for {
+		resp, err := client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{NatGatewayIds: aws.StringSlice(ids)})
+		if err != nil {
+			return err
+		}
+
+		var pending []string
+		for _, g := range resp.NatGateways {
+			if aws.StringValue(g.State) != "deleted" {
+				pending = append(pending, aws.StringValue(g.NatGatewayId))
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return newError(errTimeout, "NAT gateways "+strings.Join(pending, ", ")+" are still not deleted after "+timeout.String())
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxInterfaceBackoff {
+			backoff = maxInterfaceBackoff
+		}
+	}
+}
@@ -0,0 +1,238 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// teardownEC2 records the deletes of an environment teardown
+type teardownEC2 struct {
+	mockEC2
+	failing string
+}
+
+func (m *teardownEC2) record(call, id string) error {
+	m.calls = append(m.calls, call+" "+id)
+	if id == m.failing {
+		return errors.New("DependencyViolation")
+	}
+	return nil
+}
+
+func (m *teardownEC2) DeleteNatGateway(in *ec2.DeleteNatGatewayInput) (*ec2.DeleteNatGatewayOutput, error) {
+	return &ec2.DeleteNatGatewayOutput{}, m.record("DeleteNatGateway", aws.StringValue(in.NatGatewayId))
+}
+
+func (m *teardownEC2) DescribeNatGateways(in *ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error) {
+	var gateways []*ec2.NatGateway
+	for _, id := range in.NatGatewayIds {
+		gateways = append(gateways, &ec2.NatGateway{NatGatewayId: id, State: aws.String("deleted")})
+	}
+	return &ec2.DescribeNatGatewaysOutput{NatGateways: gateways}, nil
+}
+
+func (m *teardownEC2) DeleteVpcEndpoints(in *ec2.DeleteVpcEndpointsInput) (*ec2.DeleteVpcEndpointsOutput, error) {
+	return &ec2.DeleteVpcEndpointsOutput{}, m.record("DeleteVpcEndpoints", aws.StringValue(in.VpcEndpointIds[0]))
+}
+
+func (m *teardownEC2) DescribeNetworkInterfaces(in *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	return &ec2.DescribeNetworkInterfacesOutput{}, nil
+}
+
+func (m *teardownEC2) DeleteSubnet(in *ec2.DeleteSubnetInput) (*ec2.DeleteSubnetOutput, error) {
+	return &ec2.DeleteSubnetOutput{}, m.record("DeleteSubnet", aws.StringValue(in.SubnetId))
+}
+
+func (m *teardownEC2) DeleteRouteTable(in *ec2.DeleteRouteTableInput) (*ec2.DeleteRouteTableOutput, error) {
+	return &ec2.DeleteRouteTableOutput{}, m.record("DeleteRouteTable", aws.StringValue(in.RouteTableId))
+}
+
+func (m *teardownEC2) DetachInternetGateway(in *ec2.DetachInternetGatewayInput) (*ec2.DetachInternetGatewayOutput, error) {
+	return &ec2.DetachInternetGatewayOutput{}, m.record("DetachInternetGateway", aws.StringValue(in.InternetGatewayId))
+}
+
+func (m *teardownEC2) DeleteInternetGateway(in *ec2.DeleteInternetGatewayInput) (*ec2.DeleteInternetGatewayOutput, error) {
+	return &ec2.DeleteInternetGatewayOutput{}, m.record("DeleteInternetGateway", aws.StringValue(in.InternetGatewayId))
+}
+
+func managedTestSubnet(id, service string) *ec2.Subnet {
+	s := &ec2.Subnet{SubnetId: aws.String(id), VpcId: aws.String("vpc-00000000")}
+	if service != "" {
+		s.Tags = []*ec2.Tag{{Key: aws.String("ernest.service"), Value: aws.String(service)}}
+	}
+	return s
+}
+
+func TestEnvironmentPlan(t *testing.T) {
+	Convey("Given a VPC with ernest managed and unmanaged networks", t, func() {
+		subnets := []*ec2.Subnet{
+			managedTestSubnet("subnet-00000000", "web"),
+			managedTestSubnet("subnet-11111111", "web"),
+			managedTestSubnet("subnet-22222222", ""),
+		}
+		gateways := []*ec2.NatGateway{
+			{NatGatewayId: aws.String("nat-00000000"), SubnetId: aws.String("subnet-00000000"), State: aws.String("available"), Tags: ernestTags()},
+			{NatGatewayId: aws.String("nat-22222222"), SubnetId: aws.String("subnet-22222222"), State: aws.String("available")},
+		}
+		endpoints := []*ec2.VpcEndpoint{
+			{VpcEndpointId: aws.String("vpce-00000000"), SubnetIds: aws.StringSlice([]string{"subnet-00000000"}), Tags: ernestTags()},
+			{VpcEndpointId: aws.String("vpce-11111111"), SubnetIds: aws.StringSlice([]string{"subnet-11111111", "subnet-22222222"})},
+		}
+		tables := []*ec2.RouteTable{
+			routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000"),
+			routeTable("rtb-11111111", []string{"subnet-11111111", "subnet-22222222"}, ""),
+		}
+		tables[0].Tags = ernestTags()
+		igws := []*ec2.InternetGateway{ernestGateway("igw-00000000")}
+
+		Convey("When it is planned", func() {
+			plan := environmentPlan("", subnets, gateways, endpoints, tables, igws)
+
+			Convey("It should delete the managed networks in dependency order and keep what others use", func() {
+				So(plan, ShouldResemble, []plannedResource{
+					{Type: "nat_gateway", ID: "nat-00000000", Action: actionDelete},
+					{Type: "vpc_endpoint", ID: "vpce-00000000", Action: actionDelete},
+					{Type: "vpc_endpoint", ID: "vpce-11111111", Action: actionKeep, Reason: "used by other networks"},
+					{Type: "subnet", ID: "subnet-00000000", Action: actionDelete},
+					{Type: "subnet", ID: "subnet-11111111", Action: actionDelete},
+					{Type: "route_table", ID: "rtb-00000000", Action: actionDelete},
+					{Type: "route_table", ID: "rtb-11111111", Action: actionKeep, Reason: "shared with other networks"},
+					{Type: "internet_gateway", ID: "igw-00000000", Action: actionDelete},
+				})
+			})
+		})
+
+		Convey("When the user created its route table and internet gateway", func() {
+			tables[0].Tags = nil
+			plan := environmentPlan("", subnets, gateways, endpoints, tables, igws)
+
+			Convey("It should keep the route table and leave the gateway it routes through alone", func() {
+				So(plan[5], ShouldResemble, plannedResource{Type: "route_table", ID: "rtb-00000000", Action: actionKeep, Reason: "not created by ernest"})
+				So(plan, ShouldHaveLength, 7)
+			})
+		})
+
+		Convey("When the user created the internet gateway only", func() {
+			igws[0].Tags = nil
+			plan := environmentPlan("", subnets, gateways, endpoints, tables, igws)
+
+			Convey("It should keep the gateway", func() {
+				So(plan[5], ShouldResemble, plannedResource{Type: "route_table", ID: "rtb-00000000", Action: actionDelete})
+				So(plan[7], ShouldResemble, plannedResource{Type: "internet_gateway", ID: "igw-00000000", Action: actionKeep, Reason: "not created by ernest"})
+			})
+		})
+
+		Convey("When the user created the NAT gateway and endpoint of a managed network", func() {
+			gateways[0].Tags = nil
+			endpoints[0].Tags = nil
+			plan := environmentPlan("", subnets, gateways, endpoints, tables, igws)
+
+			Convey("It should keep them", func() {
+				So(plan[0], ShouldResemble, plannedResource{Type: "nat_gateway", ID: "nat-00000000", Action: actionKeep, Reason: "not created by ernest"})
+				So(plan[1], ShouldResemble, plannedResource{Type: "vpc_endpoint", ID: "vpce-00000000", Action: actionKeep, Reason: "not created by ernest"})
+			})
+		})
+
+		Convey("When a network ernest doesn't manage routes through the NAT gateway", func() {
+			tables = append(tables, routeTable("rtb-22222222", []string{"subnet-22222222"}, ""))
+			tables[2].Routes = append(tables[2].Routes, &ec2.Route{DestinationCidrBlock: aws.String("0.0.0.0/0"), NatGatewayId: aws.String("nat-00000000")})
+			plan := environmentPlan("", subnets, gateways, endpoints, tables, igws)
+
+			Convey("It should keep it so that network keeps its egress", func() {
+				So(plan[0], ShouldResemble, plannedResource{Type: "nat_gateway", ID: "nat-00000000", Action: actionKeep, Reason: "used by other route tables"})
+			})
+		})
+
+		Convey("When it is planned for another service", func() {
+			plan := environmentPlan("api", subnets, gateways, endpoints, tables, igws)
+
+			Convey("It should not touch anything", func() {
+				So(plan, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestTeardownEnvironment(t *testing.T) {
+	Convey("Given an environment teardown plan", t, func() {
+		plan := []plannedResource{
+			{Type: "nat_gateway", ID: "nat-00000000", Action: actionDelete},
+			{Type: "subnet", ID: "subnet-00000000", Action: actionDelete},
+			{Type: "route_table", ID: "rtb-11111111", Action: actionKeep, Reason: "shared with other networks"},
+			{Type: "internet_gateway", ID: "igw-00000000", Action: actionDelete},
+		}
+		r := request{VPCID: "vpc-00000000", InterfaceTimeout: "1s"}
+		var steps []string
+		progress := func(step string) { steps = append(steps, step) }
+
+		Convey("When every delete succeeds", func() {
+			client := &teardownEC2{}
+			results, err := teardownEnvironment(client, client, r, plan, progress)
+
+			Convey("It should delete the resources in order", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{
+					"DeleteNatGateway nat-00000000",
+					"DeleteSubnet subnet-00000000",
+					"DetachInternetGateway igw-00000000",
+					"DeleteInternetGateway igw-00000000",
+				})
+				So(steps, ShouldResemble, []string{stepNATGatewaysDeleted, stepSubnetsDeleted, stepInternetGatewaysDeleted})
+			})
+
+			Convey("It should report each resource", func() {
+				So(results[0].Status, ShouldEqual, resultDeleted)
+				So(results[2].Status, ShouldEqual, resultKept)
+				So(results[3].Status, ShouldEqual, resultDeleted)
+			})
+		})
+
+		Convey("When a subnet fails to delete", func() {
+			client := &teardownEC2{failing: "subnet-00000000"}
+			results, err := teardownEnvironment(client, client, r, plan, progress)
+
+			Convey("It should stop and skip what depends on it", func() {
+				So(err, ShouldNotBeNil)
+				So(results[1].Status, ShouldEqual, resultFailed)
+				So(results[1].Error, ShouldEqual, "DependencyViolation")
+				So(results[3].Status, ShouldEqual, resultSkipped)
+				So(client.calls, ShouldNotContain, "DeleteInternetGateway igw-00000000")
+			})
+		})
+	})
+}
+
+func TestEnvironmentLockKeys(t *testing.T) {
+	Convey("Given an environment teardown deleting a network and its internet gateway", t, func() {
+		plan := []plannedResource{
+			{Type: "nat_gateway", ID: "nat-00000000", Action: actionDelete},
+			{Type: "subnet", ID: "subnet-00000000", Action: actionDelete},
+			{Type: "subnet", ID: "subnet-11111111", Action: actionKeep},
+			{Type: "internet_gateway", ID: "igw-00000000", Action: actionDelete},
+		}
+		keys := environmentLockKeys("vpc-00000000", plan)
+
+		Convey("It should lock the networks it deletes and the internet routing of the VPC", func() {
+			So(keys, ShouldResemble, []string{"subnet-00000000", "vpc-00000000/internet_gateway"})
+		})
+
+		Convey("When a public network of another batch is created meanwhile", func() {
+			l := newLocks()
+			So(l.acquire(keys, "teardown"), ShouldBeNil)
+			err := l.acquire(request{VPCID: "vpc-00000000", Subnet: "10.0.9.0/24", IsPublic: true}.lockKeys(), "build")
+
+			Convey("It should be turned away", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errConflict)
+			})
+		})
+	})
+}
@@ -0,0 +1,120 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+)
+
+// errorCategories group the AWS error codes platform teams watch for:
+// throttling and limits warn of account pressure, auth of IAM drift
+var errorCategories = []struct {
+	name  string
+	match func(code string) bool
+}{
+	{"throttling", func(c string) bool {
+		return c == "RequestLimitExceeded" || strings.HasPrefix(c, "Throttling")
+	}},
+	{"auth", func(c string) bool {
+		return c == "UnauthorizedOperation" || c == "AccessDenied" || c == "AuthFailure" ||
+			strings.HasPrefix(c, "InvalidClientTokenId") || c == "ExpiredToken" || c == "SignatureDoesNotMatch"
+	}},
+	{"limit", func(c string) bool {
+		return strings.HasSuffix(c, "LimitExceeded") || strings.HasPrefix(c, "Insufficient")
+	}},
+	{"dependency", func(c string) bool { return c == "DependencyViolation" }},
+	{"not_found", func(c string) bool { return strings.HasSuffix(c, ".NotFound") }},
+	{"service", func(c string) bool {
+		return c == "InternalError" || c == "ServiceUnavailable" || c == "Unavailable" || c == "RequestCanceled"
+	}},
+}
+
+// errorCategory returns the category of an AWS error code, other when it
+// falls in none
+func errorCategory(code string) string {
+	for _, c := range errorCategories {
+		if c.match(code) {
+			return c.name
+		}
+	}
+	return "other"
+}
+
+// errorCodes counts the AWS error codes seen since startup
+type errorCodes struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newErrorCodes() *errorCodes {
+	return &errorCodes{counts: make(map[string]int)}
+}
+
+func (c *errorCodes) add(code string) {
+	if code == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[code]++
+}
+
+// byCode returns a copy of the counts of each code
+func (c *errorCodes) byCode() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]int)
+	for code, n := range c.counts {
+		counts[code] = n
+	}
+	return counts
+}
+
+// byCategory returns the counts summed by category
+func (c *errorCodes) byCategory() map[string]int {
+	counts := make(map[string]int)
+	for code, n := range c.byCode() {
+		counts[errorCategory(code)] += n
+	}
+	return counts
+}
+
+// write renders the counters in the OpenMetrics text format
+func (c *errorCodes) write(w io.Writer) {
+	counts := c.byCode()
+
+	name := "network_aws_errors"
+	fmt.Fprintln(w, "# TYPE "+name+" counter")
+	fmt.Fprintln(w, "# HELP "+name+" AWS API errors seen by the connector, by error code.")
+
+	var codes []string
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		fmt.Fprintln(w, name+`_total{code="`+labelValue(code)+`",category="`+errorCategory(code)+`"} `+strconv.Itoa(counts[code]))
+	}
+}
+
+// awsErrorHandler counts the error code of the AWS calls made by the
+// connector's own clients which failed, once the SDK gave up retrying
+func awsErrorHandler(req *awsrequest.Request) {
+	if aerr, ok := req.Error.(awserr.Error); ok {
+		awsErrors.add(aerr.Code())
+	}
+}
@@ -0,0 +1,72 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestErrorCodes(t *testing.T) {
+	Convey("Given the AWS errors seen by the connector", t, func() {
+		c := newErrorCodes()
+		c.add("RequestLimitExceeded")
+		c.add("RequestLimitExceeded")
+		c.add("UnauthorizedOperation")
+		c.add("DependencyViolation")
+		c.add("InvalidSubnetID.NotFound")
+		c.add("")
+
+		Convey("It should count them by code", func() {
+			So(c.byCode(), ShouldResemble, map[string]int{
+				"RequestLimitExceeded":     2,
+				"UnauthorizedOperation":    1,
+				"DependencyViolation":      1,
+				"InvalidSubnetID.NotFound": 1,
+			})
+		})
+
+		Convey("It should sum them by category", func() {
+			So(c.byCategory(), ShouldResemble, map[string]int{
+				"throttling": 2,
+				"auth":       1,
+				"dependency": 1,
+				"not_found":  1,
+			})
+		})
+
+		Convey("When they are rendered", func() {
+			var out bytes.Buffer
+			c.write(&out)
+
+			Convey("It should expose a counter per code", func() {
+				So(out.String(), ShouldContainSubstring, `network_aws_errors_total{code="RequestLimitExceeded",category="throttling"} 2`)
+				So(out.String(), ShouldContainSubstring, `network_aws_errors_total{code="DependencyViolation",category="dependency"} 1`)
+			})
+		})
+	})
+
+	Convey("Given error codes of account limits", t, func() {
+		Convey("It should tell them apart from throttling", func() {
+			So(errorCategory("VpcLimitExceeded"), ShouldEqual, "limit")
+			So(errorCategory("InsufficientFreeAddressesInSubnet"), ShouldEqual, "limit")
+			So(errorCategory("Throttling"), ShouldEqual, "throttling")
+			So(errorCategory("InvalidParameterValue"), ShouldEqual, "other")
+		})
+	})
+
+	Convey("Given an AWS call failing once the SDK gave up", t, func() {
+		before := awsErrors.byCode()["AuthFailure"]
+		awsErrorHandler(&awsrequest.Request{Error: awserr.New("AuthFailure", "AWS was not able to validate the provided access credentials", nil)})
+
+		Convey("It should count its error code", func() {
+			So(awsErrors.byCode()["AuthFailure"], ShouldEqual, before+1)
+		})
+	})
+}
@@ -0,0 +1,68 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+)
+
+const (
+	errTimeout   = "timeout"
+	errPolicy    = "policy"
+	errStale     = "stale"
+	errConflict  = "conflict"
+	errMismatch  = "mismatch"
+	errNotFound  = "not_found"
+	errPayload   = "invalid_payload"
+	errInUse     = "in_use"
+	errRange     = "out_of_range"
+	errRecreate  = "requires_recreation"
+	errAmbiguous = "ambiguous"
+
+	errCapability = "capability_missing"
+	errInternal   = "internal"
+	errFreeze     = "freeze"
+	errBudget     = "budget_exceeded"
+	errZoneClosed = "zone_unavailable"
+)
+
+// connectorError is an error raised by the connector itself, its code lets
+// consumers classify the failure
+type connectorError struct {
+	code  string
+	field string
+	msg   string
+}
+
+func (e *connectorError) Error() string {
+	return e.msg
+}
+
+func newError(code, msg string) error {
+	return &connectorError{code: code, msg: msg}
+}
+
+// newFieldError raises an error caused by the value of an event field,
+// named in the response
+func newFieldError(code, field, msg string) error {
+	return &connectorError{code: code, field: field, msg: msg}
+}
+
+// errorResponse builds an error payload from the original event body
+func errorResponse(data []byte, err error) []byte {
+	body := make(map[string]interface{})
+	json.Unmarshal(data, &body)
+
+	body["error"] = err.Error()
+	if ce, ok := err.(*connectorError); ok {
+		body["error_code"] = ce.code
+		if ce.field != "" {
+			body["error_field"] = ce.field
+		}
+	}
+
+	resp, _ := json.Marshal(body)
+	return resp
+}
@@ -0,0 +1,80 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+const providerFake = "aws-fake"
+
+// fakeBackend is an in-memory stand-in for AWS, used for events of the
+// aws-fake provider type ernest test environments send. It handles them
+// in place of ernestaws, keeping their networks in the in-memory EC2 the
+// connector's own clients use for those events.
+type fakeBackend struct {
+	mu       sync.Mutex
+	networks map[string]map[string]interface{}
+	aws      *fakeEC2
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{networks: make(map[string]map[string]interface{}), aws: newFakeEC2()}
+}
+
+func (f *fakeBackend) handle(subject string, data []byte) (string, []byte) {
+	if err := validate(subject, data); err != nil {
+		return subject + ".error", errorResponse(data, err)
+	}
+
+	body := make(map[string]interface{})
+	json.Unmarshal(data, &body)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch verb(subject) {
+	case "create":
+		r := parseRequest(data)
+		subnet := f.aws.createSubnet(r.DatacenterRegion, r.VPCID, r.Subnet, r.AvailabilityZone, r.IsPublic)
+		body["network_aws_id"] = aws.StringValue(subnet.SubnetId)
+		body["availability_zone"] = aws.StringValue(subnet.AvailabilityZone)
+		body["availability_zone_id"] = aws.StringValue(subnet.AvailabilityZoneId)
+		f.networks[body["network_aws_id"].(string)] = body
+	case "update":
+		id, _ := body["network_aws_id"].(string)
+		stored, ok := f.networks[id]
+		if !ok {
+			return subject + ".error", errorResponse(data, errors.New("Network "+id+" not found"))
+		}
+		body["availability_zone"] = stored["availability_zone"]
+		body["availability_zone_id"] = stored["availability_zone_id"]
+		f.networks[id] = body
+	case "delete":
+		id, _ := body["network_aws_id"].(string)
+		if err := f.aws.deleteSubnet(id); err != nil && !gone(err) {
+			return subject + ".error", errorResponse(data, err)
+		}
+		delete(f.networks, id)
+	default:
+		return subject + ".error", errorResponse(data, errors.New(verb(subject)+" is not supported"))
+	}
+
+	resp, _ := json.Marshal(body)
+	return subject + ".done", resp
+}
+
+// fakeID generates an id shaped like the ones AWS returns
+func fakeID(prefix string) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return prefix + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,73 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	network "github.com/ernestio/ernestaws/network"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFakeBackend(t *testing.T) {
+	Convey("Given a fake backend", t, func() {
+		f := newFakeBackend()
+		fakeEvent := testEvent
+		fakeEvent.ProviderType = providerFake
+		fakeEvent.NetworkAWSID = ""
+
+		Convey("When creating a network", func() {
+			data, _ := json.Marshal(fakeEvent)
+			subject, resp := f.handle("network.create.aws", data)
+
+			var created network.Event
+			json.Unmarshal(resp, &created)
+
+			Convey("It should return a generated network id", func() {
+				So(subject, ShouldEqual, "network.create.aws.done")
+				So(created.NetworkAWSID, ShouldStartWith, "subnet-")
+				So(created.NetworkAWSID, ShouldHaveLength, 15)
+				So(created.AvailabilityZone, ShouldEqual, "eu-west-1a")
+			})
+
+			Convey("And updating it without an availability zone", func() {
+				created.AvailabilityZone = ""
+				data, _ := json.Marshal(created)
+				subject, resp := f.handle("network.update.aws", data)
+
+				var updated map[string]interface{}
+				json.Unmarshal(resp, &updated)
+
+				Convey("It should keep the zone it was created in", func() {
+					So(subject, ShouldEqual, "network.update.aws.done")
+					So(updated["availability_zone"], ShouldEqual, "eu-west-1a")
+					So(updated["availability_zone_id"], ShouldEqual, "eu-west-1a-id")
+				})
+			})
+
+			Convey("And deleting it", func() {
+				data, _ := json.Marshal(created)
+				subject, _ := f.handle("network.delete.aws", data)
+
+				Convey("It should be removed", func() {
+					So(subject, ShouldEqual, "network.delete.aws.done")
+					So(f.networks, ShouldBeEmpty)
+				})
+			})
+		})
+
+		Convey("When creating an invalid network", func() {
+			fakeEvent.Subnet = ""
+			data, _ := json.Marshal(fakeEvent)
+			subject, resp := f.handle("network.create.aws", data)
+
+			Convey("It should error", func() {
+				So(subject, ShouldEqual, "network.create.aws.error")
+				So(string(resp), ShouldContainSubstring, "Network subnet invalid")
+			})
+		})
+	})
+}
@@ -0,0 +1,647 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// fakeEC2 is an in-memory EC2 backing the fake provider: the VPCs,
+// subnets, route tables and internet gateways of its networks, so every
+// connector step describing or changing them runs without AWS. VPCs are
+// made up, along with their main route table, the first time a network is
+// created in them. Flow logs, NAT gateways, endpoints, prefix lists and
+// interfaces are always empty.
+type fakeEC2 struct {
+	mu       sync.Mutex
+	vpcs     []*ec2.Vpc
+	subnets  []*ec2.Subnet
+	tables   []*ec2.RouteTable
+	gateways []*ec2.InternetGateway
+
+	// routing holds the route table made for each public network
+	routing map[string]string
+}
+
+func newFakeEC2() *fakeEC2 {
+	return &fakeEC2{routing: make(map[string]string)}
+}
+
+// createSubnet adds a network to the VPC, in its first zone unless one is
+// given, routing it through an internet gateway when it is public
+func (f *fakeEC2) createSubnet(region, vpc, cidr, zone string, public bool) *ec2.Subnet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.vpc(vpc, cidr)
+	if zone == "" {
+		zone = region + "a"
+	}
+
+	s := &ec2.Subnet{
+		SubnetId:           aws.String(fakeID("subnet")),
+		VpcId:              aws.String(vpc),
+		CidrBlock:          aws.String(cidr),
+		AvailabilityZone:   aws.String(zone),
+		AvailabilityZoneId: aws.String(zone + "-id"),
+		State:              aws.String("available"),
+	}
+	f.subnets = append(f.subnets, s)
+
+	if public {
+		id := aws.String(fakeID("rtb"))
+		f.tables = append(f.tables, &ec2.RouteTable{
+			RouteTableId: id,
+			VpcId:        s.VpcId,
+			Routes: []*ec2.Route{
+				{DestinationCidrBlock: f.vpc(vpc, cidr).CidrBlock, GatewayId: aws.String("local")},
+				{DestinationCidrBlock: aws.String("0.0.0.0/0"), GatewayId: f.gateway(vpc).InternetGatewayId},
+			},
+			Associations: []*ec2.RouteTableAssociation{{RouteTableAssociationId: aws.String(fakeID("rtbassoc")), RouteTableId: id, SubnetId: s.SubnetId}},
+		})
+		f.routing[aws.StringValue(s.SubnetId)] = aws.StringValue(id)
+	}
+
+	return s
+}
+
+// deleteSubnet removes a network along with the route table made for it,
+// as ernestaws does
+func (f *fakeEC2) deleteSubnet(id string) error {
+	if _, err := f.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: aws.String(id)}); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	table, ok := f.routing[id]
+	delete(f.routing, id)
+	f.mu.Unlock()
+
+	if ok {
+		_, err := f.DeleteRouteTable(&ec2.DeleteRouteTableInput{RouteTableId: aws.String(table)})
+		if err != nil && !gone(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// vpc returns the VPC, making it up as the /16 around the first range
+// created in it when it isn't known yet
+func (f *fakeEC2) vpc(id, cidr string) *ec2.Vpc {
+	for _, v := range f.vpcs {
+		if aws.StringValue(v.VpcId) == id {
+			return v
+		}
+	}
+
+	block := cidr
+	if _, n, err := net.ParseCIDR(cidr); err == nil && n.IP.To4() != nil {
+		block = (&net.IPNet{IP: n.IP.Mask(net.CIDRMask(16, 32)), Mask: net.CIDRMask(16, 32)}).String()
+	}
+
+	v := &ec2.Vpc{VpcId: aws.String(id), CidrBlock: aws.String(block), State: aws.String("available")}
+	f.vpcs = append(f.vpcs, v)
+
+	table := aws.String(fakeID("rtb"))
+	f.tables = append(f.tables, &ec2.RouteTable{
+		RouteTableId: table,
+		VpcId:        v.VpcId,
+		Routes:       []*ec2.Route{{DestinationCidrBlock: v.CidrBlock, GatewayId: aws.String("local")}},
+		Associations: []*ec2.RouteTableAssociation{{RouteTableAssociationId: aws.String(fakeID("rtbassoc")), RouteTableId: table, Main: aws.Bool(true)}},
+	})
+
+	return v
+}
+
+// gateway returns the internet gateway attached to the VPC, attaching a
+// new one when there is none
+func (f *fakeEC2) gateway(vpc string) *ec2.InternetGateway {
+	for _, g := range f.gateways {
+		for _, a := range g.Attachments {
+			if aws.StringValue(a.VpcId) == vpc {
+				return g
+			}
+		}
+	}
+
+	g := &ec2.InternetGateway{
+		InternetGatewayId: aws.String(fakeID("igw")),
+		Attachments:       []*ec2.InternetGatewayAttachment{{VpcId: aws.String(vpc), State: aws.String("available")}},
+	}
+	f.gateways = append(f.gateways, g)
+	return g
+}
+
+// fakeMatches reports whether a resource passes every filter, given the
+// values it has for each filter name and its tags
+func fakeMatches(filters []*ec2.Filter, tags []*ec2.Tag, values map[string][]string) bool {
+	for _, filter := range filters {
+		name := aws.StringValue(filter.Name)
+
+		have := values[name]
+		if strings.HasPrefix(name, "tag:") {
+			have = nil
+			for _, t := range tags {
+				if aws.StringValue(t.Key) == strings.TrimPrefix(name, "tag:") {
+					have = append(have, aws.StringValue(t.Value))
+				}
+			}
+		}
+
+		var found bool
+		for _, v := range aws.StringValueSlice(filter.Values) {
+			found = found || contains(have, v)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// listed reports whether the id was asked for, when ids were given
+func listed(ids []*string, id *string) bool {
+	return len(ids) == 0 || contains(aws.StringValueSlice(ids), aws.StringValue(id))
+}
+
+func (f *fakeEC2) subnet(id string) *ec2.Subnet {
+	for _, s := range f.subnets {
+		if aws.StringValue(s.SubnetId) == id {
+			return s
+		}
+	}
+	return nil
+}
+
+func (f *fakeEC2) table(id string) *ec2.RouteTable {
+	for _, t := range f.tables {
+		if aws.StringValue(t.RouteTableId) == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func (f *fakeEC2) DescribeVpcs(in *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &ec2.DescribeVpcsOutput{}
+	for _, v := range f.vpcs {
+		if listed(in.VpcIds, v.VpcId) && fakeMatches(in.Filters, v.Tags, map[string][]string{"vpc-id": {aws.StringValue(v.VpcId)}}) {
+			out.Vpcs = append(out.Vpcs, v)
+		}
+	}
+	if len(in.VpcIds) > 0 && len(out.Vpcs) == 0 {
+		return nil, awserr.New("InvalidVpcID.NotFound", "The vpc ID does not exist", nil)
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeSubnets(in *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &ec2.DescribeSubnetsOutput{}
+	for _, s := range f.subnets {
+		values := map[string][]string{
+			"subnet-id":         {aws.StringValue(s.SubnetId)},
+			"vpc-id":            {aws.StringValue(s.VpcId)},
+			"cidr-block":        {aws.StringValue(s.CidrBlock)},
+			"availability-zone": {aws.StringValue(s.AvailabilityZone)},
+		}
+		if listed(in.SubnetIds, s.SubnetId) && fakeMatches(in.Filters, s.Tags, values) {
+			out.Subnets = append(out.Subnets, s)
+		}
+	}
+	if len(in.SubnetIds) > 0 && len(out.Subnets) == 0 {
+		return nil, awserr.New("InvalidSubnetID.NotFound", "The subnet ID does not exist", nil)
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeRouteTables(in *ec2.DescribeRouteTablesInput) (*ec2.DescribeRouteTablesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &ec2.DescribeRouteTablesOutput{}
+	for _, t := range f.tables {
+		values := map[string][]string{
+			"route-table-id": {aws.StringValue(t.RouteTableId)},
+			"vpc-id":         {aws.StringValue(t.VpcId)},
+		}
+		for _, a := range t.Associations {
+			values["association.subnet-id"] = append(values["association.subnet-id"], aws.StringValue(a.SubnetId))
+			if aws.BoolValue(a.Main) {
+				values["association.main"] = []string{"true"}
+			}
+		}
+		if listed(in.RouteTableIds, t.RouteTableId) && fakeMatches(in.Filters, t.Tags, values) {
+			out.RouteTables = append(out.RouteTables, t)
+		}
+	}
+	if len(in.RouteTableIds) > 0 && len(out.RouteTables) == 0 {
+		return nil, awserr.New("InvalidRouteTableID.NotFound", "The routeTable ID does not exist", nil)
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeInternetGateways(in *ec2.DescribeInternetGatewaysInput) (*ec2.DescribeInternetGatewaysOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &ec2.DescribeInternetGatewaysOutput{}
+	for _, g := range f.gateways {
+		values := map[string][]string{"internet-gateway-id": {aws.StringValue(g.InternetGatewayId)}}
+		for _, a := range g.Attachments {
+			values["attachment.vpc-id"] = append(values["attachment.vpc-id"], aws.StringValue(a.VpcId))
+		}
+		if listed(in.InternetGatewayIds, g.InternetGatewayId) && fakeMatches(in.Filters, g.Tags, values) {
+			out.InternetGateways = append(out.InternetGateways, g)
+		}
+	}
+	if len(in.InternetGatewayIds) > 0 && len(out.InternetGateways) == 0 {
+		return nil, awserr.New("InvalidInternetGatewayID.NotFound", "The internetGateway ID does not exist", nil)
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeAvailabilityZones(in *ec2.DescribeAvailabilityZonesInput) (*ec2.DescribeAvailabilityZonesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	zones := make(map[string]bool)
+	out := &ec2.DescribeAvailabilityZonesOutput{}
+	for _, s := range f.subnets {
+		zone := aws.StringValue(s.AvailabilityZone)
+		if !zones[zone] {
+			zones[zone] = true
+			out.AvailabilityZones = append(out.AvailabilityZones, &ec2.AvailabilityZone{
+				ZoneName: s.AvailabilityZone,
+				ZoneId:   s.AvailabilityZoneId,
+				State:    aws.String("available"),
+			})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeNetworkInterfaces(in *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	return &ec2.DescribeNetworkInterfacesOutput{}, nil
+}
+
+func (f *fakeEC2) DescribeNatGateways(in *ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error) {
+	return &ec2.DescribeNatGatewaysOutput{}, nil
+}
+
+func (f *fakeEC2) DescribeFlowLogs(in *ec2.DescribeFlowLogsInput) (*ec2.DescribeFlowLogsOutput, error) {
+	return &ec2.DescribeFlowLogsOutput{}, nil
+}
+
+func (f *fakeEC2) DescribeVpcEndpoints(in *ec2.DescribeVpcEndpointsInput) (*ec2.DescribeVpcEndpointsOutput, error) {
+	return &ec2.DescribeVpcEndpointsOutput{}, nil
+}
+
+func (f *fakeEC2) DescribeManagedPrefixLists(in *ec2.DescribeManagedPrefixListsInput) (*ec2.DescribeManagedPrefixListsOutput, error) {
+	return &ec2.DescribeManagedPrefixListsOutput{}, nil
+}
+
+func (f *fakeEC2) DeleteFlowLogs(in *ec2.DeleteFlowLogsInput) (*ec2.DeleteFlowLogsOutput, error) {
+	return &ec2.DeleteFlowLogsOutput{}, nil
+}
+
+func (f *fakeEC2) DeleteNatGateway(in *ec2.DeleteNatGatewayInput) (*ec2.DeleteNatGatewayOutput, error) {
+	return nil, awserr.New("NatGatewayNotFound", "The NAT gateway does not exist", nil)
+}
+
+func (f *fakeEC2) DeleteVpcEndpoints(in *ec2.DeleteVpcEndpointsInput) (*ec2.DeleteVpcEndpointsOutput, error) {
+	return &ec2.DeleteVpcEndpointsOutput{}, nil
+}
+
+func (f *fakeEC2) ModifyManagedPrefixList(in *ec2.ModifyManagedPrefixListInput) (*ec2.ModifyManagedPrefixListOutput, error) {
+	return nil, awserr.New("InvalidPrefixListID.NotFound", "The prefix list does not exist", nil)
+}
+
+func (f *fakeEC2) CreateTags(in *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, id := range aws.StringValueSlice(in.Resources) {
+		tags := f.tags(id)
+		if tags == nil {
+			continue
+		}
+		for _, t := range in.Tags {
+			*tags = setTag(*tags, aws.StringValue(t.Key), aws.StringValue(t.Value))
+		}
+	}
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+// tags returns the tags of the resource with the id
+func (f *fakeEC2) tags(id string) *[]*ec2.Tag {
+	for _, v := range f.vpcs {
+		if aws.StringValue(v.VpcId) == id {
+			return &v.Tags
+		}
+	}
+	for _, s := range f.subnets {
+		if aws.StringValue(s.SubnetId) == id {
+			return &s.Tags
+		}
+	}
+	for _, t := range f.tables {
+		if aws.StringValue(t.RouteTableId) == id {
+			return &t.Tags
+		}
+	}
+	for _, g := range f.gateways {
+		if aws.StringValue(g.InternetGatewayId) == id {
+			return &g.Tags
+		}
+	}
+	return nil
+}
+
+func setTag(tags []*ec2.Tag, key, value string) []*ec2.Tag {
+	for _, t := range tags {
+		if aws.StringValue(t.Key) == key {
+			t.Value = aws.String(value)
+			return tags
+		}
+	}
+	return append(tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+}
+
+func (f *fakeEC2) ModifySubnetAttribute(in *ec2.ModifySubnetAttributeInput) (*ec2.ModifySubnetAttributeOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.subnet(aws.StringValue(in.SubnetId))
+	if s == nil {
+		return nil, awserr.New("InvalidSubnetID.NotFound", "The subnet ID does not exist", nil)
+	}
+	if in.MapPublicIpOnLaunch != nil {
+		s.MapPublicIpOnLaunch = in.MapPublicIpOnLaunch.Value
+	}
+	if in.AssignIpv6AddressOnCreation != nil {
+		s.AssignIpv6AddressOnCreation = in.AssignIpv6AddressOnCreation.Value
+	}
+	return &ec2.ModifySubnetAttributeOutput{}, nil
+}
+
+func (f *fakeEC2) AssociateSubnetCidrBlock(in *ec2.AssociateSubnetCidrBlockInput) (*ec2.AssociateSubnetCidrBlockOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.subnet(aws.StringValue(in.SubnetId))
+	if s == nil {
+		return nil, awserr.New("InvalidSubnetID.NotFound", "The subnet ID does not exist", nil)
+	}
+
+	block := &ec2.SubnetIpv6CidrBlockAssociation{
+		AssociationId:      aws.String(fakeID("subnet-cidr-assoc")),
+		Ipv6CidrBlock:      in.Ipv6CidrBlock,
+		Ipv6CidrBlockState: &ec2.SubnetCidrBlockState{State: aws.String("associated")},
+	}
+	s.Ipv6CidrBlockAssociationSet = append(s.Ipv6CidrBlockAssociationSet, block)
+	return &ec2.AssociateSubnetCidrBlockOutput{Ipv6CidrBlockAssociation: block, SubnetId: s.SubnetId}, nil
+}
+
+func (f *fakeEC2) DisassociateSubnetCidrBlock(in *ec2.DisassociateSubnetCidrBlockInput) (*ec2.DisassociateSubnetCidrBlockOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, s := range f.subnets {
+		for i, b := range s.Ipv6CidrBlockAssociationSet {
+			if aws.StringValue(b.AssociationId) == aws.StringValue(in.AssociationId) {
+				s.Ipv6CidrBlockAssociationSet = append(s.Ipv6CidrBlockAssociationSet[:i], s.Ipv6CidrBlockAssociationSet[i+1:]...)
+				return &ec2.DisassociateSubnetCidrBlockOutput{Ipv6CidrBlockAssociation: b, SubnetId: s.SubnetId}, nil
+			}
+		}
+	}
+	return nil, awserr.New("InvalidSubnetCidrBlockAssociationID.NotFound", "The association does not exist", nil)
+}
+
+func (f *fakeEC2) DeleteSubnet(in *ec2.DeleteSubnetInput) (*ec2.DeleteSubnetOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, s := range f.subnets {
+		if aws.StringValue(s.SubnetId) != aws.StringValue(in.SubnetId) {
+			continue
+		}
+		f.subnets = append(f.subnets[:i], f.subnets[i+1:]...)
+		for _, t := range f.tables {
+			var kept []*ec2.RouteTableAssociation
+			for _, a := range t.Associations {
+				if aws.StringValue(a.SubnetId) != aws.StringValue(in.SubnetId) {
+					kept = append(kept, a)
+				}
+			}
+			t.Associations = kept
+		}
+		return &ec2.DeleteSubnetOutput{}, nil
+	}
+	return nil, awserr.New("InvalidSubnetID.NotFound", "The subnet ID does not exist", nil)
+}
+
+func (f *fakeEC2) CreateRouteTable(in *ec2.CreateRouteTableInput) (*ec2.CreateRouteTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	vpc := f.vpc(aws.StringValue(in.VpcId), "")
+	t := &ec2.RouteTable{
+		RouteTableId: aws.String(fakeID("rtb")),
+		VpcId:        vpc.VpcId,
+		Routes:       []*ec2.Route{{DestinationCidrBlock: vpc.CidrBlock, GatewayId: aws.String("local")}},
+	}
+	f.tables = append(f.tables, t)
+	return &ec2.CreateRouteTableOutput{RouteTable: t}, nil
+}
+
+func (f *fakeEC2) AssociateRouteTable(in *ec2.AssociateRouteTableInput) (*ec2.AssociateRouteTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := f.table(aws.StringValue(in.RouteTableId))
+	if t == nil {
+		return nil, awserr.New("InvalidRouteTableID.NotFound", "The routeTable ID does not exist", nil)
+	}
+	if f.subnet(aws.StringValue(in.SubnetId)) == nil {
+		return nil, awserr.New("InvalidSubnetID.NotFound", "The subnet ID does not exist", nil)
+	}
+
+	a := &ec2.RouteTableAssociation{RouteTableAssociationId: aws.String(fakeID("rtbassoc")), RouteTableId: t.RouteTableId, SubnetId: in.SubnetId}
+	t.Associations = append(t.Associations, a)
+	return &ec2.AssociateRouteTableOutput{AssociationId: a.RouteTableAssociationId}, nil
+}
+
+func (f *fakeEC2) DisassociateRouteTable(in *ec2.DisassociateRouteTableInput) (*ec2.DisassociateRouteTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, t := range f.tables {
+		for i, a := range t.Associations {
+			if aws.StringValue(a.RouteTableAssociationId) == aws.StringValue(in.AssociationId) {
+				t.Associations = append(t.Associations[:i], t.Associations[i+1:]...)
+				return &ec2.DisassociateRouteTableOutput{}, nil
+			}
+		}
+	}
+	return nil, awserr.New("InvalidAssociationID.NotFound", "The association ID does not exist", nil)
+}
+
+func (f *fakeEC2) DeleteRouteTable(in *ec2.DeleteRouteTableInput) (*ec2.DeleteRouteTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, t := range f.tables {
+		if aws.StringValue(t.RouteTableId) != aws.StringValue(in.RouteTableId) {
+			continue
+		}
+		if len(t.Associations) > 0 {
+			return nil, awserr.New("DependencyViolation", "The routeTable has dependencies and cannot be deleted.", nil)
+		}
+		f.tables = append(f.tables[:i], f.tables[i+1:]...)
+		return &ec2.DeleteRouteTableOutput{}, nil
+	}
+	return nil, awserr.New("InvalidRouteTableID.NotFound", "The routeTable ID does not exist", nil)
+}
+
+func (f *fakeEC2) CreateRoute(in *ec2.CreateRouteInput) (*ec2.CreateRouteOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := f.table(aws.StringValue(in.RouteTableId))
+	if t == nil {
+		return nil, awserr.New("InvalidRouteTableID.NotFound", "The routeTable ID does not exist", nil)
+	}
+
+	rt := &ec2.Route{
+		DestinationCidrBlock:        in.DestinationCidrBlock,
+		DestinationIpv6CidrBlock:    in.DestinationIpv6CidrBlock,
+		DestinationPrefixListId:     in.DestinationPrefixListId,
+		GatewayId:                   in.GatewayId,
+		NatGatewayId:                in.NatGatewayId,
+		InstanceId:                  in.InstanceId,
+		NetworkInterfaceId:          in.NetworkInterfaceId,
+		VpcPeeringConnectionId:      in.VpcPeeringConnectionId,
+		TransitGatewayId:            in.TransitGatewayId,
+		EgressOnlyInternetGatewayId: in.EgressOnlyInternetGatewayId,
+		State:                       aws.String("active"),
+	}
+	if fakeRoute(t, routeDestination(rt)) >= 0 {
+		return nil, awserr.New("RouteAlreadyExists", "The route identified by "+routeDestination(rt)+" already exists.", nil)
+	}
+	t.Routes = append(t.Routes, rt)
+	return &ec2.CreateRouteOutput{Return: aws.Bool(true)}, nil
+}
+
+func (f *fakeEC2) ReplaceRoute(in *ec2.ReplaceRouteInput) (*ec2.ReplaceRouteOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := f.table(aws.StringValue(in.RouteTableId))
+	if t == nil {
+		return nil, awserr.New("InvalidRouteTableID.NotFound", "The routeTable ID does not exist", nil)
+	}
+
+	rt := &ec2.Route{
+		DestinationCidrBlock:        in.DestinationCidrBlock,
+		DestinationIpv6CidrBlock:    in.DestinationIpv6CidrBlock,
+		DestinationPrefixListId:     in.DestinationPrefixListId,
+		GatewayId:                   in.GatewayId,
+		NatGatewayId:                in.NatGatewayId,
+		InstanceId:                  in.InstanceId,
+		NetworkInterfaceId:          in.NetworkInterfaceId,
+		VpcPeeringConnectionId:      in.VpcPeeringConnectionId,
+		TransitGatewayId:            in.TransitGatewayId,
+		EgressOnlyInternetGatewayId: in.EgressOnlyInternetGatewayId,
+		State:                       aws.String("active"),
+	}
+	i := fakeRoute(t, routeDestination(rt))
+	if i < 0 {
+		return nil, awserr.New("InvalidRoute.NotFound", "no route with destination-cidr-block "+routeDestination(rt)+" in route table "+aws.StringValue(in.RouteTableId), nil)
+	}
+	t.Routes[i] = rt
+	return &ec2.ReplaceRouteOutput{}, nil
+}
+
+func (f *fakeEC2) DeleteRoute(in *ec2.DeleteRouteInput) (*ec2.DeleteRouteOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := f.table(aws.StringValue(in.RouteTableId))
+	if t == nil {
+		return nil, awserr.New("InvalidRouteTableID.NotFound", "The routeTable ID does not exist", nil)
+	}
+
+	destination := routeDestination(&ec2.Route{
+		DestinationCidrBlock:     in.DestinationCidrBlock,
+		DestinationIpv6CidrBlock: in.DestinationIpv6CidrBlock,
+		DestinationPrefixListId:  in.DestinationPrefixListId,
+	})
+	i := fakeRoute(t, destination)
+	if i < 0 {
+		return nil, awserr.New("InvalidRoute.NotFound", "no route with destination "+destination+" in route table "+aws.StringValue(in.RouteTableId), nil)
+	}
+	t.Routes = append(t.Routes[:i], t.Routes[i+1:]...)
+	return &ec2.DeleteRouteOutput{}, nil
+}
+
+// fakeRoute returns the index of the route to the destination in the
+// table, or -1
+func fakeRoute(t *ec2.RouteTable, destination string) int {
+	for i, rt := range t.Routes {
+		if routeDestination(rt) == destination {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *fakeEC2) DetachInternetGateway(in *ec2.DetachInternetGatewayInput) (*ec2.DetachInternetGatewayOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, g := range f.gateways {
+		if aws.StringValue(g.InternetGatewayId) != aws.StringValue(in.InternetGatewayId) {
+			continue
+		}
+		for i, a := range g.Attachments {
+			if aws.StringValue(a.VpcId) == aws.StringValue(in.VpcId) {
+				g.Attachments = append(g.Attachments[:i], g.Attachments[i+1:]...)
+				return &ec2.DetachInternetGatewayOutput{}, nil
+			}
+		}
+		return nil, awserr.New("Gateway.NotAttached", "resource "+aws.StringValue(in.InternetGatewayId)+" is not attached to network "+aws.StringValue(in.VpcId), nil)
+	}
+	return nil, awserr.New("InvalidInternetGatewayID.NotFound", "The internetGateway ID does not exist", nil)
+}
+
+func (f *fakeEC2) DeleteInternetGateway(in *ec2.DeleteInternetGatewayInput) (*ec2.DeleteInternetGatewayOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, g := range f.gateways {
+		if aws.StringValue(g.InternetGatewayId) != aws.StringValue(in.InternetGatewayId) {
+			continue
+		}
+		if len(g.Attachments) > 0 {
+			return nil, awserr.New("DependencyViolation", "The internetGateway has dependencies and cannot be deleted.", nil)
+		}
+		f.gateways = append(f.gateways[:i], f.gateways[i+1:]...)
+		return &ec2.DeleteInternetGatewayOutput{}, nil
+	}
+	return nil, awserr.New("InvalidInternetGatewayID.NotFound", "The internetGateway ID does not exist", nil)
+}
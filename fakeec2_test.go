@@ -0,0 +1,112 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFakeEC2(t *testing.T) {
+	Convey("Given a fake backend", t, func() {
+		f := newFakeBackend()
+		fakeEvent := testEvent
+		fakeEvent.ProviderType = providerFake
+		fakeEvent.NetworkAWSID = ""
+		fakeEvent.Subnet = "10.0.1.0/24"
+		data, _ := json.Marshal(fakeEvent)
+
+		Convey("When a public network is created", func() {
+			_, resp := f.handle("network.create.aws", setField(data, "is_public", true))
+			id := parseRequest(resp).NetworkAWSID
+
+			Convey("It should be described like a network in AWS", func() {
+				subnet, err := describeSubnet(f.aws, id)
+				So(err, ShouldBeNil)
+				So(aws.StringValue(subnet.CidrBlock), ShouldEqual, "10.0.1.0/24")
+				So(aws.StringValue(subnet.VpcId), ShouldEqual, "vpc-0000000")
+
+				networks, err := lookupNetworks(f.aws, request{VPCID: "vpc-0000000", Subnet: "10.0.1.0/24"})
+				So(err, ShouldBeNil)
+				So(networks, ShouldHaveLength, 1)
+			})
+
+			Convey("It should route it through an internet gateway of its VPC", func() {
+				tables, gateways, err := vpcRouting(f.aws, "vpc-0000000")
+				So(err, ShouldBeNil)
+				So(tables, ShouldHaveLength, 2)
+				So(gateways, ShouldHaveLength, 1)
+
+				subnets, _ := f.aws.DescribeSubnets(&ec2.DescribeSubnetsInput{})
+				So(routedThrough(aws.StringValue(gateways[0].InternetGatewayId), "vpc-0000000", subnets.Subnets, tables), ShouldBeTrue)
+			})
+
+			Convey("It should refuse to remove routing still in use", func() {
+				_, gateways, _ := vpcRouting(f.aws, "vpc-0000000")
+				_, err := f.aws.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{InternetGatewayId: gateways[0].InternetGatewayId})
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "DependencyViolation")
+			})
+
+			Convey("And deleted", func() {
+				subject, _ := f.handle("network.delete.aws", resp)
+
+				Convey("It should remove it along with its route table", func() {
+					So(subject, ShouldEqual, "network.delete.aws.done")
+					subnet, err := describeSubnet(f.aws, id)
+					So(err, ShouldBeNil)
+					So(subnet, ShouldBeNil)
+
+					tables, _, _ := vpcRouting(f.aws, "vpc-0000000")
+					So(tables, ShouldHaveLength, 1)
+					So(aws.BoolValue(tables[0].Associations[0].Main), ShouldBeTrue)
+				})
+			})
+		})
+
+		Convey("When the connector tags and routes what was created", func() {
+			_, resp := f.handle("network.create.aws", data)
+			id := parseRequest(resp).NetworkAWSID
+
+			table, _ := f.aws.CreateRouteTable(&ec2.CreateRouteTableInput{VpcId: aws.String("vpc-0000000")})
+			f.aws.AssociateRouteTable(&ec2.AssociateRouteTableInput{RouteTableId: table.RouteTable.RouteTableId, SubnetId: aws.String(id)})
+			f.aws.CreateRoute(&ec2.CreateRouteInput{RouteTableId: table.RouteTable.RouteTableId, DestinationCidrBlock: aws.String("10.1.0.0/16"), VpcPeeringConnectionId: aws.String("pcx-00000000")})
+			f.aws.CreateTags(&ec2.CreateTagsInput{Resources: []*string{table.RouteTable.RouteTableId}, Tags: []*ec2.Tag{{Key: aws.String(teardownTag), Value: aws.String(id)}}})
+
+			Convey("It should find them by their tags and associations", func() {
+				marked, err := f.aws.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: []*ec2.Filter{
+					{Name: aws.String("tag:" + teardownTag), Values: []*string{aws.String(id)}},
+				}})
+				So(err, ShouldBeNil)
+				So(marked.RouteTables, ShouldHaveLength, 1)
+				So(marked.RouteTables[0].Routes, ShouldHaveLength, 2)
+
+				associated, _ := f.aws.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: []*ec2.Filter{
+					{Name: aws.String("association.subnet-id"), Values: []*string{aws.String(id)}},
+				}})
+				So(associated.RouteTables, ShouldHaveLength, 1)
+			})
+
+			Convey("It should refuse a route it already has", func() {
+				_, err := f.aws.CreateRoute(&ec2.CreateRouteInput{RouteTableId: table.RouteTable.RouteTableId, DestinationCidrBlock: aws.String("10.1.0.0/16")})
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When something missing is described by id", func() {
+			_, subnets := f.aws.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: []*string{aws.String("subnet-11111111")}})
+			_, tables := f.aws.DescribeRouteTables(&ec2.DescribeRouteTablesInput{RouteTableIds: []*string{aws.String("rtb-11111111")}})
+
+			Convey("It should fail like AWS does", func() {
+				So(gone(subnets), ShouldBeTrue)
+				So(gone(tables), ShouldBeTrue)
+			})
+		})
+	})
+}
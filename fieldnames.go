@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import "encoding/json"
+
+const (
+	schemaLegacy  = "1"
+	schemaGeneric = "2"
+)
+
+// genericFields maps the field names of the generic schema of newer ernest
+// releases to the ones of this connector
+var genericFields = map[string]string{
+	"aws_access_key_id":     "datacenter_secret",
+	"aws_secret_access_key": "datacenter_token",
+	"cidr":                  "range",
+}
+
+// schemaVersion returns the schema an event is written in, its _version
+// or, when it has none, the generic one if it uses any of its field names
+func schemaVersion(body map[string]interface{}) string {
+	if v, _ := body["_version"].(string); v == schemaLegacy || v == schemaGeneric {
+		return v
+	}
+
+	for f := range genericFields {
+		if _, ok := body[f]; ok {
+			return schemaGeneric
+		}
+	}
+	return schemaLegacy
+}
+
+// fromGenericFields returns the event with the generic field names
+// renamed to the ones of this connector, and the schema it was written in
+func fromGenericFields(data []byte) ([]byte, string) {
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(data, &body); err != nil {
+		return data, schemaLegacy
+	}
+
+	version := schemaVersion(body)
+	if version != schemaGeneric {
+		return data, version
+	}
+
+	return renameFields(data, body, genericFields), version
+}
+
+// toGenericFields returns a response with the field names of this
+// connector renamed to the generic ones
+func toGenericFields(data []byte) []byte {
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(data, &body); err != nil {
+		return data
+	}
+
+	names := make(map[string]string)
+	for generic, legacy := range genericFields {
+		names[legacy] = generic
+	}
+	return renameFields(data, body, names)
+}
+
+func renameFields(data []byte, body map[string]interface{}, names map[string]string) []byte {
+	for from, to := range names {
+		if v, ok := body[from]; ok {
+			delete(body, from)
+			body[to] = v
+		}
+	}
+
+	renamed, err := json.Marshal(body)
+	if err != nil {
+		return data
+	}
+	return renamed
+}
@@ -0,0 +1,61 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGenericFields(t *testing.T) {
+	Convey("Given an event using the generic field names", t, func() {
+		data := []byte(`{"aws_access_key_id":"key","aws_secret_access_key":"secret","cidr":"10.0.1.0/24","vpc_id":"vpc-00000000"}`)
+
+		Convey("When it is decoded", func() {
+			legacy, version := fromGenericFields(data)
+			r := parseRequest(legacy)
+
+			Convey("It should be detected as the generic schema", func() {
+				So(version, ShouldEqual, schemaGeneric)
+			})
+
+			Convey("It should fill the fields of this connector", func() {
+				So(r.DatacenterAccessKey, ShouldEqual, "key")
+				So(r.DatacenterAccessToken, ShouldEqual, "secret")
+				So(r.Subnet, ShouldEqual, "10.0.1.0/24")
+				So(r.VPCID, ShouldEqual, "vpc-00000000")
+			})
+
+			Convey("It should answer with the generic names again", func() {
+				body := make(map[string]interface{})
+				json.Unmarshal(toGenericFields(legacy), &body)
+				So(body["cidr"], ShouldEqual, "10.0.1.0/24")
+				So(body, ShouldNotContainKey, "range")
+			})
+		})
+	})
+
+	Convey("Given an event using the connector field names", t, func() {
+		data := []byte(`{"datacenter_secret":"key","range":"10.0.1.0/24"}`)
+
+		Convey("It should be left as is", func() {
+			legacy, version := fromGenericFields(data)
+			So(version, ShouldEqual, schemaLegacy)
+			So(string(legacy), ShouldEqual, string(data))
+		})
+	})
+
+	Convey("Given an event pinned to the legacy schema with a cidr field", t, func() {
+		data := []byte(`{"_version":"1","cidr":"10.0.1.0/24","range":"10.0.2.0/24"}`)
+
+		Convey("It should not rename its fields", func() {
+			legacy, version := fromGenericFields(data)
+			So(version, ShouldEqual, schemaLegacy)
+			So(parseRequest(legacy).Subnet, ShouldEqual, "10.0.2.0/24")
+		})
+	})
+}
@@ -0,0 +1,229 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+const (
+	freezeReject = "reject"
+	freezePark   = "park"
+)
+
+// freezeWindow is a change freeze: mutating events of the tenant in the
+// region are held for duration from every time matching the schedule.
+// Tenant and region may be *.
+type freezeWindow struct {
+	Tenant   string
+	Region   string
+	Schedule cronSchedule
+	Duration time.Duration
+}
+
+// cronSchedule holds, for each of minute, hour, day of month, month and
+// day of week, the values it matches
+type cronSchedule [5]map[int]bool
+
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// parseCron parses a five field cron expression, each field being *, a
+// value, a range or a comma separated list of them, optionally stepped
+// with /n
+func parseCron(expr string) (cronSchedule, error) {
+	var s cronSchedule
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return s, errors.New("cron expression " + expr + " should have 5 fields")
+	}
+
+	for i, field := range fields {
+		s[i] = make(map[int]bool)
+		for _, part := range strings.Split(field, ",") {
+			lo, hi, step, err := cronPart(part, cronBounds[i])
+			if err != nil {
+				return s, errors.New("invalid cron field " + field + " in " + expr)
+			}
+			for v := lo; v <= hi; v += step {
+				s[i][v] = true
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func cronPart(part string, bounds [2]int) (int, int, int, error) {
+	step := 1
+	if i := strings.Index(part, "/"); i >= 0 {
+		n, err := strconv.Atoi(part[i+1:])
+		if err != nil || n <= 0 {
+			return 0, 0, 0, errors.New("invalid step")
+		}
+		step = n
+		part = part[:i]
+	}
+
+	lo, hi := bounds[0], bounds[1]
+	if part != "*" {
+		values := strings.SplitN(part, "-", 2)
+		var err error
+		if lo, err = strconv.Atoi(values[0]); err != nil {
+			return 0, 0, 0, err
+		}
+		hi = lo
+		if len(values) == 2 {
+			if hi, err = strconv.Atoi(values[1]); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+	}
+
+	if lo < bounds[0] || hi > bounds[1] || lo > hi {
+		return 0, 0, 0, errors.New("out of bounds")
+	}
+	return lo, hi, step, nil
+}
+
+func (s cronSchedule) matches(t time.Time) bool {
+	return s[0][t.Minute()] && s[1][t.Hour()] && s[2][t.Day()] && s[3][int(t.Month())] && s[4][int(t.Weekday())]
+}
+
+// end returns when the window holding now ends, if one does
+func (w freezeWindow) end(now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	start := now.Truncate(time.Minute)
+	for t := start; now.Sub(t) < w.Duration; t = t.Add(-time.Minute) {
+		if w.Schedule.matches(t) {
+			return t.Add(w.Duration), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w freezeWindow) applies(r request) bool {
+	return (w.Tenant == "*" || w.Tenant == r.tenant()) && (w.Region == "*" || w.Region == r.DatacenterRegion)
+}
+
+// frozenUntil returns when the last freeze window holding the event ends
+func frozenUntil(windows []freezeWindow, r request, now time.Time) (time.Time, bool) {
+	var until time.Time
+	for _, w := range windows {
+		if !w.applies(r) {
+			continue
+		}
+		if end, ok := w.end(now); ok && end.After(until) {
+			until = end
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// envFreezeWindows reads a semicolon separated list of freeze windows, each
+// as <tenant>/<region> <cron expression> <duration>
+func envFreezeWindows(name string) []freezeWindow {
+	var windows []freezeWindow
+	for _, v := range strings.Split(os.Getenv(name), ";") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		w, err := parseFreezeWindow(v)
+		if err != nil {
+			fmt.Println("invalid " + name + " entry " + v + ", ignoring it")
+			continue
+		}
+		windows = append(windows, w)
+	}
+	return windows
+}
+
+func parseFreezeWindow(v string) (freezeWindow, error) {
+	fields := strings.Fields(v)
+	if len(fields) != 7 {
+		return freezeWindow{}, errors.New("freeze window " + v + " should have a scope, 5 cron fields and a duration")
+	}
+
+	scope := strings.SplitN(fields[0], "/", 2)
+	if len(scope) != 2 {
+		return freezeWindow{}, errors.New("freeze window scope " + fields[0] + " should be <tenant>/<region>")
+	}
+
+	schedule, err := parseCron(strings.Join(fields[1:6], " "))
+	if err != nil {
+		return freezeWindow{}, err
+	}
+
+	d, err := time.ParseDuration(fields[6])
+	if err != nil || d <= 0 {
+		return freezeWindow{}, errors.New("invalid freeze window duration " + fields[6])
+	}
+
+	return freezeWindow{Tenant: scope[0], Region: scope[1], Schedule: schedule, Duration: d}, nil
+}
+
+// resubmit hands events parked by a freeze back to the connector once the
+// freeze ends, set on startup
+var resubmit nats.MsgHandler
+
+// frozenEvents counts the events parked by a freeze not handed back yet,
+// which are lost if the connector stops
+var frozenEvents = struct {
+	sync.Mutex
+	n int
+}{}
+
+// frozenParked returns how many events are parked by a freeze
+func frozenParked() int {
+	frozenEvents.Lock()
+	defer frozenEvents.Unlock()
+
+	return frozenEvents.n
+}
+
+func addFrozen(delta int) {
+	frozenEvents.Lock()
+	frozenEvents.n += delta
+	frozenEvents.Unlock()
+}
+
+// freeze holds mutating events during the freeze windows of their tenant
+// and region, rejecting them, or parking them until the window ends
+func freeze(next eventFunc) eventFunc {
+	return func(e *event) {
+		if !mutating(e.msg.Subject) || e.req.DryRun {
+			next(e)
+			return
+		}
+
+		until, frozen := frozenUntil(cfg.FreezeWindows, e.req, time.Now())
+		if !frozen {
+			next(e)
+			return
+		}
+
+		if cfg.FreezeMode == freezePark && resubmit != nil {
+			raw := e.raw
+			fmt.Println("parking " + e.msg.Subject + " " + e.req.UUID + " until " + until.Format(time.RFC3339))
+			addFrozen(1)
+			time.AfterFunc(until.Sub(time.Now()), func() {
+				addFrozen(-1)
+				resubmit(raw)
+			})
+			return
+		}
+
+		e.fail(newError(errFreeze, "Changes to "+e.req.DatacenterRegion+" are frozen until "+until.Format(time.RFC3339)))
+	}
+}
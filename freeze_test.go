@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseCron(t *testing.T) {
+	Convey("Given cron expressions", t, func() {
+		Convey("When one uses values, ranges, lists and steps", func() {
+			s, err := parseCron("*/15 18-20 * 12 1,5")
+
+			Convey("It should match the times they describe", func() {
+				So(err, ShouldBeNil)
+				So(s.matches(time.Date(2026, 12, 4, 18, 30, 0, 0, time.UTC)), ShouldBeTrue)
+				So(s.matches(time.Date(2026, 12, 4, 18, 31, 0, 0, time.UTC)), ShouldBeFalse)
+				So(s.matches(time.Date(2026, 12, 3, 18, 30, 0, 0, time.UTC)), ShouldBeFalse)
+				So(s.matches(time.Date(2026, 11, 6, 18, 30, 0, 0, time.UTC)), ShouldBeFalse)
+			})
+		})
+
+		Convey("When one is malformed", func() {
+			Convey("It should reject it", func() {
+				for _, expr := range []string{"* * * *", "60 * * * *", "* 5-2 * * *", "*/0 * * * *", "a * * * *"} {
+					_, err := parseCron(expr)
+					So(err, ShouldNotBeNil)
+				}
+			})
+		})
+	})
+}
+
+func TestFrozenUntil(t *testing.T) {
+	Convey("Given a freeze from Friday 18:00 over the weekend", t, func() {
+		w, err := parseFreezeWindow("acme/eu-west-1 0 18 * * 5 60h")
+		So(err, ShouldBeNil)
+		windows := []freezeWindow{w}
+		r := request{Tenant: "acme", DatacenterRegion: "eu-west-1"}
+
+		Convey("When an event arrives on Saturday", func() {
+			until, frozen := frozenUntil(windows, r, time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC))
+
+			Convey("It should be frozen until Monday 06:00", func() {
+				So(frozen, ShouldBeTrue)
+				So(until, ShouldResemble, time.Date(2026, 10, 19, 6, 0, 0, 0, time.UTC))
+			})
+		})
+
+		Convey("When an event arrives on Monday afternoon", func() {
+			_, frozen := frozenUntil(windows, r, time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC))
+
+			Convey("It should not be frozen", func() {
+				So(frozen, ShouldBeFalse)
+			})
+		})
+
+		Convey("When an event of another tenant arrives on Saturday", func() {
+			r.Tenant = "other"
+			_, frozen := frozenUntil(windows, r, time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC))
+
+			Convey("It should not be frozen", func() {
+				So(frozen, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given malformed freeze windows", t, func() {
+		Convey("It should reject them", func() {
+			for _, v := range []string{"acme 0 18 * * 5 60h", "*/* 0 18 * * 5", "*/* 0 18 * * 5 forever"} {
+				_, err := parseFreezeWindow(v)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
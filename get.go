@@ -0,0 +1,376 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats"
+)
+
+// getHandler looks an existing network up, by network_aws_id or by vpc_id
+// and range, and responds with its full state so it can be imported
+func getHandler(m *nats.Msg) {
+	req, _, err := decodeStandalone(m)
+	if err != nil {
+		publishError(m.Subject, errorResponse(nil, err))
+		return
+	}
+
+	if req.NetworkAWSID == "" && (req.VPCID == "" || req.Subnet == "") {
+		err := newError(errPayload, "Network get needs a network_aws_id, or a vpc_id and range")
+		publishError(m.Subject, errorResponse(m.Data, err))
+		return
+	}
+
+	networks, err := lookupNetworks(readClient(req), req)
+	if err == nil && len(networks) == 0 {
+		err = newError(errNotFound, "Network not found")
+	}
+	if err != nil {
+		publishError(m.Subject, errorResponse(m.Data, err))
+		return
+	}
+
+	nc.Publish(m.Subject+".done", setFields(m.Data, networks[0]))
+}
+
+// findHandler responds with the full state of every network of a VPC, or
+// of each of its vpc_ids, optionally narrowed down to a range, as its
+// components. Events carrying max_results get that many networks at most,
+// and the next_token to carry on from.
+func findHandler(m *nats.Msg) {
+	req, _, err := decodeStandalone(m)
+	if err != nil {
+		publishError(m.Subject, errorResponse(nil, err))
+		return
+	}
+
+	if req.NetworkAWSID == "" && req.VPCID == "" && len(req.VPCIDs) == 0 {
+		err := newError(errPayload, "Network find needs a network_aws_id, a vpc_id or vpc_ids")
+		publishError(m.Subject, errorResponse(m.Data, err))
+		return
+	}
+
+	if req.MaxResults < 0 {
+		err := newFieldError(errPayload, "max_results", "Network find max_results can't be negative")
+		publishError(m.Subject, errorResponse(m.Data, err))
+		return
+	}
+
+	if len(req.VPCIDs) > 0 && (req.MaxResults > 0 || req.NextToken != "") {
+		err := newFieldError(errPayload, "vpc_ids", "Network find can't page through several vpc_ids, find them one VPC at a time")
+		publishError(m.Subject, errorResponse(m.Data, err))
+		return
+	}
+
+	var networks []map[string]interface{}
+	var token string
+	if len(req.VPCIDs) > 0 {
+		networks, err = lookupVPCNetworks(readClient(req), req, cfg.FindConcurrency)
+	} else {
+		networks, token, err = lookupNetworkPage(readClient(req), req, req.MaxResults, req.NextToken)
+	}
+	if err != nil {
+		publishError(m.Subject, errorResponse(m.Data, err))
+		return
+	}
+
+	if networks == nil {
+		networks = []map[string]interface{}{}
+	}
+
+	data := m.Data
+	if req.MaxResults > 0 || req.NextToken != "" {
+		data = setField(data, "next_token", token)
+	}
+
+	resp := findResponse(data, networks, cfg.MaxResponseSize)
+	if cfg.MaxResponseSize > 0 && len(resp) > cfg.MaxResponseSize {
+		streamNetworks(m.Subject, data, networks, cfg.FindPage)
+		return
+	}
+
+	nc.Publish(m.Subject+".done", resp)
+}
+
+// streamNetworks publishes the networks found on the page subject, size
+// at a time, when even compacted they don't fit a single response. Each
+// page carries its sequence number and whether it is the last one, and a
+// done response telling the number of pages follows.
+func streamNetworks(subject string, data []byte, networks []map[string]interface{}, size int) {
+	pages := networkPages(networks, size)
+	for i, page := range pages {
+		nc.Publish(subject+".page", setFields(sanitizedBody(data), map[string]interface{}{
+			"page":       i + 1,
+			"last":       i == len(pages)-1,
+			"components": page,
+		}))
+	}
+
+	nc.Publish(subject+".done", setFields(data, map[string]interface{}{
+		"pages":    len(pages),
+		"streamed": true,
+	}))
+}
+
+// networkPages splits the networks into pages of at most size networks
+func networkPages(networks []map[string]interface{}, size int) [][]map[string]interface{} {
+	if size <= 0 {
+		size = len(networks)
+	}
+
+	var pages [][]map[string]interface{}
+	for len(networks) > 0 {
+		n := size
+		if n > len(networks) {
+			n = len(networks)
+		}
+		pages = append(pages, networks[:n])
+		networks = networks[n:]
+	}
+	return pages
+}
+
+// compactFields are the network fields find responses keep once
+// compacted, the rest being a get by network_aws_id away. The full tag set
+// is kept, imports relying on it.
+var compactFields = []string{"network_aws_id", "vpc_id", "name", "range", "availability_zone", "is_public", "tags"}
+
+// findResponse returns the find response with the networks as its
+// components, summarized to their compactFields when the full response
+// would be larger than maxSize
+func findResponse(data []byte, networks []map[string]interface{}, maxSize int) []byte {
+	resp := setField(data, "components", networks)
+	if maxSize <= 0 || len(resp) <= maxSize {
+		return resp
+	}
+
+	compact := make([]map[string]interface{}, 0, len(networks))
+	for _, n := range networks {
+		summary := make(map[string]interface{})
+		for _, f := range compactFields {
+			summary[f] = n[f]
+		}
+		compact = append(compact, summary)
+	}
+
+	return setFields(data, map[string]interface{}{
+		"components": compact,
+		"compacted":  true,
+	})
+}
+
+// lookupNetworks describes the networks matching the event within the
+// environment scope, along with the route tables telling whether they are
+// public
+func lookupNetworks(client ec2API, r request) ([]map[string]interface{}, error) {
+	networks, _, err := lookupNetworkPage(client, r, 0, "")
+	return networks, err
+}
+
+// lookupVPCNetworks looks up the networks of each of the vpc_ids of the
+// event, at most concurrency VPCs at a time, and returns them in the order
+// of their VPCs
+func lookupVPCNetworks(client ec2API, r request, concurrency int) ([]map[string]interface{}, error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	found := make([][]map[string]interface{}, len(r.VPCIDs))
+	errs := make([]error, len(r.VPCIDs))
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, vpc := range r.VPCIDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, vpc string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			scoped := r
+			scoped.VPCID = vpc
+			scoped.VPCIDs = nil
+			scoped.NetworkAWSID = ""
+			found[i], errs[i] = lookupNetworks(client, scoped)
+		}(i, vpc)
+	}
+	wg.Wait()
+
+	var networks []map[string]interface{}
+	for i := range r.VPCIDs {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		networks = append(networks, found[i]...)
+	}
+
+	return networks, nil
+}
+
+// Bounds AWS puts on the max results of a DescribeSubnets page
+const (
+	minSubnetResults = 5
+	maxSubnetResults = 1000
+)
+
+// lookupNetworkPage describes the networks matching the event from the
+// token on, one DescribeSubnets page of at most max subnets, or following
+// every page when max is 0. It returns the token the next page starts
+// from, empty once there are no more.
+func lookupNetworkPage(client ec2API, r request, max int64, token string) ([]map[string]interface{}, string, error) {
+	input := &ec2.DescribeSubnetsInput{}
+	if r.NetworkAWSID != "" {
+		input.SubnetIds = []*string{aws.String(r.NetworkAWSID)}
+	} else {
+		input.Filters = append(input.Filters, &ec2.Filter{Name: aws.String("vpc-id"), Values: []*string{aws.String(r.VPCID)}})
+		if r.Subnet != "" {
+			input.Filters = append(input.Filters, &ec2.Filter{Name: aws.String("cidr-block"), Values: []*string{aws.String(r.Subnet)}})
+		}
+	}
+
+	if max > 0 && len(input.SubnetIds) == 0 {
+		switch {
+		case max < minSubnetResults:
+			max = minSubnetResults
+		case max > maxSubnetResults:
+			max = maxSubnetResults
+		}
+		input.MaxResults = aws.Int64(max)
+	}
+	if token != "" {
+		input.NextToken = aws.String(token)
+	}
+
+	var found []*ec2.Subnet
+	for {
+		subnets, err := client.DescribeSubnets(input)
+		if isNotFound(err) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		found = append(found, subnets.Subnets...)
+
+		token = aws.StringValue(subnets.NextToken)
+		if token == "" || max > 0 {
+			break
+		}
+		input.NextToken = subnets.NextToken
+	}
+
+	scoped := cfg.Scope.subnets(found)
+	if len(scoped) == 0 {
+		return nil, token, nil
+	}
+
+	var vpcs []*string
+	for _, s := range scoped {
+		if !contains(aws.StringValueSlice(vpcs), aws.StringValue(s.VpcId)) {
+			vpcs = append(vpcs, s.VpcId)
+		}
+	}
+
+	var tables []*ec2.RouteTable
+	tablesInput := &ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: vpcs}},
+	}
+	for {
+		resp, err := client.DescribeRouteTables(tablesInput)
+		if err != nil {
+			return nil, "", err
+		}
+		tables = append(tables, resp.RouteTables...)
+
+		if aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		tablesInput.NextToken = resp.NextToken
+	}
+
+	var networks []map[string]interface{}
+	for _, s := range scoped {
+		networks = append(networks, networkState(s, tables))
+	}
+
+	return networks, token, nil
+}
+
+// networkState returns the event fields describing a live network
+func networkState(subnet *ec2.Subnet, tables []*ec2.RouteTable) map[string]interface{} {
+	tags := tagMap(subnet.Tags)
+	routed := internetRouted(subnet, tables)
+	table, association := routeTableAssociation(subnet, tables)
+
+	return map[string]interface{}{
+		"network_aws_id":          aws.StringValue(subnet.SubnetId),
+		"vpc_id":                  aws.StringValue(subnet.VpcId),
+		"name":                    tags["Name"],
+		"range":                   aws.StringValue(subnet.CidrBlock),
+		"availability_zone":       aws.StringValue(subnet.AvailabilityZone),
+		"availability_zone_id":    aws.StringValue(subnet.AvailabilityZoneId),
+		"available_ip_count":      aws.Int64Value(subnet.AvailableIpAddressCount),
+		"is_public":               routed,
+		"internet_routed":         routed,
+		"map_public_ip_on_launch": aws.BoolValue(subnet.MapPublicIpOnLaunch),
+		"route_table_id":          table,
+		"route_table_association": association,
+		"tags":                    tags,
+	}
+}
+
+const (
+	associationExplicit = "explicit"
+	associationMain     = "main"
+)
+
+// routeTableAssociation returns the route table of the subnet and whether
+// it is explicitly associated with it or implicitly uses the main route
+// table of its VPC, whose routes other networks share and may change
+func routeTableAssociation(subnet *ec2.Subnet, tables []*ec2.RouteTable) (string, string) {
+	table := subnetRouteTable(subnet, tables)
+	switch {
+	case table == nil:
+		return "", ""
+	case associatedWith(table, aws.StringValue(subnet.SubnetId)):
+		return aws.StringValue(table.RouteTableId), associationExplicit
+	}
+	return aws.StringValue(table.RouteTableId), associationMain
+}
+
+// internetRouted reports whether the route table of the subnet, its own
+// or else the main one of its VPC, routes through an internet gateway
+func internetRouted(subnet *ec2.Subnet, tables []*ec2.RouteTable) bool {
+	table := subnetRouteTable(subnet, tables)
+	if table == nil {
+		return false
+	}
+
+	for _, route := range table.Routes {
+		if strings.HasPrefix(aws.StringValue(route.GatewayId), "igw-") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func subnetRouteTable(subnet *ec2.Subnet, tables []*ec2.RouteTable) *ec2.RouteTable {
+	var main *ec2.RouteTable
+	for _, t := range tables {
+		if associatedWith(t, aws.StringValue(subnet.SubnetId)) {
+			return t
+		}
+		if isMain(t) && aws.StringValue(t.VpcId) == aws.StringValue(subnet.VpcId) {
+			main = t
+		}
+	}
+	return main
+}
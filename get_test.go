@@ -0,0 +1,294 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNetworkState(t *testing.T) {
+	Convey("Given an existing network", t, func() {
+		subnet := &ec2.Subnet{
+			SubnetId:                aws.String("subnet-00000000"),
+			VpcId:                   aws.String("vpc-0000000"),
+			CidrBlock:               aws.String("10.0.1.0/24"),
+			AvailabilityZone:        aws.String("eu-west-1a"),
+			AvailabilityZoneId:      aws.String("euw1-az1"),
+			AvailableIpAddressCount: aws.Int64(251),
+			MapPublicIpOnLaunch:     aws.Bool(false),
+			Tags: []*ec2.Tag{
+				{Key: aws.String("Name"), Value: aws.String("web")},
+				{Key: aws.String("ernest.service"), Value: aws.String("shop")},
+				{Key: aws.String("cost-center"), Value: aws.String("1234")},
+			},
+		}
+
+		mainTable := routeTable("rtb-00000000", nil, "igw-00000000")
+		mainTable.VpcId = aws.String("vpc-0000000")
+		mainTable.Associations = []*ec2.RouteTableAssociation{{Main: aws.Bool(true)}}
+
+		Convey("When it uses the main route table", func() {
+			state := networkState(subnet, []*ec2.RouteTable{mainTable})
+
+			Convey("It should describe it", func() {
+				So(state["network_aws_id"], ShouldEqual, "subnet-00000000")
+				So(state["vpc_id"], ShouldEqual, "vpc-0000000")
+				So(state["name"], ShouldEqual, "web")
+				So(state["range"], ShouldEqual, "10.0.1.0/24")
+				So(state["availability_zone"], ShouldEqual, "eu-west-1a")
+				So(state["availability_zone_id"], ShouldEqual, "euw1-az1")
+				So(state["available_ip_count"], ShouldEqual, int64(251))
+			})
+
+			Convey("It should carry every tag of the subnet", func() {
+				So(state["tags"], ShouldResemble, map[string]string{"Name": "web", "ernest.service": "shop", "cost-center": "1234"})
+			})
+
+			Convey("It should be public through the main route table", func() {
+				So(state["is_public"], ShouldBeTrue)
+				So(state["internet_routed"], ShouldBeTrue)
+			})
+
+			Convey("It should tell apart instances not getting public ips", func() {
+				So(state["map_public_ip_on_launch"], ShouldBeFalse)
+			})
+
+			Convey("It should be implicitly associated with the main route table", func() {
+				So(state["route_table_id"], ShouldEqual, "rtb-00000000")
+				So(state["route_table_association"], ShouldEqual, associationMain)
+			})
+		})
+
+		Convey("When it has its own private route table", func() {
+			own := routeTable("rtb-11111111", []string{"subnet-00000000"}, "")
+			state := networkState(subnet, []*ec2.RouteTable{mainTable, own})
+
+			Convey("It should not be public", func() {
+				So(state["is_public"], ShouldBeFalse)
+				So(state["internet_routed"], ShouldBeFalse)
+			})
+
+			Convey("It should be explicitly associated with it", func() {
+				So(state["route_table_id"], ShouldEqual, "rtb-11111111")
+				So(state["route_table_association"], ShouldEqual, associationExplicit)
+			})
+		})
+	})
+}
+
+func TestFindResponse(t *testing.T) {
+	Convey("Given the networks found for a VPC", t, func() {
+		networks := []map[string]interface{}{
+			{"network_aws_id": "subnet-00000000", "vpc_id": "vpc-0000000", "range": "10.0.1.0/24", "tags": map[string]string{"Name": "web"}},
+			{"network_aws_id": "subnet-11111111", "vpc_id": "vpc-0000000", "range": "10.0.2.0/24", "available_ip_count": int64(251), "tags": map[string]string{"Name": "db"}},
+		}
+
+		Convey("When the response fits", func() {
+			data := findResponse([]byte(`{"vpc_id":"vpc-0000000"}`), networks, 1024*1024)
+
+			Convey("It should carry the full networks", func() {
+				So(string(data), ShouldContainSubstring, `"tags"`)
+				So(string(data), ShouldNotContainSubstring, `"compacted"`)
+			})
+		})
+
+		Convey("When the response is too large", func() {
+			data := findResponse([]byte(`{"vpc_id":"vpc-0000000"}`), networks, 100)
+
+			var body struct {
+				Components []map[string]interface{} `json:"components"`
+				Compacted  bool                     `json:"compacted"`
+			}
+			json.Unmarshal(data, &body)
+
+			Convey("It should summarize them", func() {
+				So(body.Compacted, ShouldBeTrue)
+				So(len(body.Components), ShouldEqual, 2)
+				So(body.Components[1]["network_aws_id"], ShouldEqual, "subnet-11111111")
+				So(body.Components[1], ShouldNotContainKey, "available_ip_count")
+				So(body.Components[1]["tags"], ShouldResemble, map[string]interface{}{"Name": "db"})
+			})
+		})
+	})
+}
+
+// pagedEC2 describes the subnets of the account two at a time, unless
+// asked for more
+type pagedEC2 struct {
+	*mockEC2
+	calls []*ec2.DescribeSubnetsInput
+}
+
+func (m *pagedEC2) DescribeSubnets(in *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	m.calls = append(m.calls, in)
+
+	subnets := filterSubnets(m.subnets, in.Filters)
+	start := 0
+	if in.NextToken != nil {
+		fmt.Sscanf(aws.StringValue(in.NextToken), "page-%d", &start)
+	}
+	end := start + 2
+	if in.MaxResults != nil {
+		end = start + int(aws.Int64Value(in.MaxResults))
+	}
+
+	out := &ec2.DescribeSubnetsOutput{}
+	if end < len(subnets) {
+		out.NextToken = aws.String(fmt.Sprintf("page-%d", end))
+	} else {
+		end = len(subnets)
+	}
+	out.Subnets = subnets[start:end]
+	return out, nil
+}
+
+func TestLookupNetworkPage(t *testing.T) {
+	Convey("Given a VPC holding more networks than a page of subnets", t, func() {
+		client := &pagedEC2{mockEC2: &mockEC2{}}
+		for i := 0; i < 7; i++ {
+			client.subnets = append(client.subnets, &ec2.Subnet{
+				SubnetId:  aws.String(fmt.Sprintf("subnet-%08d", i)),
+				VpcId:     aws.String("vpc-0000000"),
+				CidrBlock: aws.String(fmt.Sprintf("10.0.%d.0/24", i)),
+			})
+		}
+
+		Convey("When looking all of them up", func() {
+			networks, err := lookupNetworks(client, request{VPCID: "vpc-0000000"})
+
+			Convey("It should follow every page", func() {
+				So(err, ShouldBeNil)
+				So(len(networks), ShouldEqual, 7)
+				So(len(client.calls), ShouldEqual, 4)
+			})
+		})
+
+		Convey("When looking up a page of them", func() {
+			networks, token, err := lookupNetworkPage(client, request{VPCID: "vpc-0000000"}, 5, "")
+
+			Convey("It should describe a single page", func() {
+				So(err, ShouldBeNil)
+				So(len(networks), ShouldEqual, 5)
+				So(len(client.calls), ShouldEqual, 1)
+			})
+
+			Convey("It should tell where the next one starts", func() {
+				So(token, ShouldEqual, "page-5")
+			})
+
+			Convey("When looking the next page up", func() {
+				networks, token, err := lookupNetworkPage(client, request{VPCID: "vpc-0000000"}, 5, token)
+
+				Convey("It should carry on from the token to the last networks", func() {
+					So(err, ShouldBeNil)
+					So(len(networks), ShouldEqual, 2)
+					So(networks[0]["network_aws_id"], ShouldEqual, "subnet-00000005")
+					So(token, ShouldEqual, "")
+				})
+			})
+		})
+
+		Convey("When asking for fewer results than AWS allows", func() {
+			lookupNetworkPage(client, request{VPCID: "vpc-0000000"}, 1, "")
+
+			Convey("It should ask for the least AWS allows", func() {
+				So(aws.Int64Value(client.calls[0].MaxResults), ShouldEqual, int64(minSubnetResults))
+			})
+		})
+	})
+}
+
+func TestNetworkPages(t *testing.T) {
+	Convey("Given five networks found", t, func() {
+		networks := make([]map[string]interface{}, 5)
+
+		Convey("It should split them into pages of at most the page size", func() {
+			pages := networkPages(networks, 2)
+			So(len(pages), ShouldEqual, 3)
+			So(len(pages[2]), ShouldEqual, 1)
+		})
+
+		Convey("It should keep them in a single page without a page size", func() {
+			So(len(networkPages(networks, 0)), ShouldEqual, 1)
+		})
+	})
+}
+
+// concurrentEC2 tracks how many VPCs are being described at once
+type concurrentEC2 struct {
+	*mockEC2
+	mu       sync.Mutex
+	inflight int
+	peak     int
+}
+
+func (m *concurrentEC2) DescribeSubnets(in *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	m.mu.Lock()
+	m.inflight++
+	if m.inflight > m.peak {
+		m.peak = m.inflight
+	}
+	m.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	m.mu.Lock()
+	m.inflight--
+	m.mu.Unlock()
+
+	if aws.StringValue(in.Filters[0].Values[0]) == "vpc-broken" {
+		return nil, awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil)
+	}
+	return m.mockEC2.DescribeSubnets(in)
+}
+
+func TestLookupVPCNetworks(t *testing.T) {
+	Convey("Given an account with a network in each of six VPCs", t, func() {
+		client := &concurrentEC2{mockEC2: &mockEC2{}}
+		var vpcs []string
+		for i := 0; i < 6; i++ {
+			vpc := fmt.Sprintf("vpc-%07d", i)
+			vpcs = append(vpcs, vpc)
+			client.subnets = append(client.subnets, &ec2.Subnet{
+				SubnetId:  aws.String(fmt.Sprintf("subnet-%08d", i)),
+				VpcId:     aws.String(vpc),
+				CidrBlock: aws.String("10.0.0.0/24"),
+			})
+		}
+
+		Convey("When finding the networks of every VPC", func() {
+			networks, err := lookupVPCNetworks(client, request{VPCIDs: vpcs}, 2)
+
+			Convey("It should merge them in the order of the VPCs", func() {
+				So(err, ShouldBeNil)
+				So(len(networks), ShouldEqual, 6)
+				for i, n := range networks {
+					So(n["vpc_id"], ShouldEqual, vpcs[i])
+				}
+			})
+
+			Convey("It should describe several VPCs at a time, within the limit", func() {
+				So(client.peak, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When a VPC fails to be described", func() {
+			_, err := lookupVPCNetworks(client, request{VPCIDs: append(vpcs, "vpc-broken")}, 2)
+
+			Convey("It should fail the find", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
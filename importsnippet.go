@@ -0,0 +1,106 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+const (
+	importCloudFormation = "cloudformation"
+	importTerraform      = "terraform"
+)
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// importFormat returns the IaC tool the created resources are rendered for
+// in responses, empty for none
+func (r request) importFormat(c config) string {
+	if r.ImportFormat != "" {
+		return r.ImportFormat
+	}
+	return c.ImportFormat
+}
+
+// importedResource is a resource of the network, as an IaC tool imports it
+type importedResource struct {
+	name       string
+	cfnType    string
+	cfnID      string
+	tfType     string
+	physicalID string
+}
+
+// importResources lists the resources the response reports
+func importResources(r request, data []byte) []importedResource {
+	var resp struct {
+		NetworkAWSID string `json:"network_aws_id"`
+		RouteTableID string `json:"route_table_id"`
+	}
+	json.Unmarshal(data, &resp)
+
+	name := logicalName(r.Name)
+
+	var resources []importedResource
+	if resp.NetworkAWSID != "" {
+		resources = append(resources, importedResource{name, "AWS::EC2::Subnet", "SubnetId", "aws_subnet", resp.NetworkAWSID})
+	}
+	if resp.RouteTableID != "" {
+		resources = append(resources, importedResource{name + "_routes", "AWS::EC2::RouteTable", "RouteTableId", "aws_route_table", resp.RouteTableID})
+	}
+	return resources
+}
+
+// importSnippet adds to a response what importing its resources into
+// CloudFormation or Terraform takes
+func importSnippet(data []byte, r request, format string) []byte {
+	resources := importResources(r, data)
+	if len(resources) == 0 {
+		return data
+	}
+
+	switch format {
+	case importCloudFormation:
+		var imports []map[string]interface{}
+		for _, res := range resources {
+			imports = append(imports, map[string]interface{}{
+				"ResourceType":       res.cfnType,
+				"LogicalResourceId":  cfnName(res.name),
+				"ResourceIdentifier": map[string]string{res.cfnID: res.physicalID},
+			})
+		}
+		return setField(data, "import", imports)
+	case importTerraform:
+		var blocks []string
+		for _, res := range resources {
+			blocks = append(blocks, "import {\n  to = "+res.tfType+"."+res.name+"\n  id = \""+res.physicalID+"\"\n}\n")
+		}
+		return setField(data, "import", strings.Join(blocks, "\n"))
+	}
+
+	return data
+}
+
+// logicalName turns a network name into an identifier both tools accept
+func logicalName(name string) string {
+	name = strings.Trim(unsafeName.ReplaceAllString(name, "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "network_" + name
+	}
+	return strings.TrimSuffix(name, "_")
+}
+
+// cfnName drops the underscores CloudFormation logical ids can't hold
+func cfnName(name string) string {
+	var id string
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			id += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return id
+}
@@ -0,0 +1,60 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestImportSnippet(t *testing.T) {
+	Convey("Given a created network routed through its own route table", t, func() {
+		r := request{Name: "web-tier"}
+		data := []byte(`{"name":"web-tier","network_aws_id":"subnet-00000000","route_table_id":"rtb-00000000"}`)
+
+		Convey("When rendering it for CloudFormation", func() {
+			var resp struct {
+				Import []struct {
+					ResourceType       string
+					LogicalResourceId  string
+					ResourceIdentifier map[string]string
+				} `json:"import"`
+			}
+			json.Unmarshal(importSnippet(data, r, importCloudFormation), &resp)
+
+			Convey("It should list both resources to import", func() {
+				So(len(resp.Import), ShouldEqual, 2)
+				So(resp.Import[0].ResourceType, ShouldEqual, "AWS::EC2::Subnet")
+				So(resp.Import[0].LogicalResourceId, ShouldEqual, "WebTier")
+				So(resp.Import[0].ResourceIdentifier["SubnetId"], ShouldEqual, "subnet-00000000")
+				So(resp.Import[1].ResourceIdentifier["RouteTableId"], ShouldEqual, "rtb-00000000")
+			})
+		})
+
+		Convey("When rendering it for Terraform", func() {
+			var resp struct {
+				Import string `json:"import"`
+			}
+			json.Unmarshal(importSnippet(data, r, importTerraform), &resp)
+
+			Convey("It should render import blocks", func() {
+				So(resp.Import, ShouldContainSubstring, "to = aws_subnet.web_tier\n  id = \"subnet-00000000\"")
+				So(resp.Import, ShouldContainSubstring, "to = aws_route_table.web_tier_routes\n  id = \"rtb-00000000\"")
+			})
+		})
+	})
+}
+
+func TestLogicalName(t *testing.T) {
+	Convey("Given network names", t, func() {
+		Convey("It should turn them into identifiers", func() {
+			So(logicalName("web-tier"), ShouldEqual, "web_tier")
+			So(logicalName("10.0.0.0/24"), ShouldEqual, "network_10_0_0_0_24")
+			So(logicalName(""), ShouldEqual, "network")
+		})
+	})
+}
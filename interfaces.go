@@ -0,0 +1,243 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const maxInterfaceBackoff = 30 * time.Second
+
+const (
+	resolverPrefix = "Route 53 Resolver: "
+	elbPrefix      = "ELB "
+	natPrefix      = "Interface for NAT Gateway "
+	endpointPrefix = "VPC Endpoint Interface "
+)
+
+// blockerNames are the readable names of each blocker type
+var blockerNames = map[string]string{
+	"resolver_endpoint": "Route 53 Resolver endpoint",
+	"alb":               "ALB",
+	"nlb":               "NLB",
+	"elb":               "ELB",
+	"nat_gateway":       "NAT gateway",
+	"vpc_endpoint":      "VPC endpoint",
+	"instance":          "instance",
+}
+
+// permanentBlockers never release their interfaces on their own, so
+// deleting the subnet would wait forever
+var permanentBlockers = map[string]bool{
+	"resolver_endpoint": true,
+	"alb":               true,
+	"nlb":               true,
+	"elb":               true,
+}
+
+// blocker is a resource holding network interfaces in a subnet, the
+// subnet can't be deleted until it is gone
+type blocker struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// BlockedEvent : published on <subject>.blocked naming the components
+// holding a network, so they can be torn down first
+type BlockedEvent struct {
+	UUID         string    `json:"_uuid"`
+	BatchID      string    `json:"_batch_id"`
+	NetworkAWSID string    `json:"network_aws_id"`
+	Components   []string  `json:"components"`
+	BlockedBy    []blocker `json:"blocked_by"`
+}
+
+// classifyInterface returns the resource owning a network interface
+func classifyInterface(eni *ec2.NetworkInterface) *blocker {
+	description := aws.StringValue(eni.Description)
+
+	if strings.HasPrefix(description, resolverPrefix) {
+		id := strings.SplitN(strings.TrimPrefix(description, resolverPrefix), ":", 2)[0]
+		return &blocker{Type: "resolver_endpoint", ID: id}
+	}
+
+	// load balancer interfaces are described as "ELB app/<name>/<id>" for
+	// ALBs, "ELB net/<name>/<id>" for NLBs and "ELB <name>" for classic ones
+	if strings.HasPrefix(description, elbPrefix) {
+		parts := strings.Split(strings.TrimPrefix(description, elbPrefix), "/")
+		if len(parts) == 3 && parts[0] == "app" {
+			return &blocker{Type: "alb", ID: parts[1]}
+		}
+		if len(parts) == 3 && parts[0] == "net" {
+			return &blocker{Type: "nlb", ID: parts[1]}
+		}
+		return &blocker{Type: "elb", ID: parts[0]}
+	}
+
+	if strings.HasPrefix(description, natPrefix) {
+		return &blocker{Type: "nat_gateway", ID: strings.TrimPrefix(description, natPrefix)}
+	}
+
+	if strings.HasPrefix(description, endpointPrefix) {
+		return &blocker{Type: "vpc_endpoint", ID: strings.TrimPrefix(description, endpointPrefix)}
+	}
+
+	if eni.Attachment != nil && aws.StringValue(eni.Attachment.InstanceId) != "" {
+		return &blocker{Type: "instance", ID: aws.StringValue(eni.Attachment.InstanceId)}
+	}
+
+	return nil
+}
+
+func (b blocker) String() string {
+	return blockerNames[b.Type] + " " + b.ID
+}
+
+// subnetBlockers lists the resources holding network interfaces in the
+// subnet
+func subnetBlockers(client ec2API, subnetID string) ([]blocker, error) {
+	enis, err := subnetInterfaces(client, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	return blockers(enis), nil
+}
+
+func subnetInterfaces(client ec2API, subnetID string) ([]*ec2.NetworkInterface, error) {
+	resp, err := client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("subnet-id"), Values: []*string{aws.String(subnetID)}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.NetworkInterfaces, nil
+}
+
+// waitForInterfaces waits, backing off up to maxInterfaceBackoff, for the
+// interfaces of a network about to be deleted to be released. Past the
+// timeout it fails naming the interfaces left and what holds them, rather
+// than leaving the deletion hanging.
+func waitForInterfaces(client ec2API, r request, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := time.Second
+
+	for {
+		enis, err := subnetInterfaces(client, r.NetworkAWSID)
+		if err != nil {
+			return err
+		}
+
+		if len(enis) == 0 {
+			return nil
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return newError(errTimeout, "Network "+r.NetworkAWSID+" still holds interfaces after "+timeout.String()+": "+strings.Join(interfaceOwners(enis), ", "))
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxInterfaceBackoff {
+			backoff = maxInterfaceBackoff
+		}
+	}
+}
+
+// interfaceOwners describes each interface along with what it is attached
+// to
+func interfaceOwners(enis []*ec2.NetworkInterface) []string {
+	var owners []string
+	for _, eni := range enis {
+		owner := aws.StringValue(eni.Description)
+		if eni.Attachment != nil && aws.StringValue(eni.Attachment.InstanceId) != "" {
+			owner = aws.StringValue(eni.Attachment.InstanceId)
+		} else if eni.Attachment != nil && aws.StringValue(eni.Attachment.InstanceOwnerId) != "" {
+			owner = aws.StringValue(eni.Attachment.InstanceOwnerId)
+		}
+
+		if owner == "" {
+			owners = append(owners, aws.StringValue(eni.NetworkInterfaceId))
+			continue
+		}
+		owners = append(owners, aws.StringValue(eni.NetworkInterfaceId)+" ("+owner+")")
+	}
+	return owners
+}
+
+// blockers returns the unique resources holding the given interfaces
+func blockers(enis []*ec2.NetworkInterface) []blocker {
+	var found []blocker
+
+	seen := make(map[blocker]bool)
+	for _, eni := range enis {
+		b := classifyInterface(eni)
+		if b == nil || seen[*b] {
+			continue
+		}
+		seen[*b] = true
+		found = append(found, *b)
+	}
+
+	return found
+}
+
+// checkBlockers reports the resources holding a network about to be
+// deleted on <subject>.blocked, and fails the deletion when any of them
+// will never release its interfaces
+func checkBlockers(client ec2API, subject string, r request) error {
+	found, err := subnetBlockers(client, r.NetworkAWSID)
+	if err != nil {
+		return err
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	publishBlocked(subject, r, found)
+
+	var names []string
+	for _, b := range found {
+		if permanentBlockers[b.Type] {
+			names = append(names, b.String())
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	return newError(errInUse, "Network "+r.NetworkAWSID+" is in use by "+strings.Join(names, ", "))
+}
+
+func publishBlocked(subject string, r request, found []blocker) {
+	ev := BlockedEvent{
+		UUID:         r.UUID,
+		BatchID:      r.BatchID,
+		NetworkAWSID: r.NetworkAWSID,
+		BlockedBy:    found,
+	}
+
+	for _, b := range found {
+		if !contains(ev.Components, b.Type) {
+			ev.Components = append(ev.Components, b.Type)
+		}
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	nc.Publish(subject+".blocked", data)
+}
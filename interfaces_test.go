@@ -0,0 +1,101 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func eni(description string) *ec2.NetworkInterface {
+	return &ec2.NetworkInterface{
+		NetworkInterfaceId: aws.String("eni-00000000"),
+		Description:        aws.String(description),
+	}
+}
+
+func TestInterfaceBlockers(t *testing.T) {
+	Convey("Given the network interfaces of a subnet", t, func() {
+		Convey("With interfaces owned by a resolver endpoint", func() {
+			found := blockers([]*ec2.NetworkInterface{
+				eni("Route 53 Resolver: rslvr-in-0123456789abcdef0:rni-0123456789abcdef0"),
+				eni("Route 53 Resolver: rslvr-in-0123456789abcdef0:rni-0123456789abcdef1"),
+			})
+
+			Convey("It should report the endpoint once", func() {
+				So(found, ShouldResemble, []blocker{{Type: "resolver_endpoint", ID: "rslvr-in-0123456789abcdef0"}})
+			})
+		})
+
+		Convey("With interfaces owned by load balancers", func() {
+			found := blockers([]*ec2.NetworkInterface{
+				eni("ELB app/my-alb/50dc6c495c0c9188"),
+				eni("ELB net/my-nlb/50dc6c495c0c9189"),
+				eni("ELB my-classic-elb"),
+			})
+
+			Convey("It should report them by name", func() {
+				So(found, ShouldHaveLength, 3)
+				So(found[0].String(), ShouldEqual, "ALB my-alb")
+				So(found[1].String(), ShouldEqual, "NLB my-nlb")
+				So(found[2].String(), ShouldEqual, "ELB my-classic-elb")
+			})
+		})
+
+		Convey("With interfaces owned by other components", func() {
+			instance := eni("Primary network interface")
+			instance.Attachment = &ec2.NetworkInterfaceAttachment{InstanceId: aws.String("i-00000000")}
+
+			found := blockers([]*ec2.NetworkInterface{
+				instance,
+				eni("Interface for NAT Gateway nat-0123456789abcdef0"),
+				eni("VPC Endpoint Interface vpce-0123456789abcdef0"),
+			})
+
+			Convey("It should report them", func() {
+				So(found, ShouldResemble, []blocker{
+					{Type: "instance", ID: "i-00000000"},
+					{Type: "nat_gateway", ID: "nat-0123456789abcdef0"},
+					{Type: "vpc_endpoint", ID: "vpce-0123456789abcdef0"},
+				})
+			})
+
+			Convey("They should not be permanent", func() {
+				for _, b := range found {
+					So(permanentBlockers[b.Type], ShouldBeFalse)
+				}
+			})
+		})
+
+		Convey("With unattached interfaces", func() {
+			found := blockers([]*ec2.NetworkInterface{
+				eni("AWS Lambda VPC ENI-my-function"),
+			})
+
+			Convey("It should not report anything", func() {
+				So(found, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestInterfaceOwners(t *testing.T) {
+	Convey("Given interfaces left in a network", t, func() {
+		attached := eni("Primary network interface")
+		attached.Attachment = &ec2.NetworkInterfaceAttachment{InstanceId: aws.String("i-00000000")}
+		lambda := eni("AWS Lambda VPC ENI-my-function")
+		lambda.NetworkInterfaceId = aws.String("eni-11111111")
+
+		Convey("It should name what holds each of them", func() {
+			So(interfaceOwners([]*ec2.NetworkInterface{attached, lambda}), ShouldResemble, []string{
+				"eni-00000000 (i-00000000)",
+				"eni-11111111 (AWS Lambda VPC ENI-my-function)",
+			})
+		})
+	})
+}
@@ -0,0 +1,238 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats"
+)
+
+// inventoryItem is a network resource of the account, normalized across
+// resource types
+type inventoryItem struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	VPCID      string                 `json:"vpc_id,omitempty"`
+	CIDR       string                 `json:"cidr_block,omitempty"`
+	State      string                 `json:"state,omitempty"`
+	Tags       map[string]string      `json:"tags,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// inventoryHandler walks every VPC of the event region and publishes its
+// resources on network.inventory.aws.page, INVENTORY_PAGE_SIZE at a time,
+// before a done response counting them
+func inventoryHandler(m *nats.Msg) {
+	req, data, err := decodeStandalone(m)
+	if err != nil {
+		deliver(m.Subject+".error", errorResponse(nil, err))
+		return
+	}
+
+	items, err := inventory(readClient(req))
+	if err != nil {
+		deliver(m.Subject+".error", errorResponse(sanitizedBody(m.Data), err))
+		return
+	}
+	items = cfg.Scope.items(items)
+
+	pages := inventoryPages(items, cfg.InventoryPage)
+	for i, page := range pages {
+		deliver(m.Subject+".page", setFields(sanitizedBody(m.Data), map[string]interface{}{
+			"page":      i + 1,
+			"pages":     len(pages),
+			"resources": page,
+		}))
+	}
+
+	counts := make(map[string]int)
+	for _, item := range items {
+		counts[item.Type]++
+	}
+
+	response := setFields(sanitizedBody(m.Data), map[string]interface{}{
+		"pages":  len(pages),
+		"counts": counts,
+	})
+
+	var event struct {
+		Cleanup bool `json:"cleanup_internet_gateways"`
+	}
+	json.Unmarshal(data, &event)
+	if event.Cleanup {
+		// cleaning up deletes resources, as delete events do
+		err := checkPolicy(cfg, "network.delete.aws", req)
+		if until, frozen := frozenUntil(cfg.FreezeWindows, req, time.Now()); err == nil && frozen && !req.DryRun {
+			err = newError(errFreeze, "Changes to "+req.DatacenterRegion+" are frozen until "+until.Format(time.RFC3339))
+		}
+
+		var orphans []orphanedGateway
+		if err == nil {
+			orphans, err = cleanupInternetGateways(ec2Client(req), routingClient(req), req)
+		}
+		response = setField(response, "cleanup", orphans)
+		if err != nil {
+			deliver(m.Subject+".error", errorResponse(response, err))
+			return
+		}
+	}
+
+	deliver(m.Subject+".done", response)
+}
+
+// inventory describes the VPCs, subnets, route tables, internet gateways
+// and NAT gateways of the region, following every page
+func inventory(client ec2API) ([]inventoryItem, error) {
+	var items []inventoryItem
+
+	vpcs := &ec2.DescribeVpcsInput{}
+	for {
+		resp, err := client.DescribeVpcs(vpcs)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range resp.Vpcs {
+			items = append(items, inventoryItem{
+				Type:       "vpc",
+				ID:         aws.StringValue(v.VpcId),
+				CIDR:       aws.StringValue(v.CidrBlock),
+				State:      aws.StringValue(v.State),
+				Tags:       tagMap(v.Tags),
+				Attributes: map[string]interface{}{"is_default": aws.BoolValue(v.IsDefault)},
+			})
+		}
+		if aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		vpcs.NextToken = resp.NextToken
+	}
+
+	subnets := &ec2.DescribeSubnetsInput{}
+	for {
+		resp, err := client.DescribeSubnets(subnets)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range resp.Subnets {
+			items = append(items, inventoryItem{
+				Type:  "subnet",
+				ID:    aws.StringValue(s.SubnetId),
+				VPCID: aws.StringValue(s.VpcId),
+				CIDR:  aws.StringValue(s.CidrBlock),
+				State: aws.StringValue(s.State),
+				Tags:  tagMap(s.Tags),
+				Attributes: map[string]interface{}{
+					"availability_zone":       aws.StringValue(s.AvailabilityZone),
+					"map_public_ip_on_launch": aws.BoolValue(s.MapPublicIpOnLaunch),
+				},
+			})
+		}
+		if aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		subnets.NextToken = resp.NextToken
+	}
+
+	tables := &ec2.DescribeRouteTablesInput{}
+	for {
+		resp, err := client.DescribeRouteTables(tables)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range resp.RouteTables {
+			var associated []string
+			for _, a := range t.Associations {
+				if id := aws.StringValue(a.SubnetId); id != "" {
+					associated = append(associated, id)
+				}
+			}
+			items = append(items, inventoryItem{
+				Type:  "route_table",
+				ID:    aws.StringValue(t.RouteTableId),
+				VPCID: aws.StringValue(t.VpcId),
+				Tags:  tagMap(t.Tags),
+				Attributes: map[string]interface{}{
+					"main":    isMain(t),
+					"subnets": associated,
+					"routes":  len(t.Routes),
+				},
+			})
+		}
+		if aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		tables.NextToken = resp.NextToken
+	}
+
+	gateways := &ec2.DescribeInternetGatewaysInput{}
+	for {
+		resp, err := client.DescribeInternetGateways(gateways)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range resp.InternetGateways {
+			item := inventoryItem{
+				Type: "internet_gateway",
+				ID:   aws.StringValue(g.InternetGatewayId),
+				Tags: tagMap(g.Tags),
+			}
+			if len(g.Attachments) > 0 {
+				item.VPCID = aws.StringValue(g.Attachments[0].VpcId)
+				item.State = aws.StringValue(g.Attachments[0].State)
+			}
+			items = append(items, item)
+		}
+		if aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		gateways.NextToken = resp.NextToken
+	}
+
+	natGateways := &ec2.DescribeNatGatewaysInput{}
+	for {
+		resp, err := client.DescribeNatGateways(natGateways)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range resp.NatGateways {
+			items = append(items, inventoryItem{
+				Type:       "nat_gateway",
+				ID:         aws.StringValue(n.NatGatewayId),
+				VPCID:      aws.StringValue(n.VpcId),
+				State:      aws.StringValue(n.State),
+				Tags:       tagMap(n.Tags),
+				Attributes: map[string]interface{}{"subnet_id": aws.StringValue(n.SubnetId)},
+			})
+		}
+		if aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		natGateways.NextToken = resp.NextToken
+	}
+
+	return items, nil
+}
+
+// inventoryPages splits the inventory into pages of at most size items
+func inventoryPages(items []inventoryItem, size int) [][]inventoryItem {
+	if size <= 0 {
+		size = len(items)
+	}
+
+	var pages [][]inventoryItem
+	for len(items) > 0 {
+		n := size
+		if n > len(items) {
+			n = len(items)
+		}
+		pages = append(pages, items[:n])
+		items = items[n:]
+	}
+	return pages
+}
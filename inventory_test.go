@@ -0,0 +1,65 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInventory(t *testing.T) {
+	Convey("Given an account with two VPCs", t, func() {
+		client := &mockEC2{
+			vpcs: []*ec2.Vpc{
+				{VpcId: aws.String("vpc-0000000"), CidrBlock: aws.String("10.0.0.0/16"), State: aws.String("available")},
+				{VpcId: aws.String("vpc-1111111"), CidrBlock: aws.String("10.1.0.0/16"), State: aws.String("available")},
+			},
+			subnets: []*ec2.Subnet{
+				{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000"), CidrBlock: aws.String("10.0.1.0/24")},
+			},
+			tables: []*ec2.RouteTable{routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")},
+			gateways: []*ec2.InternetGateway{{
+				InternetGatewayId: aws.String("igw-00000000"),
+				Attachments:       []*ec2.InternetGatewayAttachment{{VpcId: aws.String("vpc-0000000"), State: aws.String("available")}},
+			}},
+		}
+
+		Convey("When taking its inventory", func() {
+			items, err := inventory(client)
+
+			Convey("It should follow every page and normalize each resource", func() {
+				So(err, ShouldBeNil)
+				So(len(items), ShouldEqual, 5)
+				So(items[0].ID, ShouldEqual, "vpc-0000000")
+				So(items[1].ID, ShouldEqual, "vpc-1111111")
+				So(items[2].Type, ShouldEqual, "subnet")
+				So(items[2].CIDR, ShouldEqual, "10.0.1.0/24")
+				So(items[3].Type, ShouldEqual, "route_table")
+				So(items[3].Attributes["subnets"], ShouldResemble, []string{"subnet-00000000"})
+				So(items[4].Type, ShouldEqual, "internet_gateway")
+				So(items[4].VPCID, ShouldEqual, "vpc-0000000")
+			})
+		})
+	})
+}
+
+func TestInventoryPages(t *testing.T) {
+	Convey("Given an inventory of five resources", t, func() {
+		items := make([]inventoryItem, 5)
+
+		Convey("It should split it into pages of at most the page size", func() {
+			pages := inventoryPages(items, 2)
+			So(len(pages), ShouldEqual, 3)
+			So(len(pages[2]), ShouldEqual, 1)
+		})
+
+		Convey("It should keep it in a single page without a page size", func() {
+			So(len(inventoryPages(items, 0)), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,177 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	ipv6Attempts = 20
+	ipv6Interval = 3 * time.Second
+)
+
+// releaseIPv6 disassociates the IPv6 CIDR blocks of a network about to be
+// deleted and waits until AWS reports them gone, as lingering associations
+// keep the range from being allocated again
+func releaseIPv6(client ec2API, r request) error {
+	subnet, err := describeSubnet(client, r.NetworkAWSID)
+	if err != nil || subnet == nil {
+		return err
+	}
+
+	associations := ipv6Associations(subnet)
+	if len(associations) == 0 {
+		return nil
+	}
+
+	for _, id := range associations {
+		_, err := client.DisassociateSubnetCidrBlock(&ec2.DisassociateSubnetCidrBlockInput{
+			AssociationId: aws.String(id),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < ipv6Attempts; i++ {
+		time.Sleep(ipv6Interval)
+
+		subnet, err := describeSubnet(client, r.NetworkAWSID)
+		if err != nil || subnet == nil {
+			return err
+		}
+
+		if len(ipv6Associations(subnet)) == 0 {
+			return nil
+		}
+	}
+
+	return newError(errTimeout, "IPv6 CIDR block of "+r.NetworkAWSID+" is still being disassociated")
+}
+
+// addIPv6 associates the IPv6 range of the event to a created network and,
+// when the event asks for it, gives instances IPv6 addresses on launch.
+// Public networks also get their IPv6 traffic routed to the internet
+// gateway, with the routing client.
+func addIPv6(client, routing ec2API, r request, id string) error {
+	if r.IPv6Range == "" {
+		return nil
+	}
+
+	_, err := client.AssociateSubnetCidrBlock(&ec2.AssociateSubnetCidrBlockInput{
+		SubnetId:      aws.String(id),
+		Ipv6CidrBlock: aws.String(r.IPv6Range),
+	})
+	if err != nil {
+		return err
+	}
+
+	subnet, err := waitForIPv6(client, id)
+	if err != nil {
+		return err
+	}
+
+	if r.AssignIPv6OnLaunch {
+		_, err := client.ModifySubnetAttribute(&ec2.ModifySubnetAttributeInput{
+			SubnetId:                    aws.String(id),
+			AssignIpv6AddressOnCreation: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !r.IsPublic {
+		return nil
+	}
+
+	tables, err := routing.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{subnet.VpcId}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	table := subnetRouteTable(subnet, tables.RouteTables)
+	if table == nil {
+		return nil
+	}
+
+	gateway := ipv6Gateway(table)
+	if gateway == "" {
+		return nil
+	}
+
+	_, err = routing.CreateRoute(&ec2.CreateRouteInput{
+		RouteTableId:             table.RouteTableId,
+		DestinationIpv6CidrBlock: aws.String("::/0"),
+		GatewayId:                aws.String(gateway),
+	})
+	return err
+}
+
+// waitForIPv6 waits for the IPv6 range of the network to be associated
+func waitForIPv6(client ec2API, id string) (*ec2.Subnet, error) {
+	for i := 0; i < ipv6Attempts; i++ {
+		subnet, err := describeSubnet(client, id)
+		if err != nil {
+			return nil, err
+		}
+		if subnet == nil {
+			return nil, newError(errNotFound, "Network "+id+" does not exist")
+		}
+
+		for _, a := range subnet.Ipv6CidrBlockAssociationSet {
+			if a.Ipv6CidrBlockState != nil && aws.StringValue(a.Ipv6CidrBlockState.State) == "associated" {
+				return subnet, nil
+			}
+		}
+
+		time.Sleep(ipv6Interval)
+	}
+
+	return nil, newError(errTimeout, "IPv6 CIDR block of "+id+" is still being associated")
+}
+
+// ipv6Gateway returns the internet gateway the route table sends IPv4
+// traffic to, when it doesn't route IPv6 traffic anywhere yet
+func ipv6Gateway(table *ec2.RouteTable) string {
+	var gateway string
+	for _, route := range table.Routes {
+		if aws.StringValue(route.DestinationIpv6CidrBlock) == "::/0" {
+			return ""
+		}
+		if aws.StringValue(route.DestinationCidrBlock) == "0.0.0.0/0" && strings.HasPrefix(aws.StringValue(route.GatewayId), "igw-") {
+			gateway = aws.StringValue(route.GatewayId)
+		}
+	}
+	return gateway
+}
+
+// ipv6Associations returns the ids of the IPv6 CIDR blocks still
+// associated, or being associated, to the subnet
+func ipv6Associations(subnet *ec2.Subnet) []string {
+	var ids []string
+	for _, a := range subnet.Ipv6CidrBlockAssociationSet {
+		var state string
+		if a.Ipv6CidrBlockState != nil {
+			state = aws.StringValue(a.Ipv6CidrBlockState.State)
+		}
+
+		switch state {
+		case "disassociating", "disassociated", "failed":
+			continue
+		}
+		ids = append(ids, aws.StringValue(a.AssociationId))
+	}
+	return ids
+}
@@ -0,0 +1,72 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func ipv6Block(id, state string) *ec2.SubnetIpv6CidrBlockAssociation {
+	return &ec2.SubnetIpv6CidrBlockAssociation{
+		AssociationId:      aws.String(id),
+		Ipv6CidrBlock:      aws.String("2600:1f18::/64"),
+		Ipv6CidrBlockState: &ec2.SubnetCidrBlockState{State: aws.String(state)},
+	}
+}
+
+func TestIPv6Associations(t *testing.T) {
+	Convey("Given a network with IPv6 CIDR blocks", t, func() {
+		subnet := &ec2.Subnet{
+			Ipv6CidrBlockAssociationSet: []*ec2.SubnetIpv6CidrBlockAssociation{
+				ipv6Block("subnet-cidr-assoc-00000000", "associated"),
+				ipv6Block("subnet-cidr-assoc-11111111", "associating"),
+				ipv6Block("subnet-cidr-assoc-22222222", "disassociating"),
+				ipv6Block("subnet-cidr-assoc-33333333", "disassociated"),
+			},
+		}
+
+		Convey("It should only return the blocks still to disassociate", func() {
+			So(ipv6Associations(subnet), ShouldResemble, []string{"subnet-cidr-assoc-00000000", "subnet-cidr-assoc-11111111"})
+		})
+	})
+
+	Convey("Given a network without IPv6", t, func() {
+		Convey("It should return nothing", func() {
+			So(ipv6Associations(&ec2.Subnet{}), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestIPv6Gateway(t *testing.T) {
+	Convey("Given the route table of a public network", t, func() {
+		table := routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")
+
+		Convey("When it doesn't route IPv6 traffic yet", func() {
+			Convey("It should route it to the internet gateway", func() {
+				So(ipv6Gateway(table), ShouldEqual, "igw-00000000")
+			})
+		})
+
+		Convey("When it already routes IPv6 traffic", func() {
+			table.Routes = append(table.Routes, &ec2.Route{DestinationIpv6CidrBlock: aws.String("::/0"), GatewayId: aws.String("eigw-00000000")})
+
+			Convey("It should leave it alone", func() {
+				So(ipv6Gateway(table), ShouldEqual, "")
+			})
+		})
+	})
+
+	Convey("Given the route table of a private network", t, func() {
+		table := routeTable("rtb-00000000", []string{"subnet-00000000"}, "")
+
+		Convey("It should not route IPv6 traffic", func() {
+			So(ipv6Gateway(table), ShouldEqual, "")
+		})
+	})
+}
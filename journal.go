@@ -0,0 +1,266 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// JournalEntry : an operation on a network, its outcome and the AWS
+// resources it touched
+type JournalEntry struct {
+	UUID      string      `json:"_uuid"`
+	BatchID   string      `json:"_batch_id"`
+	Subject   string      `json:"subject"`
+	Verb      string      `json:"verb"`
+	Outcome   string      `json:"outcome"`
+	Timestamp time.Time   `json:"timestamp"`
+	Resources []component `json:"resources,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	ErrorCode string      `json:"error_code,omitempty"`
+}
+
+const (
+	// journalSubject is where every instance answers with the operations
+	// of a batch it journaled, as each only journals the events it handled
+	journalSubject = "network.history.aws.journal"
+	// journalWait is how long history requests collect those answers
+	journalWait = 2 * time.Second
+)
+
+// journal appends every operation to a JSON lines file per batch, which
+// unlike the event store keeps every attempt of every event
+type journal struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newJournal(dir string) *journal {
+	return &journal{dir: dir}
+}
+
+func (j *journal) path(batch string) (string, error) {
+	if batch == "" {
+		batch = "unbatched"
+	}
+	path, err := eventFile(j.dir, batch)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(path, ".json") + ".jsonl", nil
+}
+
+func (j *journal) append(e JournalEntry) error {
+	path, err := j.path(e.BatchID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// entries returns the operations of a batch, oldest first
+func (j *journal) entries(batch string) ([]JournalEntry, error) {
+	path, err := j.path(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// journalEntry describes an operation from its response
+func journalEntry(subject string, r request, resp []byte, outcome string, now time.Time) JournalEntry {
+	var body struct {
+		NetworkAWSID string      `json:"network_aws_id"`
+		RouteTableID string      `json:"route_table_id"`
+		Components   []component `json:"components"`
+		Error        string      `json:"error"`
+		ErrorCode    string      `json:"error_code"`
+	}
+	json.Unmarshal(resp, &body)
+
+	e := JournalEntry{
+		UUID:      r.UUID,
+		BatchID:   r.BatchID,
+		Subject:   subject,
+		Verb:      verb(subject),
+		Outcome:   outcome,
+		Timestamp: now,
+		Error:     body.Error,
+		ErrorCode: body.ErrorCode,
+	}
+
+	seen := make(map[string]bool)
+	add := func(c component) {
+		if c.ID == "" || seen[c.ID] {
+			return
+		}
+		seen[c.ID] = true
+		e.Resources = append(e.Resources, component{Type: c.Type, ID: c.ID})
+	}
+
+	add(component{Type: "subnet", ID: body.NetworkAWSID})
+	add(component{Type: "route_table", ID: body.RouteTableID})
+	for _, c := range body.Components {
+		add(c)
+	}
+
+	return e
+}
+
+// journalReply : the operations of a batch in the journal of an instance
+type journalReply struct {
+	Operations []JournalEntry `json:"operations"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// journalHandler answers history requests of other instances with the
+// operations of the batch in its own journal
+func journalHandler(m *nats.Msg) {
+	if m.Reply == "" {
+		return
+	}
+
+	var reply journalReply
+	entries, err := operations.entries(parseRequest(m.Data).BatchID)
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	reply.Operations = entries
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+	nc.Publish(m.Reply, data)
+}
+
+// collectHistory gathers the operations of the batch from the journals
+// of every instance answering within wait, oldest first
+func collectHistory(batch string, wait time.Duration) ([]JournalEntry, error) {
+	inbox := nats.NewInbox()
+	replies := make(chan *nats.Msg, 64)
+	sub, err := nc.ChanSubscribe(inbox, replies)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	body, _ := json.Marshal(map[string]string{"_batch_id": batch})
+	if err := nc.PublishRequest(journalSubject, inbox, body); err != nil {
+		return nil, err
+	}
+
+	var journals [][]JournalEntry
+	timeout := time.After(wait)
+	for {
+		select {
+		case m := <-replies:
+			var reply journalReply
+			if err := json.Unmarshal(m.Data, &reply); err != nil {
+				continue
+			}
+			// a partial history would be misleading
+			if reply.Error != "" {
+				return nil, newError(errInternal, "Could not read the journal of an instance: "+reply.Error)
+			}
+			journals = append(journals, reply.Operations)
+		case <-timeout:
+			return mergeJournals(journals), nil
+		}
+	}
+}
+
+// byTimestamp sorts journal entries oldest first
+type byTimestamp []JournalEntry
+
+func (e byTimestamp) Len() int           { return len(e) }
+func (e byTimestamp) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byTimestamp) Less(i, j int) bool { return e[i].Timestamp.Before(e[j].Timestamp) }
+
+// mergeJournals merges the operations of several journals, oldest first
+func mergeJournals(journals [][]JournalEntry) []JournalEntry {
+	entries := []JournalEntry{}
+	for _, j := range journals {
+		entries = append(entries, j...)
+	}
+	sort.Stable(byTimestamp(entries))
+	return entries
+}
+
+// historyHandler answers with the operations of the _batch_id of the
+// event, collected from the journals of every instance
+func historyHandler(m *nats.Msg) {
+	req, _, err := decodeStandalone(m)
+	if err != nil {
+		publishError(m.Subject, errorResponse(nil, err))
+		return
+	}
+
+	if cfg.JournalDir == "" {
+		err := newError(errCapability, "The operation journal is disabled, set JOURNAL_DIR to enable it")
+		publishError(m.Subject, errorResponse(sanitizedBody(m.Data), err))
+		return
+	}
+	if req.BatchID == "" {
+		err := newFieldError(errPayload, "_batch_id", "Network history needs a _batch_id")
+		publishError(m.Subject, errorResponse(sanitizedBody(m.Data), err))
+		return
+	}
+
+	entries, err := collectHistory(req.BatchID, journalWait)
+	if err != nil {
+		publishError(m.Subject, errorResponse(sanitizedBody(m.Data), err))
+		return
+	}
+
+	nc.Publish(m.Subject+".done", setField(sanitizedBody(m.Data), "operations", entries))
+}
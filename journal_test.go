@@ -0,0 +1,91 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJournal(t *testing.T) {
+	Convey("Given an operation journal", t, func() {
+		dir, _ := ioutil.TempDir("", "network-journal")
+		defer os.RemoveAll(dir)
+		j := newJournal(dir)
+		now := time.Now()
+		r := request{UUID: "event-1", BatchID: "batch-1"}
+
+		Convey("When a create fails and is retried", func() {
+			failed := []byte(`{"error":"InsufficientCapacity: no capacity","error_code":"InsufficientCapacity"}`)
+			done := []byte(`{"network_aws_id":"subnet-00000000","route_table_id":"rtb-00000000","components":[{"type":"subnet","id":"subnet-00000000"},{"type":"internet_gateway","id":"igw-00000000"}]}`)
+
+			So(j.append(journalEntry("network.create.aws", r, failed, statusErrored, now)), ShouldBeNil)
+			So(j.append(journalEntry("network.create.aws", r, done, statusDone, now)), ShouldBeNil)
+
+			Convey("It should keep both attempts for the batch, in order", func() {
+				entries, err := j.entries("batch-1")
+				So(err, ShouldBeNil)
+				So(len(entries), ShouldEqual, 2)
+				So(entries[0].Outcome, ShouldEqual, statusErrored)
+				So(entries[0].ErrorCode, ShouldEqual, "InsufficientCapacity")
+				So(entries[1].Outcome, ShouldEqual, statusDone)
+				So(entries[1].Verb, ShouldEqual, "create")
+			})
+
+			Convey("It should record the AWS resources touched, once each", func() {
+				entries, _ := j.entries("batch-1")
+				So(entries[1].Resources, ShouldResemble, []component{
+					{Type: "subnet", ID: "subnet-00000000"},
+					{Type: "route_table", ID: "rtb-00000000"},
+					{Type: "internet_gateway", ID: "igw-00000000"},
+				})
+			})
+		})
+
+		Convey("When querying an unknown batch", func() {
+			entries, err := j.entries("batch-2")
+
+			Convey("It should have no operations", func() {
+				So(err, ShouldBeNil)
+				So(entries, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When querying a batch id escaping the journal", func() {
+			_, err := j.entries("../batch-1")
+
+			Convey("It should refuse it", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestMergeJournals(t *testing.T) {
+	Convey("Given the journals of two instances", t, func() {
+		at := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+		first := []JournalEntry{
+			{UUID: "a", Timestamp: at},
+			{UUID: "c", Timestamp: at.Add(2 * time.Second)},
+		}
+		second := []JournalEntry{{UUID: "b", Timestamp: at.Add(time.Second)}}
+
+		Convey("It should merge their operations oldest first", func() {
+			var uuids []string
+			for _, e := range mergeJournals([][]JournalEntry{first, second}) {
+				uuids = append(uuids, e.UUID)
+			}
+			So(uuids, ShouldResemble, []string{"a", "b", "c"})
+		})
+
+		Convey("It should answer an empty list when none has the batch", func() {
+			So(mergeJournals(nil), ShouldResemble, []JournalEntry{})
+		})
+	})
+}
@@ -0,0 +1,143 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// locks tracks the networks being mutated and the batch mutating them, so
+// a second batch touching the same network is turned away instead of
+// interleaving its operations with the first one
+type locks struct {
+	mu   sync.Mutex
+	held map[string]*lock
+}
+
+type lock struct {
+	batch string
+	count int
+	vpc   string
+	since time.Time
+}
+
+// LockHolder : batch holding a network lock, reported on control requests
+type LockHolder struct {
+	Key     string `json:"key"`
+	Batch   string `json:"batch"`
+	Events  int    `json:"events"`
+	HeldFor int64  `json:"held_ms"`
+}
+
+func newLocks() *locks {
+	return &locks{held: make(map[string]*lock)}
+}
+
+// acquire takes all the keys for the batch, or none of them if any is
+// held by another batch. Keys held by the same batch are shared.
+func (l *locks) acquire(keys []string, batch string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, k := range keys {
+		if h, ok := l.held[k]; ok && h.batch != batch {
+			return newError(errConflict, "Network "+k+" is being modified by batch "+h.batch)
+		}
+	}
+
+	var vpc string
+	for _, k := range keys {
+		if i := strings.Index(k, "/"); i > 0 {
+			vpc = k[:i]
+		}
+	}
+
+	for _, k := range keys {
+		if h, ok := l.held[k]; ok {
+			h.count++
+			continue
+		}
+		l.held[k] = &lock{batch: batch, count: 1, vpc: vpc, since: time.Now()}
+	}
+
+	return nil
+}
+
+func (l *locks) release(keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, k := range keys {
+		h, ok := l.held[k]
+		if !ok {
+			continue
+		}
+
+		h.count--
+		if h.count < 1 {
+			delete(l.held, k)
+		}
+	}
+}
+
+// holders returns the locks held, by VPC. Networks locked by id alone, on
+// events without a range, are listed under unknown.
+func (l *locks) holders(now time.Time) map[string][]LockHolder {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keys := make([]string, 0, len(l.held))
+	for k := range l.held {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	holders := make(map[string][]LockHolder)
+	for _, k := range keys {
+		h := l.held[k]
+		vpc := h.vpc
+		if vpc == "" {
+			vpc = "unknown"
+		}
+		holders[vpc] = append(holders[vpc], LockHolder{
+			Key:     k,
+			Batch:   h.batch,
+			Events:  h.count,
+			HeldFor: milliseconds(now.Sub(h.since)),
+		})
+	}
+
+	return holders
+}
+
+// lockKeys returns the keys identifying the network an event mutates
+func (r request) lockKeys() []string {
+	var keys []string
+
+	if r.NetworkAWSID != "" {
+		keys = append(keys, r.NetworkAWSID)
+	}
+
+	if r.VPCID != "" && r.Subnet != "" {
+		keys = append(keys, r.VPCID+"/"+r.Subnet)
+	}
+
+	// public networks route through the internet gateway of their VPC,
+	// which teardowns may delete
+	if r.VPCID != "" && r.IsPublic {
+		keys = append(keys, internetRoutingKey(r.VPCID))
+	}
+
+	return keys
+}
+
+// internetRoutingKey is the key of the internet gateway of the VPC, held
+// by events routing public networks through it and by those deleting it
+func internetRoutingKey(vpc string) string {
+	return vpc + "/internet_gateway"
+}
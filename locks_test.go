@@ -0,0 +1,130 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLocks(t *testing.T) {
+	Convey("Given a network being mutated by a batch", t, func() {
+		l := newLocks()
+		first := request{BatchID: "first", VPCID: "vpc-0000000", Subnet: "10.0.0.0/24"}
+		So(l.acquire(first.lockKeys(), first.BatchID), ShouldBeNil)
+
+		Convey("When another batch mutates the same range", func() {
+			second := request{BatchID: "second", VPCID: "vpc-0000000", Subnet: "10.0.0.0/24"}
+			err := l.acquire(second.lockKeys(), second.BatchID)
+
+			Convey("It should conflict, naming the first batch", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Network vpc-0000000/10.0.0.0/24 is being modified by batch first")
+				So(err.(*connectorError).code, ShouldEqual, errConflict)
+			})
+		})
+
+		Convey("When the same batch mutates the same range", func() {
+			err := l.acquire(first.lockKeys(), first.BatchID)
+
+			Convey("It should be allowed", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("It should hold the lock until both are released", func() {
+				l.release(first.lockKeys())
+				So(l.held, ShouldNotBeEmpty)
+				l.release(first.lockKeys())
+				So(l.held, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When another batch mutates a different range", func() {
+			other := request{BatchID: "second", VPCID: "vpc-0000000", Subnet: "10.0.1.0/24"}
+			So(l.acquire(other.lockKeys(), other.BatchID), ShouldBeNil)
+		})
+
+		Convey("When the first batch is done", func() {
+			l.release(first.lockKeys())
+
+			Convey("Another batch should be able to mutate the range", func() {
+				second := request{BatchID: "second", VPCID: "vpc-0000000", Subnet: "10.0.0.0/24"}
+				So(l.acquire(second.lockKeys(), second.BatchID), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestLockHolders(t *testing.T) {
+	Convey("Given networks locked by two batches", t, func() {
+		l := newLocks()
+		l.acquire(request{BatchID: "first", VPCID: "vpc-0000000", Subnet: "10.0.0.0/24", NetworkAWSID: "subnet-00000000"}.lockKeys(), "first")
+		l.acquire(request{BatchID: "second", NetworkAWSID: "subnet-11111111"}.lockKeys(), "second")
+
+		Convey("When listing the lock holders", func() {
+			holders := l.holders(time.Now())
+
+			Convey("It should group them by VPC", func() {
+				So(holders["vpc-0000000"], ShouldHaveLength, 2)
+				So(holders["vpc-0000000"][0].Key, ShouldEqual, "subnet-00000000")
+				So(holders["vpc-0000000"][0].Batch, ShouldEqual, "first")
+				So(holders["unknown"], ShouldHaveLength, 1)
+				So(holders["unknown"][0].Batch, ShouldEqual, "second")
+			})
+		})
+	})
+}
+
+func TestAbandonment(t *testing.T) {
+	Convey("Given the handling of an event", t, func() {
+		a := &abandonment{}
+		released := make(chan struct{})
+
+		Convey("When it returned in time", func() {
+			a.then(func() { close(released) })
+
+			Convey("It should release the network right away", func() {
+				So(a.isCancelled(), ShouldBeFalse)
+				select {
+				case <-released:
+				default:
+					t.Error("network still locked")
+				}
+			})
+		})
+
+		Convey("When it was abandoned past its deadline", func() {
+			a.running.Add(1)
+			a.cancel()
+			a.then(func() { close(released) })
+
+			Convey("It should keep the network locked until it returns", func() {
+				So(a.isCancelled(), ShouldBeTrue)
+				select {
+				case <-released:
+					t.Error("network released while still being changed")
+				case <-time.After(10 * time.Millisecond):
+				}
+
+				a.running.Done()
+				select {
+				case <-released:
+				case <-time.After(time.Second):
+					t.Error("network never released")
+				}
+			})
+		})
+	})
+
+	Convey("Given an event handled without a deadline", t, func() {
+		var a *abandonment
+
+		Convey("It should never be cancelled", func() {
+			So(a.isCancelled(), ShouldBeFalse)
+		})
+	})
+}
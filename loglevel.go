@@ -0,0 +1,95 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+)
+
+const (
+	levelInfo  = "info"
+	levelDebug = "debug"
+)
+
+// logLevel is the verbosity of the connector logs, which can be raised
+// at runtime for a while and falls back to the configured one afterwards
+type logLevel struct {
+	mu    sync.Mutex
+	base  string
+	level string
+	until time.Time
+}
+
+func newLogLevel(level string) *logLevel {
+	if level != levelDebug {
+		level = levelInfo
+	}
+	return &logLevel{base: level, level: level}
+}
+
+// set changes the level, for the given time or, when 0, until changed
+// again
+func (l *logLevel) set(level string, d time.Duration, now time.Time) error {
+	if level != levelInfo && level != levelDebug {
+		return newFieldError(errPayload, "level", "Log level must be info or debug")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.level, l.until = level, time.Time{}
+	if d > 0 {
+		l.until = now.Add(d)
+	} else {
+		l.base = level
+	}
+
+	return nil
+}
+
+// current returns the level and until when it applies, zero when it
+// doesn't expire
+func (l *logLevel) current(now time.Time) (string, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.until.IsZero() && now.After(l.until) {
+		l.level, l.until = l.base, time.Time{}
+	}
+
+	return l.level, l.until
+}
+
+func (l *logLevel) debug() bool {
+	level, _ := l.current(time.Now())
+	return level == levelDebug
+}
+
+func logDebug(msg string) {
+	if logs.debug() {
+		fmt.Println("debug: " + msg)
+	}
+}
+
+// debugHandler logs every AWS call the event makes, with its outcome and
+// the SDK retries it took, when debugging
+func debugHandler(r request) func(*awsrequest.Request) {
+	return func(req *awsrequest.Request) {
+		if req.Operation == nil || !logs.debug() {
+			return
+		}
+
+		outcome := "ok"
+		if req.Error != nil {
+			outcome = req.Error.Error()
+		}
+		logDebug("aws " + req.Operation.Name + " for " + r.UUID + " after " + strconv.Itoa(req.RetryCount) + " retries: " + outcome)
+	}
+}
@@ -0,0 +1,54 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogLevel(t *testing.T) {
+	Convey("Given a connector logging at info level", t, func() {
+		now := time.Now()
+		l := newLogLevel("")
+
+		Convey("When debugging is turned on for 10 minutes", func() {
+			So(l.set(levelDebug, 10*time.Minute, now), ShouldBeNil)
+
+			Convey("It should debug until then", func() {
+				level, until := l.current(now.Add(5 * time.Minute))
+				So(level, ShouldEqual, levelDebug)
+				So(until, ShouldEqual, now.Add(10*time.Minute))
+			})
+
+			Convey("It should fall back to info afterwards", func() {
+				level, until := l.current(now.Add(11 * time.Minute))
+				So(level, ShouldEqual, levelInfo)
+				So(until.IsZero(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When debugging is turned on for good", func() {
+			So(l.set(levelDebug, 0, now), ShouldBeNil)
+
+			Convey("It should not expire", func() {
+				level, _ := l.current(now.Add(24 * time.Hour))
+				So(level, ShouldEqual, levelDebug)
+			})
+		})
+
+		Convey("When an unknown level is asked for", func() {
+			err := l.set("trace", 0, now)
+
+			Convey("It should be refused", func() {
+				So(err, ShouldNotBeNil)
+				level, _ := l.current(now)
+				So(level, ShouldEqual, levelInfo)
+			})
+		})
+	})
+}
@@ -5,35 +5,489 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
-	"runtime"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
-	ecc "github.com/ernestio/ernest-config-client"
 	"github.com/ernestio/ernestaws"
 	"github.com/ernestio/ernestaws/network"
 	"github.com/nats-io/nats"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 var nc *nats.Conn
 var natsErr error
 var err error
+var cfg = loadConfig()
+var st = newStats()
+var logs = newLogLevel(cfg.LogLevel)
+var zones = newZoneSelector()
+var capacity = newCapacitySignals(cfg.CapacityWindow)
+var fake = newFakeBackend()
+var inflight = newLocks()
+var waits = newWaitSlots(cfg.MaxWaits)
+var store = newEventStore(cfg.EventStoreDir)
+var operations = newJournal(cfg.JournalDir)
+var creates = newCoalescer()
+var describes = newDescribeCache(cfg.DescribeCacheTTL, cfg.DescribeInterval)
+var routings = newRoutingCache(cfg.RoutingCacheTTL)
+var regions = newRegionSlots(cfg.regionLimit)
+var sessions = newSessionCache()
+var sdkRetries = newRetryCounter()
+var eventCalls = newCallCounter()
+var awsErrors = newErrorCodes()
+var responses = newOutbox(cfg.OutboxDir)
 
+// eventHandler runs create, update and delete events through the pipeline
 func eventHandler(m *nats.Msg) {
+	events.serve(m)
+}
+
+// run hands the event over to ernestaws, within its deadline if it has
+// one, and applies the settings ernestaws doesn't manage
+func run(m *nats.Msg, r request) (string, []byte) {
+	var subject string
+	var data []byte
+	var plan []plannedResource
+
+	// what the VPC routes through before a create isn't ernest's to tag
+	if verb(m.Subject) == "create" && r.ProviderType != providerFake {
+		var err error
+		if r.preexisting, err = routingIDs(readClient(r), r.VPCID); err != nil {
+			return m.Subject + ".error", errorResponse(m.Data, err)
+		}
+	}
+
+	if verb(m.Subject) == "delete" && r.ProviderType != providerFake {
+		var err error
+		if plan, err = planDelete(readClient(r), r); err != nil {
+			return m.Subject + ".error", errorResponse(m.Data, err)
+		}
+		if err := markTeardown(routingClient(r), r, plan); err != nil {
+			return m.Subject + ".error", errorResponse(m.Data, err)
+		}
+		if err := teardownRouting(ec2Client(r), routingClient(r), r, plan); err != nil {
+			return m.Subject + ".error", errorResponse(m.Data, err)
+		}
+		publishProgress(m.Subject, r, stepWaitingInterfaces)
+		if err := waitForInterfaces(readClient(r), r, r.interfaceTimeout(cfg)); err != nil {
+			return m.Subject + ".error", errorResponse(m.Data, err)
+		}
+		publishProgress(m.Subject, r, stepInterfacesFreed)
+		if err := releaseIPv6(ec2Client(r), r); err != nil {
+			return m.Subject + ".error", errorResponse(m.Data, err)
+		}
+	}
+
+	// a _ttl counts from when the event was received, not from each attempt
+	deadline, bounded := r.deadline(r.received)
+	subject, data = createWithFailover(m, r, func(m *nats.Msg) (string, []byte) {
+		return withRetries(r, cfg.RetryAttempts, cfg.RetryBackoff, deadline, func() (string, []byte) {
+			if bounded {
+				return handleWithDeadline(m, r, deadline)
+			}
+			return handle(m, nil)
+		})
+	})
+
+	// ernestaws changes the routing of the VPC with its own client
+	routings.forgetVPC(r.VPCID)
+
+	if verb(m.Subject) == "create" && r.AvailabilityZone != "" && cfg.ZoneErrors != zoneErrorsRaw && finalStatus(subject) == statusErrored && zoneConstrained(data) {
+		data = zoneConstraintResponse(readClient(r), r, data)
+	}
+
+	// the subnet may disappear between the upfront checks and the delete
+	if alreadyDeleted(subject, data) {
+		subject, data = m.Subject+".done", m.Data
+	}
+
+	if finalStatus(subject) == statusDone {
+		switch verb(m.Subject) {
+		case "create":
+			publishProgress(m.Subject, r, stepSubnetCreated)
+		case "delete":
+			publishProgress(m.Subject, r, stepSubnetDeleted)
+		}
+	}
+
+	if finalStatus(subject) == statusDone && len(plan) > 0 {
+		if err := teardownGateways(routingClient(r), r, plan); err != nil {
+			return m.Subject + ".error", errorResponse(data, err)
+		}
+		publishProgress(m.Subject, r, stepRoutingRemoved)
+		data = setField(data, "components", deletedComponents(plan))
+	}
+
+	var undo *undoLog
+	if verb(m.Subject) == "create" {
+		undo = &undoLog{}
+	}
+	subject, data = postProcess(m, r, subject, data, undo)
+
+	if verb(m.Subject) == "create" && finalStatus(subject) == statusErrored && r.ProviderType != providerFake {
+		data = rollback(ec2Client(r), r, undo, data)
+	}
+
+	return subject, data
+}
+
+// respond publishes the event response and its final lifecycle status
+func respond(m *nats.Msg, r request, subject string, data []byte) {
+	if r.profile(cfg) == profileExtended {
+		data = extend(data, r, time.Now())
+		if finalStatus(subject) == statusDone && (verb(m.Subject) == "create" || verb(m.Subject) == "update") && r.ProviderType != providerFake && !r.DryRun {
+			data = extendNetwork(readClient(r), data, r)
+		}
+	}
+
+	if calls := eventCalls.take(r.UUID); len(calls) > 0 && finalStatus(subject) == statusDone {
+		data = setField(data, "aws_calls", calls)
+	}
+
+	if format := r.importFormat(cfg); format != "" && finalStatus(subject) == statusDone && (verb(m.Subject) == "create" || verb(m.Subject) == "update") {
+		data = importSnippet(data, r, format)
+	}
+
+	if r.sealed != nil {
+		data = setFields(data, r.sealed)
+	}
+
+	// analytics and central errors always read the field names of schema 1
+	legacy := data
+	if r.Version == schemaGeneric {
+		data = toGenericFields(data)
+	}
+
+	responses.send(nc.Publish, confirmPublished, subject, data)
+	switch {
+	case finalStatus(subject) == statusErrored:
+		publishCentralError(m.Subject, legacy)
+	case cfg.EventsSubject != "":
+		publishAnalytics(cfg.EventsSubject, analyticsEvent(m.Subject, r, legacy, time.Now()))
+	}
+	publishStatus(m.Subject, r, finalStatus(subject))
+	st.record(r, finalStatus(subject) == statusErrored, r.provisioning)
+	latencies.observe(verb(m.Subject), r, r.provisioning, time.Now())
+
+	if cfg.EventStoreDir != "" {
+		if err := store.save(newRecord(m.Subject, r, m.Data, data, finalStatus(subject))); err != nil {
+			fmt.Println("could not store event " + r.UUID + ": " + err.Error())
+		}
+	}
+
+	if cfg.JournalDir != "" && mutating(m.Subject) {
+		if err := operations.append(journalEntry(m.Subject, r, data, finalStatus(subject), time.Now())); err != nil {
+			fmt.Println("could not journal event " + r.UUID + ": " + err.Error())
+		}
+	}
+
+	if finalStatus(subject) == statusErrored && cfg.diagnostics() {
+		go publishBundle(cfg, newBundle(m.Subject, r, m.Data, data))
+	}
+}
+
+func validate(subject string, data []byte) error {
+	n := network.New(subject, data)
+	if err := n.Process(); err != nil {
+		return err
+	}
+
+	return n.Validate()
+}
+
+// handle hands the event over to ernestaws, unless its handling was
+// cancelled
+func handle(m *nats.Msg, a *abandonment) (string, []byte) {
+	if a.isCancelled() {
+		return m.Subject + ".error", errorResponse(m.Data, newError(errTimeout, "Event deadline exceeded"))
+	}
+
+	// ernestaws answers subjects it doesn't know with a bare .done
+	d, err := parseSubject(m.Subject)
+	if err != nil {
+		return m.Subject + ".error", errorResponse(m.Data, err)
+	}
+	if !contains(handledVerbs, d.Verb) {
+		return m.Subject + ".error", capabilityMissing(m.Data, d.Verb)
+	}
+
+	r := parseRequest(m.Data)
+	if r.ProviderType == providerFake {
+		return fake.handle(m.Subject, m.Data)
+	}
+
+	if d.Verb == "create" {
+		return handleCreate(readClient(r), m, a)
+	}
+
 	n := network.New(m.Subject, m.Data)
 
-	subject, data := ernestaws.Handle(&n)
-	nc.Publish(subject, data)
+	return ernestaws.Handle(&n)
+}
+
+// abandonment tracks the handling of an event left running past its
+// deadline: the connector's own steps stop once it is cancelled, while
+// ernestaws, which can't be interrupted, runs on
+type abandonment struct {
+	mu        sync.Mutex
+	cancelled bool
+	running   sync.WaitGroup
+}
+
+func (a *abandonment) cancel() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.cancelled = true
+}
+
+func (a *abandonment) isCancelled() bool {
+	if a == nil {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.cancelled
+}
+
+// then runs fn once the abandoned handling returned, right away when
+// nothing was abandoned
+func (a *abandonment) then(fn func()) {
+	if !a.isCancelled() {
+		fn()
+		return
+	}
+
+	go func() {
+		a.running.Wait()
+		fn()
+	}()
+}
+
+// handleWithDeadline stops waiting for the event once its deadline is
+// reached and reports a timeout. ernestaws can't be interrupted, so the
+// handling is cancelled, leaving the network locked until it returns, and
+// a late result is logged and dropped.
+func handleWithDeadline(m *nats.Msg, r request, deadline time.Time) (string, []byte) {
+	timeout := newError(errTimeout, "Event deadline exceeded")
+
+	remaining := deadline.Sub(time.Now())
+	if remaining <= 0 {
+		return m.Subject + ".error", errorResponse(m.Data, timeout)
+	}
+
+	a := r.abandoned
+	if a == nil {
+		a = &abandonment{}
+	}
+
+	type result struct {
+		subject string
+		data    []byte
+	}
+
+	done := make(chan result, 1)
+	a.running.Add(1)
+	go func() {
+		defer a.running.Done()
+		subject, data := handle(m, a)
+		done <- result{subject, data}
+	}()
+
+	select {
+	case r := <-done:
+		return r.subject, r.data
+	case <-time.After(remaining):
+		a.cancel()
+		go func() {
+			r := <-done
+			fmt.Println("dropping late response on " + r.subject)
+		}()
+		return m.Subject + ".error", errorResponse(m.Data, timeout)
+	}
 }
 
 func main() {
-	nc = ecc.NewConfig(os.Getenv("NATS_URI")).Nats()
+	if len(os.Args) > 1 && os.Args[1] == "publish" {
+		if err := publishCommand(os.Args[2:]); err != nil {
+			fmt.Println("publish failed: " + err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	runSelftest := flag.Bool("selftest", false, "create, get, update and delete a network in a sandbox VPC and exit")
+	standalone := flag.Bool("standalone", cfg.Standalone, "connect to NATS directly instead of through the ernest config client")
+	natsURL := flag.String("nats", cfg.NATSURL, "NATS server a standalone connector connects to")
+	region := flag.String("region", cfg.DefaultRegion, "AWS region of the events without a datacenter_region, when standalone")
+	flag.Parse()
+	cfg.Standalone, cfg.NATSURL, cfg.DefaultRegion = *standalone, *natsURL, *region
+
+	if *runSelftest {
+		if err := selftest(); err != nil {
+			fmt.Println("selftest failed: " + err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("selftest passed")
+		os.Exit(0)
+	}
+
+	var err error
+	if nc, err = connect(cfg); err != nil {
+		fmt.Println("could not connect to NATS: " + err.Error())
+		os.Exit(1)
+	}
+	nc.SetReconnectHandler(func(*nats.Conn) {
+		responses.flush(nc.Publish, confirmPublished)
+	})
+
+	if err := responses.load(); err != nil {
+		fmt.Println("could not load the outbox: " + err.Error())
+	}
+	responses.flush(nc.Publish, confirmPublished)
+
+	pool := newWorkerPool(cfg.Workers, cfg.WorkerQueue, eventHandler)
+	resubmit = pool.submit
+	ctl := newController(pool.submit)
+	redrive = ctl.handle
+	nc.Subscribe("network.control.aws", ctl.command)
 
-	events := []string{"network.create.aws", "network.delete.aws"}
-	for _, subject := range events {
-		fmt.Println("listening for " + subject)
-		nc.Subscribe(subject, eventHandler)
+	// every replica answers history requests from its own journal
+	if cfg.JournalDir != "" {
+		nc.Subscribe(journalSubject, journalHandler)
 	}
 
-	runtime.Goexit()
+	// every replica keeps its own view of the capacity signals
+	if cfg.CapacitySubject != "" {
+		nc.Subscribe(cfg.CapacitySubject, capacityHandler)
+	}
+
+	var subs []*nats.Subscription
+	queue := func(subject, group string, h nats.MsgHandler) *nats.Subscription {
+		sub, _ := nc.QueueSubscribe(subject, group, h)
+		subs = append(subs, sub)
+		return sub
+	}
+
+	queue(schemaSubject, cfg.QueueGroup, schemaHandler)
+
+	// a single replica replays each request
+	if cfg.EventStoreDir != "" {
+		queue("network.replay.aws", cfg.QueueGroup, replayHandler)
+	}
+
+	routes := newRouter("network", "aws").
+		handle("get", getHandler).
+		handle("find", findHandler).
+		handle("compare", compareHandler).
+		handle("inventory", inventoryHandler).
+		handle("history", historyHandler).
+		handle("create", ctl.handle).
+		handle("update", ctl.handle).
+		handle("delete", ctl.handle)
+
+	environments := newRouter("networks", "aws").
+		handle("delete", environmentHandler).
+		handle("sync", syncHandler).
+		handle("repair", repairHandler)
+
+	for _, rt := range []*router{routes, environments} {
+		for _, subject := range rt.subjects() {
+			sub := queue(subject, cfg.QueueGroup, rt.serve)
+			if mutating(subject) {
+				fmt.Println("listening for " + subject)
+				st.track(sub)
+			}
+		}
+	}
+
+	// a group of its own, as a group only gets one copy of each event
+	// across all of its subscriptions
+	queue("network.*.aws", cfg.QueueGroup+".unsupported", unsupportedHandler)
+
+	go monitor(st, cfg.MonitorSubject, cfg.MonitorInterval)
+	if cfg.MetricsAddr != "" {
+		go serveMetrics(cfg.MetricsAddr)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+
+	shutdown(subs, pool, ctl)
+	os.Exit(0)
+}
+
+// shutdown stops receiving events, so the rest of the queue group picks
+// them up, hands the events already received to the workers, waits for
+// them to finish and publishes the shutdown report
+func shutdown(subs []*nats.Subscription, pool *workerPool, ctl *controller) {
+	fmt.Println("shutting down, draining in-flight events")
+	report := ShutdownReport{Version: version}
+	started := time.Now()
+	completed := st.completedEvents()
+
+	for _, sub := range subs {
+		if sub != nil {
+			sub.Drain()
+		}
+	}
+
+	// core NATS doesn't redeliver, so events still pending once the drain
+	// times out are lost
+	for _, sub := range drainSubscriptions(subs, cfg.DrainTimeout) {
+		if pending, _, err := sub.Pending(); err == nil {
+			report.Abandoned += pending
+		}
+		sub.Unsubscribe()
+	}
+
+	pool.stop()
+
+	// events parked by a pause, a freeze or for a wait slot are only held
+	// in memory. Those handed back meanwhile are dropped by the stopped
+	// workers, so they're counted at worst twice, never missed.
+	if parked := ctl.state().Parked + frozenParked() + waits.waiting(); parked > 0 {
+		fmt.Println(fmt.Sprintf("dropping %d parked events", parked))
+		report.Abandoned += parked
+	}
+	report.Abandoned += pool.droppedEvents()
+	report.Completed = st.completedEvents() - completed
+
+	responses.flush(nc.Publish, confirmPublished)
+	if pending := responses.size(); pending > 0 {
+		fmt.Println(fmt.Sprintf("exiting with %d unpublished responses", pending))
+		report.Unpublished = pending
+	}
+
+	publishShutdownReport(cfg.ShutdownSubject, report.finish(started, time.Now()))
+	nc.Flush()
+	nc.Close()
+}
+
+// drainSubscriptions waits up to timeout for the draining subscriptions to
+// hand their pending events over and close, returning those still open
+func drainSubscriptions(subs []*nats.Subscription, timeout time.Duration) []*nats.Subscription {
+	deadline := time.Now().Add(timeout)
+	for {
+		var open []*nats.Subscription
+		for _, sub := range subs {
+			if sub != nil && sub.IsValid() {
+				open = append(open, sub)
+			}
+		}
+		if len(open) == 0 || !time.Now().Before(deadline) {
+			return open
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 }
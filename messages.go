@@ -0,0 +1,118 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// UserMessage : progress line published for the ernest monitor, which
+// streams it to the users following the build
+type UserMessage struct {
+	UUID      string `json:"_uuid"`
+	BatchID   string `json:"_batch_id"`
+	Subject   string `json:"_subject"`
+	Component string `json:"_component"`
+	State     string `json:"_state"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+}
+
+// stepMessages describe the progress steps to users
+var stepMessages = map[string]string{
+	stepSubnetCreated:     "subnet created",
+	stepIPv6Associated:    "IPv6 range associated",
+	stepRoutesProgrammed:  "routes programmed",
+	stepTagged:            "tagged",
+	stepDependentsReady:   "dependent resources ready",
+	stepStabilized:        "available to other services",
+	stepWaitingInterfaces: "waiting for its network interfaces to be released",
+	stepInterfacesFreed:   "network interfaces released",
+	stepSubnetDeleted:     "subnet deleted",
+	stepRoutingRemoved:    "routing removed",
+
+	stepNATGatewaysDeleted:      "NAT gateways deleted",
+	stepEndpointsDeleted:        "VPC endpoints deleted",
+	stepSubnetsDeleted:          "networks deleted",
+	stepRouteTablesDeleted:      "route tables deleted",
+	stepInternetGatewaysDeleted: "internet gateways deleted",
+}
+
+// userMessage returns the progress line for a status or progress step of
+// a create or delete, and whether there is one
+func userMessage(subject string, r request, status, step string) (UserMessage, bool) {
+	action := verb(subject)
+	if action != "create" && action != "delete" {
+		return UserMessage{}, false
+	}
+
+	m := UserMessage{
+		UUID:      r.UUID,
+		BatchID:   r.BatchID,
+		Subject:   subject,
+		Component: "network",
+		State:     "running",
+		Level:     "INFO",
+	}
+
+	what := "network " + networkLabel(r)
+	if subject == "networks.delete.aws" {
+		what = "networks of " + r.Service
+	}
+	label := strings.ToUpper(what[:1]) + what[1:]
+
+	done := map[string]string{"create": "created", "delete": "deleted"}[action]
+	switch status {
+	case statusReceived:
+		m.Message = map[string]string{"create": "Creating ", "delete": "Deleting "}[action] + what
+	case statusProvisioning, statusVerifying:
+		text, ok := stepMessages[step]
+		if !ok {
+			return m, false
+		}
+		m.Message = label + ": " + text
+	case statusDone:
+		m.State, m.Message = "completed", label+" "+done
+	case statusErrored:
+		m.State, m.Level, m.Message = "errored", "ERROR", label+" could not be "+done
+	default:
+		return m, false
+	}
+
+	return m, true
+}
+
+// networkLabel names the network as users know it
+func networkLabel(r request) string {
+	switch {
+	case r.Name != "" && r.Subnet != "":
+		return r.Name + " (" + r.Subnet + ")"
+	case r.Name != "":
+		return r.Name
+	case r.Subnet != "":
+		return r.Subnet
+	}
+	return r.NetworkAWSID
+}
+
+// publishUserMessage publishes the progress line of a create or delete on
+// USER_MESSAGES_SUBJECT, when set
+func publishUserMessage(subject string, r request, status, step string) {
+	if cfg.MessagesSubject == "" {
+		return
+	}
+
+	m, ok := userMessage(subject, r, status, step)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+
+	nc.Publish(cfg.MessagesSubject, data)
+}
@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUserMessages(t *testing.T) {
+	Convey("Given a network being created", t, func() {
+		r := request{UUID: "uuid", BatchID: "batch", Name: "web", Subnet: "10.1.0.0/24"}
+
+		Convey("When it is received", func() {
+			m, ok := userMessage("network.create.aws", r, statusReceived, "")
+
+			Convey("It should tell users it is being created", func() {
+				So(ok, ShouldBeTrue)
+				So(m.Message, ShouldEqual, "Creating network web (10.1.0.0/24)")
+				So(m.State, ShouldEqual, "running")
+				So(m.Component, ShouldEqual, "network")
+			})
+		})
+
+		Convey("When a step completes", func() {
+			m, _ := userMessage("network.create.aws", r, statusProvisioning, stepRoutesProgrammed)
+
+			Convey("It should describe it", func() {
+				So(m.Message, ShouldEqual, "Network web (10.1.0.0/24): routes programmed")
+			})
+		})
+
+		Convey("When it fails", func() {
+			m, _ := userMessage("network.create.aws.error", r, statusErrored, "")
+
+			Convey("It should report it as an error", func() {
+				So(m.Message, ShouldEqual, "Network web (10.1.0.0/24) could not be created")
+				So(m.State, ShouldEqual, "errored")
+				So(m.Level, ShouldEqual, "ERROR")
+			})
+		})
+
+		Convey("When a step has no message", func() {
+			_, ok := userMessage("network.create.aws", r, statusProvisioning, "")
+
+			Convey("It should publish none", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When it starts verifying", func() {
+			_, ok := userMessage("network.create.aws", r, statusVerifying, "")
+
+			Convey("It should publish none", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given the networks of a service being deleted", t, func() {
+		r := request{Service: "shop"}
+
+		Convey("When a stage completes", func() {
+			m, _ := userMessage("networks.delete.aws", r, statusProvisioning, stepNATGatewaysDeleted)
+
+			Convey("It should name the service", func() {
+				So(m.Message, ShouldEqual, "Networks of shop: NAT gateways deleted")
+			})
+		})
+	})
+
+	Convey("Given a network being updated", t, func() {
+		Convey("It should publish no messages", func() {
+			_, ok := userMessage("network.update.aws", request{Name: "web"}, statusReceived, "")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
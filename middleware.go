@@ -0,0 +1,449 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// event is an event going through the pipeline, along with the request
+// parsed from it once it has been decoded. raw is the message as it was
+// received, credentials still sealed.
+type event struct {
+	msg   *nats.Msg
+	raw   *nats.Msg
+	req   request
+	valid bool
+}
+
+// setField sets a field of the event body handed down the pipeline
+func (e *event) setField(key string, value interface{}) {
+	e.msg = &nats.Msg{Subject: e.msg.Subject, Reply: e.msg.Reply, Data: setField(e.msg.Data, key, value)}
+}
+
+// reparse hands the rewritten event down, parsing its request again while
+// keeping what decode recorded about it
+func (e *event) reparse(data []byte) {
+	e.msg = &nats.Msg{Subject: e.msg.Subject, Reply: e.msg.Reply, Data: data}
+
+	r := parseRequest(data)
+	r.Version, r.sealed, r.received, r.abandoned = e.req.Version, e.req.sealed, e.req.received, e.req.abandoned
+	e.req = r
+}
+
+// fail responds to the event with an error
+func (e *event) fail(err error) {
+	respond(e.msg, e.req, e.msg.Subject+".error", errorResponse(e.msg.Data, err))
+}
+
+// eventFunc handles an event
+type eventFunc func(e *event)
+
+// middleware wraps the rest of the pipeline. It hands the event down by
+// calling next, or responds itself to stop the event there.
+type middleware func(next eventFunc) eventFunc
+
+type stage struct {
+	name string
+	wrap middleware
+}
+
+// pipeline runs events through its middlewares, in the order they were
+// registered, before handing them over to its final handler
+type pipeline struct {
+	stages []stage
+	final  eventFunc
+}
+
+func newPipeline(final eventFunc) *pipeline {
+	return &pipeline{final: final}
+}
+
+// use registers a middleware at the end of the pipeline
+func (p *pipeline) use(name string, m middleware) *pipeline {
+	p.stages = append(p.stages, stage{name: name, wrap: m})
+	return p
+}
+
+// names returns the registered middlewares, in order
+func (p *pipeline) names() []string {
+	var names []string
+	for _, s := range p.stages {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+func (p *pipeline) handler() eventFunc {
+	h := p.final
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		h = p.stages[i].wrap(h)
+	}
+	return h
+}
+
+// serve runs a message through the pipeline
+func (p *pipeline) serve(m *nats.Msg) {
+	p.handler()(&event{msg: m, raw: m})
+}
+
+// events is the pipeline every create, update and delete goes through
+var events = newPipeline(dispatch).
+	use("recovery", recovery).
+	use("metrics", metrics).
+	use("logging", logging).
+	use("decode", decode).
+	use("template", template).
+	use("purpose", purpose).
+	use("freshness", freshness).
+	use("policy", policy).
+	use("freeze", freeze).
+	use("vpc_tag", vpcTag).
+	use("dedupe", dedupe).
+	use("placement", placement).
+	use("wait_guard", waitGuard).
+	use("budget", budget).
+	use("validation", validation)
+
+// recovery responds with an internal error to events whose handling
+// panics, rather than letting them take the connector down
+func recovery(next eventFunc) eventFunc {
+	return func(e *event) {
+		defer func() {
+			if v := recover(); v != nil {
+				err := recovered(v)
+				fmt.Println("recovered while handling " + e.msg.Subject + ": " + err.Error())
+				e.fail(err)
+			}
+		}()
+		next(e)
+	}
+}
+
+func recovered(v interface{}) error {
+	return newError(errInternal, fmt.Sprint("Unexpected failure: ", v))
+}
+
+func metrics(next eventFunc) eventFunc {
+	return func(e *event) {
+		st.start(e.msg.Subject)
+		defer st.finish(e.msg.Subject)
+		next(e)
+	}
+}
+
+func logging(next eventFunc) eventFunc {
+	return func(e *event) {
+		started := time.Now()
+		next(e)
+		fmt.Println(e.msg.Subject + " " + e.req.UUID + " handled in " + time.Since(started).String())
+	}
+}
+
+// decode rejects oversized or malformed payloads, renames the fields of
+// the generic schema, opens encrypted credentials, refusing those the key
+// doesn't open, and parses the request
+func decode(next eventFunc) eventFunc {
+	return func(e *event) {
+		if err := checkPayload(e.msg.Data, cfg.MaxMessageSize, cfg.MaxJSONDepth); err != nil {
+			publishError(e.msg.Subject, errorResponse(nil, err))
+			return
+		}
+
+		legacy, version := fromGenericFields(e.msg.Data)
+		if f := undecryptable(legacy, cfg.CryptoKey); f != "" {
+			publishError(e.msg.Subject, errorResponse(nil, newFieldError(errPayload, f, "Credential "+f+" could not be decrypted with ERNEST_CRYPTO_KEY")))
+			return
+		}
+		opened, sealed := openCredentials(legacy, cfg.CryptoKey)
+		opened, blanked := standaloneDefaults(opened, cfg)
+		for f, v := range blanked {
+			if sealed == nil {
+				sealed = make(map[string]interface{})
+			}
+			sealed[f] = v
+		}
+		e.msg = &nats.Msg{Subject: e.msg.Subject, Reply: e.msg.Reply, Data: opened}
+
+		e.req = parseRequest(e.msg.Data)
+		e.req.Version = version
+		e.req.sealed = sealed
+		e.req.abandoned = &abandonment{}
+		publishStatus(e.msg.Subject, e.req, statusReceived)
+
+		uuid := e.req.UUID
+		eventCalls.watch(uuid)
+		defer eventCalls.take(uuid)
+
+		next(e)
+	}
+}
+
+// decodeStandalone decodes the events of the handlers serving outside of
+// the pipeline as decode does, refusing malformed events and credentials
+// the crypto key doesn't open. It returns the request along with the
+// event, its fields renamed and credentials opened.
+func decodeStandalone(m *nats.Msg) (request, []byte, error) {
+	if err := checkPayload(m.Data, cfg.MaxMessageSize, cfg.MaxJSONDepth); err != nil {
+		return request{}, nil, err
+	}
+
+	legacy, version := fromGenericFields(m.Data)
+	if f := undecryptable(legacy, cfg.CryptoKey); f != "" {
+		return request{}, nil, newFieldError(errPayload, f, "Credential "+f+" could not be decrypted with ERNEST_CRYPTO_KEY")
+	}
+
+	opened, sealed := openCredentials(legacy, cfg.CryptoKey)
+	opened, _ = standaloneDefaults(opened, cfg)
+
+	r := parseRequest(opened)
+	if err := checkRoles(cfg, r); err != nil {
+		return request{}, nil, err
+	}
+
+	r.Version = version
+	r.sealed = sealed
+	return r, opened, nil
+}
+
+// template fills in the defaults of the network template creates and
+// updates reference
+func template(next eventFunc) eventFunc {
+	return func(e *event) {
+		if verb(e.msg.Subject) == "create" || verb(e.msg.Subject) == "update" {
+			data, err := applyTemplate(e.msg.Data, cfg.Templates)
+			if err != nil {
+				e.fail(err)
+				return
+			}
+			e.reparse(data)
+		}
+		next(e)
+	}
+}
+
+// purpose applies the conventions of the platform a network is created
+// or updated for
+func purpose(next eventFunc) eventFunc {
+	return func(e *event) {
+		if (verb(e.msg.Subject) == "create" || verb(e.msg.Subject) == "update") && e.req.Purpose != "" {
+			data, err := applyPurpose(e.msg.Data)
+			if err != nil {
+				e.fail(err)
+				return
+			}
+			e.reparse(data)
+		}
+		next(e)
+	}
+}
+
+func freshness(next eventFunc) eventFunc {
+	return func(e *event) {
+		if e.req.stale(time.Now(), cfg.MaxEventAge) {
+			e.fail(newError(errStale, "Event published at "+e.req.Timestamp+" is older than "+cfg.MaxEventAge.String()))
+			return
+		}
+		next(e)
+	}
+}
+
+func policy(next eventFunc) eventFunc {
+	return func(e *event) {
+		if err := checkPolicy(cfg, e.msg.Subject, e.req); err != nil {
+			e.fail(err)
+			return
+		}
+		next(e)
+	}
+}
+
+// vpcTag resolves the vpc_tag of events without a vpc_id
+func vpcTag(next eventFunc) eventFunc {
+	return func(e *event) {
+		if e.req.VPCID == "" && e.req.VPCTag != "" && e.req.ProviderType != providerFake {
+			id, err := resolveVPC(readClient(e.req), e.req.VPCTag)
+			if err != nil {
+				e.fail(err)
+				return
+			}
+			e.req.VPCID = id
+			e.setField("vpc_id", id)
+		}
+		next(e)
+	}
+}
+
+// dedupe keeps two changes to the same network from running at once
+func dedupe(next eventFunc) eventFunc {
+	return func(e *event) {
+		if mutating(e.msg.Subject) && !e.req.DryRun {
+			keys := e.req.lockKeys()
+			if err := inflight.acquire(keys, e.req.BatchID); err != nil {
+				e.fail(err)
+				return
+			}
+			// ernestaws may still be changing the network past its deadline
+			defer e.req.abandoned.then(func() { inflight.release(keys) })
+		}
+		next(e)
+	}
+}
+
+// placement picks an availability zone for creates without one, avoiding
+// the zones recently short of capacity
+func placement(next eventFunc) eventFunc {
+	return func(e *event) {
+		if verb(e.msg.Subject) == "create" && e.req.AvailabilityZone == "" {
+			region := e.req.DatacenterRegion
+			allowed := cfg.defaultZones(region)
+			if e.req.ProviderType != providerFake {
+				var err error
+				if allowed, err = candidateZones(readClient(e.req), cfg, region); err != nil {
+					e.fail(err)
+					return
+				}
+			}
+
+			candidates := capacity.unconstrained(allowed, time.Now())
+			if az := zones.pick(region, candidates); az != "" {
+				e.setField("availability_zone", az)
+			}
+		}
+		next(e)
+	}
+}
+
+// validation runs the upfront checks against the event and the live
+// network, answers dry run deletes, and times how long it all took
+func validation(next eventFunc) eventFunc {
+	return func(e *event) {
+		m, req := e.msg, e.req
+
+		if err := checkStaticCredentials(m.Subject, req); err != nil {
+			e.fail(err)
+			return
+		}
+
+		if verb(m.Subject) == "create" || verb(m.Subject) == "update" {
+			if err := checkFields(m.Subject, req); err != nil {
+				e.fail(err)
+				return
+			}
+		}
+
+		// other validation failures are reported by ernestaws itself
+		started := time.Now()
+		e.valid = validate(m.Subject, m.Data) == nil
+		if e.valid {
+			publishStatus(m.Subject, req, statusValidated)
+		}
+
+		if e.valid && (verb(m.Subject) == "create" || verb(m.Subject) == "update") {
+			if err := validRoutes(req.Routes); err != nil {
+				e.fail(err)
+				return
+			}
+		}
+
+		if e.valid && cfg.AccountCheck && mutating(m.Subject) && req.ProviderType != providerFake {
+			if err := checkAccount(stsClient(req), readClient(req), req); err != nil {
+				e.fail(err)
+				return
+			}
+		}
+
+		if e.valid && existing(m.Subject) && req.ProviderType != providerFake {
+			gone, err := checkNetwork(readClient(req), m.Subject, req)
+			if err == nil && gone && verb(m.Subject) == "delete" {
+				// an interrupted delete may have left its routing behind
+				gone, err = teardownFinished(readClient(req), req)
+			}
+			if err != nil {
+				e.fail(err)
+				return
+			}
+			if gone {
+				respond(m, req, m.Subject+".done", m.Data)
+				return
+			}
+		}
+
+		if e.valid && verb(m.Subject) == "create" && req.ProviderType != providerFake {
+			if err := checkVPCRange(readClient(req), req); err != nil {
+				e.fail(err)
+				return
+			}
+			if err := checkZoneExists(readClient(req), req); err != nil {
+				e.fail(err)
+				return
+			}
+		}
+
+		if e.valid && verb(m.Subject) == "delete" && req.DryRun {
+			plan := []plannedResource{{Type: "subnet", ID: req.NetworkAWSID, Action: actionDelete}}
+			if req.ProviderType != providerFake {
+				var err error
+				if plan, err = planDelete(readClient(req), req); err != nil {
+					e.fail(err)
+					return
+				}
+			}
+			respond(m, req, m.Subject+".done", setFields(m.Data, map[string]interface{}{"dry_run": true, "resources": plan}))
+			return
+		}
+
+		if e.valid && verb(m.Subject) == "delete" && req.ProviderType != providerFake {
+			if err := checkBlockers(readClient(req), m.Subject, req); err != nil {
+				e.fail(err)
+				return
+			}
+		}
+
+		if e.valid {
+			publishStatus(m.Subject, req, statusProvisioning)
+		}
+		e.req.validation = time.Since(started)
+
+		next(e)
+	}
+}
+
+// dispatch hands the event over to ernestaws, one create per range at a
+// time, and responds with the outcome
+func dispatch(e *event) {
+	m := e.msg
+
+	if mutating(m.Subject) {
+		regions.acquire(e.req.DatacenterRegion)
+		defer regions.release(e.req.DatacenterRegion)
+	}
+
+	var subject string
+	var data []byte
+
+	started := time.Now()
+	if verb(m.Subject) == "create" {
+		var shared bool
+		var err error
+		subject, data, shared, err = creates.do(e.req.VPCID+"/"+e.req.Subnet, func() (string, []byte) {
+			return run(m, e.req)
+		})
+		switch {
+		case err != nil:
+			subject, data = m.Subject+".error", errorResponse(m.Data, err)
+		case shared:
+			data = setField(data, "_uuid", e.req.UUID)
+		}
+	} else {
+		subject, data = run(m, e.req)
+	}
+	e.req.provisioning = time.Since(started)
+
+	respond(m, e.req, subject, data)
+}
@@ -0,0 +1,209 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// mockEC2 serves subnets and route tables from memory and records the
+// calls mutating them. Calls it doesn't implement panic through the nil
+// embedded interface.
+type mockEC2 struct {
+	ec2API
+
+	vpcs     []*ec2.Vpc
+	subnets  []*ec2.Subnet
+	tables   []*ec2.RouteTable
+	zones    []*ec2.AvailabilityZone
+	gateways []*ec2.InternetGateway
+	calls    []string
+}
+
+// DescribeVpcs serves a VPC per page, to exercise pagination
+func (m *mockEC2) DescribeVpcs(in *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	page, _ := strconv.Atoi(aws.StringValue(in.NextToken))
+	if page >= len(m.vpcs) {
+		return &ec2.DescribeVpcsOutput{}, nil
+	}
+
+	out := &ec2.DescribeVpcsOutput{Vpcs: m.vpcs[page : page+1]}
+	if page+1 < len(m.vpcs) {
+		out.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+	return out, nil
+}
+
+func (m *mockEC2) DescribeInternetGateways(in *ec2.DescribeInternetGatewaysInput) (*ec2.DescribeInternetGatewaysOutput, error) {
+	return &ec2.DescribeInternetGatewaysOutput{InternetGateways: m.gateways}, nil
+}
+
+func (m *mockEC2) DescribeSubnets(in *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	if len(in.SubnetIds) == 0 {
+		return &ec2.DescribeSubnetsOutput{Subnets: filterSubnets(m.subnets, in.Filters)}, nil
+	}
+
+	for _, s := range m.subnets {
+		if aws.StringValue(s.SubnetId) == aws.StringValue(in.SubnetIds[0]) {
+			return &ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{s}}, nil
+		}
+	}
+	return nil, awserr.New("InvalidSubnetID.NotFound", "The subnet ID does not exist", nil)
+}
+
+func (m *mockEC2) DescribeAvailabilityZones(in *ec2.DescribeAvailabilityZonesInput) (*ec2.DescribeAvailabilityZonesOutput, error) {
+	return &ec2.DescribeAvailabilityZonesOutput{AvailabilityZones: m.zones}, nil
+}
+
+func (m *mockEC2) DescribeRouteTables(in *ec2.DescribeRouteTablesInput) (*ec2.DescribeRouteTablesOutput, error) {
+	if len(in.RouteTableIds) == 0 {
+		return &ec2.DescribeRouteTablesOutput{RouteTables: m.tables}, nil
+	}
+
+	if t := m.table(in.RouteTableIds[0]); t != nil {
+		return &ec2.DescribeRouteTablesOutput{RouteTables: []*ec2.RouteTable{t}}, nil
+	}
+	return nil, awserr.New("InvalidRouteTableID.NotFound", "The routeTable ID does not exist", nil)
+}
+
+func (m *mockEC2) DescribeNatGateways(in *ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error) {
+	return &ec2.DescribeNatGatewaysOutput{}, nil
+}
+
+func (m *mockEC2) DescribeFlowLogs(in *ec2.DescribeFlowLogsInput) (*ec2.DescribeFlowLogsOutput, error) {
+	return &ec2.DescribeFlowLogsOutput{}, nil
+}
+
+func (m *mockEC2) CreateRouteTable(in *ec2.CreateRouteTableInput) (*ec2.CreateRouteTableOutput, error) {
+	m.calls = append(m.calls, "CreateRouteTable")
+	table := &ec2.RouteTable{RouteTableId: aws.String("rtb-11111111"), VpcId: in.VpcId}
+	m.tables = append(m.tables, table)
+	return &ec2.CreateRouteTableOutput{RouteTable: table}, nil
+}
+
+func (m *mockEC2) AssociateRouteTable(in *ec2.AssociateRouteTableInput) (*ec2.AssociateRouteTableOutput, error) {
+	m.calls = append(m.calls, "AssociateRouteTable")
+	return &ec2.AssociateRouteTableOutput{AssociationId: aws.String("rtbassoc-11111111")}, nil
+}
+
+func (m *mockEC2) CreateRoute(in *ec2.CreateRouteInput) (*ec2.CreateRouteOutput, error) {
+	rt := &ec2.Route{
+		DestinationCidrBlock:        in.DestinationCidrBlock,
+		DestinationIpv6CidrBlock:    in.DestinationIpv6CidrBlock,
+		DestinationPrefixListId:     in.DestinationPrefixListId,
+		GatewayId:                   in.GatewayId,
+		VpcPeeringConnectionId:      in.VpcPeeringConnectionId,
+		InstanceId:                  in.InstanceId,
+		NatGatewayId:                in.NatGatewayId,
+		TransitGatewayId:            in.TransitGatewayId,
+		EgressOnlyInternetGatewayId: in.EgressOnlyInternetGatewayId,
+	}
+	m.calls = append(m.calls, "CreateRoute "+routeDestination(rt))
+	if t := m.table(in.RouteTableId); t != nil {
+		t.Routes = append(t.Routes, rt)
+	}
+	return &ec2.CreateRouteOutput{}, nil
+}
+
+func (m *mockEC2) ReplaceRoute(in *ec2.ReplaceRouteInput) (*ec2.ReplaceRouteOutput, error) {
+	m.calls = append(m.calls, "ReplaceRoute "+aws.StringValue(in.DestinationCidrBlock))
+	if t := m.table(in.RouteTableId); t != nil {
+		for _, rt := range t.Routes {
+			if routeDestination(rt) == aws.StringValue(in.DestinationCidrBlock) {
+				*rt = ec2.Route{
+					DestinationCidrBlock:   in.DestinationCidrBlock,
+					GatewayId:              in.GatewayId,
+					VpcPeeringConnectionId: in.VpcPeeringConnectionId,
+					InstanceId:             in.InstanceId,
+					NatGatewayId:           in.NatGatewayId,
+				}
+			}
+		}
+	}
+	return &ec2.ReplaceRouteOutput{}, nil
+}
+
+func (m *mockEC2) DeleteRoute(in *ec2.DeleteRouteInput) (*ec2.DeleteRouteOutput, error) {
+	m.calls = append(m.calls, "DeleteRoute "+aws.StringValue(in.DestinationCidrBlock))
+	if t := m.table(in.RouteTableId); t != nil {
+		var kept []*ec2.Route
+		for _, rt := range t.Routes {
+			if routeDestination(rt) != aws.StringValue(in.DestinationCidrBlock) {
+				kept = append(kept, rt)
+			}
+		}
+		t.Routes = kept
+	}
+	return &ec2.DeleteRouteOutput{}, nil
+}
+
+// CreateTags tags the subnets, route tables and internet gateways it
+// serves
+func (m *mockEC2) CreateTags(in *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	for _, id := range in.Resources {
+		m.calls = append(m.calls, "CreateTags "+aws.StringValue(id))
+		for _, s := range m.subnets {
+			if aws.StringValue(s.SubnetId) == aws.StringValue(id) {
+				s.Tags = append(s.Tags, in.Tags...)
+			}
+		}
+		if t := m.table(id); t != nil {
+			t.Tags = append(t.Tags, in.Tags...)
+		}
+		for _, g := range m.gateways {
+			if aws.StringValue(g.InternetGatewayId) == aws.StringValue(id) {
+				g.Tags = append(g.Tags, in.Tags...)
+			}
+		}
+	}
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (m *mockEC2) ModifySubnetAttribute(in *ec2.ModifySubnetAttributeInput) (*ec2.ModifySubnetAttributeOutput, error) {
+	call := "ModifySubnetAttribute " + aws.StringValue(in.SubnetId)
+	if in.EnableResourceNameDnsARecordOnLaunch != nil {
+		call += fmt.Sprintf(" A=%t", aws.BoolValue(in.EnableResourceNameDnsARecordOnLaunch.Value))
+	}
+	if in.EnableResourceNameDnsAAAARecordOnLaunch != nil {
+		call += fmt.Sprintf(" AAAA=%t", aws.BoolValue(in.EnableResourceNameDnsAAAARecordOnLaunch.Value))
+	}
+	m.calls = append(m.calls, call)
+	return &ec2.ModifySubnetAttributeOutput{}, nil
+}
+
+// table returns the route table with the given id
+func (m *mockEC2) table(id *string) *ec2.RouteTable {
+	for _, t := range m.tables {
+		if aws.StringValue(t.RouteTableId) == aws.StringValue(id) {
+			return t
+		}
+	}
+	return nil
+}
+
+// filterSubnets applies the vpc-id and cidr-block filters
+func filterSubnets(subnets []*ec2.Subnet, filters []*ec2.Filter) []*ec2.Subnet {
+	var matched []*ec2.Subnet
+	for _, s := range subnets {
+		match := true
+		for _, f := range filters {
+			switch aws.StringValue(f.Name) {
+			case "vpc-id":
+				match = match && aws.StringValue(s.VpcId) == aws.StringValue(f.Values[0])
+			case "cidr-block":
+				match = match && aws.StringValue(s.CidrBlock) == aws.StringValue(f.Values[0])
+			}
+		}
+		if match {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,97 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// routeThroughNAT gives a private network a route table of its own, unless
+// it already has one, sending its internet traffic to the NAT gateway of
+// the event. It returns the id of the route table.
+func routeThroughNAT(client ec2API, r request, id string) (string, error) {
+	table, err := ownRouteTable(client, id)
+	if err != nil {
+		return "", err
+	}
+
+	if route := defaultRoute(table); route != nil {
+		if aws.StringValue(route.NatGatewayId) == r.NATGatewayID {
+			return aws.StringValue(table.RouteTableId), nil
+		}
+
+		_, err = client.ReplaceRoute(&ec2.ReplaceRouteInput{
+			RouteTableId:         table.RouteTableId,
+			DestinationCidrBlock: aws.String("0.0.0.0/0"),
+			NatGatewayId:         aws.String(r.NATGatewayID),
+		})
+	} else {
+		_, err = client.CreateRoute(&ec2.CreateRouteInput{
+			RouteTableId:         table.RouteTableId,
+			DestinationCidrBlock: aws.String("0.0.0.0/0"),
+			NatGatewayId:         aws.String(r.NATGatewayID),
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(table.RouteTableId), nil
+}
+
+// ownRouteTable returns the route table explicitly associated to the
+// network, creating and associating one when it still uses the main route
+// table of the VPC
+func ownRouteTable(client ec2API, id string) (*ec2.RouteTable, error) {
+	subnet, err := describeSubnet(client, id)
+	if err != nil {
+		return nil, err
+	}
+	if subnet == nil {
+		return nil, newError(errNotFound, "Network "+id+" does not exist")
+	}
+
+	tables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{subnet.VpcId}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	table := subnetRouteTable(subnet, tables.RouteTables)
+	if table != nil && associatedWith(table, id) {
+		return table, nil
+	}
+
+	created, err := client.CreateRouteTable(&ec2.CreateRouteTableInput{VpcId: subnet.VpcId})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.AssociateRouteTable(&ec2.AssociateRouteTableInput{
+		RouteTableId: created.RouteTable.RouteTableId,
+		SubnetId:     aws.String(id),
+	})
+	if err != nil {
+		// an unassociated table would be left behind for good
+		client.DeleteRouteTable(&ec2.DeleteRouteTableInput{RouteTableId: created.RouteTable.RouteTableId})
+		return nil, err
+	}
+
+	return created.RouteTable, nil
+}
+
+// defaultRoute returns the IPv4 default route of the route table
+func defaultRoute(table *ec2.RouteTable) *ec2.Route {
+	for _, route := range table.Routes {
+		if aws.StringValue(route.DestinationCidrBlock) == "0.0.0.0/0" {
+			return route
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// associationFailingEC2 fails to associate route tables
+type associationFailingEC2 struct {
+	*mockEC2
+}
+
+func (m *associationFailingEC2) AssociateRouteTable(in *ec2.AssociateRouteTableInput) (*ec2.AssociateRouteTableOutput, error) {
+	m.calls = append(m.calls, "AssociateRouteTable")
+	return nil, awserr.New("Resource.AlreadyAssociated", "the specified association for route table already exists", nil)
+}
+
+func (m *associationFailingEC2) DeleteRouteTable(in *ec2.DeleteRouteTableInput) (*ec2.DeleteRouteTableOutput, error) {
+	m.calls = append(m.calls, "DeleteRouteTable "+aws.StringValue(in.RouteTableId))
+	return &ec2.DeleteRouteTableOutput{}, nil
+}
+
+func TestDefaultRoute(t *testing.T) {
+	Convey("Given a route table", t, func() {
+		Convey("When it routes internet traffic", func() {
+			table := routeTable("rtb-00000000", nil, "igw-00000000")
+
+			Convey("It should find the default route", func() {
+				So(defaultRoute(table), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When it only has local routes", func() {
+			table := routeTable("rtb-00000000", nil, "")
+
+			Convey("It should find no default route", func() {
+				So(defaultRoute(table), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestRouteThroughNAT(t *testing.T) {
+	Convey("Given a private network using the main route table", t, func() {
+		main := routeTable("rtb-00000000", nil, "")
+		main.VpcId = aws.String("vpc-0000000")
+		main.Associations = []*ec2.RouteTableAssociation{{Main: aws.Bool(true)}}
+
+		client := &mockEC2{
+			subnets: []*ec2.Subnet{{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000")}},
+			tables:  []*ec2.RouteTable{main},
+		}
+
+		Convey("When routing it through a NAT gateway", func() {
+			id, err := routeThroughNAT(client, request{NATGatewayID: "nat-00000000"}, "subnet-00000000")
+
+			Convey("It should give it a route table of its own", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "rtb-11111111")
+				So(client.calls, ShouldResemble, []string{"CreateRouteTable", "AssociateRouteTable", "CreateRoute 0.0.0.0/0"})
+			})
+		})
+
+		Convey("When its new route table can't be associated", func() {
+			_, err := routeThroughNAT(&associationFailingEC2{client}, request{NATGatewayID: "nat-00000000"}, "subnet-00000000")
+
+			Convey("It should delete the route table", func() {
+				So(err, ShouldNotBeNil)
+				So(client.calls, ShouldResemble, []string{"CreateRouteTable", "AssociateRouteTable", "DeleteRouteTable rtb-11111111"})
+			})
+		})
+	})
+}
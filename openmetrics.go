@@ -0,0 +1,137 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the event latency
+// histograms
+var latencyBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// exemplar is the last event observed in a histogram bucket, linking the
+// bucket to the build it came from
+type exemplar struct {
+	uuid  string
+	batch string
+	value float64
+	at    time.Time
+}
+
+type histogram struct {
+	counts    []int
+	exemplars []*exemplar
+	sum       float64
+	count     int
+}
+
+// histograms keeps the event latency histograms of each verb
+type histograms struct {
+	mu     sync.Mutex
+	bounds []float64
+	byVerb map[string]*histogram
+}
+
+func newHistograms(bounds []float64) *histograms {
+	return &histograms{bounds: bounds, byVerb: make(map[string]*histogram)}
+}
+
+// observe records the latency of an event, making it the exemplar of the
+// bucket it falls in
+func (h *histograms) observe(v string, r request, latency time.Duration, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist, ok := h.byVerb[v]
+	if !ok {
+		hist = &histogram{
+			counts:    make([]int, len(h.bounds)+1),
+			exemplars: make([]*exemplar, len(h.bounds)+1),
+		}
+		h.byVerb[v] = hist
+	}
+
+	value := latency.Seconds()
+	i := sort.SearchFloat64s(h.bounds, value)
+	hist.counts[i]++
+	hist.sum += value
+	hist.count++
+	if r.UUID != "" {
+		hist.exemplars[i] = &exemplar{uuid: r.UUID, batch: r.BatchID, value: value, at: now}
+	}
+}
+
+// write renders the histograms in the OpenMetrics text format
+func (h *histograms) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name := "network_aws_event_duration_seconds"
+	fmt.Fprintln(w, "# TYPE "+name+" histogram")
+	fmt.Fprintln(w, "# HELP "+name+" Time spent provisioning network events on AWS, by verb.")
+
+	var verbs []string
+	for v := range h.byVerb {
+		verbs = append(verbs, v)
+	}
+	sort.Strings(verbs)
+
+	for _, v := range verbs {
+		hist := h.byVerb[v]
+		verbLabel := `verb="` + labelValue(v) + `"`
+
+		var cumulative int
+		for i, count := range hist.counts {
+			cumulative += count
+
+			le := "+Inf"
+			if i < len(h.bounds) {
+				le = strconv.FormatFloat(h.bounds[i], 'f', -1, 64)
+			}
+
+			line := name + "_bucket{" + verbLabel + `,le="` + le + `"} ` + strconv.Itoa(cumulative)
+			if e := hist.exemplars[i]; e != nil {
+				line += ` # {event_uuid="` + labelValue(e.uuid) + `",batch_id="` + labelValue(e.batch) + `"} ` +
+					strconv.FormatFloat(e.value, 'f', -1, 64) + " " +
+					strconv.FormatFloat(float64(e.at.UnixNano())/1e9, 'f', 3, 64)
+			}
+			fmt.Fprintln(w, line)
+		}
+
+		fmt.Fprintln(w, name+"_sum{"+verbLabel+"} "+strconv.FormatFloat(hist.sum, 'f', -1, 64))
+		fmt.Fprintln(w, name+"_count{"+verbLabel+"} "+strconv.Itoa(hist.count))
+	}
+
+	fmt.Fprintln(w, "# EOF")
+}
+
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+var latencies = newHistograms(latencyBuckets)
+
+// serveMetrics exposes the AWS error counters and the event latency
+// histograms, with their exemplars, on /metrics of addr for Prometheus to scrape
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		awsErrors.write(w)
+		latencies.write(w)
+	})
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Println("could not serve metrics on " + addr + ": " + err.Error())
+	}
+}
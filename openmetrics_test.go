@@ -0,0 +1,46 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHistograms(t *testing.T) {
+	Convey("Given the latencies of a few creates", t, func() {
+		h := newHistograms([]float64{1, 10})
+		at := time.Unix(1500000000, 0)
+		h.observe("create", request{UUID: "event-1", BatchID: "batch-1"}, 500*time.Millisecond, at)
+		h.observe("create", request{UUID: "event-2", BatchID: "batch-1"}, 4*time.Second, at)
+		h.observe("create", request{UUID: "event-3", BatchID: "batch-2"}, time.Minute, at)
+
+		Convey("When they are rendered", func() {
+			var out bytes.Buffer
+			h.write(&out)
+			text := out.String()
+
+			Convey("It should count them in cumulative buckets", func() {
+				So(text, ShouldContainSubstring, `network_aws_event_duration_seconds_bucket{verb="create",le="1"} 1`)
+				So(text, ShouldContainSubstring, `network_aws_event_duration_seconds_bucket{verb="create",le="10"} 2`)
+				So(text, ShouldContainSubstring, `network_aws_event_duration_seconds_bucket{verb="create",le="+Inf"} 3`)
+				So(text, ShouldContainSubstring, `network_aws_event_duration_seconds_count{verb="create"} 3`)
+				So(text, ShouldContainSubstring, `network_aws_event_duration_seconds_sum{verb="create"} 64.5`)
+			})
+
+			Convey("It should link each bucket to the event it counted last", func() {
+				So(text, ShouldContainSubstring, `le="10"} 2 # {event_uuid="event-2",batch_id="batch-1"} 4 1500000000.000`)
+				So(text, ShouldContainSubstring, `le="+Inf"} 3 # {event_uuid="event-3",batch_id="batch-2"} 60 1500000000.000`)
+			})
+
+			Convey("It should end the exposition", func() {
+				So(text, ShouldEndWith, "# EOF\n")
+			})
+		})
+	})
+}
@@ -0,0 +1,124 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const resultOrphaned = "orphaned"
+
+// orphanedGateway is an internet gateway ernest created that no network
+// routes through any more, and what its cleanup did
+type orphanedGateway struct {
+	ID     string `json:"id"`
+	VPCID  string `json:"vpc_id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// cleanupInternetGateways finds the internet gateways leaked by earlier
+// connector versions, which carry ernest tags but are attached to VPCs
+// without any public network, and detaches and deletes them unless the
+// event is a dry run. It stops at the first failure.
+func cleanupInternetGateways(client, routing ec2API, r request) ([]orphanedGateway, error) {
+	var candidates []orphanedGateway
+
+	input := &ec2.DescribeInternetGatewaysInput{}
+	for {
+		resp, err := client.DescribeInternetGateways(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range resp.InternetGateways {
+			if !createdByErnest(g.Tags) {
+				continue
+			}
+			for _, a := range g.Attachments {
+				candidates = append(candidates, orphanedGateway{ID: aws.StringValue(g.InternetGatewayId), VPCID: aws.StringValue(a.VpcId)})
+			}
+		}
+		if aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		input.NextToken = resp.NextToken
+	}
+
+	orphans := []orphanedGateway{}
+	for _, c := range candidates {
+		c, err := cleanupInternetGateway(client, routing, r, c)
+		if err != nil {
+			return append(orphans, c), err
+		}
+		if c.Status != "" {
+			orphans = append(orphans, c)
+		}
+	}
+
+	return orphans, nil
+}
+
+// cleanupInternetGateway checks whether a network of the VPC routes
+// through the gateway and deletes it if none does. Unless the event is a
+// dry run the VPC internet routing lock is held from the check to the
+// delete, so a public network being created can't start routing through
+// the gateway in between; a gateway whose VPC is locked by another batch
+// is skipped and left for a later cleanup.
+func cleanupInternetGateway(client, routing ec2API, r request, c orphanedGateway) (orphanedGateway, error) {
+	if !r.DryRun {
+		keys := []string{internetRoutingKey(c.VPCID)}
+		if err := inflight.acquire(keys, r.BatchID); err != nil {
+			c.Status, c.Error = resultSkipped, err.Error()
+			return c, nil
+		}
+		defer inflight.release(keys)
+	}
+
+	vpc := []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(c.VPCID)}}}
+
+	subnets, err := client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: vpc})
+	if err != nil {
+		return c, err
+	}
+	tables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: vpc})
+	if err != nil {
+		return c, err
+	}
+
+	if routedThrough(c.ID, c.VPCID, subnets.Subnets, tables.RouteTables) {
+		return c, nil
+	}
+
+	c.Status = resultOrphaned
+	if r.DryRun {
+		return c, nil
+	}
+
+	network := r
+	network.VPCID = c.VPCID
+	err = deleteEnvironmentResource(client, routing, network, plannedResource{Type: "internet_gateway", ID: c.ID})
+	if err != nil {
+		c.Status, c.Error = resultFailed, err.Error()
+		return c, err
+	}
+	c.Status = resultDeleted
+
+	return c, nil
+}
+
+// routedThrough reports whether any network of the VPC routes through the
+// internet gateway, with its own route table or the main one
+func routedThrough(gateway, vpc string, subnets []*ec2.Subnet, tables []*ec2.RouteTable) bool {
+	for _, s := range subnets {
+		if aws.StringValue(s.VpcId) != vpc {
+			continue
+		}
+		if t := subnetRouteTable(s, tables); t != nil && routesThrough(t, gateway) {
+			return true
+		}
+	}
+	return false
+}
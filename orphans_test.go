@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCleanupInternetGateways(t *testing.T) {
+	Convey("Given ernest internet gateways, one of which no network routes through", t, func() {
+		managed := []*ec2.Tag{{Key: aws.String("ernest.service"), Value: aws.String("web")}}
+		client := &teardownEC2{mockEC2: mockEC2{
+			gateways: []*ec2.InternetGateway{
+				{InternetGatewayId: aws.String("igw-00000000"), Tags: managed, Attachments: []*ec2.InternetGatewayAttachment{{VpcId: aws.String("vpc-0000000")}}},
+				{InternetGatewayId: aws.String("igw-11111111"), Tags: managed, Attachments: []*ec2.InternetGatewayAttachment{{VpcId: aws.String("vpc-1111111")}}},
+				{InternetGatewayId: aws.String("igw-22222222"), Attachments: []*ec2.InternetGatewayAttachment{{VpcId: aws.String("vpc-2222222")}}},
+			},
+			subnets: []*ec2.Subnet{
+				{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000")},
+				{SubnetId: aws.String("subnet-11111111"), VpcId: aws.String("vpc-1111111")},
+			},
+			tables: []*ec2.RouteTable{
+				{RouteTableId: aws.String("rtb-00000000"), VpcId: aws.String("vpc-0000000"),
+					Associations: []*ec2.RouteTableAssociation{{Main: aws.Bool(true)}},
+					Routes:       []*ec2.Route{{DestinationCidrBlock: aws.String("0.0.0.0/0"), GatewayId: aws.String("igw-00000000")}}},
+				{RouteTableId: aws.String("rtb-11111111"), VpcId: aws.String("vpc-1111111"),
+					Associations: []*ec2.RouteTableAssociation{{Main: aws.Bool(true)}}},
+			},
+		}}
+
+		Convey("When cleaning up as a dry run", func() {
+			orphans, err := cleanupInternetGateways(client, client, request{DryRun: true})
+
+			Convey("It should only report the orphaned one", func() {
+				So(err, ShouldBeNil)
+				So(orphans, ShouldResemble, []orphanedGateway{{ID: "igw-11111111", VPCID: "vpc-1111111", Status: resultOrphaned}})
+				So(client.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When cleaning up", func() {
+			orphans, err := cleanupInternetGateways(client, client, request{})
+
+			Convey("It should detach and delete it", func() {
+				So(err, ShouldBeNil)
+				So(orphans[0].Status, ShouldEqual, resultDeleted)
+				So(client.calls, ShouldResemble, []string{"DetachInternetGateway igw-11111111", "DeleteInternetGateway igw-11111111"})
+			})
+		})
+
+		Convey("When another batch is creating a public network in its VPC", func() {
+			keys := []string{internetRoutingKey("vpc-1111111")}
+			So(inflight.acquire(keys, "create"), ShouldBeNil)
+			defer inflight.release(keys)
+
+			orphans, err := cleanupInternetGateways(client, client, request{BatchID: "cleanup"})
+
+			Convey("It should skip it and leave it in place", func() {
+				So(err, ShouldBeNil)
+				So(orphans[0].Status, ShouldEqual, resultSkipped)
+				So(client.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the deletion fails", func() {
+			client.failing = "igw-11111111"
+			orphans, err := cleanupInternetGateways(client, client, request{})
+
+			Convey("It should report the failure", func() {
+				So(err, ShouldNotBeNil)
+				So(orphans[0].Status, ShouldEqual, resultFailed)
+			})
+		})
+	})
+}
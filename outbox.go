@@ -0,0 +1,253 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	publishAttempts = 5
+	publishBackoff  = 100 * time.Millisecond
+	publishTimeout  = 5 * time.Second
+)
+
+// publishFunc publishes a message, nc.Publish outside of tests
+type publishFunc func(subject string, data []byte) error
+
+// confirmFunc waits for NATS to have received what was published so far,
+// as the client only buffers it, confirmPublished outside of tests
+type confirmFunc func() error
+
+// confirmPublished flushes the NATS connection, bounded by publishTimeout
+func confirmPublished() error {
+	return nc.FlushTimeout(publishTimeout)
+}
+
+// outgoing is a response waiting to be published
+type outgoing struct {
+	Subject string `json:"subject"`
+	Data    []byte `json:"data"`
+
+	path string
+}
+
+// outbox holds the responses that couldn't be published, until NATS is
+// reachable again. With a spool directory every response is written to
+// disk until NATS confirms it received it, so none is lost across
+// restarts.
+type outbox struct {
+	mu          sync.Mutex
+	dir         string
+	seq         int
+	pending     []outgoing
+	unconfirmed []outgoing
+}
+
+func newOutbox(dir string) *outbox {
+	return &outbox{dir: dir}
+}
+
+// publishWithRetry publishes a message, retrying with exponential backoff
+// while NATS refuses it
+func publishWithRetry(publish publishFunc, subject string, data []byte, attempts int, backoff time.Duration) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = publish(subject, data); err == nil {
+			return nil
+		}
+		if i < attempts-1 {
+			time.Sleep(backoff << uint(i))
+		}
+	}
+	return err
+}
+
+// send publishes a response, keeping it in the outbox when it can't be
+// published, so it isn't lost and the build doesn't hang waiting for it
+func (o *outbox) send(publish publishFunc, confirm confirmFunc, subject string, data []byte) {
+	m := outgoing{Subject: subject, Data: data}
+	if err := o.spool(&m); err != nil {
+		fmt.Println("could not spool " + subject + ": " + err.Error())
+	}
+
+	err := publishWithRetry(publish, subject, data, publishAttempts, publishBackoff)
+	if err == nil {
+		o.settle(confirm, []outgoing{m})
+		return
+	}
+
+	fmt.Println("could not publish " + subject + ", keeping it in the outbox: " + err.Error())
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pending = append(o.pending, m)
+}
+
+// deliver sends the response of a handler serving outside of the
+// pipeline through the outbox, reporting errors centrally as respond does
+func deliver(subject string, data []byte) {
+	responses.send(nc.Publish, confirmPublished, subject, data)
+	if finalStatus(subject) == statusErrored {
+		publishCentralError(strings.TrimSuffix(subject, ".error"), data)
+	}
+}
+
+// spool writes the response to the spool directory, named so that
+// responses sort in the order they were sent. Only the connector may read
+// it, and it is written without the credentials of the event, which stay
+// in memory.
+func (o *outbox) spool(m *outgoing) error {
+	if o.dir == "" {
+		return nil
+	}
+
+	o.mu.Lock()
+	o.seq++
+	name := fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), o.seq%1000000)
+	o.mu.Unlock()
+
+	data, err := json.Marshal(outgoing{Subject: m.Subject, Data: sanitizedBody(m.Data)})
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(o.dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	m.path = path
+
+	return nil
+}
+
+func (o *outbox) unspool(m outgoing) {
+	if m.path != "" {
+		os.Remove(m.path)
+	}
+}
+
+// settle unspools the published responses once NATS confirms it received
+// them, along with those left unconfirmed before. Until then they stay on
+// disk, as the connection may drop them from its buffer.
+func (o *outbox) settle(confirm confirmFunc, published []outgoing) {
+	var spooled []outgoing
+	for _, m := range published {
+		if m.path != "" {
+			spooled = append(spooled, m)
+		}
+	}
+
+	o.mu.Lock()
+	if len(spooled) == 0 && len(o.unconfirmed) == 0 {
+		o.mu.Unlock()
+		return
+	}
+	o.mu.Unlock()
+
+	if err := confirm(); err != nil {
+		fmt.Println(fmt.Sprintf("NATS did not confirm %d responses, keeping them spooled: %s", len(spooled), err.Error()))
+		o.mu.Lock()
+		o.unconfirmed = append(o.unconfirmed, spooled...)
+		o.mu.Unlock()
+		return
+	}
+
+	o.mu.Lock()
+	spooled = append(o.unconfirmed, spooled...)
+	o.unconfirmed = nil
+	o.mu.Unlock()
+
+	for _, m := range spooled {
+		o.unspool(m)
+	}
+}
+
+// load queues the responses left in the spool directory by a previous
+// run, to be flushed
+func (o *outbox) load() error {
+	if o.dir == "" {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(o.dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, name := range names {
+		path := filepath.Join(o.dir, name)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var m outgoing
+		if err := json.Unmarshal(data, &m); err != nil {
+			fmt.Println("skipping unreadable spooled response " + name)
+			continue
+		}
+		m.path = path
+		o.pending = append(o.pending, m)
+	}
+
+	return nil
+}
+
+// flush publishes the responses held in the outbox, keeping those that
+// still can't be published
+func (o *outbox) flush(publish publishFunc, confirm confirmFunc) {
+	o.mu.Lock()
+	var sent, failed []outgoing
+	for _, m := range o.pending {
+		if err := publish(m.Subject, m.Data); err != nil {
+			failed = append(failed, m)
+			continue
+		}
+		sent = append(sent, m)
+	}
+	o.pending = failed
+	o.mu.Unlock()
+
+	if len(sent) > 0 {
+		fmt.Println(fmt.Sprintf("flushed %d responses from the outbox", len(sent)))
+	}
+	o.settle(confirm, sent)
+}
+
+// size returns how many responses NATS didn't receive or confirm yet
+func (o *outbox) size() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.pending) + len(o.unconfirmed)
+}
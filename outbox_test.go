@@ -0,0 +1,152 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPublishWithRetry(t *testing.T) {
+	Convey("Given NATS refusing the first publishes", t, func() {
+		var calls int
+		publish := func(failures int) publishFunc {
+			return func(subject string, data []byte) error {
+				calls++
+				if calls <= failures {
+					return errors.New("nats: connection closed")
+				}
+				return nil
+			}
+		}
+
+		Convey("When it recovers before the last attempt", func() {
+			err := publishWithRetry(publish(2), "network.create.aws.done", []byte(`{}`), 5, time.Millisecond)
+
+			Convey("It should publish the message", func() {
+				So(err, ShouldBeNil)
+				So(calls, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When it doesn't recover", func() {
+			err := publishWithRetry(publish(10), "network.create.aws.done", []byte(`{}`), 5, time.Millisecond)
+
+			Convey("It should give up after the last attempt", func() {
+				So(err, ShouldNotBeNil)
+				So(calls, ShouldEqual, 5)
+			})
+		})
+	})
+}
+
+// confirmed stands for NATS confirming every publish
+func confirmed() error { return nil }
+
+func TestOutbox(t *testing.T) {
+	Convey("Given responses held in the outbox", t, func() {
+		o := newOutbox("")
+		o.pending = []outgoing{
+			{Subject: "network.create.aws.done", Data: []byte(`{}`)},
+			{Subject: "network.delete.aws.done", Data: []byte(`{}`)},
+		}
+
+		Convey("When NATS is reachable again", func() {
+			var published []string
+			o.flush(func(subject string, data []byte) error {
+				published = append(published, subject)
+				return nil
+			}, confirmed)
+
+			Convey("It should publish them in order and empty the outbox", func() {
+				So(published, ShouldResemble, []string{"network.create.aws.done", "network.delete.aws.done"})
+				So(o.size(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When NATS still refuses them", func() {
+			o.flush(func(subject string, data []byte) error {
+				return errors.New("nats: connection closed")
+			}, confirmed)
+
+			Convey("It should keep them", func() {
+				So(o.size(), ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestSpooledOutbox(t *testing.T) {
+	Convey("Given an outbox spooling to disk", t, func() {
+		dir, _ := ioutil.TempDir("", "network-outbox")
+		defer os.RemoveAll(dir)
+		o := newOutbox(dir)
+
+		Convey("When responses can't be published before a restart", func() {
+			for _, subject := range []string{"network.create.aws.done", "network.delete.aws.error"} {
+				m := outgoing{Subject: subject, Data: []byte(`{"_uuid":"test"}`)}
+				So(o.spool(&m), ShouldBeNil)
+			}
+
+			Convey("It should load them back in order and remove them once published", func() {
+				restarted := newOutbox(dir)
+				So(restarted.load(), ShouldBeNil)
+				So(restarted.size(), ShouldEqual, 2)
+
+				var published []string
+				restarted.flush(func(subject string, data []byte) error {
+					published = append(published, subject)
+					return nil
+				}, confirmed)
+				So(published, ShouldResemble, []string{"network.create.aws.done", "network.delete.aws.error"})
+
+				files, _ := ioutil.ReadDir(dir)
+				So(len(files), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When spooling a response carrying credentials", func() {
+			m := outgoing{Subject: "network.create.aws.done", Data: []byte(`{"_uuid":"test","datacenter_secret":"key","datacenter_token":"secret"}`)}
+			So(o.spool(&m), ShouldBeNil)
+
+			Convey("It should only be readable by the connector", func() {
+				info, err := os.Stat(m.path)
+				So(err, ShouldBeNil)
+				So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+			})
+
+			Convey("It should be written without the credentials", func() {
+				data, _ := ioutil.ReadFile(m.path)
+				So(string(data), ShouldNotContainSubstring, "secret")
+				So(string(m.Data), ShouldContainSubstring, "datacenter_token")
+
+				restarted := newOutbox(dir)
+				So(restarted.load(), ShouldBeNil)
+				So(string(restarted.pending[0].Data), ShouldContainSubstring, `"_uuid":"test"`)
+			})
+		})
+
+		Convey("When NATS doesn't confirm a published response", func() {
+			publish := func(subject string, data []byte) error { return nil }
+			o.send(publish, func() error { return errors.New("nats: timeout") }, "network.create.aws.done", []byte(`{}`))
+
+			Convey("It should keep it spooled until a later flush is confirmed", func() {
+				files, _ := ioutil.ReadDir(dir)
+				So(len(files), ShouldEqual, 1)
+				So(o.size(), ShouldEqual, 1)
+
+				o.flush(publish, confirmed)
+				files, _ = ioutil.ReadDir(dir)
+				So(len(files), ShouldEqual, 0)
+				So(o.size(), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,49 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// checkPayload rejects oversized, malformed or deeply nested event bodies
+// before anything unmarshals them
+func checkPayload(data []byte, maxSize, maxDepth int) error {
+	if maxSize > 0 && len(data) > maxSize {
+		return newError(errPayload, fmt.Sprintf("Event body of %d bytes exceeds the %d bytes limit", len(data), maxSize))
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	var depth, tokens int
+	for ; ; tokens++ {
+		tok, err := dec.Token()
+		if err == io.EOF && depth == 0 && tokens > 0 {
+			break
+		}
+		if err != nil {
+			return newError(errPayload, "Event body is not valid JSON")
+		}
+
+		if depth == 0 && tok != json.Delim('{') {
+			return newError(errPayload, "Event body is not a JSON object")
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if maxDepth > 0 && depth > maxDepth {
+				return newError(errPayload, fmt.Sprintf("Event body is nested deeper than %d levels", maxDepth))
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+
+	return nil
+}
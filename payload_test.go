@@ -0,0 +1,53 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPayloadChecks(t *testing.T) {
+	Convey("Given payload limits", t, func() {
+		maxSize, maxDepth := 1024, 3
+
+		Convey("With a valid event", func() {
+			valid, _ := json.Marshal(testEvent)
+			So(checkPayload(valid, maxSize, maxDepth), ShouldBeNil)
+		})
+
+		Convey("With an oversized event", func() {
+			body := `{"name":"` + strings.Repeat("a", 2048) + `"}`
+			err := checkPayload([]byte(body), maxSize, maxDepth)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Event body of 2059 bytes exceeds the 1024 bytes limit")
+		})
+
+		Convey("With a deeply nested event", func() {
+			err := checkPayload([]byte(`{"a":{"b":[{"c":1}]}}`), maxSize, maxDepth)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Event body is nested deeper than 3 levels")
+		})
+
+		Convey("With malformed JSON", func() {
+			err := checkPayload([]byte(`{"name":`), maxSize, maxDepth)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Event body is not valid JSON")
+		})
+
+		Convey("With an empty body", func() {
+			So(checkPayload([]byte(``), maxSize, maxDepth), ShouldNotBeNil)
+		})
+
+		Convey("With a JSON array", func() {
+			err := checkPayload([]byte(`[1, 2]`), maxSize, maxDepth)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Event body is not a JSON object")
+		})
+	})
+}
@@ -0,0 +1,78 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// zoneSelector spreads networks created without an availability zone
+// across the allowed zones of their region
+type zoneSelector struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+func newZoneSelector() *zoneSelector {
+	return &zoneSelector{next: make(map[string]int)}
+}
+
+// pick returns the next zone for the region, or an empty string when no
+// zones are configured and AWS should choose one
+func (z *zoneSelector) pick(region string, zones []string) string {
+	if len(zones) == 0 {
+		return ""
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	i := z.next[region] % len(zones)
+	z.next[region] = i + 1
+
+	return zones[i]
+}
+
+// availableZones returns the available zones of the region the rules of
+// the connector leave usable
+func availableZones(client ec2API, c config, region string) ([]string, error) {
+	resp, err := client.DescribeAvailabilityZones(&ec2.DescribeAvailabilityZonesInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []string
+	for _, z := range resp.AvailabilityZones {
+		name := aws.StringValue(z.ZoneName)
+		if aws.StringValue(z.State) != "available" || !strings.HasPrefix(name, region) {
+			continue
+		}
+		if checkZone(c, region, name) == nil {
+			zones = append(zones, name)
+		}
+	}
+	return zones, nil
+}
+
+// candidateZones returns the zones networks of the region created without
+// one are spread across: its default or allowed zones or, when it only
+// has excluded zones, every available zone left. None leaves the choice
+// to AWS.
+func candidateZones(client ec2API, c config, region string) ([]string, error) {
+	if zones := c.defaultZones(region); len(zones) > 0 {
+		return zones, nil
+	}
+
+	for _, az := range c.ExcludedAZs {
+		if strings.HasPrefix(az, region) {
+			return availableZones(client, c, region)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestZoneSelection(t *testing.T) {
+	Convey("Given a connector with availability zone rules", t, func() {
+		c := config{
+			AllowedAZs:  []string{"eu-west-1a", "eu-west-1b", "eu-west-1c", "us-east-1a"},
+			ExcludedAZs: []string{"eu-west-1c"},
+		}
+		z := newZoneSelector()
+
+		Convey("When picking zones for a region", func() {
+			zones := c.allowedZones("eu-west-1")
+			Convey("It should rotate over the allowed, not excluded, zones", func() {
+				So(zones, ShouldResemble, []string{"eu-west-1a", "eu-west-1b"})
+				So(z.pick("eu-west-1", zones), ShouldEqual, "eu-west-1a")
+				So(z.pick("eu-west-1", zones), ShouldEqual, "eu-west-1b")
+				So(z.pick("eu-west-1", zones), ShouldEqual, "eu-west-1a")
+			})
+		})
+
+		Convey("When picking zones for a region with default zones", func() {
+			c.DefaultAZs = []string{"eu-west-1b", "eu-west-1c", "us-east-1a"}
+			Convey("It should only use the allowed default zones", func() {
+				So(c.defaultZones("eu-west-1"), ShouldResemble, []string{"eu-west-1b"})
+				So(c.defaultZones("us-east-1"), ShouldResemble, []string{"us-east-1a"})
+			})
+		})
+
+		Convey("When picking zones for a region with no default zones", func() {
+			Convey("It should use the allowed zones", func() {
+				So(c.defaultZones("eu-west-1"), ShouldResemble, []string{"eu-west-1a", "eu-west-1b"})
+			})
+		})
+
+		Convey("When picking zones for a region with no rules", func() {
+			zones := c.allowedZones("ap-south-1")
+			Convey("It should leave the choice to AWS", func() {
+				So(z.pick("ap-south-1", zones), ShouldEqual, "")
+			})
+		})
+
+		Convey("When requesting an excluded zone", func() {
+			err := checkPolicy(c, "network.create.aws", request{DatacenterRegion: "eu-west-1", AvailabilityZone: "eu-west-1c"})
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Availability zone eu-west-1c is excluded")
+			})
+		})
+
+		Convey("When requesting a zone outside the allowed ones", func() {
+			err := checkPolicy(c, "network.create.aws", request{DatacenterRegion: "us-east-1", AvailabilityZone: "us-east-1b"})
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Availability zone us-east-1b is not allowed, use one of us-east-1a")
+			})
+		})
+	})
+}
+
+func TestCandidateZones(t *testing.T) {
+	Convey("Given a region with some zones excluded and none allowed", t, func() {
+		c := config{ExcludedAZs: []string{"eu-west-1b"}}
+		client := &mockEC2{zones: []*ec2.AvailabilityZone{
+			{ZoneName: aws.String("eu-west-1a"), State: aws.String("available")},
+			{ZoneName: aws.String("eu-west-1b"), State: aws.String("available")},
+			{ZoneName: aws.String("eu-west-1c"), State: aws.String("impaired")},
+			{ZoneName: aws.String("eu-west-1d"), State: aws.String("available")},
+		}}
+
+		Convey("When picking zones for a network created without one", func() {
+			zones, err := candidateZones(client, c, "eu-west-1")
+
+			Convey("It should use the available zones left", func() {
+				So(err, ShouldBeNil)
+				So(zones, ShouldResemble, []string{"eu-west-1a", "eu-west-1d"})
+			})
+		})
+
+		Convey("When picking zones for a region without exclusions", func() {
+			zones, err := candidateZones(client, c, "us-east-1")
+
+			Convey("It should leave the choice to AWS", func() {
+				So(err, ShouldBeNil)
+				So(zones, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,208 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// checkPolicy rejects the events this connector instance is configured not
+// to process, before any AWS call is made
+func checkPolicy(c config, subject string, r request) error {
+	if c.ReadOnly && mutating(subject) {
+		return newError(errPolicy, "Connector is in read only mode, "+verb(subject)+" is not allowed")
+	}
+
+	if len(c.AllowedRegions) > 0 && !contains(c.AllowedRegions, r.DatacenterRegion) {
+		return newError(errPolicy, "Datacenter region "+r.DatacenterRegion+" is not allowed")
+	}
+
+	if err := checkRoles(c, r); err != nil {
+		return err
+	}
+
+	if verb(subject) == "create" && r.AvailabilityZone != "" {
+		if err := checkZone(c, r.DatacenterRegion, r.AvailabilityZone); err != nil {
+			return err
+		}
+	}
+
+	if verb(subject) == "create" && c.rangeRules() {
+		if err := checkRange(c, r.Subnet); err != nil {
+			return err
+		}
+	}
+
+	if c.NamePattern != "" && (verb(subject) == "create" || (verb(subject) == "update" && r.Name != "")) {
+		if err := checkName(c.NamePattern, r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// namePlaceholder matches the <placeholders> of a NAME_PATTERN
+var namePlaceholder = regexp.MustCompile(`<([a-z_]+)>`)
+
+// checkName rejects network names not matching the naming convention, a
+// regular expression whose <region>, <az> and <tenant> placeholders stand
+// for those of the event, and any other placeholder for a lowercase word
+func checkName(pattern string, r request) error {
+	expr := namePlaceholder.ReplaceAllStringFunc(pattern, func(p string) string {
+		switch p {
+		case "<region>":
+			return regexp.QuoteMeta(r.DatacenterRegion)
+		case "<tenant>":
+			return regexp.QuoteMeta(r.tenant())
+		case "<az>":
+			if r.AvailabilityZone != "" {
+				return regexp.QuoteMeta(r.AvailabilityZone)
+			}
+			return "[a-z0-9-]+"
+		}
+		return "[a-z0-9]+"
+	})
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return newError(errPolicy, "Naming convention "+pattern+" is not a valid expression")
+	}
+
+	if !re.MatchString(r.Name) {
+		return newFieldError(errPolicy, "name", "Network name "+r.Name+" does not follow the naming convention "+pattern)
+	}
+	return nil
+}
+
+// checkRoles refuses events naming roles the connector may not assume.
+// Roles are assumed with the connector's own credentials when events carry
+// none, so any event could otherwise act in any account trusting them:
+// only the roles of ALLOWED_ROLE_ARNS, or of the accounts of
+// ALLOWED_ROLE_ACCOUNTS, are assumed, and only along with an external id.
+func checkRoles(c config, r request) error {
+	if err := checkRole(c, "datacenter_role_arn", r.RoleARN, r.ExternalID); err != nil {
+		return err
+	}
+	return checkRole(c, "datacenter_routing_role_arn", r.RoutingRoleARN, r.ExternalID)
+}
+
+func checkRole(c config, field, arn, externalID string) error {
+	if arn == "" {
+		return nil
+	}
+
+	if !contains(c.AllowedRoles, arn) && !contains(c.AllowedAccounts, roleAccount(arn)) {
+		return newFieldError(errPolicy, field, "Role "+arn+" is not allowed, see ALLOWED_ROLE_ARNS and ALLOWED_ROLE_ACCOUNTS")
+	}
+
+	if externalID == "" {
+		return newFieldError(errPolicy, "datacenter_external_id", "Role "+arn+" is only assumed with a datacenter_external_id")
+	}
+
+	return nil
+}
+
+// roleAccount returns the account id of a role ARN, such as
+// arn:aws:iam::123456789012:role/ernest
+func roleAccount(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
+
+func checkZone(c config, region, az string) error {
+	if contains(c.ExcludedAZs, az) {
+		return newError(errPolicy, "Availability zone "+az+" is excluded")
+	}
+
+	allowed := c.allowedZones(region)
+	if len(allowed) > 0 && !contains(allowed, az) {
+		return newError(errPolicy, "Availability zone "+az+" is not allowed, use one of "+strings.Join(allowed, ", "))
+	}
+
+	return nil
+}
+
+func checkRange(c config, subnet string) error {
+	_, n, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return newError(errPolicy, "Network range "+subnet+" is not a valid CIDR")
+	}
+
+	ones, _ := n.Mask.Size()
+	if c.MinPrefixLength > 0 && ones < c.MinPrefixLength {
+		return newError(errPolicy, fmt.Sprintf("Network range %s is larger than /%d", subnet, c.MinPrefixLength))
+	}
+
+	if c.MaxPrefixLength > 0 && ones > c.MaxPrefixLength {
+		return newError(errPolicy, fmt.Sprintf("Network range %s is smaller than /%d", subnet, c.MaxPrefixLength))
+	}
+
+	if len(c.AllowedCIDRs) > 0 && !withinAny(n, c.AllowedCIDRs) {
+		return newError(errPolicy, "Network range "+subnet+" is outside the allowed ranges")
+	}
+
+	for _, reserved := range c.ReservedCIDRs {
+		if overlaps(n, reserved) {
+			return newError(errPolicy, "Network range "+subnet+" overlaps reserved range "+reserved.String())
+		}
+	}
+
+	return nil
+}
+
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+func withinAny(n *net.IPNet, supernets []*net.IPNet) bool {
+	for _, s := range supernets {
+		if cidrWithin(n, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// cidrWithin reports whether n is fully contained in super
+func cidrWithin(n, super *net.IPNet) bool {
+	nOnes, nBits := n.Mask.Size()
+	sOnes, sBits := super.Mask.Size()
+
+	return nBits == sBits && nOnes >= sOnes && super.Contains(n.IP)
+}
+
+func mutating(subject string) bool {
+	switch verb(subject) {
+	case "create", "update", "delete":
+		return true
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// existing reports whether the subject acts on a network that should
+// already exist
+func existing(subject string) bool {
+	switch verb(subject) {
+	case "update", "delete":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicy(t *testing.T) {
+	Convey("Given a read only connector", t, func() {
+		c := config{ReadOnly: true}
+
+		Convey("When receiving a create event", func() {
+			err := checkPolicy(c, "network.create.aws", request{})
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Connector is in read only mode, create is not allowed")
+				So(err.(*connectorError).code, ShouldEqual, errPolicy)
+			})
+		})
+
+		Convey("When receiving a delete event", func() {
+			err := checkPolicy(c, "network.delete.aws", request{})
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When receiving a get event", func() {
+			err := checkPolicy(c, "network.get.aws", request{})
+			Convey("It should be allowed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a connector with allowed regions", t, func() {
+		c := config{AllowedRegions: []string{"eu-west-1", "eu-central-1"}}
+
+		Convey("When receiving an event for an allowed region", func() {
+			err := checkPolicy(c, "network.create.aws", request{DatacenterRegion: "eu-west-1"})
+			Convey("It should be allowed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When receiving an event for another region", func() {
+			err := checkPolicy(c, "network.create.aws", request{DatacenterRegion: "us-east-1"})
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Datacenter region us-east-1 is not allowed")
+			})
+		})
+	})
+
+	Convey("Given a connector with allowed cidrs", t, func() {
+		_, allowed, _ := net.ParseCIDR("10.0.0.0/8")
+		c := config{AllowedCIDRs: []*net.IPNet{allowed}}
+
+		Convey("When creating a network inside them", func() {
+			err := checkPolicy(c, "network.create.aws", request{Subnet: "10.1.0.0/24"})
+			Convey("It should be allowed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When creating a network outside them", func() {
+			err := checkPolicy(c, "network.create.aws", request{Subnet: "100.1.0.0/24"})
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Network range 100.1.0.0/24 is outside the allowed ranges")
+			})
+		})
+
+		Convey("When creating a network larger than them", func() {
+			err := checkPolicy(c, "network.create.aws", request{Subnet: "10.0.0.0/7"})
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When deleting a network outside them", func() {
+			err := checkPolicy(c, "network.delete.aws", request{Subnet: "100.1.0.0/24"})
+			Convey("It should be allowed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a connector with network size limits", t, func() {
+		c := config{MinPrefixLength: 20, MaxPrefixLength: 27}
+
+		Convey("When creating a network within the limits", func() {
+			So(checkPolicy(c, "network.create.aws", request{Subnet: "10.0.0.0/24"}), ShouldBeNil)
+		})
+
+		Convey("When creating a network that is too large", func() {
+			err := checkPolicy(c, "network.create.aws", request{Subnet: "10.0.0.0/16"})
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Network range 10.0.0.0/16 is larger than /20")
+			})
+		})
+
+		Convey("When creating a network that is too small", func() {
+			err := checkPolicy(c, "network.create.aws", request{Subnet: "10.0.0.0/28"})
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Network range 10.0.0.0/28 is smaller than /27")
+			})
+		})
+	})
+
+	Convey("Given a connector with reserved ranges", t, func() {
+		_, onprem, _ := net.ParseCIDR("10.100.0.0/16")
+		c := config{ReservedCIDRs: []*net.IPNet{onprem}}
+
+		Convey("When creating a network inside a reserved range", func() {
+			err := checkPolicy(c, "network.create.aws", request{Subnet: "10.100.4.0/24"})
+			Convey("It should be rejected, naming the reservation", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Network range 10.100.4.0/24 overlaps reserved range 10.100.0.0/16")
+			})
+		})
+
+		Convey("When creating a network containing a reserved range", func() {
+			err := checkPolicy(c, "network.create.aws", request{Subnet: "10.64.0.0/10"})
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When creating a network outside the reserved ranges", func() {
+			So(checkPolicy(c, "network.create.aws", request{Subnet: "10.0.0.0/24"}), ShouldBeNil)
+		})
+	})
+	Convey("Given a connector with a naming convention", t, func() {
+		c := config{NamePattern: "^<env>-<tier>-<az>$"}
+
+		Convey("When creating a network following it", func() {
+			r := request{Name: "prod-web-eu-west-1a", DatacenterRegion: "eu-west-1", AvailabilityZone: "eu-west-1a"}
+			Convey("It should be allowed", func() {
+				So(checkPolicy(c, "network.create.aws", r), ShouldBeNil)
+			})
+		})
+
+		Convey("When creating a network in another zone than its name", func() {
+			r := request{Name: "prod-web-eu-west-1a", DatacenterRegion: "eu-west-1", AvailabilityZone: "eu-west-1b"}
+			Convey("It should be rejected on its name", func() {
+				err := checkPolicy(c, "network.create.aws", r)
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errPolicy)
+				So(err.(*connectorError).field, ShouldEqual, "name")
+			})
+		})
+
+		Convey("When creating a network not following it", func() {
+			Convey("It should be rejected", func() {
+				So(checkPolicy(c, "network.create.aws", request{Name: "My Network"}), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When updating a network without renaming it", func() {
+			Convey("It should be allowed", func() {
+				So(checkPolicy(c, "network.update.aws", request{}), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestCheckRoles(t *testing.T) {
+	Convey("Given a connector allowed to assume a role and the roles of an account", t, func() {
+		c := config{
+			AllowedRoles:    []string{"arn:aws:iam::111111111111:role/ernest"},
+			AllowedAccounts: []string{"222222222222"},
+		}
+
+		Convey("When an event names the allowed role with an external id", func() {
+			err := checkRoles(c, request{RoleARN: "arn:aws:iam::111111111111:role/ernest", ExternalID: "ernest"})
+
+			Convey("It should be allowed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When an event names a role of the allowed account", func() {
+			err := checkRoles(c, request{RoleARN: "arn:aws:iam::222222222222:role/networks", ExternalID: "ernest"})
+
+			Convey("It should be allowed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When an event names a role of another account", func() {
+			err := checkRoles(c, request{RoleARN: "arn:aws:iam::333333333333:role/ernest", ExternalID: "ernest"})
+
+			Convey("It should be refused on the role", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errPolicy)
+				So(err.(*connectorError).field, ShouldEqual, "datacenter_role_arn")
+			})
+		})
+
+		Convey("When an event names the allowed role without an external id", func() {
+			err := checkRoles(c, request{RoleARN: "arn:aws:iam::111111111111:role/ernest"})
+
+			Convey("It should be refused on the external id", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).field, ShouldEqual, "datacenter_external_id")
+			})
+		})
+
+		Convey("When an event names a routing role of another account", func() {
+			err := checkRoles(c, request{RoutingRoleARN: "arn:aws:iam::333333333333:role/routing", ExternalID: "ernest"})
+
+			Convey("It should be refused on the routing role", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).field, ShouldEqual, "datacenter_routing_role_arn")
+			})
+		})
+
+		Convey("When an event names no role", func() {
+			err := checkRoles(c, request{})
+
+			Convey("It should be allowed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a connector without allowed roles", t, func() {
+		Convey("When an event names a role", func() {
+			err := checkPolicy(config{}, "network.get.aws", request{RoleARN: "arn:aws:iam::111111111111:role/ernest", ExternalID: "ernest"})
+
+			Convey("It should be refused", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).field, ShouldEqual, "datacenter_role_arn")
+			})
+		})
+	})
+}
@@ -0,0 +1,279 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats"
+)
+
+// postProcess applies the network settings ernestaws doesn't manage once
+// it has successfully handled the event. What creates make is recorded in
+// undo for rollbacks. Steps only reporting on the network, or waiting on
+// others, warn rather than fail it.
+func postProcess(m *nats.Msg, r request, subject string, data []byte, undo *undoLog) (string, []byte) {
+	if finalStatus(subject) != statusDone || r.ProviderType == providerFake {
+		return subject, data
+	}
+
+	switch verb(m.Subject) {
+	case "create":
+		client, routing := undo.wrap(ec2Client(r)), undo.wrap(routingClient(r))
+		id := parseRequest(data).NetworkAWSID
+		zone, err := zoneFields(readClient(r), id)
+		if err != nil {
+			data = warn(data, warnReportIncomplete, "Could not describe the zone of network "+id+": "+err.Error())
+		}
+		data = setFields(data, zone)
+		if err := addIPv6(client, routing, r, id); err != nil {
+			return m.Subject + ".error", errorResponse(data, err)
+		}
+		if r.IPv6Range != "" {
+			publishProgress(m.Subject, r, stepIPv6Associated)
+		}
+		if r.NATGatewayID != "" && !r.IsPublic {
+			table, err := routeThroughNAT(routing, r, id)
+			if err != nil {
+				return m.Subject + ".error", errorResponse(data, err)
+			}
+			data = setField(data, "route_table_id", table)
+		}
+		if r.Routes != nil {
+			table, err := programRoutes(routing, r, id)
+			if err != nil {
+				return m.Subject + ".error", errorResponse(data, err)
+			}
+			data = setField(data, "route_table_id", table)
+		}
+		if r.Routes != nil || (r.NATGatewayID != "" && !r.IsPublic) {
+			publishProgress(m.Subject, r, stepRoutesProgrammed)
+			data = sharedTableWarning(readClient(r), data, id)
+		}
+		if err := tagNetwork(client, id, resourceTags(r), r.preexisting); err != nil {
+			return m.Subject + ".error", errorResponse(data, err)
+		}
+		data = setField(data, "tags", resourceTags(r))
+		publishProgress(m.Subject, r, stepTagged)
+		if cfg.CorrelationTags {
+			if err := tag(client, []string{id}, correlationTags(r)); err != nil {
+				return m.Subject + ".error", errorResponse(data, err)
+			}
+		}
+		if cfg.LastOpTags {
+			if err := tag(client, []string{id}, lastOpTags(m.Subject, r, time.Now())); err != nil {
+				return m.Subject + ".error", errorResponse(data, err)
+			}
+		}
+		if err := updatePrefixList(client, m.Subject, r); err != nil {
+			return m.Subject + ".error", errorResponse(data, err)
+		}
+		if cfg.IPAlarmThreshold > 0 {
+			if err := alarmIPs(r, id); err != nil {
+				return m.Subject + ".error", errorResponse(data, err)
+			}
+			undo.add("ip_alarm", alarmName(id), func() error {
+				return deleteIPAlarm(cloudWatchClient(r), id)
+			})
+		}
+		if len(r.Regions) > 0 {
+			replicas := replicate(m, r, undo)
+			data = setField(data, "replicas", replicas)
+			for _, rep := range replicas {
+				if rep.Error != "" {
+					data = warn(data, warnReplicaFailed, "Replica in "+rep.Region+" failed: "+rep.Error)
+				}
+			}
+		}
+		// what follows checks the network ernestaws and the steps above made
+		publishStatus(m.Subject, r, statusVerifying)
+		if len(r.WaitFor) > 0 {
+			err := waitForDependents(readClient(r), r, id, r.waitForTimeout(cfg))
+			switch {
+			case timedOut(err):
+				data = warn(data, warnWaitForTimeout, err.Error())
+			case err != nil:
+				return m.Subject + ".error", errorResponse(data, err)
+			default:
+				publishVerified(m.Subject, r, stepDependentsReady)
+			}
+		}
+		if cfg.StabilizeDelay > 0 || cfg.StabilizeChecks > 0 {
+			err := stabilize(readClient(r), id, cfg.StabilizeDelay, cfg.StabilizeChecks, r.waitForTimeout(cfg))
+			switch {
+			case timedOut(err):
+				data = warn(data, warnNotStabilized, err.Error())
+			case err != nil:
+				return m.Subject + ".error", errorResponse(data, err)
+			default:
+				publishVerified(m.Subject, r, stepStabilized)
+			}
+		}
+		if cfg.ConfigSubject != "" {
+			go publishConfigurationItem(cfg.ConfigSubject, r, id)
+		}
+		components, err := networkComponents(readClient(r), id)
+		if err != nil {
+			data = warn(data, warnReportIncomplete, "Could not describe the components of network "+id+": "+err.Error())
+		} else {
+			data = setField(data, "components", components)
+		}
+	case "update":
+		if err := applyResourceNameDNS(ec2Client(r), r); err != nil {
+			return m.Subject + ".error", errorResponse(data, err)
+		}
+		data = setFields(data, r.resourceNameDNS())
+		if r.NATGatewayID != "" && !r.IsPublic {
+			table, err := routeThroughNAT(routingClient(r), r, r.NetworkAWSID)
+			if err != nil {
+				return m.Subject + ".error", errorResponse(data, err)
+			}
+			data = setField(data, "route_table_id", table)
+		}
+		if r.Routes != nil {
+			table, err := programRoutes(routingClient(r), r, r.NetworkAWSID)
+			if err != nil {
+				return m.Subject + ".error", errorResponse(data, err)
+			}
+			data = setField(data, "route_table_id", table)
+		}
+		if r.Routes != nil || (r.NATGatewayID != "" && !r.IsPublic) {
+			publishProgress(m.Subject, r, stepRoutesProgrammed)
+			data = sharedTableWarning(readClient(r), data, r.NetworkAWSID)
+		}
+		if err := tagNetwork(ec2Client(r), r.NetworkAWSID, resourceTags(r), nil); err != nil {
+			return m.Subject + ".error", errorResponse(data, err)
+		}
+		data = setField(data, "tags", resourceTags(r))
+		publishProgress(m.Subject, r, stepTagged)
+		if cfg.LastOpTags {
+			if err := tag(ec2Client(r), []string{r.NetworkAWSID}, lastOpTags(m.Subject, r, time.Now())); err != nil {
+				return m.Subject + ".error", errorResponse(data, err)
+			}
+		}
+		if cfg.IPAlarmThreshold > 0 {
+			if err := alarmIPs(r, r.NetworkAWSID); err != nil {
+				return m.Subject + ".error", errorResponse(data, err)
+			}
+		}
+		publishStatus(m.Subject, r, statusVerifying)
+		zone, err := zoneFields(readClient(r), r.NetworkAWSID)
+		if err != nil {
+			data = warn(data, warnReportIncomplete, "Could not describe the zone of network "+r.NetworkAWSID+": "+err.Error())
+		}
+		data = setFields(data, zone)
+		components, err := networkComponents(readClient(r), r.NetworkAWSID)
+		if err != nil {
+			data = warn(data, warnReportIncomplete, "Could not describe the components of network "+r.NetworkAWSID+": "+err.Error())
+		} else {
+			data = setField(data, "components", components)
+		}
+	case "delete":
+		if err := updatePrefixList(ec2Client(r), m.Subject, r); err != nil {
+			return m.Subject + ".error", errorResponse(data, err)
+		}
+		if cfg.IPAlarmThreshold > 0 {
+			if err := deleteIPAlarm(cloudWatchClient(r), r.NetworkAWSID); err != nil {
+				return m.Subject + ".error", errorResponse(data, err)
+			}
+		}
+	}
+
+	return subject, data
+}
+
+// timedOut reports whether a wait gave up on its timeout, which leaves the
+// network itself correct
+func timedOut(err error) bool {
+	ce, ok := err.(*connectorError)
+	return ok && ce.code == errTimeout
+}
+
+// zoneFields returns the availability zone the network lives in, which
+// AWS picks when the event doesn't, so later events never imply a move
+func zoneFields(client ec2API, id string) (map[string]interface{}, error) {
+	subnet, err := describeSubnet(client, id)
+	if err != nil || subnet == nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"availability_zone":    aws.StringValue(subnet.AvailabilityZone),
+		"availability_zone_id": aws.StringValue(subnet.AvailabilityZoneId),
+	}, nil
+}
+
+// correlationTags map resources back to the ernest event and build that
+// created them, in CloudTrail and AWS Config records
+func correlationTags(r request) map[string]string {
+	return map[string]string{
+		"ernest.uuid":     r.UUID,
+		"ernest.batch_id": r.BatchID,
+	}
+}
+
+// lastOpTags record on the network the last change made to it, by which
+// ernest build and when, for forensics from the AWS console
+func lastOpTags(subject string, r request, now time.Time) map[string]string {
+	return map[string]string{
+		"ernest.last_op":       verb(subject),
+		"ernest.last_batch_id": r.BatchID,
+		"ernest.last_op_at":    now.UTC().Format(time.RFC3339),
+	}
+}
+
+func tag(client ec2API, ids []string, tags map[string]string) error {
+	input := &ec2.CreateTagsInput{
+		Resources: aws.StringSlice(ids),
+	}
+
+	for k, v := range tags {
+		input.Tags = append(input.Tags, &ec2.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	_, err := client.CreateTags(input)
+	return err
+}
+
+// applyResourceNameDNS sets the resource name DNS record options requested
+// by the event, one attribute per call as EC2 requires
+func applyResourceNameDNS(client ec2API, r request) error {
+	if r.ResourceNameDNSA != nil {
+		_, err := client.ModifySubnetAttribute(&ec2.ModifySubnetAttributeInput{
+			SubnetId:                             aws.String(r.NetworkAWSID),
+			EnableResourceNameDnsARecordOnLaunch: &ec2.AttributeBooleanValue{Value: r.ResourceNameDNSA},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.ResourceNameDNSAAAA != nil {
+		_, err := client.ModifySubnetAttribute(&ec2.ModifySubnetAttributeInput{
+			SubnetId:                                aws.String(r.NetworkAWSID),
+			EnableResourceNameDnsAAAARecordOnLaunch: &ec2.AttributeBooleanValue{Value: r.ResourceNameDNSAAAA},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resourceNameDNS returns the resource name DNS options set on the event,
+// so they are reflected in the response
+func (r request) resourceNameDNS() map[string]interface{} {
+	fields := make(map[string]interface{})
+	if r.ResourceNameDNSA != nil {
+		fields["enable_resource_name_dns_a_record"] = *r.ResourceNameDNSA
+	}
+	if r.ResourceNameDNSAAAA != nil {
+		fields["enable_resource_name_dns_aaaa_record"] = *r.ResourceNameDNSAAAA
+	}
+	return fields
+}
@@ -0,0 +1,95 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestApplyResourceNameDNS(t *testing.T) {
+	Convey("Given an update of a network", t, func() {
+		client := &mockEC2{}
+		r := request{NetworkAWSID: "subnet-00000000"}
+
+		Convey("When it carries no resource name DNS options", func() {
+			err := applyResourceNameDNS(client, r)
+
+			Convey("It should leave the subnet attributes alone", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldBeEmpty)
+				So(r.resourceNameDNS(), ShouldResemble, map[string]interface{}{})
+			})
+		})
+
+		Convey("When it enables A records", func() {
+			r.ResourceNameDNSA = aws.Bool(true)
+			err := applyResourceNameDNS(client, r)
+
+			Convey("It should modify that attribute and report it", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{"ModifySubnetAttribute subnet-00000000 A=true"})
+				So(r.resourceNameDNS(), ShouldResemble, map[string]interface{}{"enable_resource_name_dns_a_record": true})
+			})
+		})
+
+		Convey("When it disables A records and enables AAAA records", func() {
+			r.ResourceNameDNSA, r.ResourceNameDNSAAAA = aws.Bool(false), aws.Bool(true)
+			err := applyResourceNameDNS(client, r)
+
+			Convey("It should modify one attribute per call", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{"ModifySubnetAttribute subnet-00000000 A=false", "ModifySubnetAttribute subnet-00000000 AAAA=true"})
+				So(r.resourceNameDNS(), ShouldResemble, map[string]interface{}{"enable_resource_name_dns_a_record": false, "enable_resource_name_dns_aaaa_record": true})
+			})
+		})
+	})
+}
+
+// taggingEC2 keeps the tags set on each resource
+type taggingEC2 struct {
+	*mockEC2
+	tags map[string]map[string]string
+}
+
+func (m taggingEC2) CreateTags(in *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	for _, id := range in.Resources {
+		if m.tags[aws.StringValue(id)] == nil {
+			m.tags[aws.StringValue(id)] = make(map[string]string)
+		}
+		for _, t := range in.Tags {
+			m.tags[aws.StringValue(id)][aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+		}
+	}
+	return m.mockEC2.CreateTags(in)
+}
+
+func TestCorrelationTags(t *testing.T) {
+	Convey("Given a created network", t, func() {
+		client := taggingEC2{mockEC2: &mockEC2{}, tags: make(map[string]map[string]string)}
+
+		Convey("When it is tagged for correlation as part of a build", func() {
+			err := tag(client, []string{"subnet-00000000"}, correlationTags(request{UUID: "event-1", BatchID: "build-1"}))
+
+			Convey("It should carry the event uuid and batch id", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{"CreateTags subnet-00000000"})
+				So(client.tags["subnet-00000000"], ShouldResemble, map[string]string{"ernest.uuid": "event-1", "ernest.batch_id": "build-1"})
+			})
+		})
+
+		Convey("When it is tagged for correlation outside of a build", func() {
+			err := tag(client, []string{"subnet-00000000"}, correlationTags(request{UUID: "event-1"}))
+
+			Convey("It should carry the event uuid and an empty batch id", func() {
+				So(err, ShouldBeNil)
+				So(client.tags["subnet-00000000"], ShouldResemble, map[string]string{"ernest.uuid": "event-1", "ernest.batch_id": ""})
+			})
+		})
+	})
+}
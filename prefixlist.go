@@ -0,0 +1,51 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// updatePrefixList adds the range of a created network to the prefix list
+// of its environment, or removes the range of a deleted one, so security
+// groups and firewalls can reference the list instead of each range
+func updatePrefixList(client ec2API, subject string, r request) error {
+	if r.PrefixListID == "" || r.Subnet == "" {
+		return nil
+	}
+
+	resp, err := client.DescribeManagedPrefixLists(&ec2.DescribeManagedPrefixListsInput{
+		PrefixListIds: []*string{aws.String(r.PrefixListID)},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.PrefixLists) == 0 {
+		return newError(errNotFound, "Prefix list "+r.PrefixListID+" does not exist")
+	}
+
+	input := &ec2.ModifyManagedPrefixListInput{
+		PrefixListId:   aws.String(r.PrefixListID),
+		CurrentVersion: resp.PrefixLists[0].Version,
+	}
+
+	switch verb(subject) {
+	case "create":
+		input.AddEntries = []*ec2.AddPrefixListEntry{
+			{Cidr: aws.String(r.Subnet), Description: aws.String(r.Name)},
+		}
+	case "delete":
+		input.RemoveEntries = []*ec2.RemovePrefixListEntry{
+			{Cidr: aws.String(r.Subnet)},
+		}
+	default:
+		return nil
+	}
+
+	_, err = client.ModifyManagedPrefixList(input)
+	return err
+}
@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// prefixListEC2 serves prefix lists and records their entry changes
+type prefixListEC2 struct {
+	*mockEC2
+	lists []*ec2.ManagedPrefixList
+}
+
+func (m prefixListEC2) DescribeManagedPrefixLists(in *ec2.DescribeManagedPrefixListsInput) (*ec2.DescribeManagedPrefixListsOutput, error) {
+	var lists []*ec2.ManagedPrefixList
+	for _, l := range m.lists {
+		if aws.StringValue(l.PrefixListId) == aws.StringValue(in.PrefixListIds[0]) {
+			lists = append(lists, l)
+		}
+	}
+	return &ec2.DescribeManagedPrefixListsOutput{PrefixLists: lists}, nil
+}
+
+func (m prefixListEC2) ModifyManagedPrefixList(in *ec2.ModifyManagedPrefixListInput) (*ec2.ModifyManagedPrefixListOutput, error) {
+	call := "ModifyManagedPrefixList " + aws.StringValue(in.PrefixListId) + "@" + strconv.FormatInt(aws.Int64Value(in.CurrentVersion), 10)
+	for _, e := range in.AddEntries {
+		call += " +" + aws.StringValue(e.Cidr)
+	}
+	for _, e := range in.RemoveEntries {
+		call += " -" + aws.StringValue(e.Cidr)
+	}
+	m.calls = append(m.calls, call)
+	return &ec2.ModifyManagedPrefixListOutput{}, nil
+}
+
+func TestUpdatePrefixList(t *testing.T) {
+	Convey("Given an environment prefix list", t, func() {
+		client := prefixListEC2{
+			mockEC2: &mockEC2{},
+			lists:   []*ec2.ManagedPrefixList{{PrefixListId: aws.String("pl-00000000"), Version: aws.Int64(3)}},
+		}
+		r := request{Name: "web", Subnet: "10.0.0.0/24", PrefixListID: "pl-00000000"}
+
+		Convey("When a network is created", func() {
+			err := updatePrefixList(client, "network.create.aws", r)
+
+			Convey("It should add its range to the current version", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{"ModifyManagedPrefixList pl-00000000@3 +10.0.0.0/24"})
+			})
+		})
+
+		Convey("When a network is deleted", func() {
+			err := updatePrefixList(client, "network.delete.aws", r)
+
+			Convey("It should remove its range", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{"ModifyManagedPrefixList pl-00000000@3 -10.0.0.0/24"})
+			})
+		})
+
+		Convey("When a network is updated", func() {
+			err := updatePrefixList(client, "network.update.aws", r)
+
+			Convey("It should leave the list alone", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a network is created without a prefix list", func() {
+			r.PrefixListID = ""
+			err := updatePrefixList(client, "network.create.aws", r)
+
+			Convey("It should leave the list alone", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a network is created with a missing prefix list", func() {
+			r.PrefixListID = "pl-11111111"
+			err := updatePrefixList(client, "network.create.aws", r)
+
+			Convey("It should report the list not found", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errNotFound)
+				So(client.calls, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,150 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	// profileLegacy responses carry the exact fields old ernest-core
+	// releases expect
+	profileLegacy = "legacy"
+	// profileExtended responses carry additional connector data
+	profileExtended = "extended"
+)
+
+// profile returns the response profile requested by the event, falling
+// back to the connector default
+func (r request) profile(c config) string {
+	if r.Profile != "" {
+		return r.Profile
+	}
+	return c.ResponseProfile
+}
+
+// extend adds the extended profile fields to a response body
+func extend(data []byte, r request, now time.Time) []byte {
+	timings := map[string]interface{}{
+		"validation_ms":   milliseconds(r.validation),
+		"provisioning_ms": milliseconds(r.provisioning),
+		"total_ms":        milliseconds(now.Sub(r.received)),
+	}
+
+	// events published with a _timestamp also tell how long they were
+	// queued before the connector picked them up, and their age
+	if t, ok := r.published(); ok {
+		timings["queue_ms"] = milliseconds(r.queued())
+		timings["age_ms"] = milliseconds(now.Sub(t))
+	}
+
+	return setFields(data, map[string]interface{}{
+		"_profile": profileExtended,
+		"timings":  timings,
+	})
+}
+
+// Posture : how exposed a network is, in extended responses
+type Posture struct {
+	Public              bool `json:"public"`
+	MapPublicIPOnLaunch bool `json:"map_public_ip_on_launch"`
+	MainRouteTable      bool `json:"main_route_table"`
+	FlowLogs            bool `json:"flow_logs"`
+}
+
+// extendNetwork adds the extended profile fields describing the network
+// of a done create or update: its ARNs, the id of the route table it uses
+// and its security posture
+func extendNetwork(client ec2API, data []byte, r request) []byte {
+	id := parseRequest(data).NetworkAWSID
+	if id == "" {
+		id = r.NetworkAWSID
+	}
+
+	subnet, err := describeSubnet(client, id)
+	if err == nil && subnet == nil {
+		err = newError(errNotFound, "Network "+id+" does not exist")
+	}
+	if err != nil {
+		return warn(data, warnReportIncomplete, "Could not describe network "+id+" for its extended fields: "+err.Error())
+	}
+
+	tables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{subnet.VpcId}},
+		},
+	})
+	if err != nil {
+		return warn(data, warnReportIncomplete, "Could not describe the route table of network "+id+": "+err.Error())
+	}
+
+	logs, err := client.DescribeFlowLogs(&ec2.DescribeFlowLogsInput{
+		Filter: []*ec2.Filter{
+			{Name: aws.String("resource-id"), Values: []*string{aws.String(id)}},
+		},
+	})
+	if err != nil {
+		return warn(data, warnReportIncomplete, "Could not describe the flow logs of network "+id+": "+err.Error())
+	}
+
+	return setFields(data, networkProfile(r.DatacenterRegion, subnet, subnetRouteTable(subnet, tables.RouteTables), logs.FlowLogs))
+}
+
+// networkProfile returns the extended fields of a network from its subnet,
+// the route table it uses and its flow logs
+func networkProfile(region string, subnet *ec2.Subnet, table *ec2.RouteTable, flowLogs []*ec2.FlowLog) map[string]interface{} {
+	owner := aws.StringValue(subnet.OwnerId)
+	arns := map[string]string{"subnet": aws.StringValue(subnet.SubnetArn)}
+	if arns["subnet"] == "" && owner != "" {
+		arns["subnet"] = ec2ARN(region, owner, "subnet", aws.StringValue(subnet.SubnetId))
+	}
+
+	posture := Posture{MapPublicIPOnLaunch: aws.BoolValue(subnet.MapPublicIpOnLaunch)}
+	for _, l := range flowLogs {
+		if aws.StringValue(l.FlowLogStatus) == "ACTIVE" {
+			posture.FlowLogs = true
+		}
+	}
+
+	fields := map[string]interface{}{"arns": arns}
+	if table != nil {
+		tableID := aws.StringValue(table.RouteTableId)
+		fields["route_table_id"] = tableID
+		if owner := aws.StringValue(table.OwnerId); owner != "" {
+			arns["route_table"] = ec2ARN(region, owner, "route-table", tableID)
+		}
+
+		posture.MainRouteTable = !associatedWith(table, aws.StringValue(subnet.SubnetId))
+		for _, route := range table.Routes {
+			if strings.HasPrefix(aws.StringValue(route.GatewayId), "igw-") {
+				posture.Public = true
+			}
+		}
+	}
+	fields["posture"] = posture
+
+	return fields
+}
+
+// ec2ARN returns the ARN of an EC2 resource, in the partition of its region
+func ec2ARN(region, account, kind, id string) string {
+	partition := "aws"
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		partition = "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		partition = "aws-us-gov"
+	}
+	return fmt.Sprintf("arn:%s:ec2:%s:%s:%s/%s", partition, region, account, kind, id)
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
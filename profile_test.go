@@ -0,0 +1,104 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResponseProfiles(t *testing.T) {
+	Convey("Given a connector defaulting to the legacy profile", t, func() {
+		c := config{ResponseProfile: profileLegacy}
+
+		Convey("When the event doesn't request a profile", func() {
+			r := parseRequest([]byte(`{"_uuid":"test"}`))
+			So(r.profile(c), ShouldEqual, profileLegacy)
+		})
+
+		Convey("When the event requests the extended profile", func() {
+			r := parseRequest([]byte(`{"_uuid":"test","_profile":"extended"}`))
+			r.validation = 2 * time.Millisecond
+			r.provisioning = 1200 * time.Millisecond
+			So(r.profile(c), ShouldEqual, profileExtended)
+
+			Convey("It should add the extended fields to the response", func() {
+				data := extend([]byte(`{"_uuid":"test","network_aws_id":"subnet-00000000"}`), r, r.received.Add(1500*time.Millisecond))
+
+				var body map[string]interface{}
+				json.Unmarshal(data, &body)
+				So(body["network_aws_id"], ShouldEqual, "subnet-00000000")
+				So(body["_profile"], ShouldEqual, profileExtended)
+				timings := body["timings"].(map[string]interface{})
+				So(timings["validation_ms"], ShouldEqual, float64(2))
+				So(timings["provisioning_ms"], ShouldEqual, float64(1200))
+				So(timings["total_ms"], ShouldEqual, float64(1500))
+				So(timings, ShouldNotContainKey, "queue_ms")
+			})
+		})
+
+		Convey("When the event carries its publication time", func() {
+			r := parseRequest([]byte(`{"_uuid":"test","_timestamp":"2016-01-01T10:00:00Z"}`))
+			r.received = time.Date(2016, 1, 1, 10, 0, 3, 0, time.UTC)
+
+			Convey("It should report how long it was queued and its age", func() {
+				data := extend([]byte(`{"_uuid":"test"}`), r, r.received.Add(2*time.Second))
+
+				var body map[string]interface{}
+				json.Unmarshal(data, &body)
+				timings := body["timings"].(map[string]interface{})
+				So(timings["queue_ms"], ShouldEqual, float64(3000))
+				So(timings["age_ms"], ShouldEqual, float64(5000))
+			})
+		})
+	})
+}
+
+func TestNetworkProfile(t *testing.T) {
+	Convey("Given a public network with a route table of its own", t, func() {
+		subnet := &ec2.Subnet{SubnetId: aws.String("subnet-00000000"), OwnerId: aws.String("123456789012"), MapPublicIpOnLaunch: aws.Bool(true)}
+		table := routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")
+		table.OwnerId = aws.String("123456789012")
+		flowLogs := []*ec2.FlowLog{{FlowLogId: aws.String("fl-00000000"), FlowLogStatus: aws.String("ACTIVE")}}
+
+		Convey("When its extended fields are built", func() {
+			fields := networkProfile("eu-west-1", subnet, table, flowLogs)
+
+			Convey("It should name its ARNs and route table", func() {
+				So(fields["arns"], ShouldResemble, map[string]string{
+					"subnet":      "arn:aws:ec2:eu-west-1:123456789012:subnet/subnet-00000000",
+					"route_table": "arn:aws:ec2:eu-west-1:123456789012:route-table/rtb-00000000",
+				})
+				So(fields["route_table_id"], ShouldEqual, "rtb-00000000")
+			})
+
+			Convey("It should report its posture", func() {
+				So(fields["posture"], ShouldResemble, Posture{Public: true, MapPublicIPOnLaunch: true, FlowLogs: true})
+			})
+		})
+	})
+
+	Convey("Given a private network of a China region using the main route table", t, func() {
+		subnet := &ec2.Subnet{SubnetId: aws.String("subnet-00000000"), OwnerId: aws.String("123456789012")}
+		table := routeTable("rtb-00000000", nil, "")
+
+		Convey("When its extended fields are built", func() {
+			fields := networkProfile("cn-north-1", subnet, table, nil)
+
+			Convey("It should use the ARNs of the partition", func() {
+				So(fields["arns"].(map[string]string)["subnet"], ShouldEqual, "arn:aws-cn:ec2:cn-north-1:123456789012:subnet/subnet-00000000")
+			})
+
+			Convey("It should report it private and on the main route table", func() {
+				So(fields["posture"], ShouldResemble, Posture{MainRouteTable: true})
+			})
+		})
+	})
+}
@@ -0,0 +1,183 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// publishCommand validates a local event file against the event schema
+// and publishes it on the subject of its verb, optionally waiting for the
+// response:
+//
+//	network-all-aws-connector publish --file event.json --verb create
+func publishCommand(args []string) error {
+	flags := flag.NewFlagSet("publish", flag.ContinueOnError)
+	file := flags.String("file", "", "event file to publish")
+	v := flags.String("verb", "create", "verb of the event, one of "+strings.Join(supportedVerbs, ", "))
+	wait := flags.Duration("wait", 30*time.Second, "how long to wait for the response, 0 not to wait")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *file == "" {
+		return errors.New("--file is required")
+	}
+
+	raw, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+
+	subject, data, err := craftEvent(raw, *v)
+	if err != nil {
+		return err
+	}
+
+	conn, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if *wait <= 0 {
+		conn.Publish(subject, data)
+		fmt.Println("published on " + subject)
+		return conn.Flush()
+	}
+
+	replies := make(chan *nats.Msg, 2)
+	conn.ChanSubscribe(subject+".done", replies)
+	conn.ChanSubscribe(subject+".error", replies)
+	conn.Publish(subject, data)
+	fmt.Println("published on " + subject + ", waiting for the response")
+
+	select {
+	case reply := <-replies:
+		fmt.Println(reply.Subject)
+		fmt.Println(string(reply.Data))
+		if finalStatus(reply.Subject) == statusErrored {
+			return errors.New("event failed")
+		}
+		return nil
+	case <-time.After(*wait):
+		return errors.New("no response within " + wait.String())
+	}
+}
+
+// craftEvent returns the subject and body to publish a local event with,
+// giving it a _uuid when it has none. Creates, updates and deletes are
+// validated against the event schema.
+func craftEvent(data []byte, v string) (string, []byte, error) {
+	if !contains(supportedVerbs, v) {
+		return "", nil, errors.New("unsupported verb " + v + ", use one of " + strings.Join(supportedVerbs, ", "))
+	}
+
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(data, &body); err != nil {
+		return "", nil, errors.New("event is not a JSON object: " + err.Error())
+	}
+
+	if mutating("network." + v + ".aws") {
+		legacy, _ := fromGenericFields(data)
+		fields := make(map[string]interface{})
+		json.Unmarshal(legacy, &fields)
+		if problems := schemaProblems(eventSchema(), fields); len(problems) > 0 {
+			return "", nil, errors.New("event does not match the schema: " + strings.Join(problems, "; "))
+		}
+	}
+
+	if id, _ := body["_uuid"].(string); id == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		body["_uuid"] = "local-" + hex.EncodeToString(b)
+	}
+
+	data, err := json.Marshal(body)
+	return "network." + v + ".aws", data, err
+}
+
+// schemaProblems checks an event against the required fields and property
+// types of a schema
+func schemaProblems(schema, body map[string]interface{}) []string {
+	var problems []string
+
+	required, _ := schema["required"].([]string)
+	for _, f := range required {
+		if _, ok := body[f]; !ok {
+			problems = append(problems, "missing "+f)
+		}
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		var options []string
+		satisfied := false
+		for _, option := range anyOf {
+			fields, _ := option.(map[string]interface{})["required"].([]string)
+			options = append(options, strings.Join(fields, " and "))
+
+			present := true
+			for _, f := range fields {
+				if _, ok := body[f]; !ok {
+					present = false
+				}
+			}
+			satisfied = satisfied || present
+		}
+		if !satisfied {
+			problems = append(problems, "needs "+strings.Join(options, " or "))
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	var fields []string
+	for f := range body {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	for _, f := range fields {
+		p, ok := properties[f].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _ := p["type"].(string)
+		if !ofType(body[f], kind) {
+			problems = append(problems, f+" should be a "+kind)
+		}
+	}
+
+	return problems
+}
+
+func ofType(v interface{}, kind string) bool {
+	switch v.(type) {
+	case nil:
+		return true
+	case string:
+		return kind == "string"
+	case bool:
+		return kind == "boolean"
+	case float64:
+		return kind == "number" || kind == "integer"
+	case []interface{}:
+		return kind == "array"
+	case map[string]interface{}:
+		return kind == "object"
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCraftEvent(t *testing.T) {
+	Convey("Given a local event file", t, func() {
+		data := []byte(`{"datacenter_region":"eu-west-1","datacenter_secret":"key","datacenter_token":"token","vpc_id":"vpc-0000000","range":"10.0.1.0/24"}`)
+
+		Convey("When crafting a create from it", func() {
+			subject, body, err := craftEvent(data, "create")
+
+			var event map[string]interface{}
+			json.Unmarshal(body, &event)
+
+			Convey("It should publish it on the create subject with a uuid", func() {
+				So(err, ShouldBeNil)
+				So(subject, ShouldEqual, "network.create.aws")
+				So(event["_uuid"], ShouldStartWith, "local-")
+				So(event["range"], ShouldEqual, "10.0.1.0/24")
+			})
+		})
+
+		Convey("When crafting an event for an unsupported verb", func() {
+			_, _, err := craftEvent(data, "resize")
+
+			Convey("It should refuse it", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an event not matching the schema", t, func() {
+		data := []byte(`{"datacenter_region":"eu-west-1","is_public":"yes"}`)
+
+		Convey("When crafting a create from it", func() {
+			_, _, err := craftEvent(data, "create")
+
+			Convey("It should list every problem", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "missing datacenter_secret")
+				So(err.Error(), ShouldContainSubstring, "needs vpc_id or vpc_tag")
+				So(err.Error(), ShouldContainSubstring, "is_public should be a boolean")
+			})
+		})
+
+		Convey("When crafting a get from it", func() {
+			_, _, err := craftEvent(data, "get")
+
+			Convey("It should not check it against the schema", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
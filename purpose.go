@@ -0,0 +1,103 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// subnetPurpose encodes the conventions AWS sets for the subnets of a
+// platform: the tags it looks networks up by, whether they may be public
+// and the smallest range they work with
+type subnetPurpose struct {
+	publicTags  map[string]string
+	privateTags map[string]string
+	private     bool
+	maxPrefix   int
+}
+
+// purposes are the platforms a network can be created for
+var purposes = map[string]subnetPurpose{
+	// EKS places internet facing load balancers in subnets tagged
+	// kubernetes.io/role/elb and internal ones in those tagged
+	// kubernetes.io/role/internal-elb, and needs at least 6 free addresses
+	"eks": {
+		publicTags:  map[string]string{"kubernetes.io/role/elb": "1"},
+		privateTags: map[string]string{"kubernetes.io/role/internal-elb": "1"},
+		maxPrefix:   28,
+	},
+	// Lambda functions get no public address, so they reach the internet
+	// through a NAT gateway from private subnets only
+	"lambda": {
+		private:   true,
+		maxPrefix: 28,
+	},
+}
+
+// purposeNames returns the known purposes, sorted
+func purposeNames() []string {
+	var names []string
+	for name := range purposes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPurpose checks the event against the conventions of the platform
+// its purpose names, and fills in the tags the platform expects. Tags of
+// the event win, so a value can be overridden but not dropped.
+func applyPurpose(data []byte) ([]byte, error) {
+	var event struct {
+		Purpose    string            `json:"purpose"`
+		EKSCluster string            `json:"eks_cluster"`
+		IsPublic   bool              `json:"is_public"`
+		Subnet     string            `json:"range"`
+		Tags       map[string]string `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil || event.Purpose == "" {
+		return data, nil
+	}
+
+	p, ok := purposes[event.Purpose]
+	if !ok {
+		return data, newFieldError(errPayload, "purpose", "Network purpose "+event.Purpose+" is not one of "+strings.Join(purposeNames(), ", "))
+	}
+
+	if p.private && event.IsPublic {
+		return data, newFieldError(errPolicy, "is_public", "Networks for "+event.Purpose+" must be private")
+	}
+
+	if event.Subnet != "" {
+		_, n, err := net.ParseCIDR(event.Subnet)
+		if err != nil {
+			return data, newFieldError(errPayload, "range", "Network range "+event.Subnet+" is not a valid IPv4 CIDR block")
+		}
+		if ones, _ := n.Mask.Size(); ones > p.maxPrefix {
+			return data, newFieldError(errPolicy, "range", fmt.Sprintf("Network range %s is too small for %s, use a /%d or larger", event.Subnet, event.Purpose, p.maxPrefix))
+		}
+	}
+
+	tags := map[string]interface{}{"ernest.purpose": event.Purpose}
+	required := p.privateTags
+	if event.IsPublic {
+		required = p.publicTags
+	}
+	for k, v := range required {
+		tags[k] = v
+	}
+	if event.EKSCluster != "" && event.Purpose == "eks" {
+		tags["kubernetes.io/cluster/"+event.EKSCluster] = "shared"
+	}
+	for k, v := range event.Tags {
+		tags[k] = v
+	}
+
+	return setField(data, "tags", tags), nil
+}
@@ -0,0 +1,82 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPurpose(t *testing.T) {
+	Convey("Given a private network for an EKS cluster", t, func() {
+		data := []byte(`{"purpose":"eks","eks_cluster":"shop","range":"10.1.0.0/24","tags":{"owner":"shop"}}`)
+
+		Convey("When its purpose is applied", func() {
+			data, err := applyPurpose(data)
+			So(err, ShouldBeNil)
+			r := parseRequest(data)
+
+			Convey("It should get the tags EKS looks subnets up by", func() {
+				So(r.Tags["kubernetes.io/role/internal-elb"], ShouldEqual, "1")
+				So(r.Tags["kubernetes.io/cluster/shop"], ShouldEqual, "shared")
+				So(r.Tags, ShouldNotContainKey, "kubernetes.io/role/elb")
+				So(r.Tags["ernest.purpose"], ShouldEqual, "eks")
+			})
+
+			Convey("It should keep the tags of the event", func() {
+				So(r.Tags["owner"], ShouldEqual, "shop")
+			})
+		})
+	})
+
+	Convey("Given a public network for EKS", t, func() {
+		data, err := applyPurpose([]byte(`{"purpose":"eks","is_public":true,"range":"10.1.0.0/24"}`))
+
+		Convey("It should be tagged for internet facing load balancers", func() {
+			So(err, ShouldBeNil)
+			So(parseRequest(data).Tags["kubernetes.io/role/elb"], ShouldEqual, "1")
+		})
+	})
+
+	Convey("Given a public network for Lambda", t, func() {
+		_, err := applyPurpose([]byte(`{"purpose":"lambda","is_public":true,"range":"10.1.0.0/24"}`))
+
+		Convey("It should be rejected", func() {
+			So(err, ShouldNotBeNil)
+			So(err.(*connectorError).code, ShouldEqual, errPolicy)
+			So(err.(*connectorError).field, ShouldEqual, "is_public")
+		})
+	})
+
+	Convey("Given a network too small for its purpose", t, func() {
+		_, err := applyPurpose([]byte(`{"purpose":"lambda","range":"10.1.0.0/29"}`))
+
+		Convey("It should be rejected", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Network range 10.1.0.0/29 is too small for lambda, use a /28 or larger")
+		})
+	})
+
+	Convey("Given an unknown purpose", t, func() {
+		_, err := applyPurpose([]byte(`{"purpose":"batch"}`))
+
+		Convey("It should be rejected", func() {
+			So(err, ShouldNotBeNil)
+			So(err.(*connectorError).code, ShouldEqual, errPayload)
+			So(err.Error(), ShouldEqual, "Network purpose batch is not one of eks, lambda")
+		})
+	})
+
+	Convey("Given a network without purpose", t, func() {
+		data := []byte(`{"range":"10.1.0.0/29"}`)
+
+		Convey("It should be left alone", func() {
+			out, err := applyPurpose(data)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, string(data))
+		})
+	})
+}
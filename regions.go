@@ -0,0 +1,52 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sync"
+)
+
+// regionSlots caps the mutating operations running at once in each
+// region, as EC2 mutation quotas are regional
+type regionSlots struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+	limit func(region string) int
+}
+
+func newRegionSlots(limit func(region string) int) *regionSlots {
+	return &regionSlots{
+		slots: make(map[string]chan struct{}),
+		limit: limit,
+	}
+}
+
+// acquire waits for a free slot in the region
+func (s *regionSlots) acquire(region string) {
+	if slots := s.region(region); slots != nil {
+		slots <- struct{}{}
+	}
+}
+
+func (s *regionSlots) release(region string) {
+	if slots := s.region(region); slots != nil {
+		<-slots
+	}
+}
+
+func (s *regionSlots) region(region string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slots, ok := s.slots[region]
+	if !ok {
+		if limit := s.limit(region); limit > 0 {
+			slots = make(chan struct{}, limit)
+		}
+		s.slots[region] = slots
+	}
+
+	return slots
+}
@@ -0,0 +1,47 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegionSlots(t *testing.T) {
+	Convey("Given a connector allowing one operation at once in eu-west-1", t, func() {
+		c := config{RegionLimits: map[string]int{"eu-west-1": 1}}
+		s := newRegionSlots(c.regionLimit)
+
+		Convey("When an operation is running there", func() {
+			s.acquire("eu-west-1")
+
+			Convey("It should hold the next one until it finishes", func() {
+				acquired := make(chan struct{})
+				go func() {
+					s.acquire("eu-west-1")
+					close(acquired)
+				}()
+
+				select {
+				case <-acquired:
+					t.Fatal("second operation should have waited")
+				case <-time.After(20 * time.Millisecond):
+				}
+
+				s.release("eu-west-1")
+				<-acquired
+				s.release("eu-west-1")
+			})
+
+			Convey("It should not hold operations in other regions", func() {
+				s.acquire("us-east-1")
+				s.release("us-east-1")
+				s.release("eu-west-1")
+			})
+		})
+	})
+}
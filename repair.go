@@ -0,0 +1,156 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats"
+)
+
+const (
+	resultUnchanged = "unchanged"
+	resultRepaired  = "repaired"
+	resultMissing   = "missing"
+)
+
+// repairResult is what a repair found and did on a network
+type repairResult struct {
+	NetworkAWSID string            `json:"network_aws_id"`
+	Status       string            `json:"status"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// repairHandler retrofits the managed markers onto networks created by
+// older connector versions: given the ids of networks known to belong to
+// the service of the event, it tags those missing their ernest.service,
+// ernest.batch_id, environment or Name tags, along with the route table
+// and internet gateway only they use
+func repairHandler(m *nats.Msg) {
+	req, data, err := decodeStandalone(m)
+	if err != nil {
+		publishError(m.Subject, errorResponse(nil, err))
+		return
+	}
+	body := sanitizedBody(m.Data)
+
+	var event struct {
+		Networks []string          `json:"network_aws_ids"`
+		Names    map[string]string `json:"names"`
+	}
+	json.Unmarshal(data, &event)
+
+	// repairs retag existing networks, as updates do
+	err = checkPolicy(cfg, "network.update.aws", req)
+	if until, frozen := frozenUntil(cfg.FreezeWindows, req, time.Now()); err == nil && frozen && !req.DryRun {
+		err = newError(errFreeze, "Changes to "+req.DatacenterRegion+" are frozen until "+until.Format(time.RFC3339))
+	}
+	if err == nil && (req.Service == "" || len(event.Networks) == 0) {
+		err = newError(errPayload, "Network repair needs a service and network_aws_ids")
+	}
+	if err != nil {
+		publishError(m.Subject, errorResponse(body, err))
+		return
+	}
+
+	results, failed := repairNetworks(ec2Client(req), req, event.Networks, event.Names)
+	response := setFields(body, map[string]interface{}{
+		"dry_run":   req.DryRun,
+		"resources": results,
+	})
+	if failed {
+		publishError(m.Subject, errorResponse(response, newError(errInternal, "Some networks could not be repaired")))
+		return
+	}
+
+	nc.Publish(m.Subject+".done", response)
+}
+
+// repairNetworks checks and, unless the event is a dry run, applies the
+// missing tags of each network. It reports whether any of them failed.
+func repairNetworks(client ec2API, r request, ids []string, names map[string]string) ([]repairResult, bool) {
+	results := make([]repairResult, 0, len(ids))
+	failed := false
+
+	for _, id := range ids {
+		result := repairResult{NetworkAWSID: id}
+
+		err := func() error {
+			subnet, err := describeSubnet(client, id)
+			if err != nil || subnet == nil {
+				result.Status = resultMissing
+				return err
+			}
+
+			missing, err := missingTags(subnet, r, names[id])
+			if err != nil || len(missing) == 0 {
+				result.Status = resultUnchanged
+				return err
+			}
+			result.Tags = missing
+			result.Status = resultRepaired
+			if r.DryRun {
+				return nil
+			}
+
+			tables, igws, err := vpcRouting(client, aws.StringValue(subnet.VpcId))
+			if err != nil {
+				return err
+			}
+			return tag(client, owned(subnet, tables, igws, nil), missing)
+		}()
+
+		if err != nil {
+			result.Status, result.Error = resultFailed, err.Error()
+			failed = true
+		}
+		results = append(results, result)
+	}
+
+	return results, failed
+}
+
+// missingTags returns the managed markers the network lacks. A network
+// marked as belonging to another service, environment or VPC is refused
+// rather than retagged.
+func missingTags(subnet *ec2.Subnet, r request, name string) (map[string]string, error) {
+	id := aws.StringValue(subnet.SubnetId)
+	tags := tagMap(subnet.Tags)
+
+	if r.VPCID != "" && aws.StringValue(subnet.VpcId) != r.VPCID {
+		return nil, newFieldError(errMismatch, "network_aws_ids", "Network "+id+" belongs to "+aws.StringValue(subnet.VpcId)+", not to "+r.VPCID)
+	}
+	if service := tags["ernest.service"]; service != "" && service != r.Service {
+		return nil, newFieldError(errMismatch, "network_aws_ids", "Network "+id+" belongs to service "+service)
+	}
+
+	want := map[string]string{"ernest.service": r.Service}
+	if r.BatchID != "" {
+		want["ernest.batch_id"] = r.BatchID
+	}
+	if cfg.Scope.enabled() {
+		if v, ok := tags[cfg.Scope.Key]; ok && v != cfg.Scope.Value {
+			return nil, newFieldError(errMismatch, "network_aws_ids", "Network "+id+" belongs to environment "+v)
+		}
+		want[cfg.Scope.Key] = cfg.Scope.Value
+	}
+	if name == "" {
+		name = r.Service + "-" + aws.StringValue(subnet.CidrBlock)
+	}
+	want["Name"] = name
+
+	missing := make(map[string]string)
+	for k, v := range want {
+		if _, ok := tags[k]; !ok {
+			missing[k] = v
+		}
+	}
+
+	return missing, nil
+}
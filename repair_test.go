@@ -0,0 +1,89 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMissingTags(t *testing.T) {
+	Convey("Given a network created by an older connector", t, func() {
+		subnet := &ec2.Subnet{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000"), CidrBlock: aws.String("10.0.0.0/24")}
+		r := request{Service: "web", BatchID: "repair-1", VPCID: "vpc-0000000"}
+
+		Convey("When it carries no managed marker", func() {
+			missing, err := missingTags(subnet, r, "")
+
+			Convey("It should add them, naming it after its service and range", func() {
+				So(err, ShouldBeNil)
+				So(missing, ShouldResemble, map[string]string{
+					"ernest.service":  "web",
+					"ernest.batch_id": "repair-1",
+					"Name":            "web-10.0.0.0/24",
+				})
+			})
+		})
+
+		Convey("When it is already named", func() {
+			subnet.Tags = []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("frontend")}}
+			missing, _ := missingTags(subnet, r, "web")
+
+			Convey("It should keep its name", func() {
+				So(missing, ShouldNotContainKey, "Name")
+			})
+		})
+
+		Convey("When it belongs to another service", func() {
+			subnet.Tags = []*ec2.Tag{{Key: aws.String("ernest.service"), Value: aws.String("api")}}
+			_, err := missingTags(subnet, r, "")
+
+			Convey("It should refuse to retag it", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errMismatch)
+			})
+		})
+	})
+}
+
+func TestRepairNetworks(t *testing.T) {
+	Convey("Given networks of which one is untagged", t, func() {
+		client := &mockEC2{subnets: []*ec2.Subnet{
+			{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000"), CidrBlock: aws.String("10.0.0.0/24")},
+			{SubnetId: aws.String("subnet-11111111"), VpcId: aws.String("vpc-0000000"), CidrBlock: aws.String("10.0.1.0/24"), Tags: []*ec2.Tag{
+				{Key: aws.String("ernest.service"), Value: aws.String("web")},
+				{Key: aws.String("Name"), Value: aws.String("db")},
+			}},
+		}}
+		r := request{Service: "web"}
+		ids := []string{"subnet-00000000", "subnet-11111111", "subnet-22222222"}
+
+		Convey("When repairing them", func() {
+			results, failed := repairNetworks(client, r, ids, map[string]string{"subnet-00000000": "frontend"})
+
+			Convey("It should only tag the untagged one", func() {
+				So(failed, ShouldBeFalse)
+				So(results[0].Status, ShouldEqual, resultRepaired)
+				So(results[0].Tags["Name"], ShouldEqual, "frontend")
+				So(results[1].Status, ShouldEqual, resultUnchanged)
+				So(results[2].Status, ShouldEqual, resultMissing)
+				So(client.calls, ShouldResemble, []string{"CreateTags subnet-00000000"})
+			})
+		})
+
+		Convey("When it is a dry run", func() {
+			r.DryRun = true
+			results, _ := repairNetworks(client, r, ids, nil)
+
+			Convey("It should report without tagging", func() {
+				So(results[0].Status, ShouldEqual, resultRepaired)
+				So(client.calls, ShouldBeEmpty)
+			})
+		})
+	})
+}
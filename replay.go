@@ -0,0 +1,74 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/nats-io/nats"
+)
+
+// replayFields are dropped from replayed events, as the operator re-drives
+// them on purpose long after they were first published
+var replayFields = []string{"_timestamp", "_deadline", "_ttl"}
+
+// redrive hands replayed events over to the controller, so they are
+// parked while the connector is paused and handled by the worker pool
+// like any other event
+var redrive nats.MsgHandler
+
+// replayHandler re-drives a stored event by uuid. Events which already
+// completed get their stored response published again, failed ones are
+// processed again with the credentials carried by the replay request.
+func replayHandler(m *nats.Msg) {
+	req := parseRequest(m.Data)
+
+	rec, err := store.load(req.UUID)
+	if err == nil && rec == nil {
+		err = newError(errNotFound, "Event "+req.UUID+" not found")
+	}
+	if err != nil {
+		publishError(m.Subject, errorResponse(sanitizedBody(m.Data), err))
+		return
+	}
+
+	if rec.Outcome == statusDone {
+		data, _ := json.Marshal(rec.Response)
+		nc.Publish(rec.Subject+".done", data)
+		nc.Publish(m.Subject+".done", sanitizedBody(m.Data))
+		return
+	}
+
+	body := rec.Request
+	for _, f := range replayFields {
+		delete(body, f)
+	}
+
+	data, _ := json.Marshal(body)
+	data = setFields(data, credentialsOf(m.Data))
+
+	nc.Publish(m.Subject+".done", sanitizedBody(m.Data))
+	redrive(&nats.Msg{Subject: rec.Subject, Data: data})
+}
+
+// credentialsOf returns the credential fields set on an event body
+func credentialsOf(data []byte) map[string]interface{} {
+	body := make(map[string]interface{})
+	json.Unmarshal(data, &body)
+
+	creds := make(map[string]interface{})
+	for _, f := range credentialFields {
+		if v, ok := body[f]; ok {
+			creds[f] = v
+		}
+	}
+
+	return creds
+}
+
+func sanitizedBody(data []byte) []byte {
+	body, _ := json.Marshal(sanitize(data))
+	return body
+}
@@ -0,0 +1,53 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nats-io/nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReplayHandler(t *testing.T) {
+	testSetup("network.replay.aws")
+
+	Convey("Given a failed event in the event store", t, func() {
+		dir, _ := ioutil.TempDir("", "network-replay")
+		defer os.RemoveAll(dir)
+		saved, savedRedrive := store, redrive
+		defer func() { store, redrive = saved, savedRedrive }()
+
+		store = newEventStore(dir)
+		data, _ := json.Marshal(testEvent)
+		So(store.save(newRecord("network.create.aws", parseRequest(data), data, data, statusErrored)), ShouldBeNil)
+
+		var handled []*nats.Msg
+		ctl := newController(func(m *nats.Msg) { handled = append(handled, m) })
+		redrive = ctl.handle
+
+		Convey("When it is replayed while the connector is paused", func() {
+			ctl.pause()
+			replayHandler(&nats.Msg{Subject: "network.replay.aws", Data: []byte(`{"_uuid":"test"}`)})
+
+			Convey("It should be parked until the connector is resumed", func() {
+				So(handled, ShouldBeEmpty)
+				So(ctl.state().Parked, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When it is replayed", func() {
+			replayHandler(&nats.Msg{Subject: "network.replay.aws", Data: []byte(`{"_uuid":"test"}`)})
+
+			Convey("It should be handed over to the worker pool", func() {
+				So(handled, ShouldHaveLength, 1)
+				So(handled[0].Subject, ShouldEqual, "network.create.aws")
+			})
+		})
+	})
+}
@@ -0,0 +1,250 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats"
+)
+
+// replica is another region a created network is replicated to, in a VPC
+// peered with the one of the event
+type replica struct {
+	Region string `json:"region"`
+	VPCID  string `json:"vpc_id"`
+}
+
+// replicaResult is the outcome of replicating a network to a region
+type replicaResult struct {
+	Region           string `json:"region"`
+	VPCID            string `json:"vpc_id"`
+	Range            string `json:"range,omitempty"`
+	NetworkAWSID     string `json:"network_aws_id,omitempty"`
+	AvailabilityZone string `json:"availability_zone,omitempty"`
+	Error            string `json:"error,omitempty"`
+	ErrorCode        string `json:"error_code,omitempty"`
+}
+
+// regionalFields name resources of the event region, so replicas are
+// created without them
+var regionalFields = []string{
+	"network_aws_id",
+	"availability_zone",
+	"egress_nat_gateway_id",
+	"routes",
+	"prefix_list_id",
+	"ipv6_range",
+	"regions",
+}
+
+// validReplicas rejects replicas missing their region or VPC, or
+// replicating to the region of the event
+func validReplicas(r request) error {
+	seen := make(map[string]bool)
+	for _, rep := range r.Regions {
+		if rep.Region == "" || rep.VPCID == "" {
+			return newFieldError(errPayload, "regions", "Replicas need a region and a vpc_id")
+		}
+		if rep.Region == r.DatacenterRegion || seen[rep.Region] {
+			return newFieldError(errPayload, "regions", "Region "+rep.Region+" is replicated to more than once")
+		}
+		seen[rep.Region] = true
+	}
+	return nil
+}
+
+// replicate creates the network again in each region of the event, at the
+// same place in the replica VPC as in the VPC of the event, with the same
+// tags and public or private role. A failing region doesn't fail the
+// others, nor the event. Replicas are recorded in undo, so they are
+// removed when the create is rolled back.
+func replicate(m *nats.Msg, r request, undo *undoLog) []replicaResult {
+	results := make([]replicaResult, 0, len(r.Regions))
+
+	source, err := describeVPCCIDRs(readClient(r), r.VPCID)
+	for _, rep := range r.Regions {
+		if err != nil {
+			results = append(results, failedReplica(rep, "", errorResponse(nil, err)))
+			continue
+		}
+		results = append(results, replicateTo(m, r, rep, source, undo))
+	}
+
+	return results
+}
+
+// replicateTo creates a replica as the events pipeline would have it
+// created: refused during freeze windows of its region and by the
+// policies of the connector, once its range is known, and locked against
+// other batches changing it
+func replicateTo(m *nats.Msg, r request, rep replica, source []*net.IPNet, undo *undoLog) replicaResult {
+	target := r
+	target.DatacenterRegion = rep.Region
+	target.VPCID = rep.VPCID
+
+	if until, frozen := frozenUntil(cfg.FreezeWindows, target, time.Now()); frozen {
+		err := newError(errFreeze, "Changes to "+rep.Region+" are frozen until "+until.Format(time.RFC3339))
+		return failedReplica(rep, "", errorResponse(nil, err))
+	}
+
+	cidrs, err := describeVPCCIDRs(readClient(target), rep.VPCID)
+	if err != nil {
+		return failedReplica(rep, "", errorResponse(nil, err))
+	}
+
+	rng, err := relativeRange(r.Subnet, source, cidrs)
+	if err != nil {
+		return failedReplica(rep, "", errorResponse(nil, err))
+	}
+
+	body := make(map[string]interface{})
+	json.Unmarshal(m.Data, &body)
+	for _, f := range regionalFields {
+		delete(body, f)
+	}
+	body["datacenter_region"] = rep.Region
+	body["vpc_id"] = rep.VPCID
+	body["range"] = rng
+
+	data, _ := json.Marshal(body)
+	msg := &nats.Msg{Subject: m.Subject, Data: data}
+	target = parseRequest(data)
+
+	if err := checkPolicy(cfg, m.Subject, target); err != nil {
+		return failedReplica(rep, rng, errorResponse(data, err))
+	}
+
+	keys := target.lockKeys()
+	if err := inflight.acquire(keys, target.BatchID); err != nil {
+		return failedReplica(rep, rng, errorResponse(data, err))
+	}
+	defer inflight.release(keys)
+
+	preexisting, err := routingIDs(readClient(target), target.VPCID)
+	if err != nil {
+		return failedReplica(rep, rng, errorResponse(data, err))
+	}
+
+	subject, resp := handle(msg, nil)
+	if finalStatus(subject) != statusDone {
+		return failedReplica(rep, rng, resp)
+	}
+
+	created := parseRequest(resp)
+	network := target
+	network.NetworkAWSID = created.NetworkAWSID
+	undo.add("replica", rep.Region+":"+network.NetworkAWSID, func() error {
+		return removeReplica(ec2Client(network), routingClient(network), network)
+	})
+	if err := tagNetwork(ec2Client(target), created.NetworkAWSID, resourceTags(target), preexisting); err != nil {
+		return failedReplica(rep, rng, errorResponse(resp, err))
+	}
+
+	return replicaResult{
+		Region:           rep.Region,
+		VPCID:            rep.VPCID,
+		Range:            rng,
+		NetworkAWSID:     created.NetworkAWSID,
+		AvailabilityZone: created.AvailabilityZone,
+	}
+}
+
+// removeReplica deletes a replica along with the routing created for it,
+// as a delete event would
+func removeReplica(client, routing ec2API, r request) error {
+	plan, err := planDelete(client, r)
+	if err != nil {
+		return err
+	}
+	if err := markTeardown(routing, r, plan); err != nil {
+		return err
+	}
+	if err := teardownRouting(client, routing, r, plan); err != nil {
+		return err
+	}
+
+	_, err = client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: aws.String(r.NetworkAWSID)})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	return teardownGateways(routing, r, plan)
+}
+
+func failedReplica(rep replica, rng string, resp []byte) replicaResult {
+	var failure struct {
+		Error     string `json:"error"`
+		ErrorCode string `json:"error_code"`
+		ID        string `json:"network_aws_id"`
+	}
+	json.Unmarshal(resp, &failure)
+
+	return replicaResult{
+		Region:       rep.Region,
+		VPCID:        rep.VPCID,
+		Range:        rng,
+		NetworkAWSID: failure.ID,
+		Error:        failure.Error,
+		ErrorCode:    failure.ErrorCode,
+	}
+}
+
+func describeVPCCIDRs(client ec2API, id string) ([]*net.IPNet, error) {
+	resp, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{
+		VpcIds: []*string{aws.String(id)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Vpcs) == 0 {
+		return nil, newFieldError(errNotFound, "vpc_id", "VPC "+id+" does not exist")
+	}
+
+	return vpcCIDRs(resp.Vpcs[0]), nil
+}
+
+// relativeRange returns the range at the same offset in the target CIDR
+// blocks as the network is in the source ones, block for block
+func relativeRange(subnet string, source, target []*net.IPNet) (string, error) {
+	ip, n, err := net.ParseCIDR(subnet)
+	if err != nil || ip.To4() == nil {
+		return "", newFieldError(errPayload, "range", "Network range "+subnet+" is not a valid IPv4 CIDR block")
+	}
+
+	for i, s := range source {
+		if !cidrWithin(n, s) {
+			continue
+		}
+		if i >= len(target) {
+			return "", newFieldError(errRange, "regions", "Replica VPC has no CIDR block matching the one of "+subnet)
+		}
+
+		offset := ipv4Int(n.IP) - ipv4Int(s.IP)
+		replicated := &net.IPNet{IP: ipv4(ipv4Int(target[i].IP) + offset), Mask: n.Mask}
+		if !cidrWithin(replicated, target[i]) {
+			return "", newFieldError(errRange, "regions", "Network range "+subnet+" doesn't fit in "+target[i].String())
+		}
+		return replicated.String(), nil
+	}
+
+	return "", newFieldError(errRange, "range", "Network range "+subnet+" is outside of the CIDR blocks of its VPC")
+}
+
+func ipv4Int(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func ipv4(n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
@@ -0,0 +1,151 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func cidrs(blocks ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, b := range blocks {
+		_, n, _ := net.ParseCIDR(b)
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func TestRelativeRange(t *testing.T) {
+	Convey("Given a network in a VPC", t, func() {
+		source := cidrs("10.0.0.0/16", "100.64.0.0/20")
+
+		Convey("When the replica VPC is as large", func() {
+			rng, err := relativeRange("10.0.12.0/24", source, cidrs("10.1.0.0/16"))
+
+			Convey("It should keep the network at the same offset", func() {
+				So(err, ShouldBeNil)
+				So(rng, ShouldEqual, "10.1.12.0/24")
+			})
+		})
+
+		Convey("When the network is in a secondary CIDR block", func() {
+			rng, err := relativeRange("100.64.4.0/24", source, cidrs("10.1.0.0/16", "100.65.0.0/20"))
+
+			Convey("It should use the matching block of the replica VPC", func() {
+				So(err, ShouldBeNil)
+				So(rng, ShouldEqual, "100.65.4.0/24")
+			})
+		})
+
+		Convey("When the replica VPC is too small", func() {
+			_, err := relativeRange("10.0.20.0/24", source, cidrs("10.1.0.0/20"))
+
+			Convey("It should report the range as out of range", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errRange)
+			})
+		})
+	})
+}
+
+func TestValidReplicas(t *testing.T) {
+	Convey("Given a network replicated to other regions", t, func() {
+		r := request{DatacenterRegion: "eu-west-1"}
+
+		Convey("When each replica names a region and a VPC", func() {
+			r.Regions = []replica{{Region: "us-east-1", VPCID: "vpc-0000000"}, {Region: "eu-central-1", VPCID: "vpc-1111111"}}
+
+			Convey("It should accept them", func() {
+				So(validReplicas(r), ShouldBeNil)
+			})
+		})
+
+		Convey("When a replica is missing its VPC", func() {
+			r.Regions = []replica{{Region: "us-east-1"}}
+
+			Convey("It should reject the payload", func() {
+				err := validReplicas(r)
+				So(err.(*connectorError).code, ShouldEqual, errPayload)
+				So(err.(*connectorError).field, ShouldEqual, "regions")
+			})
+		})
+
+		Convey("When a replica is in the region of the event", func() {
+			r.Regions = []replica{{Region: "eu-west-1", VPCID: "vpc-0000000"}}
+
+			Convey("It should reject the payload", func() {
+				So(validReplicas(r), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestFailedReplica(t *testing.T) {
+	Convey("Given a failed replica create", t, func() {
+		result := failedReplica(replica{Region: "us-east-1", VPCID: "vpc-0000000"}, "10.1.12.0/24", []byte(`{"error":"VPC vpc-0000000 does not exist","error_code":"not_found"}`))
+
+		Convey("It should report the failure for its region", func() {
+			So(result.Region, ShouldEqual, "us-east-1")
+			So(result.Range, ShouldEqual, "10.1.12.0/24")
+			So(result.ErrorCode, ShouldEqual, errNotFound)
+			So(result.Error, ShouldEqual, "VPC vpc-0000000 does not exist")
+		})
+	})
+}
+
+func TestReplicateTo(t *testing.T) {
+	Convey("Given a network replicated to a region in a freeze window", t, func() {
+		w, err := parseFreezeWindow("*/us-east-1 * * * * * 1h")
+		So(err, ShouldBeNil)
+		windows := cfg.FreezeWindows
+		cfg.FreezeWindows = []freezeWindow{w}
+		defer func() { cfg.FreezeWindows = windows }()
+
+		m := &nats.Msg{Subject: "network.create.aws", Data: []byte(`{"datacenter_region":"eu-west-1","vpc_id":"vpc-0000000","range":"10.0.12.0/24"}`)}
+		r := parseRequest(m.Data)
+		undo := &undoLog{}
+
+		Convey("When it is replicated", func() {
+			result := replicateTo(m, r, replica{Region: "us-east-1", VPCID: "vpc-1111111"}, cidrs("10.0.0.0/16"), undo)
+
+			Convey("It should refuse the replica as it refuses events", func() {
+				So(result.ErrorCode, ShouldEqual, errFreeze)
+				So(undo.steps, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestRemoveReplica(t *testing.T) {
+	Convey("Given a replica created with its own route table", t, func() {
+		client := &teardownEC2{mockEC2: mockEC2{
+			subnets: []*ec2.Subnet{{SubnetId: aws.String("subnet-11111111"), VpcId: aws.String("vpc-1111111")}},
+			tables:  []*ec2.RouteTable{routeTable("rtb-11111111", []string{"subnet-11111111"}, "")},
+		}}
+		client.tables[0].Tags = ernestTags()
+		r := request{NetworkAWSID: "subnet-11111111", VPCID: "vpc-1111111"}
+
+		Convey("When the create it replicates is rolled back", func() {
+			err := removeReplica(deletingEC2{client}, deletingEC2{client}, r)
+
+			Convey("It should delete it along with its route table", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{
+					"CreateTags rtb-11111111",
+					"DisassociateRouteTable rtbassoc-11111111",
+					"DeleteRouteTable rtb-11111111",
+					"DeleteSubnet subnet-11111111",
+				})
+				So(client.subnets, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,226 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// request holds the event fields the connector acts on before handing the
+// event over to ernestaws
+type request struct {
+	UUID         string `json:"_uuid"`
+	BatchID      string `json:"_batch_id"`
+	ProviderType string `json:"_type"`
+	Tenant       string `json:"_tenant"`
+	Deadline     string `json:"_deadline"`
+	TTL          string `json:"_ttl"`
+	Profile      string `json:"_profile"`
+	Timestamp    string `json:"_timestamp"`
+	DryRun       bool   `json:"_dry_run"`
+	ImportFormat string `json:"_import_format"`
+	Version      string `json:"_version"`
+	MaxMutations int    `json:"_max_mutations"`
+	MaxDuration  string `json:"_max_duration"`
+	Continuation string `json:"_continuation"`
+
+	MaxResults int64  `json:"max_results"`
+	NextToken  string `json:"next_token"`
+
+	InterfaceTimeout string   `json:"interface_wait_timeout"`
+	WaitFor          []string `json:"wait_for"`
+	WaitForTimeout   string   `json:"wait_for_timeout"`
+
+	DatacenterRegion      string `json:"datacenter_region"`
+	DatacenterAccessKey   string `json:"datacenter_secret"`
+	DatacenterAccessToken string `json:"datacenter_token"`
+	ReadAccessKey         string `json:"datacenter_read_secret"`
+	ReadAccessToken       string `json:"datacenter_read_token"`
+	RoleARN               string `json:"datacenter_role_arn"`
+	ExternalID            string `json:"datacenter_external_id"`
+	Endpoint              string `json:"aws_endpoint"`
+	RoutingAccessKey      string `json:"datacenter_routing_secret"`
+	RoutingAccessToken    string `json:"datacenter_routing_token"`
+	RoutingRoleARN        string `json:"datacenter_routing_role_arn"`
+
+	VPCID            string            `json:"vpc_id"`
+	VPCIDs           []string          `json:"vpc_ids"`
+	VPCTag           string            `json:"vpc_tag"`
+	NetworkAWSID     string            `json:"network_aws_id"`
+	Name             string            `json:"name"`
+	Template         string            `json:"template"`
+	Purpose          string            `json:"purpose"`
+	EKSCluster       string            `json:"eks_cluster"`
+	Service          string            `json:"service"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	PrefixListID     string            `json:"prefix_list_id"`
+	Subnet           string            `json:"range"`
+	AvailabilityZone string            `json:"availability_zone"`
+	IsPublic         bool              `json:"is_public"`
+	NATGatewayID     string            `json:"egress_nat_gateway_id"`
+	Routes           []route           `json:"routes"`
+	Regions          []replica         `json:"regions"`
+
+	IPv6Range          string `json:"ipv6_range"`
+	AssignIPv6OnLaunch bool   `json:"assign_ipv6_on_launch"`
+
+	ResourceNameDNSA    *bool `json:"enable_resource_name_dns_a_record,omitempty"`
+	ResourceNameDNSAAAA *bool `json:"enable_resource_name_dns_aaaa_record,omitempty"`
+
+	received     time.Time
+	validation   time.Duration
+	provisioning time.Duration
+	sealed       map[string]interface{}
+	abandoned    *abandonment
+	// preexisting holds the route tables and internet gateways of the VPC
+	// before a create
+	preexisting map[string]bool
+}
+
+func parseRequest(data []byte) request {
+	var r request
+	json.Unmarshal(data, &r)
+	r.received = time.Now()
+	return r
+}
+
+// deadline returns the time by which the event must be processed, taken
+// from _deadline (RFC3339) or _ttl (a duration counted from now)
+func (r request) deadline(now time.Time) (time.Time, bool) {
+	if r.Deadline != "" {
+		if t, err := time.Parse(time.RFC3339, r.Deadline); err == nil {
+			return t, true
+		}
+	}
+
+	if r.TTL != "" {
+		if d, err := time.ParseDuration(r.TTL); err == nil {
+			return now.Add(d), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// interfaceTimeout returns how long a deletion waits for the interfaces of
+// the network to be released
+func (r request) interfaceTimeout(c config) time.Duration {
+	if d, err := time.ParseDuration(r.InterfaceTimeout); err == nil && d > 0 {
+		return d
+	}
+	return c.InterfaceTimeout
+}
+
+// waitForTimeout returns how long a create waits for the dependent
+// resources of wait_for to be ready
+func (r request) waitForTimeout(c config) time.Duration {
+	if d, err := time.ParseDuration(r.WaitForTimeout); err == nil && d > 0 {
+		return d
+	}
+	return c.WaitForTimeout
+}
+
+// endpoint returns the AWS endpoint the event is handled against, empty
+// for the one AWS derives from the region
+func (r request) endpoint(c config) string {
+	if r.Endpoint != "" {
+		return r.Endpoint
+	}
+	return c.AWSEndpoint
+}
+
+// tenant returns the tenant the event is accounted to
+func (r request) tenant() string {
+	if r.Tenant != "" {
+		return r.Tenant
+	}
+	return "default"
+}
+
+// stale reports whether the event was published more than maxAge ago,
+// events without a valid _timestamp are never stale
+func (r request) stale(now time.Time, maxAge time.Duration) bool {
+	if maxAge <= 0 {
+		return false
+	}
+
+	t, ok := r.published()
+	if !ok {
+		return false
+	}
+
+	return now.Sub(t) > maxAge
+}
+
+// published returns when the event was published, taken from _timestamp
+func (r request) published() (time.Time, bool) {
+	if r.Timestamp == "" {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, r.Timestamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// queued returns how long the event waited between being published and
+// being picked up by the connector
+func (r request) queued() time.Duration {
+	t, ok := r.published()
+	if !ok || r.received.Before(t) {
+		return 0
+	}
+	return r.received.Sub(t)
+}
+
+// credentialFields are stripped from events before they leave the
+// connector for anything other than a response
+var credentialFields = []string{
+	"datacenter_secret",
+	"datacenter_token",
+	"datacenter_read_secret",
+	"datacenter_read_token",
+	"datacenter_routing_secret",
+	"datacenter_routing_token",
+}
+
+// sanitize returns the event body without credentials
+func sanitize(data []byte) map[string]interface{} {
+	body := make(map[string]interface{})
+	json.Unmarshal(data, &body)
+
+	for _, f := range credentialFields {
+		delete(body, f)
+	}
+
+	return body
+}
+
+// setField returns the event body with the given field set
+func setField(data []byte, key string, value interface{}) []byte {
+	return setFields(data, map[string]interface{}{key: value})
+}
+
+// setFields returns the event body with the given fields set
+func setFields(data []byte, fields map[string]interface{}) []byte {
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(data, &body); err != nil {
+		return data
+	}
+
+	for k, v := range fields {
+		body[k] = v
+	}
+
+	updated, err := json.Marshal(body)
+	if err != nil {
+		return data
+	}
+	return updated
+}
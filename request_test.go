@@ -0,0 +1,125 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	Convey("Given a request", t, func() {
+		Convey("With no deadline or ttl", func() {
+			r := parseRequest([]byte(`{"_uuid":"test"}`))
+			_, ok := r.deadline(now)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("With a deadline", func() {
+			r := parseRequest([]byte(`{"_deadline":"2016-10-01T12:05:00Z"}`))
+			d, ok := r.deadline(now)
+			So(ok, ShouldBeTrue)
+			So(d.Sub(now), ShouldEqual, 5*time.Minute)
+		})
+
+		Convey("With a ttl", func() {
+			r := parseRequest([]byte(`{"_ttl":"90s"}`))
+			d, ok := r.deadline(now)
+			So(ok, ShouldBeTrue)
+			So(d.Sub(now), ShouldEqual, 90*time.Second)
+		})
+
+		Convey("With an invalid ttl", func() {
+			r := parseRequest([]byte(`{"_ttl":"soon"}`))
+			_, ok := r.deadline(now)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestRequestStale(t *testing.T) {
+	now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	Convey("Given a connector with a max event age", t, func() {
+		maxAge := time.Hour
+
+		Convey("With a recent event", func() {
+			r := parseRequest([]byte(`{"_timestamp":"2016-10-01T11:30:00Z"}`))
+			So(r.stale(now, maxAge), ShouldBeFalse)
+		})
+
+		Convey("With an old event", func() {
+			r := parseRequest([]byte(`{"_timestamp":"2016-10-01T09:00:00Z"}`))
+			So(r.stale(now, maxAge), ShouldBeTrue)
+		})
+
+		Convey("With an event without timestamp", func() {
+			r := parseRequest([]byte(`{"_uuid":"test"}`))
+			So(r.stale(now, maxAge), ShouldBeFalse)
+		})
+
+		Convey("With the max event age disabled", func() {
+			r := parseRequest([]byte(`{"_timestamp":"2016-10-01T09:00:00Z"}`))
+			So(r.stale(now, 0), ShouldBeFalse)
+		})
+	})
+}
+
+func TestRequestInterfaceTimeout(t *testing.T) {
+	Convey("Given a connector waiting 10 minutes for interfaces", t, func() {
+		c := config{InterfaceTimeout: 10 * time.Minute}
+
+		Convey("With no timeout on the event", func() {
+			Convey("It should wait for the default", func() {
+				So(request{}.interfaceTimeout(c), ShouldEqual, 10*time.Minute)
+			})
+		})
+
+		Convey("With a timeout on the event", func() {
+			Convey("It should wait for it instead", func() {
+				So(request{InterfaceTimeout: "2m"}.interfaceTimeout(c), ShouldEqual, 2*time.Minute)
+			})
+		})
+	})
+}
+
+func TestSanitize(t *testing.T) {
+	Convey("Given an event carrying every kind of credentials", t, func() {
+		data := []byte(`{"_uuid":"test","datacenter_secret":"key","datacenter_token":"token","datacenter_read_secret":"key","datacenter_read_token":"token","datacenter_routing_secret":"key","datacenter_routing_token":"token","datacenter_routing_role_arn":"arn:aws:iam::123456789012:role/routing"}`)
+
+		Convey("When it is sanitized", func() {
+			body := sanitize(data)
+
+			Convey("It should strip the credentials but keep the role", func() {
+				for _, f := range credentialFields {
+					So(body, ShouldNotContainKey, f)
+				}
+				So(body["datacenter_routing_role_arn"], ShouldEqual, "arn:aws:iam::123456789012:role/routing")
+			})
+		})
+	})
+}
+
+func TestRequestEndpoint(t *testing.T) {
+	Convey("Given a connector defaulting to a LocalStack endpoint", t, func() {
+		c := config{AWSEndpoint: "http://localstack:4566"}
+
+		Convey("With no endpoint on the event", func() {
+			Convey("It should use the default", func() {
+				So(request{}.endpoint(c), ShouldEqual, "http://localstack:4566")
+			})
+		})
+
+		Convey("With an endpoint on the event", func() {
+			Convey("It should use it instead", func() {
+				So(request{Endpoint: "https://ec2.us-gov-west-1.amazonaws.com"}.endpoint(c), ShouldEqual, "https://ec2.us-gov-west-1.amazonaws.com")
+			})
+		})
+	})
+}
@@ -0,0 +1,205 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+)
+
+// transientCodes are the AWS error codes worth retrying: throttling,
+// service hiccups and resources not visible yet right after being created
+var transientCodes = []string{
+	"RequestLimitExceeded",
+	"Throttling",
+	"ThrottlingException",
+	"InternalError",
+	"ServiceUnavailable",
+	"Unavailable",
+	"InvalidSubnetID.NotFound",
+	"InvalidRouteTableID.NotFound",
+	"InvalidInternetGatewayID.NotFound",
+	// calls cut short by CALL_TIMEOUT or OPERATION_TIMEOUTS
+	"RequestCanceled",
+}
+
+// transient reports whether an error response was caused by a transient
+// AWS error. ernestaws only reports error messages, which carry the AWS
+// error code.
+func transient(data []byte) bool {
+	for _, code := range transientCodes {
+		if strings.Contains(failureMessage(data), code) {
+			return true
+		}
+	}
+	return false
+}
+
+// alreadyDeleted reports whether a delete failed because the subnet no
+// longer exists, removed by hand or by an earlier partial run
+func alreadyDeleted(subject string, data []byte) bool {
+	if verb(subject) != "delete" || finalStatus(subject) != statusErrored {
+		return false
+	}
+	return strings.Contains(failureMessage(data), "InvalidSubnetID.NotFound")
+}
+
+func failureMessage(data []byte) string {
+	var failure struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(data, &failure)
+	return failure.Error
+}
+
+// retryable reports whether a failed event can safely be handled again.
+// Creates which got as far as creating the subnet are not retried, as
+// that would create a second one.
+func retryable(subject string, r request, data []byte) bool {
+	if finalStatus(subject) != statusErrored || !transient(data) || alreadyDeleted(subject, data) {
+		return false
+	}
+
+	if verb(subject) == "create" {
+		id := parseRequest(data).NetworkAWSID
+		return id == "" || id == r.NetworkAWSID
+	}
+
+	return true
+}
+
+// retryReport condenses the attempts made for an event that failed
+// after being retried
+type retryReport struct {
+	Attempts   int      `json:"attempts"`
+	ErrorCodes []string `json:"error_codes"`
+	BackoffMS  int64    `json:"backoff_ms"`
+	SDKRetries int      `json:"sdk_retries"`
+}
+
+// maxBackoffShift caps the exponential backoff, which would otherwise
+// overflow with many attempts
+const maxBackoffShift = 10
+
+// withRetries handles the event until it succeeds, fails permanently or
+// runs out of attempts, backing off exponentially with jitter in between.
+// It gives up early when the next back off would pass the deadline of the
+// event, if it has one. Failures after retries carry a retries report.
+func withRetries(r request, attempts int, backoff time.Duration, deadline time.Time, fn func() (string, []byte)) (string, []byte) {
+	sdkRetries.watch(r.UUID)
+	defer sdkRetries.take(r.UUID)
+
+	subject, data := fn()
+	awsErrors.add(failureCode(data))
+	report := retryReport{Attempts: 1, ErrorCodes: []string{failureCode(data)}}
+
+	for i := 1; i < attempts && retryable(subject, r, data); i++ {
+		wait := backoffWait(backoff, i)
+		if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+			break
+		}
+		time.Sleep(wait)
+
+		subject, data = fn()
+		awsErrors.add(failureCode(data))
+		report.Attempts++
+		report.ErrorCodes = append(report.ErrorCodes, failureCode(data))
+		report.BackoffMS += int64(wait / time.Millisecond)
+	}
+
+	if report.Attempts > 1 && finalStatus(subject) == statusErrored {
+		report.SDKRetries = sdkRetries.take(r.UUID)
+		data = setField(data, "retries", report)
+	}
+
+	return subject, data
+}
+
+// backoffWait returns how long to wait before the given retry: the
+// backoff doubled on each retry, up to maxBackoffShift times, with jitter
+// over its second half
+func backoffWait(backoff time.Duration, retry int) time.Duration {
+	shift := retry - 1
+	if shift > maxBackoffShift {
+		shift = maxBackoffShift
+	}
+
+	wait := backoff << uint(shift)
+	if wait < backoff {
+		wait = backoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// failureCode returns the AWS error code leading the error message of a
+// response, ernestaws reporting errors as "Code: message"
+func failureCode(data []byte) string {
+	msg := failureMessage(data)
+	if i := strings.Index(msg, ":"); i > 0 && !strings.Contains(msg[:i], " ") {
+		return msg[:i]
+	}
+	return ""
+}
+
+// retryCounter counts the retries the AWS SDK makes on its own for the
+// events being handled, which are capped by SDK_MAX_RETRIES so the
+// connector retries above own the retry policy
+type retryCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newRetryCounter() *retryCounter {
+	return &retryCounter{counts: make(map[string]int)}
+}
+
+// watch starts counting the SDK retries of the event
+func (c *retryCounter) watch(uuid string) {
+	if uuid == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[uuid] = 0
+}
+
+// add counts SDK retries for the event, when watched
+func (c *retryCounter) add(uuid string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.counts[uuid]; ok {
+		c.counts[uuid] += n
+	}
+}
+
+// take returns the SDK retries of the event and stops counting them
+func (c *retryCounter) take(uuid string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := c.counts[uuid]
+	delete(c.counts, uuid)
+	return n
+}
+
+// sdkRetryHandler counts the SDK retries each AWS call of the event took
+func sdkRetryHandler(r request) func(*awsrequest.Request) {
+	return func(req *awsrequest.Request) {
+		if req.RetryCount > 0 {
+			sdkRetries.add(r.UUID, req.RetryCount)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetries(t *testing.T) {
+	Convey("Given an event handled with retries", t, func() {
+		r := request{}
+		throttled := errorResponse([]byte(`{}`), errors.New("RequestLimitExceeded: Request limit exceeded."))
+		invalid := errorResponse([]byte(`{}`), errors.New("InvalidParameterValue: bad range"))
+
+		var calls int
+		handler := func(outcomes ...[]byte) func() (string, []byte) {
+			return func() (string, []byte) {
+				data := outcomes[calls]
+				calls++
+				if data == nil {
+					return "network.update.aws.done", []byte(`{}`)
+				}
+				return "network.update.aws.error", data
+			}
+		}
+
+		Convey("When it is throttled once", func() {
+			subject, _ := withRetries(r, 3, time.Millisecond, time.Time{}, handler(throttled, nil))
+
+			Convey("It should succeed on the next attempt", func() {
+				So(subject, ShouldEqual, "network.update.aws.done")
+				So(calls, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When it keeps being throttled", func() {
+			subject, data := withRetries(r, 3, time.Millisecond, time.Time{}, handler(throttled, throttled, throttled))
+
+			Convey("It should give up after the last attempt", func() {
+				So(subject, ShouldEqual, "network.update.aws.error")
+				So(calls, ShouldEqual, 3)
+			})
+
+			Convey("It should report the attempts made", func() {
+				var resp struct {
+					Retries retryReport `json:"retries"`
+				}
+				json.Unmarshal(data, &resp)
+				So(resp.Retries.Attempts, ShouldEqual, 3)
+				So(resp.Retries.ErrorCodes, ShouldResemble, []string{"RequestLimitExceeded", "RequestLimitExceeded", "RequestLimitExceeded"})
+			})
+		})
+
+		Convey("When the AWS SDK retried its calls on its own", func() {
+			r.UUID = "uuid"
+			sdk := func() (string, []byte) {
+				sdkRetryHandler(r)(&awsrequest.Request{RetryCount: 1})
+				return handler(throttled, throttled)()
+			}
+			_, data := withRetries(r, 2, time.Millisecond, time.Time{}, sdk)
+
+			Convey("It should report them apart from its own attempts", func() {
+				var resp struct {
+					Retries retryReport `json:"retries"`
+				}
+				json.Unmarshal(data, &resp)
+				So(resp.Retries.Attempts, ShouldEqual, 2)
+				So(resp.Retries.SDKRetries, ShouldEqual, 2)
+			})
+
+			Convey("It should stop counting once handled", func() {
+				sdkRetryHandler(r)(&awsrequest.Request{RetryCount: 1})
+				So(sdkRetries.take("uuid"), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When backing off would pass its deadline", func() {
+			subject, _ := withRetries(r, 3, time.Hour, time.Now().Add(time.Second), handler(throttled, nil))
+
+			Convey("It should give up rather than retry past it", func() {
+				So(subject, ShouldEqual, "network.update.aws.error")
+				So(calls, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When it fails permanently", func() {
+			subject, data := withRetries(r, 3, time.Millisecond, time.Time{}, handler(invalid))
+
+			Convey("It should not be retried", func() {
+				So(subject, ShouldEqual, "network.update.aws.error")
+				So(calls, ShouldEqual, 1)
+			})
+
+			Convey("It should carry no retries report", func() {
+				So(sanitize(data), ShouldNotContainKey, "retries")
+			})
+		})
+	})
+
+	Convey("Given a create throttled after creating its subnet", t, func() {
+		data := setField(errorResponse([]byte(`{}`), errors.New("RequestLimitExceeded")), "network_aws_id", "subnet-00000000")
+
+		Convey("It should not be retried", func() {
+			So(retryable("network.create.aws.error", request{}, data), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a delete failing as its subnet is already gone", t, func() {
+		data := errorResponse([]byte(`{}`), errors.New("InvalidSubnetID.NotFound: The subnet ID 'subnet-00000000' does not exist"))
+
+		Convey("It should be treated as already deleted", func() {
+			So(alreadyDeleted("network.delete.aws.error", data), ShouldBeTrue)
+			So(retryable("network.delete.aws.error", request{}, data), ShouldBeFalse)
+		})
+
+		Convey("It should still be retried on update", func() {
+			So(alreadyDeleted("network.update.aws.error", data), ShouldBeFalse)
+			So(retryable("network.update.aws.error", request{}, data), ShouldBeTrue)
+		})
+	})
+}
+
+func TestBackoffWait(t *testing.T) {
+	Convey("Given many retry attempts", t, func() {
+		Convey("It should cap the backoff instead of overflowing", func() {
+			for retry := 1; retry < 100; retry++ {
+				wait := backoffWait(time.Second, retry)
+				So(wait >= 0 && wait <= time.Second<<maxBackoffShift, ShouldBeTrue)
+			}
+		})
+	})
+
+	Convey("Given no backoff", t, func() {
+		Convey("It should not wait", func() {
+			So(backoffWait(0, 3), ShouldEqual, time.Duration(0))
+		})
+	})
+}
@@ -0,0 +1,43 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// rollback deletes the network a failed create left behind, after the
+// route tables, routes, prefix list entries and alarms the connector
+// created for it, latest first, so retrying the create doesn't conflict
+// with them. The error response reports the network it removed in
+// rolled_back and everything removed in rolled_back_resources, or why it
+// couldn't in rollback_error.
+func rollback(client ec2API, r request, undo *undoLog, data []byte) []byte {
+	id := parseRequest(data).NetworkAWSID
+	if id == "" || id == r.NetworkAWSID {
+		return data
+	}
+
+	removed, failed := undo.run()
+	fields := make(map[string]interface{})
+
+	_, err := client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: aws.String(id)})
+	if err != nil && !isNotFound(err) {
+		if failed == nil {
+			failed = err
+		}
+	} else {
+		removed = append(removed, plannedResource{Type: "subnet", ID: id, Action: actionDelete})
+		fields["network_aws_id"] = ""
+		fields["rolled_back"] = id
+	}
+
+	fields["rolled_back_resources"] = removed
+	if failed != nil {
+		fields["rollback_error"] = failed.Error()
+	}
+	return setFields(data, fields)
+}
@@ -0,0 +1,97 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func (m *teardownEC2) DisassociateRouteTable(in *ec2.DisassociateRouteTableInput) (*ec2.DisassociateRouteTableOutput, error) {
+	return &ec2.DisassociateRouteTableOutput{}, m.record("DisassociateRouteTable", aws.StringValue(in.AssociationId))
+}
+
+func TestRollback(t *testing.T) {
+	Convey("Given a create which routed its network through a NAT gateway before failing", t, func() {
+		client := &teardownEC2{mockEC2: mockEC2{
+			subnets: []*ec2.Subnet{{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-00000000")}},
+		}}
+		r := request{NATGatewayID: "nat-00000000"}
+		undo := &undoLog{}
+
+		_, err := routeThroughNAT(undo.wrap(client), r, "subnet-00000000")
+		So(err, ShouldBeNil)
+		client.calls = nil
+		data := errorResponse([]byte(`{"network_aws_id":"subnet-00000000"}`), errors.New("tagging failed"))
+
+		Convey("When it is rolled back", func() {
+			var resp struct {
+				NetworkAWSID string            `json:"network_aws_id"`
+				RolledBack   string            `json:"rolled_back"`
+				Resources    []plannedResource `json:"rolled_back_resources"`
+				Error        string            `json:"rollback_error"`
+			}
+			json.Unmarshal(rollback(client, r, undo, data), &resp)
+
+			Convey("It should undo what it created in reverse order, then delete the network", func() {
+				So(client.calls, ShouldResemble, []string{
+					"DeleteRoute 0.0.0.0/0",
+					"DisassociateRouteTable rtbassoc-11111111",
+					"DeleteRouteTable rtb-11111111",
+					"DeleteSubnet subnet-00000000",
+				})
+			})
+
+			Convey("It should report everything it removed", func() {
+				So(resp.NetworkAWSID, ShouldEqual, "")
+				So(resp.RolledBack, ShouldEqual, "subnet-00000000")
+				So(resp.Resources, ShouldResemble, []plannedResource{
+					{Type: "route", ID: "rtb-11111111:0.0.0.0/0", Action: actionDelete},
+					{Type: "route_table_association", ID: "rtbassoc-11111111", Action: actionDelete},
+					{Type: "route_table", ID: "rtb-11111111", Action: actionDelete},
+					{Type: "subnet", ID: "subnet-00000000", Action: actionDelete},
+				})
+				So(resp.Error, ShouldEqual, "")
+			})
+		})
+
+		Convey("When a resource can't be removed", func() {
+			client.failing = "rtb-11111111"
+			var resp struct {
+				RolledBack string `json:"rolled_back"`
+				Error      string `json:"rollback_error"`
+			}
+			json.Unmarshal(rollback(client, r, undo, data), &resp)
+
+			Convey("It should still remove the rest and report why", func() {
+				So(client.calls[len(client.calls)-1], ShouldEqual, "DeleteSubnet subnet-00000000")
+				So(resp.RolledBack, ShouldEqual, "subnet-00000000")
+				So(resp.Error, ShouldEqual, "DependencyViolation")
+			})
+		})
+	})
+
+	Convey("Given a failed update", t, func() {
+		data := errorResponse([]byte(`{"network_aws_id":"subnet-00000000"}`), errors.New("tagging failed"))
+
+		Convey("It should not be rolled back", func() {
+			So(rollback(&teardownEC2{}, request{NetworkAWSID: "subnet-00000000"}, nil, data), ShouldResemble, data)
+		})
+	})
+
+	Convey("Given post create steps failing", t, func() {
+		Convey("It should only let waits running out of time pass", func() {
+			So(timedOut(newFieldError(errTimeout, "wait_for", "Still waiting for nat_gateway_available after 15m0s")), ShouldBeTrue)
+			So(timedOut(newFieldError(errInternal, "wait_for", "NAT gateway nat-00000000 is failed")), ShouldBeFalse)
+			So(timedOut(errors.New("RequestLimitExceeded")), ShouldBeFalse)
+			So(timedOut(nil), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,302 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// route is a custom route of the network, sending traffic for an IPv4 or
+// IPv6 CIDR block or a managed prefix list to a gateway, peering
+// connection, instance, NAT gateway, transit gateway or egress only
+// internet gateway
+type route struct {
+	Destination string `json:"destination"`
+	Target      string `json:"target"`
+}
+
+// routeTargets are the id prefixes of the targets a custom route accepts
+var routeTargets = []string{"igw-", "pcx-", "i-", "nat-", "tgw-", "eigw-"}
+
+// validRoutes rejects custom routes whose destination or target can't be
+// programmed
+func validRoutes(routes []route) error {
+	seen := make(map[string]bool)
+	for _, rt := range canonicalRoutes(routes) {
+		if !strings.HasPrefix(rt.Destination, "pl-") {
+			if _, _, err := net.ParseCIDR(rt.Destination); err != nil {
+				return newError(errPayload, "Route destination "+rt.Destination+" is neither a CIDR block nor a prefix list")
+			}
+		}
+		if seen[rt.Destination] {
+			return newError(errPayload, "Route destination "+rt.Destination+" is declared more than once")
+		}
+		seen[rt.Destination] = true
+
+		switch targetKind(rt.Target) {
+		case "":
+			return newError(errPayload, "Route target "+rt.Target+" is not a gateway, peering connection, instance, NAT gateway or transit gateway")
+		case "eigw-":
+			if !ipv6Destination(rt.Destination) {
+				return newError(errPayload, "Route target "+rt.Target+" is an egress only internet gateway, which only takes IPv6 destinations")
+			}
+		}
+	}
+	return nil
+}
+
+// canonicalRoutes returns the routes with their IPv6 destinations written
+// the way AWS reports them, so 2001:DB8:0::/48 matches 2001:db8::/48
+func canonicalRoutes(routes []route) []route {
+	canonical := make([]route, 0, len(routes))
+	for _, rt := range routes {
+		if ipv6Destination(rt.Destination) {
+			if _, n, err := net.ParseCIDR(rt.Destination); err == nil {
+				rt.Destination = n.String()
+			}
+		}
+		canonical = append(canonical, rt)
+	}
+	return canonical
+}
+
+func ipv6Destination(destination string) bool {
+	return strings.Contains(destination, ":")
+}
+
+func targetKind(target string) string {
+	for _, prefix := range routeTargets {
+		if strings.HasPrefix(target, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// routeAttempts is how many times custom routes are programmed against a
+// route table other events keep changing
+const routeAttempts = 3
+
+// routeConflicts are the route errors AWS raises when the route table
+// changed since it was described
+var routeConflicts = []string{"RouteAlreadyExists", "InvalidRoute.NotFound"}
+
+// programRoutes makes the route table of the network hold the custom
+// routes of the event. Route tables may be shared and changed by other
+// events at the same time, so the table is described again once
+// programmed and the routes programmed again from its fresh state whenever
+// a change was lost. It returns the id of the route table.
+func programRoutes(client ec2API, r request, id string) (string, error) {
+	r.Routes = canonicalRoutes(r.Routes)
+
+	var err error
+	for attempt := 0; attempt < routeAttempts; attempt++ {
+		var table string
+		if table, err = applyRoutes(client, r, id); err == nil {
+			if err = verifyRoutes(client, table, r.Routes); err == nil {
+				return table, nil
+			}
+		}
+		if !routeConflict(err) {
+			return "", err
+		}
+	}
+
+	return "", newError(errConflict, "Routes of network "+id+" kept being changed by other events: "+err.Error())
+}
+
+func routeConflict(err error) bool {
+	if ce, ok := err.(*connectorError); ok {
+		return ce.code == errConflict
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		return contains(routeConflicts, aerr.Code())
+	}
+	return false
+}
+
+// verifyRoutes checks the route table holds the custom routes as
+// programmed
+func verifyRoutes(client ec2API, tableID string, routes []route) error {
+	resp, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		RouteTableIds: []*string{aws.String(tableID)},
+	})
+	if err != nil {
+		return err
+	}
+
+	var table *ec2.RouteTable
+	for _, t := range resp.RouteTables {
+		if aws.StringValue(t.RouteTableId) == tableID {
+			table = t
+		}
+	}
+	if table == nil {
+		return newError(errConflict, "Route table "+tableID+" disappeared")
+	}
+
+	current := make(map[string]string)
+	for _, existing := range table.Routes {
+		current[routeDestination(existing)] = routeTarget(existing)
+	}
+	for _, rt := range routes {
+		if target, ok := current[rt.Destination]; !ok || target != rt.Target {
+			return newError(errConflict, "Route "+rt.Destination+" of "+tableID+" does not go to "+rt.Target)
+		}
+	}
+
+	return nil
+}
+
+// applyRoutes creates and replaces the custom routes of the event in the
+// route table of the network. Routes no longer declared are removed, but
+// only from a route table the network doesn't share.
+func applyRoutes(client ec2API, r request, id string) (string, error) {
+	table, err := routesTable(client, r, id)
+	if err != nil {
+		return "", err
+	}
+
+	current := make(map[string]*ec2.Route)
+	for _, existing := range table.Routes {
+		current[routeDestination(existing)] = existing
+	}
+
+	for _, rt := range r.Routes {
+		existing, ok := current[rt.Destination]
+		switch {
+		case !ok:
+			input := &ec2.CreateRouteInput{RouteTableId: table.RouteTableId}
+			setDestination(rt, &input.DestinationCidrBlock, &input.DestinationIpv6CidrBlock, &input.DestinationPrefixListId)
+			setTarget(rt, &input.GatewayId, &input.VpcPeeringConnectionId, &input.InstanceId, &input.NatGatewayId, &input.TransitGatewayId, &input.EgressOnlyInternetGatewayId)
+			_, err = client.CreateRoute(input)
+		case routeTarget(existing) != rt.Target:
+			input := &ec2.ReplaceRouteInput{RouteTableId: table.RouteTableId}
+			setDestination(rt, &input.DestinationCidrBlock, &input.DestinationIpv6CidrBlock, &input.DestinationPrefixListId)
+			setTarget(rt, &input.GatewayId, &input.VpcPeeringConnectionId, &input.InstanceId, &input.NatGatewayId, &input.TransitGatewayId, &input.EgressOnlyInternetGatewayId)
+			_, err = client.ReplaceRoute(input)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !associatedWith(table, id) || isMain(table) {
+		return aws.StringValue(table.RouteTableId), nil
+	}
+
+	for _, existing := range staleRoutes(table, r.Routes) {
+		input := &ec2.DeleteRouteInput{RouteTableId: table.RouteTableId}
+		rt := route{Destination: routeDestination(existing)}
+		setDestination(rt, &input.DestinationCidrBlock, &input.DestinationIpv6CidrBlock, &input.DestinationPrefixListId)
+		if _, err := client.DeleteRoute(input); err != nil {
+			return "", err
+		}
+	}
+
+	return aws.StringValue(table.RouteTableId), nil
+}
+
+// routesTable returns the route table custom routes go to. Private
+// networks get one of their own rather than changing the main route table
+// of the VPC; public ones keep the table holding their internet route.
+func routesTable(client ec2API, r request, id string) (*ec2.RouteTable, error) {
+	if !r.IsPublic {
+		return ownRouteTable(client, id)
+	}
+
+	subnet, err := describeSubnet(client, id)
+	if err != nil {
+		return nil, err
+	}
+	if subnet == nil {
+		return nil, newError(errNotFound, "Network "+id+" does not exist")
+	}
+
+	tables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{subnet.VpcId}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	table := subnetRouteTable(subnet, tables.RouteTables)
+	if table == nil {
+		return nil, newError(errNotFound, "Network "+id+" has no route table")
+	}
+	return table, nil
+}
+
+// staleRoutes returns the custom routes of the table that are no longer
+// declared. Local routes, default routes, which the connector manages
+// itself, VPC endpoint routes and routes propagated by a virtual private
+// gateway are left alone.
+func staleRoutes(table *ec2.RouteTable, declared []route) []*ec2.Route {
+	keep := make(map[string]bool)
+	for _, rt := range declared {
+		keep[rt.Destination] = true
+	}
+
+	var stale []*ec2.Route
+	for _, existing := range table.Routes {
+		destination := routeDestination(existing)
+		target := routeTarget(existing)
+
+		switch {
+		case keep[destination]:
+		case target == "local", strings.HasPrefix(target, "vpce-"):
+		case destination == "0.0.0.0/0", destination == "::/0":
+		case aws.StringValue(existing.Origin) == "CreateRouteTable", aws.StringValue(existing.Origin) == "EnableVgwRoutePropagation":
+		default:
+			stale = append(stale, existing)
+		}
+	}
+	return stale
+}
+
+// routeTarget returns the id of whatever the route sends traffic to
+func routeTarget(rt *ec2.Route) string {
+	for _, id := range []*string{rt.GatewayId, rt.VpcPeeringConnectionId, rt.InstanceId, rt.NatGatewayId, rt.NetworkInterfaceId, rt.TransitGatewayId, rt.EgressOnlyInternetGatewayId} {
+		if v := aws.StringValue(id); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func setDestination(rt route, cidr, ipv6, prefixList **string) {
+	switch {
+	case strings.HasPrefix(rt.Destination, "pl-"):
+		*prefixList = aws.String(rt.Destination)
+	case ipv6Destination(rt.Destination):
+		*ipv6 = aws.String(rt.Destination)
+	default:
+		*cidr = aws.String(rt.Destination)
+	}
+}
+
+func setTarget(rt route, gateway, peering, instance, nat, transit, egressOnly **string) {
+	switch targetKind(rt.Target) {
+	case "igw-":
+		*gateway = aws.String(rt.Target)
+	case "pcx-":
+		*peering = aws.String(rt.Target)
+	case "i-":
+		*instance = aws.String(rt.Target)
+	case "nat-":
+		*nat = aws.String(rt.Target)
+	case "tgw-":
+		*transit = aws.String(rt.Target)
+	case "eigw-":
+		*egressOnly = aws.String(rt.Target)
+	}
+}
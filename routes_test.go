@@ -0,0 +1,233 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidRoutes(t *testing.T) {
+	Convey("Given custom routes", t, func() {
+		Convey("When they point CIDR blocks and prefix lists to known targets", func() {
+			routes := []route{
+				{Destination: "10.20.0.0/16", Target: "pcx-00000000"},
+				{Destination: "2001:db8::/56", Target: "igw-00000000"},
+				{Destination: "pl-00000000", Target: "nat-00000000"},
+			}
+
+			Convey("It should accept them", func() {
+				So(validRoutes(routes), ShouldBeNil)
+			})
+		})
+
+		Convey("When a destination is not a CIDR block", func() {
+			routes := []route{{Destination: "10.20.0.0", Target: "pcx-00000000"}}
+
+			Convey("It should reject the payload", func() {
+				err := validRoutes(routes)
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errPayload)
+			})
+		})
+
+		Convey("When a destination is declared twice", func() {
+			routes := []route{
+				{Destination: "10.20.0.0/16", Target: "pcx-00000000"},
+				{Destination: "10.20.0.0/16", Target: "i-00000000"},
+			}
+
+			Convey("It should reject the payload", func() {
+				So(validRoutes(routes), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When IPv6 destinations go to transit and egress only internet gateways", func() {
+			routes := []route{
+				{Destination: "::/0", Target: "eigw-00000000"},
+				{Destination: "2001:db8:1::/48", Target: "tgw-00000000"},
+				{Destination: "2001:db8:2::/48", Target: "pcx-00000000"},
+			}
+
+			Convey("It should accept them", func() {
+				So(validRoutes(routes), ShouldBeNil)
+			})
+		})
+
+		Convey("When an IPv4 destination goes to an egress only internet gateway", func() {
+			routes := []route{{Destination: "0.0.0.0/0", Target: "eigw-00000000"}}
+
+			Convey("It should reject the payload", func() {
+				So(validRoutes(routes), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When an IPv6 destination is declared twice in different forms", func() {
+			routes := []route{
+				{Destination: "2001:DB8:0::/48", Target: "tgw-00000000"},
+				{Destination: "2001:db8::/48", Target: "pcx-00000000"},
+			}
+
+			Convey("It should reject the payload", func() {
+				So(validRoutes(routes), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a target is not supported", func() {
+			routes := []route{{Destination: "10.20.0.0/16", Target: "vgw-00000000"}}
+
+			Convey("It should reject the payload", func() {
+				So(validRoutes(routes), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestStaleRoutes(t *testing.T) {
+	Convey("Given the route table of a network", t, func() {
+		table := routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")
+		table.Routes = append(table.Routes,
+			&ec2.Route{DestinationCidrBlock: aws.String("10.20.0.0/16"), VpcPeeringConnectionId: aws.String("pcx-00000000")},
+			&ec2.Route{DestinationCidrBlock: aws.String("10.30.0.0/16"), InstanceId: aws.String("i-00000000")},
+			&ec2.Route{DestinationPrefixListId: aws.String("pl-00000000"), GatewayId: aws.String("vpce-00000000")},
+			&ec2.Route{DestinationCidrBlock: aws.String("172.16.0.0/12"), GatewayId: aws.String("vgw-00000000"), Origin: aws.String("EnableVgwRoutePropagation")},
+		)
+
+		Convey("When only some custom routes are still declared", func() {
+			stale := staleRoutes(table, []route{{Destination: "10.20.0.0/16", Target: "pcx-11111111"}})
+
+			Convey("It should only return the undeclared custom routes, not the propagated ones", func() {
+				So(len(stale), ShouldEqual, 1)
+				So(routeDestination(stale[0]), ShouldEqual, "10.30.0.0/16")
+			})
+		})
+	})
+}
+
+func TestRouteTarget(t *testing.T) {
+	Convey("Given routes to different targets", t, func() {
+		Convey("It should return the id of each target", func() {
+			So(routeTarget(&ec2.Route{GatewayId: aws.String("igw-00000000")}), ShouldEqual, "igw-00000000")
+			So(routeTarget(&ec2.Route{VpcPeeringConnectionId: aws.String("pcx-00000000")}), ShouldEqual, "pcx-00000000")
+			So(routeTarget(&ec2.Route{NatGatewayId: aws.String("nat-00000000")}), ShouldEqual, "nat-00000000")
+			So(routeTarget(&ec2.Route{TransitGatewayId: aws.String("tgw-00000000")}), ShouldEqual, "tgw-00000000")
+			So(routeTarget(&ec2.Route{EgressOnlyInternetGatewayId: aws.String("eigw-00000000")}), ShouldEqual, "eigw-00000000")
+		})
+	})
+}
+
+func TestProgramRoutes(t *testing.T) {
+	Convey("Given a network with a route table of its own", t, func() {
+		table := routeTable("rtb-00000000", []string{"subnet-00000000"}, "")
+		table.VpcId = aws.String("vpc-0000000")
+		table.Routes = append(table.Routes,
+			&ec2.Route{DestinationCidrBlock: aws.String("10.20.0.0/16"), VpcPeeringConnectionId: aws.String("pcx-00000000")},
+			&ec2.Route{DestinationCidrBlock: aws.String("10.30.0.0/16"), VpcPeeringConnectionId: aws.String("pcx-11111111")},
+		)
+
+		client := &mockEC2{
+			subnets: []*ec2.Subnet{{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000")}},
+			tables:  []*ec2.RouteTable{table},
+		}
+
+		Convey("When its routes are updated", func() {
+			r := request{Routes: []route{
+				{Destination: "10.20.0.0/16", Target: "pcx-22222222"},
+				{Destination: "10.40.0.0/16", Target: "i-00000000"},
+			}}
+			id, err := programRoutes(client, r, "subnet-00000000")
+
+			Convey("It should replace, create and delete routes to match", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "rtb-00000000")
+				So(client.calls, ShouldResemble, []string{"ReplaceRoute 10.20.0.0/16", "CreateRoute 10.40.0.0/16", "DeleteRoute 10.30.0.0/16"})
+			})
+		})
+	})
+
+	Convey("Given a dual-stack network with a route table of its own", t, func() {
+		table := routeTable("rtb-00000000", []string{"subnet-00000000"}, "")
+		table.VpcId = aws.String("vpc-0000000")
+		client := &mockEC2{
+			subnets: []*ec2.Subnet{{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000")}},
+			tables:  []*ec2.RouteTable{table},
+		}
+
+		Convey("When IPv6 routes go to an egress only internet gateway and a transit gateway", func() {
+			r := request{Routes: []route{
+				{Destination: "::/0", Target: "eigw-00000000"},
+				{Destination: "2001:DB8:0::/48", Target: "tgw-00000000"},
+			}}
+			_, err := programRoutes(client, r, "subnet-00000000")
+
+			Convey("It should program them in the form AWS reports", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{"CreateRoute ::/0", "CreateRoute 2001:db8::/48"})
+				So(routeTarget(table.Routes[len(table.Routes)-1]), ShouldEqual, "tgw-00000000")
+			})
+		})
+	})
+}
+
+// racingEC2 has another event change the route table between the
+// connector programming it and describing it again
+type racingEC2 struct {
+	*mockEC2
+	races int
+}
+
+func (m *racingEC2) DescribeRouteTables(in *ec2.DescribeRouteTablesInput) (*ec2.DescribeRouteTablesOutput, error) {
+	if len(in.RouteTableIds) > 0 && m.races > 0 {
+		m.races--
+		m.ReplaceRoute(&ec2.ReplaceRouteInput{
+			RouteTableId:           in.RouteTableIds[0],
+			DestinationCidrBlock:   aws.String("10.40.0.0/16"),
+			VpcPeeringConnectionId: aws.String("pcx-99999999"),
+		})
+	}
+	return m.mockEC2.DescribeRouteTables(in)
+}
+
+func TestProgramRoutesConcurrently(t *testing.T) {
+	Convey("Given a route table another event changes at the same time", t, func() {
+		table := routeTable("rtb-00000000", []string{"subnet-00000000"}, "")
+		table.VpcId = aws.String("vpc-0000000")
+		mock := &mockEC2{
+			subnets: []*ec2.Subnet{{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000")}},
+			tables:  []*ec2.RouteTable{table},
+		}
+		r := request{Routes: []route{{Destination: "10.40.0.0/16", Target: "i-00000000"}}}
+
+		Convey("When the route is changed once after being programmed", func() {
+			client := &racingEC2{mockEC2: mock, races: 1}
+			id, err := programRoutes(client, r, "subnet-00000000")
+
+			Convey("It should program it again from the fresh table", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "rtb-00000000")
+				// the other event's replace comes in between
+				So(mock.calls, ShouldResemble, []string{
+					"CreateRoute 10.40.0.0/16",
+					"ReplaceRoute 10.40.0.0/16",
+					"ReplaceRoute 10.40.0.0/16",
+				})
+				So(routeTarget(table.Routes[len(table.Routes)-1]), ShouldEqual, "i-00000000")
+			})
+		})
+
+		Convey("When the route keeps being changed", func() {
+			client := &racingEC2{mockEC2: mock, races: routeAttempts}
+			_, err := programRoutes(client, r, "subnet-00000000")
+
+			Convey("It should give up with a conflict", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errConflict)
+			})
+		})
+	})
+}
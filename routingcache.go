@@ -0,0 +1,204 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// routingCache shares the route tables and internet gateways described in
+// a VPC for a short while, so the networks of a build created one after
+// the other in the same VPC don't describe its routing again each time.
+// Entries are keyed by the region, the VPC, the credentials they were
+// read with, the operation and its input.
+type routingCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+func newRoutingCache(ttl time.Duration) *routingCache {
+	return &routingCache{ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+// get returns the cached value for the key, or fetches it. Failed fetches
+// are not cached.
+func (c *routingCache) get(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = cacheEntry{value: value, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return value, nil
+}
+
+// forgetRegion drops everything read from a region once the connector
+// changed routing there, whichever credentials it did it with
+func (c *routingCache) forgetRegion(region string) {
+	c.forget(func(key []string) bool { return key[0] == region })
+}
+
+// forgetVPC drops everything read from a VPC, whichever account read it,
+// once ernestaws changed its routing with its own client
+func (c *routingCache) forgetVPC(vpc string) {
+	c.forget(func(key []string) bool { return key[1] == vpc })
+}
+
+func (c *routingCache) forget(match func(key []string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expires) || match(strings.SplitN(k, "|", 3)) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// cachingEC2 serves the route tables and internet gateways of a VPC from
+// the routing cache, and drops what was read from the region whenever it
+// changes them. Results are only shared between clients with the same
+// credentials.
+type cachingEC2 struct {
+	ec2API
+	cache  *routingCache
+	region string
+	scope  string
+}
+
+// withRoutingCache wraps the client with the routing cache, unless it is
+// disabled
+func withRoutingCache(client ec2API, region, scope string, c *routingCache) ec2API {
+	if c.ttl <= 0 {
+		return client
+	}
+	return &cachingEC2{ec2API: client, cache: c, region: region, scope: scope}
+}
+
+// filteredVPC returns the single VPC the filters restrict a describe to,
+// only those being cached
+func filteredVPC(filters []*ec2.Filter) string {
+	for _, f := range filters {
+		name := aws.StringValue(f.Name)
+		if (name == "vpc-id" || name == "attachment.vpc-id") && len(f.Values) == 1 {
+			return aws.StringValue(f.Values[0])
+		}
+	}
+	return ""
+}
+
+func (c *cachingEC2) key(vpc, operation string, in interface{}) string {
+	input, _ := json.Marshal(in)
+	return c.region + "|" + vpc + "|" + c.scope + "|" + operation + "|" + string(input)
+}
+
+func (c *cachingEC2) DescribeRouteTables(in *ec2.DescribeRouteTablesInput) (*ec2.DescribeRouteTablesOutput, error) {
+	vpc := filteredVPC(in.Filters)
+	if vpc == "" || len(in.RouteTableIds) > 0 || in.NextToken != nil {
+		return c.ec2API.DescribeRouteTables(in)
+	}
+
+	out, err := c.cache.get(c.key(vpc, "DescribeRouteTables", in), func() (interface{}, error) {
+		return c.ec2API.DescribeRouteTables(in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.(*ec2.DescribeRouteTablesOutput), nil
+}
+
+func (c *cachingEC2) DescribeInternetGateways(in *ec2.DescribeInternetGatewaysInput) (*ec2.DescribeInternetGatewaysOutput, error) {
+	vpc := filteredVPC(in.Filters)
+	if vpc == "" || len(in.InternetGatewayIds) > 0 || in.NextToken != nil {
+		return c.ec2API.DescribeInternetGateways(in)
+	}
+
+	out, err := c.cache.get(c.key(vpc, "DescribeInternetGateways", in), func() (interface{}, error) {
+		return c.ec2API.DescribeInternetGateways(in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.(*ec2.DescribeInternetGatewaysOutput), nil
+}
+
+func (c *cachingEC2) AssociateRouteTable(in *ec2.AssociateRouteTableInput) (*ec2.AssociateRouteTableOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.AssociateRouteTable(in)
+}
+
+func (c *cachingEC2) CreateRoute(in *ec2.CreateRouteInput) (*ec2.CreateRouteOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.CreateRoute(in)
+}
+
+func (c *cachingEC2) CreateRouteTable(in *ec2.CreateRouteTableInput) (*ec2.CreateRouteTableOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.CreateRouteTable(in)
+}
+
+func (c *cachingEC2) CreateTags(in *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.CreateTags(in)
+}
+
+func (c *cachingEC2) DeleteInternetGateway(in *ec2.DeleteInternetGatewayInput) (*ec2.DeleteInternetGatewayOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.DeleteInternetGateway(in)
+}
+
+func (c *cachingEC2) DeleteRoute(in *ec2.DeleteRouteInput) (*ec2.DeleteRouteOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.DeleteRoute(in)
+}
+
+func (c *cachingEC2) DeleteRouteTable(in *ec2.DeleteRouteTableInput) (*ec2.DeleteRouteTableOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.DeleteRouteTable(in)
+}
+
+func (c *cachingEC2) DeleteSubnet(in *ec2.DeleteSubnetInput) (*ec2.DeleteSubnetOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.DeleteSubnet(in)
+}
+
+func (c *cachingEC2) DeleteVpcEndpoints(in *ec2.DeleteVpcEndpointsInput) (*ec2.DeleteVpcEndpointsOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.DeleteVpcEndpoints(in)
+}
+
+func (c *cachingEC2) DetachInternetGateway(in *ec2.DetachInternetGatewayInput) (*ec2.DetachInternetGatewayOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.DetachInternetGateway(in)
+}
+
+func (c *cachingEC2) DisassociateRouteTable(in *ec2.DisassociateRouteTableInput) (*ec2.DisassociateRouteTableOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.DisassociateRouteTable(in)
+}
+
+func (c *cachingEC2) ReplaceRoute(in *ec2.ReplaceRouteInput) (*ec2.ReplaceRouteOutput, error) {
+	defer c.cache.forgetRegion(c.region)
+	return c.ec2API.ReplaceRoute(in)
+}
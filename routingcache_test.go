@@ -0,0 +1,92 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// describeCountingEC2 counts the route table descriptions reaching AWS
+type describeCountingEC2 struct {
+	*mockEC2
+	describes *int
+}
+
+func (m describeCountingEC2) DescribeRouteTables(in *ec2.DescribeRouteTablesInput) (*ec2.DescribeRouteTablesOutput, error) {
+	*m.describes++
+	return m.mockEC2.DescribeRouteTables(in)
+}
+
+func TestRoutingCache(t *testing.T) {
+	Convey("Given a client sharing the routing it describes", t, func() {
+		var describes int
+		live := describeCountingEC2{mockEC2: &mockEC2{tables: []*ec2.RouteTable{{RouteTableId: aws.String("rtb-00000000"), VpcId: aws.String("vpc-0000000")}}}, describes: &describes}
+		cache := newRoutingCache(time.Minute)
+		client := withRoutingCache(live, "eu-west-1", "account-a", cache)
+		inVPC := &ec2.DescribeRouteTablesInput{Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String("vpc-0000000")}}}}
+
+		Convey("When the route tables of a VPC are described twice", func() {
+			client.DescribeRouteTables(inVPC)
+			out, err := client.DescribeRouteTables(inVPC)
+
+			Convey("It should only describe them once", func() {
+				So(err, ShouldBeNil)
+				So(out.RouteTables, ShouldHaveLength, 1)
+				So(describes, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When route tables are described by id", func() {
+			by := &ec2.DescribeRouteTablesInput{RouteTableIds: []*string{aws.String("rtb-00000000")}}
+			client.DescribeRouteTables(by)
+			client.DescribeRouteTables(by)
+
+			Convey("It should describe them each time", func() {
+				So(describes, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the connector changes the routing in between", func() {
+			client.DescribeRouteTables(inVPC)
+			client.CreateRouteTable(&ec2.CreateRouteTableInput{VpcId: aws.String("vpc-0000000")})
+			out, _ := client.DescribeRouteTables(inVPC)
+
+			Convey("It should describe them again", func() {
+				So(describes, ShouldEqual, 2)
+				So(out.RouteTables, ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("When ernestaws changed the routing of the VPC", func() {
+			client.DescribeRouteTables(inVPC)
+			cache.forgetVPC("vpc-0000000")
+			client.DescribeRouteTables(inVPC)
+
+			Convey("It should describe them again", func() {
+				So(describes, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When other credentials describe the same VPC", func() {
+			client.DescribeRouteTables(inVPC)
+			withRoutingCache(live, "eu-west-1", "account-b", cache).DescribeRouteTables(inVPC)
+
+			Convey("It should not share what the first ones read", func() {
+				So(describes, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the cache is disabled", func() {
+			Convey("It should hand back the client unwrapped", func() {
+				So(withRoutingCache(live, "eu-west-1", "account-a", newRoutingCache(0)), ShouldResemble, live)
+			})
+		})
+	})
+}
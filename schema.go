@@ -0,0 +1,137 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/nats-io/nats"
+)
+
+// schemaSubject answers requests with the JSON schema of the events
+const schemaSubject = "network.schema.aws"
+
+func property(kind, description string) map[string]interface{} {
+	return map[string]interface{}{"type": kind, "description": description}
+}
+
+// eventSchema describes the event format accepted by the connector, as a
+// JSON schema
+func eventSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-04/schema#",
+		"title":       "network.aws",
+		"description": "Events handled on network.create.aws, network.update.aws, network.delete.aws, network.get.aws and network.find.aws",
+		"type":        "object",
+		"required":    []string{"datacenter_region", "datacenter_secret", "datacenter_token"},
+		"anyOf": []interface{}{
+			map[string]interface{}{"required": []string{"vpc_id"}},
+			map[string]interface{}{"required": []string{"vpc_tag"}},
+		},
+		"properties": map[string]interface{}{
+			"_uuid":                  property("string", "Event id, copied to every response and status event"),
+			"_batch_id":              property("string", "Build the event belongs to"),
+			"_type":                  property("string", "Provider type, aws-fake uses the in-memory backend"),
+			"_tenant":                property("string", "Tenant the event is accounted to"),
+			"_deadline":              property("string", "RFC3339 time by which the event must be processed"),
+			"_ttl":                   property("string", "Duration within which the event must be processed"),
+			"_profile":               property("string", "Response profile, legacy or extended"),
+			"_timestamp":             property("string", "RFC3339 time the event was published"),
+			"interface_wait_timeout": property("string", "On delete, how long to wait for the interfaces of the network to be released"),
+			"_dry_run":               property("boolean", "On delete, list the resources that would be removed instead"),
+			"_import_format":         property("string", "Render the resources in the response for import into cloudformation or terraform"),
+			"_version":               property("string", "Schema of the event, 1 for these field names or 2 for the generic ones of newer ernest releases"),
+			"_max_mutations":         property("integer", "Mutations the batch of the event may make before pausing"),
+			"_max_duration":          property("string", "Duration the batch of the event may mutate for before pausing"),
+			"_continuation":          property("string", "Token resuming a batch paused by its budget"),
+
+			"max_results": property("integer", "On find, networks a response may carry at most"),
+			"next_token":  property("string", "On find, token of the page of networks to carry on from"),
+
+			"datacenter_region":      property("string", "AWS region"),
+			"datacenter_secret":      property("string", "AWS access key id"),
+			"datacenter_token":       property("string", "AWS secret access key"),
+			"datacenter_read_secret": property("string", "AWS access key id used for read only calls"),
+			"datacenter_read_token":  property("string", "AWS secret access key used for read only calls"),
+			"datacenter_role_arn":    property("string", "IAM role assumed for the calls made by the connector itself"),
+			"datacenter_external_id": property("string", "External id required to assume the role"),
+			"aws_endpoint":           property("string", "AWS endpoint to use instead of the one of the region, such as LocalStack"),
+
+			"datacenter_routing_secret":   property("string", "AWS access key id used for route table and internet gateway calls"),
+			"datacenter_routing_token":    property("string", "AWS secret access key used for route table and internet gateway calls"),
+			"datacenter_routing_role_arn": property("string", "IAM role assumed for route table and internet gateway calls"),
+
+			"vpc_id":         property("string", "VPC the network lives in"),
+			"vpc_tag":        property("string", "key=value tag of the VPC, used when vpc_id is omitted"),
+			"network_aws_id": property("string", "Subnet id, set on update and delete"),
+			"name":           property("string", "Network name"),
+			"template":       property("string", "Network template the omitted fields default to"),
+			"purpose":        property("string", "Platform the network is for, eks or lambda, applying its tags and constraints"),
+			"eks_cluster":    property("string", "EKS cluster sharing the network, tagged kubernetes.io/cluster/<name>"),
+			"service":        property("string", "Ernest service the network belongs to"),
+			"tags": map[string]interface{}{
+				"type":                 "object",
+				"description":          "Tags added to the network resources",
+				"additionalProperties": map[string]interface{}{"type": "string"},
+			},
+			"range":                 property("string", "IPv4 CIDR block of the network"),
+			"prefix_list_id":        property("string", "Managed prefix list kept up to date with the ranges of the environment"),
+			"is_public":             property("boolean", "Whether the network routes through an internet gateway"),
+			"egress_nat_gateway_id": property("string", "NAT gateway private networks send their internet traffic to"),
+			"routes": map[string]interface{}{
+				"type":        "array",
+				"description": "Custom routes programmed into the route table of the network, reconciled on update",
+				"items": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"destination", "target"},
+					"properties": map[string]interface{}{
+						"destination": property("string", "IPv4 or IPv6 CIDR block or managed prefix list id"),
+						"target":      property("string", "Internet gateway, peering connection, instance, NAT gateway, transit gateway or egress only internet gateway id"),
+					},
+				},
+			},
+			"regions": map[string]interface{}{
+				"type":        "array",
+				"description": "Other regions a created network is replicated to, at the same place in a peered VPC",
+				"items": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"region", "vpc_id"},
+					"properties": map[string]interface{}{
+						"region": property("string", "Region of the replica"),
+						"vpc_id": property("string", "VPC of the replica"),
+					},
+				},
+			},
+			"ipv6_range":            property("string", "IPv6 CIDR block of the network, within the VPC IPv6 range"),
+			"assign_ipv6_on_launch": property("boolean", "Whether instances get an IPv6 address on launch"),
+			"availability_zone":     property("string", "Availability zone, picked when omitted on create"),
+			"wait_for": map[string]interface{}{
+				"type":        "array",
+				"description": "On create, dependent resources to wait for before responding",
+				"items":       map[string]interface{}{"type": "string", "enum": waitConditions},
+			},
+			"wait_for_timeout": property("string", "On create, how long to wait for the resources of wait_for"),
+			"vpc_ids": map[string]interface{}{
+				"type":        "array",
+				"description": "On find, VPCs to look the networks of up instead of vpc_id",
+				"items":       map[string]interface{}{"type": "string"},
+			},
+
+			"enable_resource_name_dns_a_record":    property("boolean", "Resource name DNS A records on launch"),
+			"enable_resource_name_dns_aaaa_record": property("boolean", "Resource name DNS AAAA records on launch"),
+		},
+	}
+}
+
+// schemaHandler replies with the event schema, so definitions can be
+// validated before they are published
+func schemaHandler(m *nats.Msg) {
+	data, err := json.Marshal(eventSchema())
+	if err != nil || m.Reply == "" {
+		return
+	}
+
+	nc.Publish(m.Reply, data)
+}
@@ -0,0 +1,37 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventSchema(t *testing.T) {
+	Convey("Given the event schema", t, func() {
+		properties := eventSchema()["properties"].(map[string]interface{})
+
+		Convey("It should describe every field the connector reads", func() {
+			rt := reflect.TypeOf(request{})
+			for i := 0; i < rt.NumField(); i++ {
+				tag := strings.Split(rt.Field(i).Tag.Get("json"), ",")[0]
+				if tag == "" {
+					continue
+				}
+				So(properties, ShouldContainKey, tag)
+			}
+		})
+
+		Convey("It should be valid JSON", func() {
+			data, err := json.Marshal(eventSchema())
+			So(err, ShouldBeNil)
+			So(json.Valid(data), ShouldBeTrue)
+		})
+	})
+}
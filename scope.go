@@ -0,0 +1,96 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// environmentScope restricts the connector to the resources carrying an
+// environment tag, so it never reports or touches the networks of another
+// environment sharing the same VPC
+type environmentScope struct {
+	Key   string
+	Value string
+}
+
+// enabled reports whether the connector is scoped to an environment
+func (s environmentScope) enabled() bool {
+	return s.Key != ""
+}
+
+// includes reports whether a resource with these tags is in scope, every
+// resource being when no scope is configured
+func (s environmentScope) includes(tags map[string]string) bool {
+	if !s.enabled() {
+		return true
+	}
+	v, ok := tags[s.Key]
+	return ok && v == s.Value
+}
+
+// subnets returns the subnets in scope
+func (s environmentScope) subnets(subnets []*ec2.Subnet) []*ec2.Subnet {
+	if !s.enabled() {
+		return subnets
+	}
+
+	var scoped []*ec2.Subnet
+	for _, subnet := range subnets {
+		if s.includes(tagMap(subnet.Tags)) {
+			scoped = append(scoped, subnet)
+		}
+	}
+	return scoped
+}
+
+// items returns the inventory items in scope. VPCs are containers shared by
+// every environment and are always kept.
+func (s environmentScope) items(items []inventoryItem) []inventoryItem {
+	if !s.enabled() {
+		return items
+	}
+
+	var scoped []inventoryItem
+	for _, item := range items {
+		if item.Type == "vpc" || s.includes(item.Tags) {
+			scoped = append(scoped, item)
+		}
+	}
+	return scoped
+}
+
+func (s environmentScope) String() string {
+	return s.Key + "=" + s.Value
+}
+
+// checkScope refuses to mutate a network outside of the environment
+func checkScope(subnet *ec2.Subnet, scope environmentScope) error {
+	if scope.includes(tagMap(subnet.Tags)) {
+		return nil
+	}
+	return newFieldError(errMismatch, "network_aws_id", "Network "+aws.StringValue(subnet.SubnetId)+" is not tagged "+scope.String())
+}
+
+// envScope reads a key=value environment tag
+func envScope(name string) environmentScope {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return environmentScope{}
+	}
+
+	parts := strings.SplitN(v, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		fmt.Println("invalid " + name + " value " + v + ", ignoring it")
+		return environmentScope{}
+	}
+
+	return environmentScope{Key: strings.TrimSpace(parts[0]), Value: strings.TrimSpace(parts[1])}
+}
@@ -0,0 +1,97 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEnvScope(t *testing.T) {
+	Convey("Given an environment tag setting", t, func() {
+		defer os.Unsetenv("ENVIRONMENT_TAG")
+
+		Convey("When it is a key=value pair", func() {
+			os.Setenv("ENVIRONMENT_TAG", "ernest.io/env = prod")
+			scope := envScope("ENVIRONMENT_TAG")
+
+			Convey("It should scope the connector to it", func() {
+				So(scope.enabled(), ShouldBeTrue)
+				So(scope.Key, ShouldEqual, "ernest.io/env")
+				So(scope.Value, ShouldEqual, "prod")
+			})
+		})
+
+		Convey("When it has no value", func() {
+			os.Setenv("ENVIRONMENT_TAG", "ernest.io/env")
+
+			Convey("It should ignore it", func() {
+				So(envScope("ENVIRONMENT_TAG").enabled(), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestEnvironmentScope(t *testing.T) {
+	Convey("Given a VPC shared by two environments", t, func() {
+		prod := &ec2.Subnet{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000"), CidrBlock: aws.String("10.0.0.0/24"),
+			Tags: []*ec2.Tag{{Key: aws.String("ernest.io/env"), Value: aws.String("prod")}}}
+		staging := &ec2.Subnet{SubnetId: aws.String("subnet-11111111"), VpcId: aws.String("vpc-0000000"), CidrBlock: aws.String("10.0.1.0/24"),
+			Tags: []*ec2.Tag{{Key: aws.String("ernest.io/env"), Value: aws.String("staging")}}}
+		scope := environmentScope{Key: "ernest.io/env", Value: "prod"}
+
+		Convey("When filtering its subnets", func() {
+			subnets := scope.subnets([]*ec2.Subnet{prod, staging})
+
+			Convey("It should only keep the ones of the environment", func() {
+				So(subnets, ShouldHaveLength, 1)
+				So(aws.StringValue(subnets[0].SubnetId), ShouldEqual, "subnet-00000000")
+			})
+		})
+
+		Convey("When filtering its inventory", func() {
+			items := scope.items([]inventoryItem{
+				{Type: "vpc", ID: "vpc-0000000"},
+				{Type: "subnet", ID: "subnet-00000000", Tags: map[string]string{"ernest.io/env": "prod"}},
+				{Type: "subnet", ID: "subnet-11111111", Tags: map[string]string{"ernest.io/env": "staging"}},
+				{Type: "route_table", ID: "rtb-11111111"},
+			})
+
+			Convey("It should keep the VPC and the resources of the environment", func() {
+				So(items, ShouldHaveLength, 2)
+				So(items[0].ID, ShouldEqual, "vpc-0000000")
+				So(items[1].ID, ShouldEqual, "subnet-00000000")
+			})
+		})
+
+		Convey("When the connector is scoped to one of them", func() {
+			scoped := cfg.Scope
+			cfg.Scope = scope
+			defer func() { cfg.Scope = scoped }()
+			client := &mockEC2{subnets: []*ec2.Subnet{prod, staging}}
+
+			Convey("It should not find the networks of the other one", func() {
+				networks, err := lookupNetworks(client, request{VPCID: "vpc-0000000"})
+				So(err, ShouldBeNil)
+				So(networks, ShouldHaveLength, 1)
+				So(networks[0]["network_aws_id"], ShouldEqual, "subnet-00000000")
+			})
+
+			Convey("It should refuse to delete them", func() {
+				_, err := checkNetwork(client, "network.delete.aws", request{NetworkAWSID: "subnet-11111111", VPCID: "vpc-0000000"})
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errMismatch)
+			})
+
+			Convey("It should tag the networks it creates", func() {
+				So(resourceTags(request{Name: "web"})["ernest.io/env"], ShouldEqual, "prod")
+			})
+		})
+	})
+}
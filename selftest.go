@@ -0,0 +1,76 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nats-io/nats"
+)
+
+// selftest creates, gets, updates and deletes a small network in a
+// sandbox VPC configured through SELFTEST_* variables, returning the first
+// step that failed
+func selftest() error {
+	r := request{
+		UUID:                  "selftest",
+		BatchID:               "selftest",
+		ProviderType:          "aws",
+		DatacenterRegion:      os.Getenv("SELFTEST_REGION"),
+		DatacenterAccessKey:   os.Getenv("SELFTEST_ACCESS_KEY"),
+		DatacenterAccessToken: os.Getenv("SELFTEST_ACCESS_TOKEN"),
+		VPCID:                 os.Getenv("SELFTEST_VPC_ID"),
+		Subnet:                envString("SELFTEST_RANGE", "10.0.255.240/28"),
+	}
+
+	if r.DatacenterRegion == "" || r.VPCID == "" {
+		return errors.New("SELFTEST_REGION and SELFTEST_VPC_ID must be set")
+	}
+
+	data, _ := json.Marshal(r)
+	data = setField(data, "name", "ernest-selftest")
+
+	data, err := selftestStep("network.create.aws", data)
+	if err != nil {
+		return err
+	}
+
+	r = parseRequest(data)
+	subnet, err := describeSubnet(readClient(r), r.NetworkAWSID)
+	if err != nil {
+		return errors.New("get: " + err.Error())
+	}
+	if subnet == nil {
+		return errors.New("get: network " + r.NetworkAWSID + " not found")
+	}
+	fmt.Println("selftest: get ok")
+
+	if _, err = selftestStep("network.update.aws", data); err != nil {
+		return err
+	}
+
+	_, err = selftestStep("network.delete.aws", data)
+	return err
+}
+
+func selftestStep(subject string, data []byte) ([]byte, error) {
+	step := verb(subject)
+
+	resp, body := handle(&nats.Msg{Subject: subject, Data: data}, nil)
+	if strings.HasSuffix(resp, ".error") {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(body, &failure)
+		return nil, errors.New(step + ": " + failure.Error)
+	}
+
+	fmt.Println("selftest: " + step + " ok")
+	return body, nil
+}
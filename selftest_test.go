@@ -0,0 +1,52 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSelftest(t *testing.T) {
+	Convey("Given a self test", t, func() {
+		Convey("When no sandbox VPC is configured", func() {
+			os.Setenv("SELFTEST_REGION", "eu-west-1")
+			defer os.Unsetenv("SELFTEST_REGION")
+
+			Convey("It should fail before reaching AWS", func() {
+				err := selftest()
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "SELFTEST_REGION and SELFTEST_VPC_ID must be set")
+			})
+		})
+
+		Convey("When a step succeeds", func() {
+			event := testEvent
+			event.ProviderType = providerFake
+			event.NetworkAWSID = ""
+			data, _ := json.Marshal(event)
+
+			body, err := selftestStep("network.create.aws", data)
+
+			Convey("It should pass its response on to the next step", func() {
+				So(err, ShouldBeNil)
+				So(body, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a step fails", func() {
+			_, err := selftestStep("network.resize.aws", []byte(`{"_uuid":"selftest","_type":"fake"}`))
+
+			Convey("It should name the step that failed", func() {
+				So(err, ShouldNotBeNil)
+				So(strings.HasPrefix(err.Error(), "resize: "), ShouldBeTrue)
+			})
+		})
+	})
+}
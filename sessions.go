@@ -0,0 +1,73 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// sessionTTL is how long an unused session is kept
+const sessionTTL = 15 * time.Minute
+
+// sessionCache shares AWS sessions, and the credentials they hold, across
+// the calls and events using the same region and credentials
+type sessionCache struct {
+	mu       sync.Mutex
+	sessions map[string]*cachedSession
+}
+
+type cachedSession struct {
+	session *session.Session
+	used    time.Time
+}
+
+func newSessionCache() *sessionCache {
+	return &sessionCache{sessions: make(map[string]*cachedSession)}
+}
+
+// get returns the session for the region and credentials of the event,
+// creating it when needed
+func (c *sessionCache) get(r request, key, token string) *session.Session {
+	id := sessionKey(r, key, token)
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, s := range c.sessions {
+		if now.Sub(s.used) > sessionTTL {
+			delete(c.sessions, k)
+		}
+	}
+
+	s, ok := c.sessions[id]
+	if !ok {
+		s = &cachedSession{session: session.New(awsConfig(r, key, token))}
+		c.sessions[id] = s
+	}
+	s.used = now
+
+	return s.session
+}
+
+// sessionKey identifies a session without holding the secret key. Assumed
+// roles are named after the event, so their sessions aren't shared across
+// events.
+func sessionKey(r request, key, token string) string {
+	secret := sha256.Sum256([]byte(token))
+	parts := []string{r.DatacenterRegion, r.endpoint(cfg), key, hex.EncodeToString(secret[:])}
+
+	if r.RoleARN != "" {
+		parts = append(parts, r.RoleARN, r.ExternalID, r.UUID)
+	}
+
+	return strings.Join(parts, "|")
+}
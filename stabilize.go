@@ -0,0 +1,50 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// stabilize holds the done response of a create until the services
+// reacting to it can rely on the network: for the given delay and then,
+// with checks, until the client, other than the one that created it, sees
+// the network available that many times in a row, DESCRIBE_INTERVAL apart
+func stabilize(client ec2API, id string, delay time.Duration, checks int, timeout time.Duration) error {
+	time.Sleep(delay)
+	if checks <= 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	backoff := time.Second
+
+	for seen := 0; ; {
+		subnet, err := describeSubnet(client, id)
+		if err != nil {
+			return err
+		}
+		if subnet != nil && aws.StringValue(subnet.State) == "available" {
+			if seen++; seen >= checks {
+				return nil
+			}
+			time.Sleep(cfg.DescribeInterval)
+			continue
+		}
+		seen = 0
+
+		if time.Now().Add(backoff).After(deadline) {
+			return newError(errTimeout, "Network "+id+" wasn't seen available "+strconv.Itoa(checks)+" times in a row after "+timeout.String())
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxInterfaceBackoff {
+			backoff = maxInterfaceBackoff
+		}
+	}
+}
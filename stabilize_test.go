@@ -0,0 +1,63 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingEC2 counts the describes of a network
+type countingEC2 struct {
+	*mockEC2
+	describes int
+}
+
+func (m *countingEC2) DescribeSubnets(in *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	m.describes++
+	return m.mockEC2.DescribeSubnets(in)
+}
+
+func TestStabilize(t *testing.T) {
+	Convey("Given a network just created", t, func() {
+		client := &countingEC2{mockEC2: &mockEC2{subnets: []*ec2.Subnet{
+			{SubnetId: aws.String("subnet-00000000"), State: aws.String("available")},
+		}}}
+
+		Convey("When checking it is seen available twice in a row", func() {
+			err := stabilize(client, "subnet-00000000", 0, 2, 0)
+
+			Convey("It should describe it twice", func() {
+				So(err, ShouldBeNil)
+				So(client.describes, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When only delaying the response", func() {
+			err := stabilize(client, "subnet-00000000", 0, 0, 0)
+
+			Convey("It should not describe it", func() {
+				So(err, ShouldBeNil)
+				So(client.describes, ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given a network not visible yet", t, func() {
+		client := &countingEC2{mockEC2: &mockEC2{}}
+
+		Convey("When it isn't seen before the timeout", func() {
+			err := stabilize(client, "subnet-00000000", 0, 1, 0)
+
+			Convey("It should time out", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errTimeout)
+			})
+		})
+	})
+}
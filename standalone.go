@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	ecc "github.com/ernestio/ernest-config-client"
+	"github.com/nats-io/nats"
+)
+
+// connect returns the NATS connection, through the ernest config client
+// or, when running standalone, straight to the configured server
+func connect(c config) (*nats.Conn, error) {
+	if !c.Standalone {
+		return ecc.NewConfig(os.Getenv("NATS_URI")).Nats(), nil
+	}
+
+	return nats.Connect(c.NATSURL, nats.Name(c.UserAgent), nats.MaxReconnects(-1))
+}
+
+// standaloneDefaults fills in the region and credentials events omit from
+// the settings of a standalone connector, so it can serve clients that
+// aren't ernest. It returns the fields to blank in responses, which never
+// echo the connector credentials.
+func standaloneDefaults(data []byte, c config) ([]byte, map[string]interface{}) {
+	if !c.Standalone {
+		return data, nil
+	}
+
+	var r struct {
+		Region  string `json:"datacenter_region"`
+		Key     string `json:"datacenter_secret"`
+		Token   string `json:"datacenter_token"`
+		RoleARN string `json:"datacenter_role_arn"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return data, nil
+	}
+
+	fields := make(map[string]interface{})
+	if r.Region == "" && c.DefaultRegion != "" {
+		fields["datacenter_region"] = c.DefaultRegion
+	}
+
+	// events assuming a role do so with the connector credentials already
+	var blanked map[string]interface{}
+	if r.Key == "" && r.Token == "" && r.RoleARN == "" && c.AWSAccessKeyID != "" {
+		fields["datacenter_secret"] = c.AWSAccessKeyID
+		fields["datacenter_token"] = c.AWSSecretAccessKey
+		blanked = map[string]interface{}{"datacenter_secret": "", "datacenter_token": ""}
+	}
+
+	if len(fields) == 0 {
+		return data, nil
+	}
+
+	return setFields(data, fields), blanked
+}
@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStandaloneDefaults(t *testing.T) {
+	Convey("Given a standalone connector with its own region and credentials", t, func() {
+		c := config{Standalone: true, DefaultRegion: "eu-west-1", AWSAccessKeyID: "key", AWSSecretAccessKey: "secret"}
+
+		Convey("When an event omits them", func() {
+			data, blanked := standaloneDefaults([]byte(`{"vpc_id":"vpc-0000000"}`), c)
+			r := parseRequest(data)
+
+			Convey("It should fill them in", func() {
+				So(r.DatacenterRegion, ShouldEqual, "eu-west-1")
+				So(r.DatacenterAccessKey, ShouldEqual, "key")
+				So(r.DatacenterAccessToken, ShouldEqual, "secret")
+			})
+
+			Convey("It should blank the credentials in responses", func() {
+				So(blanked["datacenter_secret"], ShouldEqual, "")
+				So(blanked["datacenter_token"], ShouldEqual, "")
+			})
+		})
+
+		Convey("When an event carries its own", func() {
+			data, blanked := standaloneDefaults([]byte(`{"datacenter_region":"us-east-1","datacenter_secret":"other","datacenter_token":"token"}`), c)
+			r := parseRequest(data)
+
+			Convey("It should keep them", func() {
+				So(r.DatacenterRegion, ShouldEqual, "us-east-1")
+				So(r.DatacenterAccessKey, ShouldEqual, "other")
+				So(blanked, ShouldBeNil)
+			})
+		})
+
+		Convey("When an event assumes a role", func() {
+			data, _ := standaloneDefaults([]byte(`{"datacenter_role_arn":"arn:aws:iam::123456789012:role/ernest"}`), c)
+
+			Convey("It should leave the credentials to the role", func() {
+				So(parseRequest(data).DatacenterAccessKey, ShouldEqual, "")
+			})
+		})
+	})
+
+	Convey("Given a connector running within ernest", t, func() {
+		Convey("When an event omits its region", func() {
+			data, _ := standaloneDefaults([]byte(`{"vpc_id":"vpc-0000000"}`), config{DefaultRegion: "eu-west-1"})
+
+			Convey("It should leave it alone", func() {
+				So(string(data), ShouldEqual, `{"vpc_id":"vpc-0000000"}`)
+			})
+		})
+	})
+}
@@ -0,0 +1,257 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"runtime"
+	"sync"
+	"time"
+
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+	"github.com/nats-io/nats"
+)
+
+// stats keeps track of the connector runtime figures
+type stats struct {
+	mu       sync.Mutex
+	since    time.Time
+	inflight map[string]int
+	handled  map[string]int
+	batches  map[string]*Usage
+	tenants  map[string]*Usage
+	subs     []*nats.Subscription
+
+	// completed counts every event handled since startup
+	completed int
+	// calls counts the AWS requests sent since the previous snapshot,
+	// operations the same requests by operation
+	calls      int
+	operations map[string]int
+}
+
+// Usage : events, failures and AWS latency attributed to a batch or tenant
+type Usage struct {
+	Events    int   `json:"events"`
+	Failures  int   `json:"failures"`
+	LatencyMS int64 `json:"latency_ms"`
+	QueueMS   int64 `json:"queue_ms"`
+}
+
+// Snapshot : runtime figures published on the monitor subject
+type Snapshot struct {
+	Timestamp  time.Time         `json:"timestamp"`
+	Goroutines int               `json:"goroutines"`
+	InFlight   map[string]int    `json:"in_flight"`
+	Handled    map[string]int    `json:"handled"`
+	QueueDepth int               `json:"queue_depth"`
+	EventRate  float64           `json:"event_rate"`
+	AWSCalls   int               `json:"aws_calls"`
+	AWSRate    float64           `json:"aws_rps"`
+	AWSOps     map[string]int    `json:"aws_calls_by_operation"`
+	Batches    map[string]*Usage `json:"batches"`
+	Tenants    map[string]*Usage `json:"tenants"`
+	AWSErrors  map[string]int    `json:"aws_errors"`
+	ErrorKinds map[string]int    `json:"aws_error_categories"`
+}
+
+func newStats() *stats {
+	return &stats{
+		since:      time.Now(),
+		inflight:   make(map[string]int),
+		handled:    make(map[string]int),
+		batches:    make(map[string]*Usage),
+		tenants:    make(map[string]*Usage),
+		operations: make(map[string]int),
+	}
+}
+
+func (s *stats) track(sub *nats.Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subs = append(s.subs, sub)
+}
+
+func (s *stats) start(subject string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inflight[verb(subject)]++
+}
+
+func (s *stats) finish(subject string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inflight[verb(subject)]--
+	s.handled[verb(subject)]++
+	s.completed++
+}
+
+// awsCalls counts AWS requests sent to an operation, retries included
+func (s *stats) awsCalls(operation string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls += n
+	s.operations[operation] += n
+}
+
+// completedEvents returns the number of events handled since startup
+func (s *stats) completedEvents() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.completed
+}
+
+// record attributes a processed event to its batch and tenant
+func (s *stats) record(r request, failed bool, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage(s.batches, r.BatchID).add(failed, latency, r.queued())
+	usage(s.tenants, r.tenant()).add(failed, latency, r.queued())
+}
+
+// maxUsageKeys bounds the batches and tenants usage is attributed to
+// between snapshots, so it can't grow unbounded when they are rare or
+// disabled. Others are attributed to usageOverflow.
+const maxUsageKeys = 1000
+
+const usageOverflow = "other"
+
+func usage(m map[string]*Usage, key string) *Usage {
+	u, ok := m[key]
+	if !ok && len(m) >= maxUsageKeys {
+		key = usageOverflow
+		u, ok = m[key]
+	}
+	if !ok {
+		u = &Usage{}
+		m[key] = u
+	}
+	return u
+}
+
+func (u *Usage) add(failed bool, latency, queued time.Duration) {
+	u.Events++
+	u.LatencyMS += milliseconds(latency)
+	u.QueueMS += milliseconds(queued)
+	if failed {
+		u.Failures++
+	}
+}
+
+// snapshot returns the current figures and resets the handled counters
+// and usage, so they cover the period since the previous snapshot
+func (s *stats) snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	snap := Snapshot{
+		Timestamp:  now,
+		Goroutines: runtime.NumGoroutine(),
+		InFlight:   make(map[string]int),
+		Handled:    make(map[string]int),
+		Batches:    s.batches,
+		Tenants:    s.tenants,
+		AWSErrors:  awsErrors.byCode(),
+		ErrorKinds: awsErrors.byCategory(),
+		AWSCalls:   s.calls,
+		AWSOps:     s.operations,
+	}
+
+	var total int
+	for k, v := range s.inflight {
+		snap.InFlight[k] = v
+	}
+	for k, v := range s.handled {
+		snap.Handled[k] = v
+		total += v
+	}
+
+	for _, sub := range s.subs {
+		pending, _, err := sub.Pending()
+		if err == nil {
+			snap.QueueDepth += pending
+		}
+	}
+
+	if elapsed := now.Sub(s.since).Seconds(); elapsed > 0 {
+		snap.EventRate = float64(total) / elapsed
+		snap.AWSRate = float64(s.calls) / elapsed
+	}
+
+	s.since = now
+	s.calls = 0
+	s.operations = make(map[string]int)
+	s.handled = make(map[string]int)
+	s.batches = make(map[string]*Usage)
+	s.tenants = make(map[string]*Usage)
+
+	return snap
+}
+
+// awsCallHandler counts the AWS requests the connector's own clients
+// sent, each retry of the SDK included, as each counts against the
+// account rate limits
+func awsCallHandler(req *awsrequest.Request) {
+	operation := "unknown"
+	if req.Operation != nil {
+		operation = req.Operation.Name
+	}
+	st.awsCalls(operation, 1+req.RetryCount)
+}
+
+// monitor publishes a stats snapshot on the given subject every interval
+func monitor(s *stats, subject string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	for range time.Tick(interval) {
+		data, err := json.Marshal(s.snapshot())
+		if err != nil {
+			continue
+		}
+		nc.Publish(subject, data)
+	}
+}
+
+// ShutdownReport : outcome of draining the connector on shutdown, so deploy
+// tooling can verify rollouts lost no event
+type ShutdownReport struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Version     string    `json:"version"`
+	DrainMS     int64     `json:"drain_ms"`
+	Completed   int       `json:"completed"`
+	Abandoned   int       `json:"abandoned"`
+	Unpublished int       `json:"unpublished_responses"`
+	Lossless    bool      `json:"lossless"`
+}
+
+// finish stamps the report with the drain duration and whether every
+// event received was completed and answered
+func (r ShutdownReport) finish(started, now time.Time) ShutdownReport {
+	r.Timestamp = now
+	r.DrainMS = milliseconds(now.Sub(started))
+	r.Lossless = r.Abandoned == 0 && r.Unpublished == 0
+	return r
+}
+
+func publishShutdownReport(subject string, r ShutdownReport) {
+	if subject == "" {
+		return
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	nc.Publish(subject, data)
+}
@@ -0,0 +1,113 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStats(t *testing.T) {
+	Convey("Given a stats tracker", t, func() {
+		s := newStats()
+
+		Convey("When events are being processed", func() {
+			s.start("network.create.aws")
+			s.start("network.create.aws")
+			s.start("network.delete.aws")
+			s.finish("network.create.aws")
+
+			Convey("It should report in flight events per verb", func() {
+				snap := s.snapshot()
+				So(snap.InFlight["create"], ShouldEqual, 1)
+				So(snap.InFlight["delete"], ShouldEqual, 1)
+				So(snap.Handled["create"], ShouldEqual, 1)
+				So(snap.Goroutines, ShouldBeGreaterThan, 0)
+			})
+
+			Convey("It should report the AWS requests sent", func() {
+				s.awsCalls("DescribeSubnets", 2)
+				s.awsCalls("CreateTags", 1)
+				snap := s.snapshot()
+				So(snap.AWSCalls, ShouldEqual, 3)
+				So(snap.AWSOps, ShouldResemble, map[string]int{"DescribeSubnets": 2, "CreateTags": 1})
+				So(snap.AWSRate, ShouldBeGreaterThan, 0)
+				So(s.snapshot().AWSCalls, ShouldEqual, 0)
+			})
+
+			Convey("It should reset handled counters between snapshots", func() {
+				s.snapshot()
+				snap := s.snapshot()
+				So(snap.InFlight["create"], ShouldEqual, 1)
+				So(snap.Handled["create"], ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given a stats tracker", t, func() {
+		s := newStats()
+
+		Convey("When events from several batches are processed", func() {
+			s.record(request{BatchID: "a", Tenant: "acme"}, false, 2*time.Second)
+			s.record(request{BatchID: "a", Tenant: "acme"}, true, time.Second)
+			s.record(request{BatchID: "b"}, false, time.Second)
+
+			Convey("It should attribute them to their batch and tenant", func() {
+				snap := s.snapshot()
+				So(*snap.Batches["a"], ShouldResemble, Usage{Events: 2, Failures: 1, LatencyMS: 3000})
+				So(*snap.Batches["b"], ShouldResemble, Usage{Events: 1, LatencyMS: 1000})
+				So(snap.Tenants["acme"].Events, ShouldEqual, 2)
+				So(snap.Tenants["default"].Events, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When more batches are processed than can be told apart", func() {
+			for i := 0; i < maxUsageKeys+10; i++ {
+				s.record(request{BatchID: strconv.Itoa(i)}, false, time.Second)
+			}
+
+			Convey("It should attribute the others together", func() {
+				snap := s.snapshot()
+				So(len(snap.Batches), ShouldEqual, maxUsageKeys+1)
+				So(snap.Batches[usageOverflow].Events, ShouldEqual, 10)
+			})
+		})
+	})
+}
+
+func TestShutdownReport(t *testing.T) {
+	Convey("Given a connector draining its events", t, func() {
+		s := newStats()
+		s.start("network.create.aws")
+		before := s.completedEvents()
+		s.finish("network.create.aws")
+		s.snapshot()
+
+		Convey("It should count the events completed during the drain across snapshots", func() {
+			So(s.completedEvents()-before, ShouldEqual, 1)
+		})
+
+		Convey("When every event was completed", func() {
+			started := time.Now()
+			r := ShutdownReport{Completed: 1}.finish(started, started.Add(2*time.Second))
+
+			Convey("It should report a lossless drain", func() {
+				So(r.Lossless, ShouldBeTrue)
+				So(r.DrainMS, ShouldEqual, int64(2000))
+			})
+		})
+
+		Convey("When parked events were dropped", func() {
+			r := ShutdownReport{Completed: 1, Abandoned: 2}.finish(time.Now(), time.Now())
+
+			Convey("It should report the loss", func() {
+				So(r.Lossless, ShouldBeFalse)
+			})
+		})
+	})
+}
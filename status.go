@@ -0,0 +1,99 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	statusReceived     = "received"
+	statusValidated    = "validated"
+	statusProvisioning = "provisioning"
+	statusVerifying    = "verifying"
+	statusParked       = "parked"
+	statusDone         = "done"
+	statusErrored      = "errored"
+)
+
+// progress steps reported while provisioning and verifying
+const (
+	stepSubnetCreated     = "subnet_created"
+	stepIPv6Associated    = "ipv6_associated"
+	stepRoutesProgrammed  = "routes_programmed"
+	stepTagged            = "tagged"
+	stepDependentsReady   = "dependents_ready"
+	stepStabilized        = "stabilized"
+	stepWaitingInterfaces = "waiting_for_interfaces"
+	stepInterfacesFreed   = "interfaces_released"
+	stepSubnetDeleted     = "subnet_deleted"
+	stepRoutingRemoved    = "routing_removed"
+
+	stepNATGatewaysDeleted      = "nat_gateways_deleted"
+	stepEndpointsDeleted        = "endpoints_deleted"
+	stepSubnetsDeleted          = "subnets_deleted"
+	stepRouteTablesDeleted      = "route_tables_deleted"
+	stepInternetGatewaysDeleted = "internet_gateways_deleted"
+)
+
+// StatusEvent : lifecycle transition published on <subject>.status
+type StatusEvent struct {
+	UUID      string    `json:"_uuid"`
+	BatchID   string    `json:"_batch_id"`
+	Status    string    `json:"status"`
+	Step      string    `json:"step,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func publishStatus(subject string, r request, status string) {
+	publishEvent(subject, StatusEvent{
+		UUID:      r.UUID,
+		BatchID:   r.BatchID,
+		Status:    status,
+		Timestamp: time.Now(),
+	})
+	publishUserMessage(subject, r, status, "")
+}
+
+// publishProgress reports a step completed while provisioning, so long
+// operations don't look stuck
+func publishProgress(subject string, r request, step string) {
+	publishStep(subject, r, statusProvisioning, step)
+}
+
+// publishVerified reports a check passed while verifying the network
+func publishVerified(subject string, r request, step string) {
+	publishStep(subject, r, statusVerifying, step)
+}
+
+func publishStep(subject string, r request, status, step string) {
+	publishEvent(subject, StatusEvent{
+		UUID:      r.UUID,
+		BatchID:   r.BatchID,
+		Status:    status,
+		Step:      step,
+		Timestamp: time.Now(),
+	})
+	publishUserMessage(subject, r, status, step)
+}
+
+func publishEvent(subject string, e StatusEvent) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	nc.Publish(subject+".status", data)
+}
+
+// finalStatus maps a response subject to its lifecycle status
+func finalStatus(subject string) string {
+	if strings.HasSuffix(subject, ".error") {
+		return statusErrored
+	}
+	return statusDone
+}
@@ -0,0 +1,98 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Record : a processed event, without credentials, as kept by the store
+type Record struct {
+	UUID      string                 `json:"_uuid"`
+	BatchID   string                 `json:"_batch_id"`
+	Subject   string                 `json:"subject"`
+	Outcome   string                 `json:"outcome"`
+	Timestamp time.Time              `json:"timestamp"`
+	Request   map[string]interface{} `json:"request"`
+	Response  map[string]interface{} `json:"response"`
+}
+
+// eventStore keeps the last outcome of every processed event as a file
+// per event uuid
+type eventStore struct {
+	dir string
+}
+
+func newEventStore(dir string) *eventStore {
+	return &eventStore{dir: dir}
+}
+
+func (s *eventStore) path(uuid string) (string, error) {
+	return eventFile(s.dir, uuid)
+}
+
+// eventFile returns the path of the file kept for an event in dir,
+// refusing uuids that would escape it
+func eventFile(dir, uuid string) (string, error) {
+	if uuid == "" || strings.ContainsAny(uuid, `/\`) || strings.HasPrefix(uuid, ".") {
+		return "", errors.New("Invalid event uuid " + uuid)
+	}
+	return filepath.Join(dir, uuid+".json"), nil
+}
+
+func (s *eventStore) save(rec Record) error {
+	path, err := s.path(rec.UUID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// load returns the record for the uuid, or nil if there is none
+func (s *eventStore) load(uuid string) (*Record, error) {
+	path, err := s.path(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+
+	return &rec, nil
+}
+
+func newRecord(subject string, r request, data, resp []byte, outcome string) Record {
+	return Record{
+		UUID:      r.UUID,
+		BatchID:   r.BatchID,
+		Subject:   subject,
+		Outcome:   outcome,
+		Timestamp: time.Now(),
+		Request:   sanitize(data),
+		Response:  sanitize(resp),
+	}
+}
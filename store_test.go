@@ -0,0 +1,49 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventStore(t *testing.T) {
+	Convey("Given an event store", t, func() {
+		dir, _ := ioutil.TempDir("", "network-store")
+		defer os.RemoveAll(dir)
+		s := newEventStore(dir)
+
+		Convey("When saving a processed event", func() {
+			data, _ := json.Marshal(testEvent)
+			rec := newRecord("network.create.aws", parseRequest(data), data, data, statusDone)
+			So(s.save(rec), ShouldBeNil)
+
+			Convey("It should be loaded back by uuid without credentials", func() {
+				loaded, err := s.load("test")
+				So(err, ShouldBeNil)
+				So(loaded.Subject, ShouldEqual, "network.create.aws")
+				So(loaded.Outcome, ShouldEqual, statusDone)
+				So(loaded.Request["vpc_id"], ShouldEqual, "vpc-0000000")
+				So(loaded.Request, ShouldNotContainKey, "datacenter_secret")
+				So(loaded.Response, ShouldNotContainKey, "datacenter_token")
+			})
+		})
+
+		Convey("When loading an unknown event", func() {
+			loaded, err := s.load("unknown")
+			So(err, ShouldBeNil)
+			So(loaded, ShouldBeNil)
+		})
+
+		Convey("When loading an event with an unsafe uuid", func() {
+			_, err := s.load("../etc/passwd")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,147 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/nats-io/nats"
+)
+
+// subject is a parsed NATS subject: <component>.<verb>.<provider>,
+// optionally followed by a v<N> version, a tenant and a done or error
+// outcome, in that order
+type subject struct {
+	Component string
+	Verb      string
+	Provider  string
+	Version   string
+	Tenant    string
+	Outcome   string
+}
+
+var subjectToken = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+var versionToken = regexp.MustCompile(`^v[0-9]+$`)
+
+// parseSubject validates the whole subject against the pattern rather
+// than picking tokens out of it
+func parseSubject(s string) (subject, error) {
+	malformed := newError(errPayload, "Malformed subject "+s)
+
+	parts := strings.Split(s, ".")
+	if len(parts) < 3 || len(parts) > 6 {
+		return subject{}, malformed
+	}
+	for _, p := range parts {
+		if !subjectToken.MatchString(p) {
+			return subject{}, malformed
+		}
+	}
+
+	d := subject{Component: parts[0], Verb: parts[1], Provider: parts[2]}
+
+	rest := parts[3:]
+	if n := len(rest); n > 0 && (rest[n-1] == "done" || rest[n-1] == "error") {
+		d.Outcome = rest[n-1]
+		rest = rest[:n-1]
+	}
+	if len(rest) > 0 && versionToken.MatchString(rest[0]) {
+		d.Version = rest[0]
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		d.Tenant = rest[0]
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		return subject{}, malformed
+	}
+
+	return d, nil
+}
+
+func (s subject) String() string {
+	parts := []string{s.Component, s.Verb, s.Provider}
+	for _, p := range []string{s.Version, s.Tenant, s.Outcome} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// verb returns the verb of the subject, empty if the subject is malformed
+func verb(s string) string {
+	d, err := parseSubject(s)
+	if err != nil {
+		return ""
+	}
+	return d.Verb
+}
+
+// router hands messages to the handler of their verb, once their subject
+// has been checked to be an event for the router's component and provider
+type router struct {
+	component string
+	provider  string
+	verbs     []string
+	handlers  map[string]nats.MsgHandler
+}
+
+func newRouter(component, provider string) *router {
+	return &router{
+		component: component,
+		provider:  provider,
+		handlers:  make(map[string]nats.MsgHandler),
+	}
+}
+
+// handle routes the events of a verb to h
+func (r *router) handle(v string, h nats.MsgHandler) *router {
+	if _, ok := r.handlers[v]; !ok {
+		r.verbs = append(r.verbs, v)
+	}
+	r.handlers[v] = h
+	return r
+}
+
+// subjects returns the subjects of the routed verbs, in the order they
+// were routed
+func (r *router) subjects() []string {
+	var subjects []string
+	for _, v := range r.verbs {
+		subjects = append(subjects, subject{Component: r.component, Verb: v, Provider: r.provider}.String())
+	}
+	return subjects
+}
+
+// route returns the handler of the subject, or why it has none
+func (r *router) route(s string) (nats.MsgHandler, error) {
+	d, err := parseSubject(s)
+	if err != nil {
+		return nil, err
+	}
+	if d.Component != r.component || d.Provider != r.provider || d.Outcome != "" {
+		return nil, newError(errPayload, "Subject "+s+" is not a "+r.component+" event for "+r.provider)
+	}
+
+	h, ok := r.handlers[d.Verb]
+	if !ok {
+		return nil, newError(errCapability, "Connector version "+version+" does not support "+d.Verb)
+	}
+	return h, nil
+}
+
+// serve hands the message over to its handler, answering it with an error
+// if it has none
+func (r *router) serve(m *nats.Msg) {
+	h, err := r.route(m.Subject)
+	if err != nil {
+		publishError(m.Subject, errorResponse(m.Data, err))
+		return
+	}
+	h(m)
+}
@@ -0,0 +1,88 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseSubject(t *testing.T) {
+	Convey("Given network subjects", t, func() {
+		Convey("When a subject is an event", func() {
+			d, err := parseSubject("network.create.aws")
+
+			Convey("It should return its component, verb and provider", func() {
+				So(err, ShouldBeNil)
+				So(d, ShouldResemble, subject{Component: "network", Verb: "create", Provider: "aws"})
+			})
+		})
+
+		Convey("When a subject has a version, a tenant and an outcome", func() {
+			d, err := parseSubject("network.delete.aws.v2.acme.error")
+
+			Convey("It should return them too", func() {
+				So(err, ShouldBeNil)
+				So(d.Version, ShouldEqual, "v2")
+				So(d.Tenant, ShouldEqual, "acme")
+				So(d.Outcome, ShouldEqual, "error")
+				So(d.String(), ShouldEqual, "network.delete.aws.v2.acme.error")
+			})
+		})
+
+		Convey("When a subject is malformed", func() {
+			Convey("It should reject it", func() {
+				for _, s := range []string{"", "network", "network.create", "network..aws", "network.create.aws.acme.other", "network.*.aws"} {
+					_, err := parseSubject(s)
+					So(err, ShouldNotBeNil)
+					So(err.(*connectorError).code, ShouldEqual, errPayload)
+					So(verb(s), ShouldEqual, "")
+				}
+			})
+		})
+	})
+}
+
+func TestRouter(t *testing.T) {
+	Convey("Given a router", t, func() {
+		var handled string
+		r := newRouter("network", "aws").handle("get", func(m *nats.Msg) {
+			handled = m.Subject
+		})
+
+		Convey("It should subscribe to the routed verbs", func() {
+			So(r.subjects(), ShouldResemble, []string{"network.get.aws"})
+		})
+
+		Convey("When routing an event for a routed verb", func() {
+			h, err := r.route("network.get.aws")
+
+			Convey("It should return its handler", func() {
+				So(err, ShouldBeNil)
+				h(&nats.Msg{Subject: "network.get.aws"})
+				So(handled, ShouldEqual, "network.get.aws")
+			})
+		})
+
+		Convey("When routing an event for another verb", func() {
+			_, err := r.route("network.find.aws")
+
+			Convey("It should report the capability as missing", func() {
+				So(err.(*connectorError).code, ShouldEqual, errCapability)
+			})
+		})
+
+		Convey("When routing a response or another provider", func() {
+			Convey("It should reject it", func() {
+				_, err := r.route("network.get.aws.done")
+				So(err.(*connectorError).code, ShouldEqual, errPayload)
+				_, err = r.route("network.get.azure")
+				So(err.(*connectorError).code, ShouldEqual, errPayload)
+			})
+		})
+	})
+}
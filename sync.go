@@ -0,0 +1,344 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats"
+)
+
+const (
+	syncCreate  = "create"
+	syncUpdate  = "update"
+	syncDelete  = "delete"
+	syncReplace = "replace"
+
+	resultApplied = "applied"
+)
+
+// syncAction is a change converging the networks of a VPC to the desired
+// ones
+type syncAction struct {
+	Action       string        `json:"action"`
+	Name         string        `json:"name,omitempty"`
+	Range        string        `json:"range"`
+	NetworkAWSID string        `json:"network_aws_id,omitempty"`
+	Changes      []FieldChange `json:"changes,omitempty"`
+	Events       []string      `json:"events,omitempty"`
+	Status       string        `json:"status,omitempty"`
+	Error        string        `json:"error,omitempty"`
+
+	desired int
+}
+
+// syncEvent is an event issued to apply a sync action
+type syncEvent struct {
+	subject string
+	uuid    string
+	data    []byte
+	action  *syncAction
+}
+
+// syncHandler compares the full list of desired networks of a VPC with
+// its ernest managed networks and answers the creates, updates and
+// deletes converging them. With apply set the actions are carried out as
+// regular network events, deletes first.
+func syncHandler(m *nats.Msg) {
+	req, data, err := decodeStandalone(m)
+	if err != nil {
+		deliver(m.Subject+".error", errorResponse(nil, err))
+		return
+	}
+	body := sanitizedBody(m.Data)
+
+	var event struct {
+		Networks []json.RawMessage `json:"networks"`
+		Apply    bool              `json:"apply"`
+	}
+	json.Unmarshal(data, &event)
+
+	if req.VPCID == "" && req.VPCTag != "" {
+		id, err := resolveVPC(readClient(req), req.VPCTag)
+		if err != nil {
+			deliver(m.Subject+".error", errorResponse(body, err))
+			return
+		}
+		req.VPCID = id
+	}
+	if req.VPCID == "" {
+		deliver(m.Subject+".error", errorResponse(body, newError(errPayload, "Network sync needs a vpc_id or vpc_tag")))
+		return
+	}
+
+	desired, err := desiredNetworks(event.Networks)
+	if err != nil {
+		deliver(m.Subject+".error", errorResponse(body, err))
+		return
+	}
+
+	resp, err := readClient(req).DescribeSubnets(&ec2.DescribeSubnetsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(req.VPCID)}}},
+	})
+	if err != nil {
+		deliver(m.Subject+".error", errorResponse(body, err))
+		return
+	}
+
+	var live []*ec2.Subnet
+	for _, s := range resp.Subnets {
+		if createdForService(s.Tags, req.Service) {
+			live = append(live, s)
+		}
+	}
+
+	actions, unchanged := syncPlan(req.VPCID, desired, live)
+	fields := map[string]interface{}{
+		"vpc_id":    req.VPCID,
+		"actions":   actions,
+		"unchanged": unchanged,
+	}
+
+	if !event.Apply || len(actions) == 0 {
+		deliver(m.Subject+".done", setFields(body, fields))
+		return
+	}
+
+	// child events carry the credentials as the sync event sealed them
+	legacy, _ := fromGenericFields(m.Data)
+	removals, additions := syncEvents(legacy, req, event.Networks, actions)
+	if err := policyForSync(append(removals, additions...)); err != nil {
+		deliver(m.Subject+".error", errorResponse(body, err))
+		return
+	}
+
+	failed := issue(removals, cfg.SyncTimeout)
+	if failed {
+		for _, e := range additions {
+			if e.action.Status != resultFailed {
+				e.action.Status = resultSkipped
+			}
+		}
+	} else {
+		failed = issue(additions, cfg.SyncTimeout)
+	}
+
+	fields["applied"] = true
+	if failed {
+		deliver(m.Subject+".error", setFields(errorResponse(body, errors.New("Some networks could not be synced")), fields))
+		return
+	}
+	deliver(m.Subject+".done", setFields(body, fields))
+}
+
+// policyForSync refuses to apply a sync when the connector policy or a
+// change freeze doesn't allow one of the events it issues, before any is
+// issued
+func policyForSync(events []syncEvent) error {
+	for _, e := range events {
+		r := parseRequest(e.data)
+		if err := checkPolicy(cfg, e.subject, r); err != nil {
+			return err
+		}
+		if until, frozen := frozenUntil(cfg.FreezeWindows, r, time.Now()); frozen {
+			return newError(errFreeze, "Changes to "+r.DatacenterRegion+" are frozen until "+until.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// desiredNetworks parses the desired networks, which are told apart by
+// their range
+func desiredNetworks(networks []json.RawMessage) ([]request, error) {
+	var desired []request
+	seen := make(map[string]bool)
+
+	for i, raw := range networks {
+		n := parseRequest(raw)
+		if n.Subnet == "" {
+			return nil, newFieldError(errPayload, "networks", "Network "+strconv.Itoa(i)+" has no range")
+		}
+		if seen[n.Subnet] {
+			return nil, newFieldError(errPayload, "networks", "Range "+n.Subnet+" is desired more than once")
+		}
+		seen[n.Subnet] = true
+		desired = append(desired, n)
+	}
+
+	return desired, nil
+}
+
+// syncPlan matches the desired networks with the live ones by range and
+// returns the deletes, replaces, creates and updates converging them, in
+// that order, along with the number of networks already converged
+func syncPlan(vpc string, desired []request, live []*ec2.Subnet) ([]syncAction, int) {
+	var deletes, replaces, creates, updates []syncAction
+	var unchanged int
+	matched := make(map[string]bool)
+
+	for i, d := range desired {
+		d.VPCID = vpc
+
+		var subnet *ec2.Subnet
+		for _, s := range live {
+			if aws.StringValue(s.CidrBlock) == d.Subnet {
+				subnet = s
+			}
+		}
+
+		if subnet == nil {
+			creates = append(creates, syncAction{Action: syncCreate, Name: d.Name, Range: d.Subnet, desired: i})
+			continue
+		}
+
+		id := aws.StringValue(subnet.SubnetId)
+		matched[id] = true
+
+		changes := diffNetwork(d, subnet)
+		action := syncAction{Name: d.Name, Range: d.Subnet, NetworkAWSID: id, Changes: changes, desired: i}
+		switch {
+		case len(changedFields(changes, changeRecreate)) > 0:
+			action.Action = syncReplace
+			replaces = append(replaces, action)
+		case len(changedFields(changes, changeInPlace)) > 0:
+			action.Action = syncUpdate
+			updates = append(updates, action)
+		default:
+			unchanged++
+		}
+	}
+
+	for _, s := range live {
+		id := aws.StringValue(s.SubnetId)
+		if matched[id] {
+			continue
+		}
+		deletes = append(deletes, syncAction{
+			Action:       syncDelete,
+			Name:         tagMap(s.Tags)["Name"],
+			Range:        aws.StringValue(s.CidrBlock),
+			NetworkAWSID: id,
+			desired:      -1,
+		})
+	}
+
+	actions := append(deletes, replaces...)
+	actions = append(actions, creates...)
+	return append(actions, updates...), unchanged
+}
+
+// syncEvents crafts the network events applying the actions, carrying the
+// credentials and metadata of the sync event: the deletes, including
+// those of replaces, and then the creates and updates
+func syncEvents(base []byte, r request, networks []json.RawMessage, actions []syncAction) ([]syncEvent, []syncEvent) {
+	var removals, additions []syncEvent
+
+	for i := range actions {
+		a := &actions[i]
+
+		craft := func(v string, fields map[string]interface{}) syncEvent {
+			id := r.UUID + "-" + strconv.Itoa(i) + "-" + v
+			fields["_uuid"] = id
+			fields["vpc_id"] = r.VPCID
+
+			body := make(map[string]interface{})
+			json.Unmarshal(base, &body)
+			for _, f := range []string{"networks", "apply", "vpc_tag"} {
+				delete(body, f)
+			}
+			for k, v := range fields {
+				body[k] = v
+			}
+			data, _ := json.Marshal(body)
+
+			a.Events = append(a.Events, id)
+			return syncEvent{subject: "network." + v + ".aws", uuid: id, data: data, action: a}
+		}
+
+		desired := make(map[string]interface{})
+		if a.desired >= 0 {
+			json.Unmarshal(networks[a.desired], &desired)
+		}
+
+		switch a.Action {
+		case syncDelete, syncReplace:
+			removals = append(removals, craft("delete", map[string]interface{}{
+				"network_aws_id": a.NetworkAWSID,
+				"range":          a.Range,
+			}))
+		}
+
+		switch a.Action {
+		case syncCreate, syncReplace:
+			additions = append(additions, craft("create", desired))
+		case syncUpdate:
+			desired["network_aws_id"] = a.NetworkAWSID
+			additions = append(additions, craft("update", desired))
+		}
+	}
+
+	return removals, additions
+}
+
+// issue publishes the events and waits for their responses, recording
+// the outcome on their actions. It reports whether any of them failed.
+func issue(events []syncEvent, timeout time.Duration) bool {
+	if len(events) == 0 {
+		return false
+	}
+
+	replies := make(chan *nats.Msg, 64)
+	pending := make(map[string]syncEvent)
+	subscribed := make(map[string]bool)
+	for _, e := range events {
+		pending[e.uuid] = e
+		if subscribed[e.subject] {
+			continue
+		}
+		subscribed[e.subject] = true
+
+		for _, s := range []string{e.subject + ".done", e.subject + ".error"} {
+			if sub, err := nc.ChanSubscribe(s, replies); err == nil {
+				defer sub.Unsubscribe()
+			}
+		}
+	}
+
+	for _, e := range events {
+		nc.Publish(e.subject, e.data)
+	}
+
+	failed := false
+	expired := time.After(timeout)
+	for len(pending) > 0 {
+		select {
+		case reply := <-replies:
+			e, ok := pending[parseRequest(reply.Data).UUID]
+			if !ok {
+				continue
+			}
+			delete(pending, e.uuid)
+
+			if finalStatus(reply.Subject) == statusErrored {
+				e.action.Status, e.action.Error = resultFailed, failureMessage(reply.Data)
+				failed = true
+			} else if e.action.Status != resultFailed {
+				e.action.Status = resultApplied
+			}
+		case <-expired:
+			for _, e := range pending {
+				e.action.Status, e.action.Error = resultFailed, "No response within "+timeout.String()
+			}
+			return true
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,134 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func liveSubnet(id, cidr, az, name string) *ec2.Subnet {
+	return &ec2.Subnet{
+		SubnetId:         aws.String(id),
+		VpcId:            aws.String("vpc-00000000"),
+		CidrBlock:        aws.String(cidr),
+		AvailabilityZone: aws.String(az),
+		Tags:             []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(name)}},
+	}
+}
+
+func TestSyncPlan(t *testing.T) {
+	Convey("Given the live networks of a VPC", t, func() {
+		live := []*ec2.Subnet{
+			liveSubnet("subnet-00000000", "10.0.0.0/24", "eu-west-1a", "web"),
+			liveSubnet("subnet-11111111", "10.0.1.0/24", "eu-west-1a", "db"),
+			liveSubnet("subnet-22222222", "10.0.2.0/24", "eu-west-1a", "cache"),
+			liveSubnet("subnet-33333333", "10.0.3.0/24", "eu-west-1a", "old"),
+		}
+
+		Convey("When the desired networks differ from them", func() {
+			desired := []request{
+				{Name: "web", Subnet: "10.0.0.0/24"},
+				{Name: "database", Subnet: "10.0.1.0/24"},
+				{Name: "cache", Subnet: "10.0.2.0/24", AvailabilityZone: "eu-west-1b"},
+				{Name: "api", Subnet: "10.0.4.0/24"},
+			}
+			actions, unchanged := syncPlan("vpc-00000000", desired, live)
+
+			Convey("It should delete, replace, create and update in that order", func() {
+				var summary []string
+				for _, a := range actions {
+					summary = append(summary, a.Action+" "+a.Range)
+				}
+				So(summary, ShouldResemble, []string{
+					"delete 10.0.3.0/24",
+					"replace 10.0.2.0/24",
+					"create 10.0.4.0/24",
+					"update 10.0.1.0/24",
+				})
+				So(unchanged, ShouldEqual, 1)
+			})
+
+			Convey("It should report the changes of updated networks", func() {
+				So(actions[3].NetworkAWSID, ShouldEqual, "subnet-11111111")
+				So(changedFields(actions[3].Changes, changeInPlace), ShouldResemble, []string{"name"})
+			})
+		})
+	})
+}
+
+func TestDesiredNetworks(t *testing.T) {
+	Convey("Given desired networks sharing a range", t, func() {
+		networks := []json.RawMessage{
+			json.RawMessage(`{"name":"web","range":"10.0.0.0/24"}`),
+			json.RawMessage(`{"name":"api","range":"10.0.0.0/24"}`),
+		}
+
+		Convey("It should refuse them", func() {
+			_, err := desiredNetworks(networks)
+			So(err, ShouldNotBeNil)
+			So(err.(*connectorError).field, ShouldEqual, "networks")
+		})
+	})
+}
+
+func TestSyncEvents(t *testing.T) {
+	Convey("Given the actions of a sync", t, func() {
+		base := []byte(`{"_uuid":"sync-1","datacenter_secret":"key","vpc_tag":"env=prod","networks":[],"apply":true}`)
+		r := request{UUID: "sync-1", VPCID: "vpc-00000000"}
+		networks := []json.RawMessage{json.RawMessage(`{"name":"cache","range":"10.0.2.0/24","availability_zone":"eu-west-1b"}`)}
+		actions := []syncAction{
+			{Action: syncReplace, Range: "10.0.2.0/24", NetworkAWSID: "subnet-22222222", desired: 0},
+		}
+
+		Convey("When the events applying them are crafted", func() {
+			removals, additions := syncEvents(base, r, networks, actions)
+
+			Convey("It should delete before creating the replaced network", func() {
+				So(len(removals), ShouldEqual, 1)
+				So(len(additions), ShouldEqual, 1)
+				So(removals[0].subject, ShouldEqual, "network.delete.aws")
+				So(additions[0].subject, ShouldEqual, "network.create.aws")
+				So(actions[0].Events, ShouldResemble, []string{"sync-1-0-delete", "sync-1-0-create"})
+			})
+
+			Convey("It should carry the credentials and the desired network", func() {
+				create := parseRequest(additions[0].data)
+				So(create.UUID, ShouldEqual, "sync-1-0-create")
+				So(create.DatacenterAccessKey, ShouldEqual, "key")
+				So(create.VPCID, ShouldEqual, "vpc-00000000")
+				So(create.AvailabilityZone, ShouldEqual, "eu-west-1b")
+				So(string(additions[0].data), ShouldNotContainSubstring, "networks")
+				So(string(additions[0].data), ShouldNotContainSubstring, "vpc_tag")
+			})
+		})
+
+		Convey("When the policy refuses the network a create would add", func() {
+			pattern := cfg.NamePattern
+			cfg.NamePattern = "^web-"
+			defer func() { cfg.NamePattern = pattern }()
+
+			removals, additions := syncEvents(base, r, networks, actions)
+			err := policyForSync(append(removals, additions...))
+
+			Convey("It should refuse to apply the sync", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errPolicy)
+			})
+		})
+
+		Convey("When the policy allows every event", func() {
+			removals, additions := syncEvents(base, r, networks, actions)
+
+			Convey("It should let the sync apply", func() {
+				So(policyForSync(append(removals, additions...)), ShouldBeNil)
+			})
+		})
+	})
+}
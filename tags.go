@@ -0,0 +1,141 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// resourceTags returns the tags of the network resources: the tags of the
+// event, its name, the ernest service and batch it belongs to and the
+// environment tag the connector is scoped to
+func resourceTags(r request) map[string]string {
+	tags := make(map[string]string)
+	for k, v := range r.Tags {
+		tags[k] = v
+	}
+
+	if r.Name != "" {
+		tags["Name"] = r.Name
+	}
+	if r.Service != "" {
+		tags["ernest.service"] = r.Service
+	}
+	if r.BatchID != "" {
+		tags["ernest.batch_id"] = r.BatchID
+	}
+	if cfg.Scope.enabled() {
+		tags[cfg.Scope.Key] = cfg.Scope.Value
+	}
+
+	return tags
+}
+
+// tagNetwork tags the network along with the route table and internet
+// gateway only it uses, which also renames them when its name changed.
+// Companions are only tagged when they already carry the ernest tags, or
+// when they were created along with the network, not being among the
+// route tables and internet gateways the VPC had before: reusing a user's
+// resource doesn't make it ernest's to delete.
+func tagNetwork(client ec2API, id string, tags map[string]string, preexisting map[string]bool) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	subnet, err := describeSubnet(client, id)
+	if err != nil || subnet == nil {
+		return err
+	}
+
+	tables, igws, err := vpcRouting(client, aws.StringValue(subnet.VpcId))
+	if err != nil {
+		return err
+	}
+
+	return tag(client, owned(subnet, tables, igws, preexisting), tags)
+}
+
+// vpcRouting describes the route tables and internet gateways of the VPC
+func vpcRouting(client ec2API, vpc string) ([]*ec2.RouteTable, []*ec2.InternetGateway, error) {
+	tables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpc)}},
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	igws, err := client.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("attachment.vpc-id"), Values: []*string{aws.String(vpc)}},
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tables.RouteTables, igws.InternetGateways, nil
+}
+
+// routingIDs returns the ids of the route tables and internet gateways of
+// the VPC, recorded before a create to tell apart the ones it adds
+func routingIDs(client ec2API, vpc string) (map[string]bool, error) {
+	tables, igws, err := vpcRouting(client, vpc)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for _, t := range tables {
+		ids[aws.StringValue(t.RouteTableId)] = true
+	}
+	for _, g := range igws {
+		ids[aws.StringValue(g.InternetGatewayId)] = true
+	}
+	return ids, nil
+}
+
+// owned returns the ids of the subnet and of the companions only it uses
+// that ernest created: those already carrying its tags and, on create,
+// those missing from the preexisting ones
+func owned(subnet *ec2.Subnet, tables []*ec2.RouteTable, igws []*ec2.InternetGateway, preexisting map[string]bool) []string {
+	created := make(map[string]bool)
+	for _, t := range tables {
+		id := aws.StringValue(t.RouteTableId)
+		created[id] = createdByErnest(t.Tags) || (preexisting != nil && !preexisting[id])
+	}
+	for _, g := range igws {
+		id := aws.StringValue(g.InternetGatewayId)
+		created[id] = createdByErnest(g.Tags) || (preexisting != nil && !preexisting[id])
+	}
+
+	ids := []string{aws.StringValue(subnet.SubnetId)}
+	for _, p := range companions(subnet, tables, nil, anyTags) {
+		if p.Action == actionDelete && p.Type != "route" && p.Type != "subnet" && created[p.ID] {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
+
+// createdByErnest reports whether a resource carries the ernest tags the
+// connector adds to the resources it creates, within the environment
+// scope. Route tables and internet gateways without them are the user's.
+func createdByErnest(tags []*ec2.Tag) bool {
+	m := tagMap(tags)
+	return (m["ernest.service"] != "" || m["ernest.batch_id"] != "") && cfg.Scope.includes(m)
+}
+
+// createdForService reports whether ernest created the resource for the
+// service, or for any of them when none is given
+func createdForService(tags []*ec2.Tag, service string) bool {
+	return createdByErnest(tags) && (service == "" || tagMap(tags)["ernest.service"] == service)
+}
+
+func anyTags(tags []*ec2.Tag) bool {
+	return true
+}
@@ -0,0 +1,101 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResourceTags(t *testing.T) {
+	Convey("Given a network event with tags", t, func() {
+		r := request{
+			Name:    "web",
+			Service: "my-service",
+			BatchID: "batch-1",
+			Tags:    map[string]string{"team": "payments", "Name": "ignored"},
+		}
+
+		Convey("It should add its name and ernest metadata", func() {
+			So(resourceTags(r), ShouldResemble, map[string]string{
+				"Name":            "web",
+				"team":            "payments",
+				"ernest.service":  "my-service",
+				"ernest.batch_id": "batch-1",
+			})
+		})
+	})
+}
+
+func TestOwned(t *testing.T) {
+	Convey("Given a network being renamed", t, func() {
+		subnet := &ec2.Subnet{SubnetId: aws.String("subnet-00000000")}
+
+		Convey("When ernest created its own route table and internet gateway", func() {
+			tables := []*ec2.RouteTable{
+				routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000"),
+			}
+			tables[0].Tags = ernestTags()
+			igws := []*ec2.InternetGateway{ernestGateway("igw-00000000")}
+
+			Convey("It should retag all of them", func() {
+				So(owned(subnet, tables, igws, nil), ShouldResemble, []string{"subnet-00000000", "rtb-00000000", "igw-00000000"})
+			})
+		})
+
+		Convey("When the user created its route table and internet gateway", func() {
+			tables := []*ec2.RouteTable{
+				routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000"),
+			}
+			igws := []*ec2.InternetGateway{{InternetGatewayId: aws.String("igw-00000000")}}
+
+			Convey("It should only retag the subnet", func() {
+				So(owned(subnet, tables, igws, nil), ShouldResemble, []string{"subnet-00000000"})
+			})
+		})
+
+		Convey("When its route table is shared", func() {
+			tables := []*ec2.RouteTable{
+				routeTable("rtb-00000000", []string{"subnet-00000000", "subnet-11111111"}, "igw-00000000"),
+			}
+			tables[0].Tags = ernestTags()
+
+			Convey("It should only retag the subnet", func() {
+				So(owned(subnet, tables, nil, nil), ShouldResemble, []string{"subnet-00000000"})
+			})
+		})
+	})
+
+	Convey("Given a network just created through an existing internet gateway", t, func() {
+		subnet := &ec2.Subnet{SubnetId: aws.String("subnet-00000000")}
+		tables := []*ec2.RouteTable{
+			routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000"),
+		}
+		igws := []*ec2.InternetGateway{{InternetGatewayId: aws.String("igw-00000000")}}
+
+		Convey("It should tag the route table created with it but not the gateway", func() {
+			So(owned(subnet, tables, igws, map[string]bool{"igw-00000000": true}), ShouldResemble, []string{"subnet-00000000", "rtb-00000000"})
+		})
+	})
+}
+
+func TestLastOpTags(t *testing.T) {
+	Convey("Given an update of a network", t, func() {
+		r := request{BatchID: "batch-1"}
+		now := time.Date(2017, 3, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+
+		Convey("It should tag the operation, its build and when in UTC", func() {
+			So(lastOpTags("network.update.aws", r, now), ShouldResemble, map[string]string{
+				"ernest.last_op":       "update",
+				"ernest.last_batch_id": "batch-1",
+				"ernest.last_op_at":    "2017-03-01T11:30:00Z",
+			})
+		})
+	})
+}
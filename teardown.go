@@ -0,0 +1,245 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Deletes remove the routing of their network in a fixed order, each step
+// skipping what an earlier attempt already removed: markTeardown tags the
+// route table and internet gateway to remove, teardownRouting deletes the
+// flow logs, then the routes of the route table, disassociates it from
+// the subnet and deletes it, the interfaces of the subnet are waited for
+// and ernestaws deletes the subnet, then teardownGateways detaches and
+// deletes the internet gateway. Route tables and internet gateways are
+// handled with the routing client.
+//
+// teardownTag is what marks them with the network they belong to: once
+// the subnet is gone nothing else tells a retried delete which ones were
+// its own.
+const teardownTag = "ernest.teardown"
+
+// markTeardown tags the route tables and internet gateways the plan
+// deletes with the network they belong to
+func markTeardown(routing ec2API, r request, plan []plannedResource) error {
+	var ids []*string
+	for _, p := range plan {
+		if (p.Type == "route_table" || p.Type == "internet_gateway") && p.Action == actionDelete {
+			ids = append(ids, aws.String(p.ID))
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := routing.CreateTags(&ec2.CreateTagsInput{
+		Resources: ids,
+		Tags:      []*ec2.Tag{{Key: aws.String(teardownTag), Value: aws.String(r.NetworkAWSID)}},
+	})
+	return err
+}
+
+// teardownRouting deletes the flow logs and route tables the plan
+// deletes, before the subnet
+func teardownRouting(client, routing ec2API, r request, plan []plannedResource) error {
+	var flowLogs []*string
+	for _, p := range plan {
+		if p.Type == "flow_log" && p.Action == actionDelete {
+			flowLogs = append(flowLogs, aws.String(p.ID))
+		}
+	}
+
+	if len(flowLogs) > 0 {
+		_, err := client.DeleteFlowLogs(&ec2.DeleteFlowLogsInput{FlowLogIds: flowLogs})
+		if err != nil && !gone(err) {
+			return err
+		}
+	}
+
+	for _, p := range plan {
+		if p.Type != "route_table" || p.Action != actionDelete {
+			continue
+		}
+		if err := removeRouteTable(routing, r, p.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeRouteTable deletes the routes of the route table, disassociates
+// it from the network and deletes it. Gateway endpoint routes go with
+// their endpoint and are left to the route table delete.
+func removeRouteTable(routing ec2API, r request, id string) error {
+	resp, err := routing.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		RouteTableIds: []*string{aws.String(id)},
+	})
+	if gone(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, t := range resp.RouteTables {
+		for _, route := range t.Routes {
+			gateway := aws.StringValue(route.GatewayId)
+			if gateway == "local" || strings.HasPrefix(gateway, "vpce-") {
+				continue
+			}
+
+			_, err := routing.DeleteRoute(&ec2.DeleteRouteInput{
+				RouteTableId:             t.RouteTableId,
+				DestinationCidrBlock:     route.DestinationCidrBlock,
+				DestinationIpv6CidrBlock: route.DestinationIpv6CidrBlock,
+				DestinationPrefixListId:  route.DestinationPrefixListId,
+			})
+			if err != nil && !gone(err) {
+				return err
+			}
+		}
+
+		for _, a := range t.Associations {
+			if aws.StringValue(a.SubnetId) != r.NetworkAWSID {
+				continue
+			}
+
+			_, err := routing.DisassociateRouteTable(&ec2.DisassociateRouteTableInput{
+				AssociationId: a.RouteTableAssociationId,
+			})
+			if err != nil && !gone(err) {
+				return err
+			}
+		}
+	}
+
+	_, err = routing.DeleteRouteTable(&ec2.DeleteRouteTableInput{
+		RouteTableId: aws.String(id),
+	})
+	if err != nil && !gone(err) {
+		return err
+	}
+
+	return nil
+}
+
+// teardownGateways detaches and deletes the internet gateways the plan
+// deletes, once the subnet is gone
+func teardownGateways(routing ec2API, r request, plan []plannedResource) error {
+	for _, p := range plan {
+		if p.Type != "internet_gateway" || p.Action != actionDelete {
+			continue
+		}
+
+		_, err := routing.DetachInternetGateway(&ec2.DetachInternetGatewayInput{
+			InternetGatewayId: aws.String(p.ID),
+			VpcId:             aws.String(r.VPCID),
+		})
+		if err != nil && !gone(err) {
+			return err
+		}
+
+		_, err = routing.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{
+			InternetGatewayId: aws.String(p.ID),
+		})
+		if err != nil && !gone(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// teardownLeftovers lists the route tables and internet gateways an
+// earlier attempt to delete the network marked and didn't get to remove.
+// A gateway another route table of the VPC routes through meanwhile is
+// kept.
+func teardownLeftovers(client ec2API, r request) ([]plannedResource, error) {
+	marked := []*ec2.Filter{
+		{Name: aws.String("tag:" + teardownTag), Values: []*string{aws.String(r.NetworkAWSID)}},
+	}
+
+	tables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: marked})
+	if err != nil {
+		return nil, err
+	}
+	igws, err := client.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{Filters: marked})
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []plannedResource
+	removed := make(map[string]bool)
+	for _, t := range tables.RouteTables {
+		if markedFor(t.Tags, r.NetworkAWSID) {
+			removed[aws.StringValue(t.RouteTableId)] = true
+			plan = append(plan, plannedResource{Type: "route_table", ID: aws.StringValue(t.RouteTableId), Action: actionDelete, Reason: "left by an interrupted delete"})
+		}
+	}
+
+	var routing []*ec2.RouteTable
+	for _, g := range igws.InternetGateways {
+		if !markedFor(g.Tags, r.NetworkAWSID) {
+			continue
+		}
+		if routing == nil {
+			vpc, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+				Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(r.VPCID)}}},
+			})
+			if err != nil {
+				return nil, err
+			}
+			routing = vpc.RouteTables
+		}
+
+		id := aws.StringValue(g.InternetGatewayId)
+		if usedByOtherTables(routing, removed, func(route *ec2.Route) bool { return aws.StringValue(route.GatewayId) == id }) {
+			plan = append(plan, plannedResource{Type: "internet_gateway", ID: id, Action: actionKeep, Reason: "used by other route tables"})
+			continue
+		}
+		plan = append(plan, plannedResource{Type: "internet_gateway", ID: id, Action: actionDelete, Reason: "left by an interrupted delete"})
+	}
+
+	return plan, nil
+}
+
+// teardownFinished tells whether nothing an interrupted delete of the
+// network marked is left to remove
+func teardownFinished(client ec2API, r request) (bool, error) {
+	leftovers, err := teardownLeftovers(client, r)
+	if err != nil {
+		return false, err
+	}
+	for _, l := range leftovers {
+		if l.Action == actionDelete {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func markedFor(tags []*ec2.Tag, network string) bool {
+	for _, t := range tags {
+		if aws.StringValue(t.Key) == teardownTag && aws.StringValue(t.Value) == network {
+			return true
+		}
+	}
+	return false
+}
+
+// gone tells whether a teardown step failed because an earlier attempt
+// already did it
+func gone(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return strings.HasSuffix(aerr.Code(), ".NotFound") || aerr.Code() == "Gateway.NotAttached"
+	}
+	return false
+}
@@ -0,0 +1,282 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// deletingEC2 removes what a delete removes, answering as AWS does for
+// what is already gone
+type deletingEC2 struct {
+	*teardownEC2
+}
+
+func (m deletingEC2) DisassociateRouteTable(in *ec2.DisassociateRouteTableInput) (*ec2.DisassociateRouteTableOutput, error) {
+	id := aws.StringValue(in.AssociationId)
+	m.record("DisassociateRouteTable", id)
+	for _, t := range m.tables {
+		for i, a := range t.Associations {
+			if aws.StringValue(a.RouteTableAssociationId) == id {
+				t.Associations = append(t.Associations[:i], t.Associations[i+1:]...)
+				return &ec2.DisassociateRouteTableOutput{}, nil
+			}
+		}
+	}
+	return nil, awserr.New("InvalidAssociationID.NotFound", "The association ID does not exist", nil)
+}
+
+func (m deletingEC2) DeleteRouteTable(in *ec2.DeleteRouteTableInput) (*ec2.DeleteRouteTableOutput, error) {
+	if err := m.record("DeleteRouteTable", aws.StringValue(in.RouteTableId)); err != nil {
+		return nil, err
+	}
+	for i, t := range m.tables {
+		if aws.StringValue(t.RouteTableId) == aws.StringValue(in.RouteTableId) {
+			m.tables = append(m.tables[:i], m.tables[i+1:]...)
+			return &ec2.DeleteRouteTableOutput{}, nil
+		}
+	}
+	return nil, awserr.New("InvalidRouteTableID.NotFound", "The routeTable ID does not exist", nil)
+}
+
+func (m deletingEC2) DeleteSubnet(in *ec2.DeleteSubnetInput) (*ec2.DeleteSubnetOutput, error) {
+	m.record("DeleteSubnet", aws.StringValue(in.SubnetId))
+	for i, s := range m.subnets {
+		if aws.StringValue(s.SubnetId) == aws.StringValue(in.SubnetId) {
+			m.subnets = append(m.subnets[:i], m.subnets[i+1:]...)
+			return &ec2.DeleteSubnetOutput{}, nil
+		}
+	}
+	return nil, awserr.New("InvalidSubnetID.NotFound", "The subnet ID does not exist", nil)
+}
+
+func (m deletingEC2) DetachInternetGateway(in *ec2.DetachInternetGatewayInput) (*ec2.DetachInternetGatewayOutput, error) {
+	m.record("DetachInternetGateway", aws.StringValue(in.InternetGatewayId))
+	for _, g := range m.gateways {
+		if aws.StringValue(g.InternetGatewayId) == aws.StringValue(in.InternetGatewayId) && len(g.Attachments) > 0 {
+			g.Attachments = nil
+			return &ec2.DetachInternetGatewayOutput{}, nil
+		}
+	}
+	return nil, awserr.New("Gateway.NotAttached", "resource is not attached to network", nil)
+}
+
+func (m deletingEC2) DeleteInternetGateway(in *ec2.DeleteInternetGatewayInput) (*ec2.DeleteInternetGatewayOutput, error) {
+	if err := m.record("DeleteInternetGateway", aws.StringValue(in.InternetGatewayId)); err != nil {
+		return nil, err
+	}
+	for i, g := range m.gateways {
+		if aws.StringValue(g.InternetGatewayId) == aws.StringValue(in.InternetGatewayId) {
+			m.gateways = append(m.gateways[:i], m.gateways[i+1:]...)
+			return &ec2.DeleteInternetGatewayOutput{}, nil
+		}
+	}
+	return nil, awserr.New("InvalidInternetGatewayID.NotFound", "The internetGateway ID does not exist", nil)
+}
+
+// deleteNetwork deletes the network in the order a delete event does,
+// standing in for ernestaws to delete the subnet
+func deleteNetwork(client ec2API, r request) error {
+	plan, err := planDelete(client, r)
+	if err != nil {
+		return err
+	}
+	if err := markTeardown(client, r, plan); err != nil {
+		return err
+	}
+	if err := teardownRouting(client, client, r, plan); err != nil {
+		return err
+	}
+	if _, err := client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: aws.String(r.NetworkAWSID)}); err != nil && !gone(err) {
+		return err
+	}
+	return teardownGateways(client, r, plan)
+}
+
+func TestTeardown(t *testing.T) {
+	r := request{NetworkAWSID: "subnet-00000000", VPCID: "vpc-00000000"}
+
+	subnet := func() *ec2.Subnet {
+		return &ec2.Subnet{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-00000000")}
+	}
+	tagged := func(t *ec2.RouteTable) *ec2.RouteTable {
+		t.Tags = ernestTags()
+		return t
+	}
+	attached := func(g *ec2.InternetGateway) *ec2.InternetGateway {
+		g.Attachments = []*ec2.InternetGatewayAttachment{{VpcId: aws.String("vpc-00000000")}}
+		return g
+	}
+
+	Convey("Given a network with its own route table and internet gateway, created by ernest", t, func() {
+		client := &teardownEC2{mockEC2: mockEC2{
+			subnets:  []*ec2.Subnet{subnet()},
+			tables:   []*ec2.RouteTable{tagged(routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000"))},
+			gateways: []*ec2.InternetGateway{attached(ernestGateway("igw-00000000"))},
+		}}
+
+		Convey("When it is deleted", func() {
+			err := deleteNetwork(deletingEC2{client}, r)
+
+			Convey("It should remove the routes, route table, subnet and gateway in order", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{
+					"CreateTags rtb-00000000",
+					"CreateTags igw-00000000",
+					"DeleteRoute 0.0.0.0/0",
+					"DisassociateRouteTable rtbassoc-00000000",
+					"DeleteRouteTable rtb-00000000",
+					"DeleteSubnet subnet-00000000",
+					"DetachInternetGateway igw-00000000",
+					"DeleteInternetGateway igw-00000000",
+				})
+				So(client.tables, ShouldBeEmpty)
+				So(client.gateways, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the gateway delete fails once the subnet is gone", func() {
+			client.failing = "igw-00000000"
+			So(deleteNetwork(deletingEC2{client}, r), ShouldNotBeNil)
+			So(client.subnets, ShouldBeEmpty)
+
+			finished, err := teardownFinished(client, r)
+			So(err, ShouldBeNil)
+			So(finished, ShouldBeFalse)
+
+			Convey("And the delete is retried", func() {
+				client.failing, client.calls = "", nil
+				err := deleteNetwork(deletingEC2{client}, r)
+
+				Convey("It should remove the gateway it marked", func() {
+					So(err, ShouldBeNil)
+					So(client.calls, ShouldResemble, []string{
+						"CreateTags igw-00000000",
+						"DeleteSubnet subnet-00000000",
+						"DetachInternetGateway igw-00000000",
+						"DeleteInternetGateway igw-00000000",
+					})
+					So(client.gateways, ShouldBeEmpty)
+
+					finished, err := teardownFinished(client, r)
+					So(err, ShouldBeNil)
+					So(finished, ShouldBeTrue)
+				})
+			})
+		})
+
+		Convey("When the route table delete fails once it is disassociated", func() {
+			client.failing = "rtb-00000000"
+			So(deleteNetwork(deletingEC2{client}, r), ShouldNotBeNil)
+			So(client.subnets, ShouldHaveLength, 1)
+
+			Convey("And the delete is retried", func() {
+				client.failing, client.calls = "", nil
+				err := deleteNetwork(deletingEC2{client}, r)
+
+				Convey("It should still remove the route table and gateway it marked", func() {
+					So(err, ShouldBeNil)
+					So(client.calls, ShouldResemble, []string{
+						"CreateTags rtb-00000000",
+						"CreateTags igw-00000000",
+						"DeleteRouteTable rtb-00000000",
+						"DeleteSubnet subnet-00000000",
+						"DetachInternetGateway igw-00000000",
+						"DeleteInternetGateway igw-00000000",
+					})
+					So(client.tables, ShouldBeEmpty)
+					So(client.gateways, ShouldBeEmpty)
+				})
+			})
+		})
+	})
+
+	Convey("Given a network whose route table is shared with another network", t, func() {
+		client := &teardownEC2{mockEC2: mockEC2{
+			subnets:  []*ec2.Subnet{subnet()},
+			tables:   []*ec2.RouteTable{tagged(routeTable("rtb-00000000", []string{"subnet-00000000", "subnet-11111111"}, "igw-00000000"))},
+			gateways: []*ec2.InternetGateway{attached(ernestGateway("igw-00000000"))},
+		}}
+
+		Convey("When it is deleted", func() {
+			err := deleteNetwork(deletingEC2{client}, r)
+
+			Convey("It should only remove the subnet", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{"DeleteSubnet subnet-00000000"})
+			})
+		})
+	})
+
+	Convey("Given a network routed by the main route table", t, func() {
+		table := tagged(routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000"))
+		table.Associations = append(table.Associations, &ec2.RouteTableAssociation{Main: aws.Bool(true)})
+		client := &teardownEC2{mockEC2: mockEC2{
+			subnets:  []*ec2.Subnet{subnet()},
+			tables:   []*ec2.RouteTable{table},
+			gateways: []*ec2.InternetGateway{attached(ernestGateway("igw-00000000"))},
+		}}
+
+		Convey("When it is deleted", func() {
+			err := deleteNetwork(deletingEC2{client}, r)
+
+			Convey("It should only remove the subnet", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{"DeleteSubnet subnet-00000000"})
+			})
+		})
+	})
+
+	Convey("Given a network routed by a route table the user created", t, func() {
+		client := &teardownEC2{mockEC2: mockEC2{
+			subnets:  []*ec2.Subnet{subnet()},
+			tables:   []*ec2.RouteTable{routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")},
+			gateways: []*ec2.InternetGateway{attached(ernestGateway("igw-00000000"))},
+		}}
+
+		Convey("When it is deleted", func() {
+			err := deleteNetwork(deletingEC2{client}, r)
+
+			Convey("It should only remove the subnet", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{"DeleteSubnet subnet-00000000"})
+			})
+		})
+	})
+
+	Convey("Given a VPC routing through an internet gateway the user created", t, func() {
+		client := &teardownEC2{mockEC2: mockEC2{gateways: []*ec2.InternetGateway{attached(&ec2.InternetGateway{InternetGatewayId: aws.String("igw-00000000")})}}}
+		preexisting, err := routingIDs(client, "vpc-00000000")
+		So(err, ShouldBeNil)
+
+		Convey("When a public network is created through it and then deleted", func() {
+			// ernestaws creates the subnet and a route table through the gateway
+			client.subnets = []*ec2.Subnet{subnet()}
+			client.tables = []*ec2.RouteTable{routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")}
+			So(tagNetwork(client, "subnet-00000000", resourceTags(request{Service: "web"}), preexisting), ShouldBeNil)
+
+			client.calls = nil
+			err := deleteNetwork(deletingEC2{client}, r)
+
+			Convey("It should remove the route table created with it and keep the gateway", func() {
+				So(err, ShouldBeNil)
+				So(client.calls, ShouldResemble, []string{
+					"CreateTags rtb-00000000",
+					"DeleteRoute 0.0.0.0/0",
+					"DisassociateRouteTable rtbassoc-00000000",
+					"DeleteRouteTable rtb-00000000",
+					"DeleteSubnet subnet-00000000",
+				})
+				So(client.gateways, ShouldHaveLength, 1)
+				So(tagMap(client.gateways[0].Tags), ShouldBeEmpty)
+			})
+		})
+	})
+}
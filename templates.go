@@ -0,0 +1,93 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// templateFields are the event fields a network template may default
+var templateFields = []string{
+	"tags",
+	"is_public",
+	"egress_nat_gateway_id",
+	"routes",
+	"assign_ipv6_on_launch",
+	"enable_resource_name_dns_a_record",
+	"enable_resource_name_dns_aaaa_record",
+	"wait_for",
+	"purpose",
+	"eks_cluster",
+}
+
+// envTemplates reads the network templates, a JSON object of named sets
+// of event field defaults
+func envTemplates(name string) map[string]map[string]interface{} {
+	templates := make(map[string]map[string]interface{})
+	v := os.Getenv(name)
+	if v == "" {
+		return templates
+	}
+
+	if err := json.Unmarshal([]byte(v), &templates); err != nil {
+		fmt.Println("invalid " + name + " value, ignoring it")
+		return make(map[string]map[string]interface{})
+	}
+
+	for t, fields := range templates {
+		for f := range fields {
+			if !contains(templateFields, f) {
+				fmt.Println("ignoring field " + f + " of " + name + " template " + t)
+				delete(fields, f)
+			}
+		}
+	}
+	return templates
+}
+
+// applyTemplate fills in the fields the event omits from the template it
+// references. Tags are merged, those of the event winning.
+func applyTemplate(data []byte, templates map[string]map[string]interface{}) ([]byte, error) {
+	var event struct {
+		Template string            `json:"template"`
+		Tags     map[string]string `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil || event.Template == "" {
+		return data, nil
+	}
+
+	template, ok := templates[event.Template]
+	if !ok {
+		return data, newFieldError(errPayload, "template", "Network template "+event.Template+" is not defined")
+	}
+
+	present := make(map[string]json.RawMessage)
+	json.Unmarshal(data, &present)
+
+	fields := make(map[string]interface{})
+	for f, v := range template {
+		if _, ok := present[f]; !ok {
+			fields[f] = v
+		}
+	}
+
+	if tags, ok := template["tags"].(map[string]interface{}); ok && event.Tags != nil {
+		merged := make(map[string]interface{})
+		for k, v := range tags {
+			merged[k] = v
+		}
+		for k, v := range event.Tags {
+			merged[k] = v
+		}
+		fields["tags"] = merged
+	}
+
+	if len(fields) == 0 {
+		return data, nil
+	}
+	return setFields(data, fields), nil
+}
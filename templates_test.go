@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNetworkTemplates(t *testing.T) {
+	Convey("Given a public web template", t, func() {
+		os.Setenv("NETWORK_TEMPLATES", `{"public-web":{"is_public":true,"tags":{"tier":"web","owner":"platform"},"wait_for":["nat_gateway_available"],"range":"10.0.0.0/8"}}`)
+		defer os.Unsetenv("NETWORK_TEMPLATES")
+		templates := envTemplates("NETWORK_TEMPLATES")
+
+		Convey("It should only keep the fields templates may default", func() {
+			So(templates["public-web"], ShouldNotContainKey, "range")
+			So(templates["public-web"], ShouldContainKey, "is_public")
+		})
+
+		Convey("When an event references it", func() {
+			data, err := applyTemplate([]byte(`{"template":"public-web","range":"10.1.0.0/24","tags":{"owner":"shop"}}`), templates)
+			r := parseRequest(data)
+
+			Convey("It should fill in the omitted fields", func() {
+				So(err, ShouldBeNil)
+				So(r.IsPublic, ShouldBeTrue)
+				So(r.WaitFor, ShouldResemble, []string{"nat_gateway_available"})
+				So(r.Subnet, ShouldEqual, "10.1.0.0/24")
+			})
+
+			Convey("It should merge the tags, those of the event winning", func() {
+				So(r.Tags, ShouldResemble, map[string]string{"tier": "web", "owner": "shop"})
+			})
+		})
+
+		Convey("When an event sets a templated field", func() {
+			data, _ := applyTemplate([]byte(`{"template":"public-web","is_public":false}`), templates)
+
+			Convey("It should keep its own value", func() {
+				So(parseRequest(data).IsPublic, ShouldBeFalse)
+			})
+		})
+
+		Convey("When an event references an unknown template", func() {
+			_, err := applyTemplate([]byte(`{"template":"private-db"}`), templates)
+
+			Convey("It should be refused", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "private-db")
+			})
+		})
+
+		Convey("When an event references no template", func() {
+			data, err := applyTemplate([]byte(`{"range":"10.1.0.0/24"}`), templates)
+
+			Convey("It should be left alone", func() {
+				So(err, ShouldBeNil)
+				So(string(data), ShouldEqual, `{"range":"10.1.0.0/24"}`)
+			})
+		})
+	})
+}
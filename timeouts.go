@@ -0,0 +1,76 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+)
+
+// callTimeout returns how long a single AWS call of the operation may take,
+// SDK retries included. An exact OPERATION_TIMEOUTS entry wins over the
+// longest matching prefix entry, such as Describe* or *, and
+// CALL_TIMEOUT applies to the rest. 0 means no timeout.
+func (c config) callTimeout(operation string) time.Duration {
+	if d, ok := c.APITimeouts[operation]; ok {
+		return d
+	}
+
+	match, found := "", false
+	for k := range c.APITimeouts {
+		prefix := strings.TrimSuffix(k, "*")
+		if prefix != k && strings.HasPrefix(operation, prefix) && len(prefix) >= len(match) {
+			match, found = prefix, true
+		}
+	}
+	if !found {
+		return c.CallTimeout
+	}
+
+	return c.APITimeouts[match+"*"]
+}
+
+// timeoutHandler bounds every AWS call with the timeout of its operation,
+// so a slow describe fails and is retried on its own instead of eating
+// the time the event has for the waits that legitimately take long
+func timeoutHandler(c config) func(*awsrequest.Request) {
+	return func(req *awsrequest.Request) {
+		if req.Operation == nil {
+			return
+		}
+		timeout := c.callTimeout(req.Operation.Name)
+		if timeout <= 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		req.SetContext(ctx)
+		req.Handlers.Complete.PushBack(func(*awsrequest.Request) { cancel() })
+	}
+}
+
+// envTimeouts reads a comma separated list of operation=duration pairs
+func envTimeouts(name string) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for _, v := range envList(name) {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			fmt.Println("invalid " + name + " entry " + v + ", ignoring it")
+			continue
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			fmt.Println("invalid " + name + " entry " + v + ", ignoring it")
+			continue
+		}
+		timeouts[strings.TrimSpace(parts[0])] = d
+	}
+	return timeouts
+}
@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCallTimeouts(t *testing.T) {
+	Convey("Given timeouts for describes, a single call and the rest", t, func() {
+		os.Setenv("OPERATION_TIMEOUTS", "Describe*=10s, DescribeNatGateways=1m, DeleteNat*=2m, *=30s, bad")
+		defer os.Unsetenv("OPERATION_TIMEOUTS")
+		c := config{APITimeouts: envTimeouts("OPERATION_TIMEOUTS"), CallTimeout: time.Minute}
+
+		Convey("It should ignore invalid entries", func() {
+			So(c.APITimeouts, ShouldHaveLength, 4)
+		})
+
+		Convey("It should prefer exact entries over prefixes", func() {
+			So(c.callTimeout("DescribeNatGateways"), ShouldEqual, time.Minute)
+			So(c.callTimeout("DescribeSubnets"), ShouldEqual, 10*time.Second)
+		})
+
+		Convey("It should prefer the longest prefix", func() {
+			So(c.callTimeout("DeleteNatGateway"), ShouldEqual, 2*time.Minute)
+			So(c.callTimeout("CreateRoute"), ShouldEqual, 30*time.Second)
+		})
+	})
+
+	Convey("Given only a timeout for every call", t, func() {
+		c := config{CallTimeout: 20 * time.Second}
+
+		Convey("It should apply to any operation", func() {
+			So(c.callTimeout("CreateRoute"), ShouldEqual, 20*time.Second)
+		})
+
+		Convey("When an AWS call is built", func() {
+			req := &awsrequest.Request{Operation: &awsrequest.Operation{Name: "DescribeSubnets"}}
+			timeoutHandler(c)(req)
+
+			Convey("It should be bounded by it", func() {
+				deadline, ok := req.Context().Deadline()
+				So(ok, ShouldBeTrue)
+				So(deadline.Before(time.Now().Add(21*time.Second)), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given no timeouts", t, func() {
+		Convey("When an AWS call is built", func() {
+			req := &awsrequest.Request{Operation: &awsrequest.Operation{Name: "DescribeSubnets"}}
+			timeoutHandler(config{})(req)
+
+			Convey("It should be left unbounded", func() {
+				_, ok := req.Context().Deadline()
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
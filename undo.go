@@ -0,0 +1,139 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// undoStep is a resource a create made, along with how to remove it
+type undoStep struct {
+	resource plannedResource
+	undo     func() error
+}
+
+// undoLog records what the connector creates while handling a create, so
+// a failed create can be rolled back in reverse order
+type undoLog struct {
+	steps []undoStep
+}
+
+func (u *undoLog) add(kind, id string, undo func() error) {
+	if u == nil {
+		return
+	}
+	u.steps = append(u.steps, undoStep{
+		resource: plannedResource{Type: kind, ID: id, Action: actionDelete},
+		undo:     undo,
+	})
+}
+
+// wrap returns the client recording in the log the route tables,
+// associations, routes and prefix list entries it creates
+func (u *undoLog) wrap(client ec2API) ec2API {
+	if u == nil {
+		return client
+	}
+	return &recordingEC2{ec2API: client, log: u}
+}
+
+// run removes what was recorded, latest first. It carries on past
+// failures, returning the resources removed and the first error.
+func (u *undoLog) run() ([]plannedResource, error) {
+	removed := []plannedResource{}
+	if u == nil {
+		return removed, nil
+	}
+
+	var failed error
+	for i := len(u.steps) - 1; i >= 0; i-- {
+		step := u.steps[i]
+		if err := step.undo(); err != nil && !isNotFound(err) {
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
+		removed = append(removed, step.resource)
+	}
+	return removed, failed
+}
+
+// recordingEC2 records in an undo log the resources created through it
+type recordingEC2 struct {
+	ec2API
+	log *undoLog
+}
+
+func (c *recordingEC2) CreateRouteTable(in *ec2.CreateRouteTableInput) (*ec2.CreateRouteTableOutput, error) {
+	out, err := c.ec2API.CreateRouteTable(in)
+	if err == nil && out.RouteTable != nil {
+		id := out.RouteTable.RouteTableId
+		c.log.add("route_table", aws.StringValue(id), func() error {
+			_, err := c.ec2API.DeleteRouteTable(&ec2.DeleteRouteTableInput{RouteTableId: id})
+			return err
+		})
+	}
+	return out, err
+}
+
+func (c *recordingEC2) AssociateRouteTable(in *ec2.AssociateRouteTableInput) (*ec2.AssociateRouteTableOutput, error) {
+	out, err := c.ec2API.AssociateRouteTable(in)
+	if err == nil && aws.StringValue(out.AssociationId) != "" {
+		id := out.AssociationId
+		c.log.add("route_table_association", aws.StringValue(id), func() error {
+			_, err := c.ec2API.DisassociateRouteTable(&ec2.DisassociateRouteTableInput{AssociationId: id})
+			return err
+		})
+	}
+	return out, err
+}
+
+func (c *recordingEC2) CreateRoute(in *ec2.CreateRouteInput) (*ec2.CreateRouteOutput, error) {
+	out, err := c.ec2API.CreateRoute(in)
+	if err == nil {
+		remove := &ec2.DeleteRouteInput{
+			RouteTableId:             in.RouteTableId,
+			DestinationCidrBlock:     in.DestinationCidrBlock,
+			DestinationIpv6CidrBlock: in.DestinationIpv6CidrBlock,
+			DestinationPrefixListId:  in.DestinationPrefixListId,
+		}
+		id := aws.StringValue(in.RouteTableId) + ":" + routeDestination(&ec2.Route{
+			DestinationCidrBlock:     in.DestinationCidrBlock,
+			DestinationIpv6CidrBlock: in.DestinationIpv6CidrBlock,
+			DestinationPrefixListId:  in.DestinationPrefixListId,
+		})
+		c.log.add("route", id, func() error {
+			_, err := c.ec2API.DeleteRoute(remove)
+			return err
+		})
+	}
+	return out, err
+}
+
+func (c *recordingEC2) ModifyManagedPrefixList(in *ec2.ModifyManagedPrefixListInput) (*ec2.ModifyManagedPrefixListOutput, error) {
+	out, err := c.ec2API.ModifyManagedPrefixList(in)
+	if err != nil {
+		return out, err
+	}
+
+	for _, e := range in.AddEntries {
+		list, cidr := in.PrefixListId, e.Cidr
+		c.log.add("prefix_list_entry", aws.StringValue(list)+":"+aws.StringValue(cidr), func() error {
+			resp, err := c.ec2API.DescribeManagedPrefixLists(&ec2.DescribeManagedPrefixListsInput{PrefixListIds: []*string{list}})
+			if err != nil || len(resp.PrefixLists) == 0 {
+				return err
+			}
+			_, err = c.ec2API.ModifyManagedPrefixList(&ec2.ModifyManagedPrefixListInput{
+				PrefixListId:   list,
+				CurrentVersion: resp.PrefixLists[0].Version,
+				RemoveEntries:  []*ec2.RemovePrefixListEntry{{Cidr: cidr}},
+			})
+			return err
+		})
+	}
+	return out, err
+}
@@ -0,0 +1,399 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	vcrRecord = "record"
+	vcrReplay = "replay"
+)
+
+// interaction is an EC2 call and its outcome, as kept in a cassette
+type interaction struct {
+	Operation string          `json:"operation"`
+	Input     json.RawMessage `json:"input"`
+	Output    json.RawMessage `json:"output,omitempty"`
+	ErrorCode string          `json:"error_code,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// cassette holds the EC2 calls made for an event, in order. Recorded in a
+// sandbox, it replays them deterministically without AWS.
+type cassette struct {
+	mu           sync.Mutex
+	path         string
+	Interactions []interaction `json:"interactions"`
+	played       int
+}
+
+var cassettes = struct {
+	sync.Mutex
+	byEvent map[string]*cassette
+}{byEvent: make(map[string]*cassette)}
+
+// eventCassette returns the cassette of the event, shared by all of its
+// clients, loading it from dir when replaying. A cassette that can't be
+// loaded is returned empty, failing every call rather than reaching AWS.
+func eventCassette(dir, uuid, mode string) (*cassette, error) {
+	cassettes.Lock()
+	defer cassettes.Unlock()
+
+	if c, ok := cassettes.byEvent[uuid]; ok {
+		return c, nil
+	}
+
+	path, err := eventFile(dir, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cassette{path: path}
+	cassettes.byEvent[uuid] = c
+
+	if mode == vcrReplay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return c, err
+		}
+		if err := json.Unmarshal(data, c); err != nil {
+			return c, err
+		}
+	}
+
+	return c, nil
+}
+
+// play records the outcome of the live call into the cassette, or when
+// replaying takes it from the next interaction, which must be the same
+// call. The output is decoded into out either way.
+func (c *cassette) play(mode, operation string, in, out interface{}, live func() (interface{}, error)) error {
+	input, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if mode == vcrReplay {
+		if c.played >= len(c.Interactions) {
+			return errors.New("Cassette " + c.path + " has no interaction left for " + operation)
+		}
+
+		i := c.Interactions[c.played]
+		c.played++
+
+		var recorded bytes.Buffer
+		json.Compact(&recorded, i.Input)
+
+		if i.Operation != operation || recorded.String() != string(input) {
+			return errors.New("Cassette " + c.path + " expected " + i.Operation + " " + recorded.String() + ", got " + operation + " " + string(input))
+		}
+		if i.ErrorCode != "" {
+			return awserr.New(i.ErrorCode, i.Error, nil)
+		}
+		return json.Unmarshal(i.Output, out)
+	}
+
+	result, liveErr := live()
+	i := interaction{Operation: operation, Input: input}
+
+	if liveErr != nil {
+		i.Error = liveErr.Error()
+		i.ErrorCode = "Error"
+		if aerr, ok := liveErr.(awserr.Error); ok {
+			i.ErrorCode = aerr.Code()
+			i.Error = aerr.Message()
+		}
+	} else if i.Output, err = json.Marshal(result); err != nil {
+		return err
+	}
+
+	c.Interactions = append(c.Interactions, i)
+	if err := c.save(); err != nil {
+		return err
+	}
+
+	if liveErr != nil {
+		return liveErr
+	}
+	return json.Unmarshal(i.Output, out)
+}
+
+func (c *cassette) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.path, data, 0600)
+}
+
+// withCassette wraps the client of the event when recording or replaying
+// its EC2 calls
+func withCassette(client ec2API, r request, c config) ec2API {
+	if c.VCRMode != vcrRecord && c.VCRMode != vcrReplay {
+		return client
+	}
+
+	tape, err := eventCassette(c.VCRDir, r.UUID, c.VCRMode)
+	if err != nil {
+		fmt.Println("could not load the cassette of " + r.UUID + ": " + err.Error())
+	}
+	if tape == nil {
+		tape = &cassette{}
+	}
+
+	return &vcrEC2{live: client, tape: tape, mode: c.VCRMode}
+}
+
+// vcrEC2 records the calls made through a live client into a cassette, or
+// replays them from it
+type vcrEC2 struct {
+	live ec2API
+	tape *cassette
+	mode string
+}
+
+func (v *vcrEC2) AssociateRouteTable(in *ec2.AssociateRouteTableInput) (*ec2.AssociateRouteTableOutput, error) {
+	out := &ec2.AssociateRouteTableOutput{}
+	if err := v.tape.play(v.mode, "AssociateRouteTable", in, out, func() (interface{}, error) { return v.live.AssociateRouteTable(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) AssociateSubnetCidrBlock(in *ec2.AssociateSubnetCidrBlockInput) (*ec2.AssociateSubnetCidrBlockOutput, error) {
+	out := &ec2.AssociateSubnetCidrBlockOutput{}
+	if err := v.tape.play(v.mode, "AssociateSubnetCidrBlock", in, out, func() (interface{}, error) { return v.live.AssociateSubnetCidrBlock(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) CreateRoute(in *ec2.CreateRouteInput) (*ec2.CreateRouteOutput, error) {
+	out := &ec2.CreateRouteOutput{}
+	if err := v.tape.play(v.mode, "CreateRoute", in, out, func() (interface{}, error) { return v.live.CreateRoute(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) CreateRouteTable(in *ec2.CreateRouteTableInput) (*ec2.CreateRouteTableOutput, error) {
+	out := &ec2.CreateRouteTableOutput{}
+	if err := v.tape.play(v.mode, "CreateRouteTable", in, out, func() (interface{}, error) { return v.live.CreateRouteTable(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) CreateTags(in *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	out := &ec2.CreateTagsOutput{}
+	if err := v.tape.play(v.mode, "CreateTags", in, out, func() (interface{}, error) { return v.live.CreateTags(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DeleteFlowLogs(in *ec2.DeleteFlowLogsInput) (*ec2.DeleteFlowLogsOutput, error) {
+	out := &ec2.DeleteFlowLogsOutput{}
+	if err := v.tape.play(v.mode, "DeleteFlowLogs", in, out, func() (interface{}, error) { return v.live.DeleteFlowLogs(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DeleteInternetGateway(in *ec2.DeleteInternetGatewayInput) (*ec2.DeleteInternetGatewayOutput, error) {
+	out := &ec2.DeleteInternetGatewayOutput{}
+	if err := v.tape.play(v.mode, "DeleteInternetGateway", in, out, func() (interface{}, error) { return v.live.DeleteInternetGateway(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DeleteNatGateway(in *ec2.DeleteNatGatewayInput) (*ec2.DeleteNatGatewayOutput, error) {
+	out := &ec2.DeleteNatGatewayOutput{}
+	if err := v.tape.play(v.mode, "DeleteNatGateway", in, out, func() (interface{}, error) { return v.live.DeleteNatGateway(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DeleteRoute(in *ec2.DeleteRouteInput) (*ec2.DeleteRouteOutput, error) {
+	out := &ec2.DeleteRouteOutput{}
+	if err := v.tape.play(v.mode, "DeleteRoute", in, out, func() (interface{}, error) { return v.live.DeleteRoute(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DeleteRouteTable(in *ec2.DeleteRouteTableInput) (*ec2.DeleteRouteTableOutput, error) {
+	out := &ec2.DeleteRouteTableOutput{}
+	if err := v.tape.play(v.mode, "DeleteRouteTable", in, out, func() (interface{}, error) { return v.live.DeleteRouteTable(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DeleteSubnet(in *ec2.DeleteSubnetInput) (*ec2.DeleteSubnetOutput, error) {
+	out := &ec2.DeleteSubnetOutput{}
+	if err := v.tape.play(v.mode, "DeleteSubnet", in, out, func() (interface{}, error) { return v.live.DeleteSubnet(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DeleteVpcEndpoints(in *ec2.DeleteVpcEndpointsInput) (*ec2.DeleteVpcEndpointsOutput, error) {
+	out := &ec2.DeleteVpcEndpointsOutput{}
+	if err := v.tape.play(v.mode, "DeleteVpcEndpoints", in, out, func() (interface{}, error) { return v.live.DeleteVpcEndpoints(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DescribeAvailabilityZones(in *ec2.DescribeAvailabilityZonesInput) (*ec2.DescribeAvailabilityZonesOutput, error) {
+	out := &ec2.DescribeAvailabilityZonesOutput{}
+	if err := v.tape.play(v.mode, "DescribeAvailabilityZones", in, out, func() (interface{}, error) { return v.live.DescribeAvailabilityZones(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DescribeFlowLogs(in *ec2.DescribeFlowLogsInput) (*ec2.DescribeFlowLogsOutput, error) {
+	out := &ec2.DescribeFlowLogsOutput{}
+	if err := v.tape.play(v.mode, "DescribeFlowLogs", in, out, func() (interface{}, error) { return v.live.DescribeFlowLogs(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DescribeInternetGateways(in *ec2.DescribeInternetGatewaysInput) (*ec2.DescribeInternetGatewaysOutput, error) {
+	out := &ec2.DescribeInternetGatewaysOutput{}
+	if err := v.tape.play(v.mode, "DescribeInternetGateways", in, out, func() (interface{}, error) { return v.live.DescribeInternetGateways(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DescribeManagedPrefixLists(in *ec2.DescribeManagedPrefixListsInput) (*ec2.DescribeManagedPrefixListsOutput, error) {
+	out := &ec2.DescribeManagedPrefixListsOutput{}
+	if err := v.tape.play(v.mode, "DescribeManagedPrefixLists", in, out, func() (interface{}, error) { return v.live.DescribeManagedPrefixLists(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DescribeNatGateways(in *ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error) {
+	out := &ec2.DescribeNatGatewaysOutput{}
+	if err := v.tape.play(v.mode, "DescribeNatGateways", in, out, func() (interface{}, error) { return v.live.DescribeNatGateways(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DescribeNetworkInterfaces(in *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	out := &ec2.DescribeNetworkInterfacesOutput{}
+	if err := v.tape.play(v.mode, "DescribeNetworkInterfaces", in, out, func() (interface{}, error) { return v.live.DescribeNetworkInterfaces(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DescribeRouteTables(in *ec2.DescribeRouteTablesInput) (*ec2.DescribeRouteTablesOutput, error) {
+	out := &ec2.DescribeRouteTablesOutput{}
+	if err := v.tape.play(v.mode, "DescribeRouteTables", in, out, func() (interface{}, error) { return v.live.DescribeRouteTables(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DescribeSubnets(in *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	out := &ec2.DescribeSubnetsOutput{}
+	if err := v.tape.play(v.mode, "DescribeSubnets", in, out, func() (interface{}, error) { return v.live.DescribeSubnets(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DescribeVpcEndpoints(in *ec2.DescribeVpcEndpointsInput) (*ec2.DescribeVpcEndpointsOutput, error) {
+	out := &ec2.DescribeVpcEndpointsOutput{}
+	if err := v.tape.play(v.mode, "DescribeVpcEndpoints", in, out, func() (interface{}, error) { return v.live.DescribeVpcEndpoints(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DescribeVpcs(in *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	out := &ec2.DescribeVpcsOutput{}
+	if err := v.tape.play(v.mode, "DescribeVpcs", in, out, func() (interface{}, error) { return v.live.DescribeVpcs(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DetachInternetGateway(in *ec2.DetachInternetGatewayInput) (*ec2.DetachInternetGatewayOutput, error) {
+	out := &ec2.DetachInternetGatewayOutput{}
+	if err := v.tape.play(v.mode, "DetachInternetGateway", in, out, func() (interface{}, error) { return v.live.DetachInternetGateway(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DisassociateRouteTable(in *ec2.DisassociateRouteTableInput) (*ec2.DisassociateRouteTableOutput, error) {
+	out := &ec2.DisassociateRouteTableOutput{}
+	if err := v.tape.play(v.mode, "DisassociateRouteTable", in, out, func() (interface{}, error) { return v.live.DisassociateRouteTable(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) DisassociateSubnetCidrBlock(in *ec2.DisassociateSubnetCidrBlockInput) (*ec2.DisassociateSubnetCidrBlockOutput, error) {
+	out := &ec2.DisassociateSubnetCidrBlockOutput{}
+	if err := v.tape.play(v.mode, "DisassociateSubnetCidrBlock", in, out, func() (interface{}, error) { return v.live.DisassociateSubnetCidrBlock(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) ModifyManagedPrefixList(in *ec2.ModifyManagedPrefixListInput) (*ec2.ModifyManagedPrefixListOutput, error) {
+	out := &ec2.ModifyManagedPrefixListOutput{}
+	if err := v.tape.play(v.mode, "ModifyManagedPrefixList", in, out, func() (interface{}, error) { return v.live.ModifyManagedPrefixList(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) ModifySubnetAttribute(in *ec2.ModifySubnetAttributeInput) (*ec2.ModifySubnetAttributeOutput, error) {
+	out := &ec2.ModifySubnetAttributeOutput{}
+	if err := v.tape.play(v.mode, "ModifySubnetAttribute", in, out, func() (interface{}, error) { return v.live.ModifySubnetAttribute(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *vcrEC2) ReplaceRoute(in *ec2.ReplaceRouteInput) (*ec2.ReplaceRouteOutput, error) {
+	out := &ec2.ReplaceRouteOutput{}
+	if err := v.tape.play(v.mode, "ReplaceRoute", in, out, func() (interface{}, error) { return v.live.ReplaceRoute(in) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
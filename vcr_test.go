@@ -0,0 +1,54 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCassette(t *testing.T) {
+	Convey("Given the delete plan of a public network recorded in a sandbox", t, func() {
+		dir, _ := ioutil.TempDir("", "network-vcr")
+		defer os.RemoveAll(dir)
+
+		live := &mockEC2{
+			subnets: []*ec2.Subnet{{SubnetId: aws.String("subnet-00000000"), VpcId: aws.String("vpc-0000000")}},
+			tables:  []*ec2.RouteTable{routeTable("rtb-00000000", []string{"subnet-00000000"}, "igw-00000000")},
+		}
+		r := request{UUID: "vcr-test", NetworkAWSID: "subnet-00000000"}
+
+		recorder := &vcrEC2{live: live, tape: &cassette{path: filepath.Join(dir, "vcr-test.json")}, mode: vcrRecord}
+		recorded, err := planDelete(recorder, r)
+		So(err, ShouldBeNil)
+
+		Convey("When replaying it without AWS", func() {
+			cassettes.byEvent = make(map[string]*cassette)
+			player := withCassette(nil, r, config{VCRMode: vcrReplay, VCRDir: dir})
+			replayed, err := planDelete(player, r)
+
+			Convey("It should plan the same delete", func() {
+				So(err, ShouldBeNil)
+				So(replayed, ShouldResemble, recorded)
+			})
+		})
+
+		Convey("When replaying a different flow", func() {
+			cassettes.byEvent = make(map[string]*cassette)
+			player := withCassette(nil, r, config{VCRMode: vcrReplay, VCRDir: dir})
+			err := checkVPCRange(player, request{VPCID: "vpc-0000000"})
+
+			Convey("It should fail instead of reaching AWS", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,55 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// vpcTagFilter turns a key=value vpc_tag selector into a DescribeVpcs
+// filter
+func vpcTagFilter(selector string) (*ec2.Filter, error) {
+	parts := strings.SplitN(selector, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, newError(errPayload, "VPC tag "+selector+" is not a key=value selector")
+	}
+
+	return &ec2.Filter{
+		Name:   aws.String("tag:" + parts[0]),
+		Values: []*string{aws.String(parts[1])},
+	}, nil
+}
+
+// resolveVPC returns the id of the only VPC carrying the vpc_tag of the
+// event
+func resolveVPC(client ec2API, selector string) (string, error) {
+	filter, err := vpcTagFilter(selector)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{
+		Filters: []*ec2.Filter{filter},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch len(resp.Vpcs) {
+	case 0:
+		return "", newError(errNotFound, "No VPC is tagged "+selector)
+	case 1:
+		return aws.StringValue(resp.Vpcs[0].VpcId), nil
+	}
+
+	var ids []string
+	for _, v := range resp.Vpcs {
+		ids = append(ids, aws.StringValue(v.VpcId))
+	}
+	return "", newError(errAmbiguous, "VPCs "+strings.Join(ids, ", ")+" are all tagged "+selector)
+}
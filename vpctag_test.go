@@ -0,0 +1,44 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVPCTagFilter(t *testing.T) {
+	Convey("Given a vpc_tag selector", t, func() {
+		Convey("When it is a key=value pair", func() {
+			filter, err := vpcTagFilter("environment=production")
+
+			Convey("It should filter VPCs on that tag", func() {
+				So(err, ShouldBeNil)
+				So(aws.StringValue(filter.Name), ShouldEqual, "tag:environment")
+				So(aws.StringValue(filter.Values[0]), ShouldEqual, "production")
+			})
+		})
+
+		Convey("When the value holds an equals sign", func() {
+			filter, err := vpcTagFilter("owner=team=network")
+
+			Convey("It should keep it in the value", func() {
+				So(err, ShouldBeNil)
+				So(aws.StringValue(filter.Values[0]), ShouldEqual, "team=network")
+			})
+		})
+
+		Convey("When it has no key", func() {
+			_, err := vpcTagFilter("production")
+
+			Convey("It should reject the payload", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errPayload)
+			})
+		})
+	})
+}
@@ -0,0 +1,142 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	waitNATGatewayAvailable = "nat_gateway_available"
+	waitFlowLogsActive      = "flow_logs_active"
+)
+
+// waitConditions are the dependent resources a create may wait for
+var waitConditions = []string{waitNATGatewayAvailable, waitFlowLogsActive}
+
+// validWaitFor rejects unknown wait_for conditions
+func validWaitFor(r request) error {
+	for _, c := range r.WaitFor {
+		if !contains(waitConditions, c) {
+			return newFieldError(errPayload, "wait_for", "Unknown wait_for condition "+c+", expected one of "+strings.Join(waitConditions, ", "))
+		}
+	}
+	return nil
+}
+
+// waitForDependents waits until the dependent resources of the network the
+// event asks for are ready, so its done response means a fully functional
+// network
+func waitForDependents(client ec2API, r request, id string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := time.Second
+
+	for {
+		var pending []string
+		for _, c := range r.WaitFor {
+			var waiting []string
+			var err error
+			switch c {
+			case waitNATGatewayAvailable:
+				waiting, err = pendingNATGateways(client, r, id)
+			case waitFlowLogsActive:
+				waiting, err = pendingFlowLogs(client, r, id)
+			}
+			if err != nil {
+				return err
+			}
+			pending = append(pending, waiting...)
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return newFieldError(errTimeout, "wait_for", "Still waiting for "+strings.Join(pending, ", ")+" after "+timeout.String())
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxInterfaceBackoff {
+			backoff = maxInterfaceBackoff
+		}
+	}
+}
+
+// pendingNATGateways describes the NAT gateway of the event and the ones
+// living in the network, returning those not available yet. A failed NAT
+// gateway will never be.
+func pendingNATGateways(client ec2API, r request, id string) ([]string, error) {
+	inputs := []*ec2.DescribeNatGatewaysInput{{
+		Filter: []*ec2.Filter{{Name: aws.String("subnet-id"), Values: []*string{aws.String(id)}}},
+	}}
+	if r.NATGatewayID != "" {
+		inputs = append(inputs, &ec2.DescribeNatGatewaysInput{NatGatewayIds: []*string{aws.String(r.NATGatewayID)}})
+	}
+
+	var gateways []*ec2.NatGateway
+	for _, input := range inputs {
+		resp, err := client.DescribeNatGateways(input)
+		if err != nil {
+			return nil, err
+		}
+		gateways = append(gateways, resp.NatGateways...)
+	}
+
+	return unavailableNATGateways(gateways)
+}
+
+func unavailableNATGateways(gateways []*ec2.NatGateway) ([]string, error) {
+	if len(gateways) == 0 {
+		return []string{"a NAT gateway"}, nil
+	}
+
+	var pending []string
+	for _, g := range gateways {
+		id := aws.StringValue(g.NatGatewayId)
+		switch state := aws.StringValue(g.State); state {
+		case "available":
+		case "pending":
+			pending = append(pending, "NAT gateway "+id)
+		default:
+			return nil, newFieldError(errInternal, "wait_for", "NAT gateway "+id+" is "+state+": "+aws.StringValue(g.FailureMessage))
+		}
+	}
+	return pending, nil
+}
+
+// pendingFlowLogs describes the flow logs of the network and of its VPC,
+// returning those not delivering yet
+func pendingFlowLogs(client ec2API, r request, id string) ([]string, error) {
+	resp, err := client.DescribeFlowLogs(&ec2.DescribeFlowLogsInput{
+		Filter: []*ec2.Filter{{Name: aws.String("resource-id"), Values: aws.StringSlice([]string{id, r.VPCID})}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return inactiveFlowLogs(resp.FlowLogs)
+}
+
+func inactiveFlowLogs(flowLogs []*ec2.FlowLog) ([]string, error) {
+	if len(flowLogs) == 0 {
+		return []string{"a flow log"}, nil
+	}
+
+	var pending []string
+	for _, l := range flowLogs {
+		id := aws.StringValue(l.FlowLogId)
+		if aws.StringValue(l.DeliverLogsStatus) == "FAILED" {
+			return nil, newFieldError(errInternal, "wait_for", "Flow log "+id+" fails to deliver: "+aws.StringValue(l.DeliverLogsErrorMessage))
+		}
+		if aws.StringValue(l.FlowLogStatus) != "ACTIVE" {
+			pending = append(pending, "flow log "+id)
+		}
+	}
+	return pending, nil
+}
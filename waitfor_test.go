@@ -0,0 +1,142 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// dependentsEC2 serves the NAT gateways and flow logs of a network
+type dependentsEC2 struct {
+	*mockEC2
+	gateways []*ec2.NatGateway
+	logs     []*ec2.FlowLog
+}
+
+func (m *dependentsEC2) DescribeNatGateways(in *ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error) {
+	return &ec2.DescribeNatGatewaysOutput{NatGateways: m.gateways}, nil
+}
+
+func (m *dependentsEC2) DescribeFlowLogs(in *ec2.DescribeFlowLogsInput) (*ec2.DescribeFlowLogsOutput, error) {
+	return &ec2.DescribeFlowLogsOutput{FlowLogs: m.logs}, nil
+}
+
+func TestValidWaitFor(t *testing.T) {
+	Convey("Given a create waiting for dependents", t, func() {
+		Convey("When they are known conditions", func() {
+			r := request{WaitFor: []string{waitNATGatewayAvailable, waitFlowLogsActive}}
+
+			Convey("It should accept them", func() {
+				So(validWaitFor(r), ShouldBeNil)
+			})
+		})
+
+		Convey("When one of them is unknown", func() {
+			err := validWaitFor(request{WaitFor: []string{"dns_propagated"}})
+
+			Convey("It should reject the event", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).field, ShouldEqual, "wait_for")
+			})
+		})
+	})
+}
+
+func TestDependentsReadiness(t *testing.T) {
+	Convey("Given the NAT gateways of a network", t, func() {
+		Convey("When one is still pending", func() {
+			pending, err := unavailableNATGateways([]*ec2.NatGateway{
+				{NatGatewayId: aws.String("nat-00000000"), State: aws.String("available")},
+				{NatGatewayId: aws.String("nat-11111111"), State: aws.String("pending")},
+			})
+
+			Convey("It should wait for it", func() {
+				So(err, ShouldBeNil)
+				So(pending, ShouldResemble, []string{"NAT gateway nat-11111111"})
+			})
+		})
+
+		Convey("When one failed", func() {
+			_, err := unavailableNATGateways([]*ec2.NatGateway{
+				{NatGatewayId: aws.String("nat-00000000"), State: aws.String("failed"), FailureMessage: aws.String("Elastic IP is in use")},
+			})
+
+			Convey("It should stop waiting", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Elastic IP is in use")
+			})
+		})
+
+		Convey("When there is none yet", func() {
+			pending, _ := unavailableNATGateways(nil)
+
+			Convey("It should wait for one", func() {
+				So(pending, ShouldHaveLength, 1)
+			})
+		})
+	})
+
+	Convey("Given the flow logs of a network", t, func() {
+		Convey("When one fails to deliver", func() {
+			_, err := inactiveFlowLogs([]*ec2.FlowLog{
+				{FlowLogId: aws.String("fl-00000000"), FlowLogStatus: aws.String("ACTIVE"), DeliverLogsStatus: aws.String("FAILED"), DeliverLogsErrorMessage: aws.String("Access error")},
+			})
+
+			Convey("It should stop waiting", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When they are all active", func() {
+			pending, err := inactiveFlowLogs([]*ec2.FlowLog{
+				{FlowLogId: aws.String("fl-00000000"), FlowLogStatus: aws.String("ACTIVE"), DeliverLogsStatus: aws.String("SUCCESS")},
+			})
+
+			Convey("It should be done waiting", func() {
+				So(err, ShouldBeNil)
+				So(pending, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestWaitForDependents(t *testing.T) {
+	Convey("Given a network whose dependents are ready", t, func() {
+		client := &dependentsEC2{
+			mockEC2:  &mockEC2{},
+			gateways: []*ec2.NatGateway{{NatGatewayId: aws.String("nat-00000000"), State: aws.String("available")}},
+			logs:     []*ec2.FlowLog{{FlowLogId: aws.String("fl-00000000"), FlowLogStatus: aws.String("ACTIVE")}},
+		}
+		r := request{VPCID: "vpc-0000000", WaitFor: []string{waitNATGatewayAvailable, waitFlowLogsActive}}
+
+		Convey("When waiting for them", func() {
+			err := waitForDependents(client, r, "subnet-00000000", time.Minute)
+
+			Convey("It should return straight away", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a network without flow logs", t, func() {
+		client := &dependentsEC2{mockEC2: &mockEC2{}}
+		r := request{VPCID: "vpc-0000000", WaitFor: []string{waitFlowLogsActive}}
+
+		Convey("When the wait times out", func() {
+			err := waitForDependents(client, r, "subnet-00000000", time.Millisecond)
+
+			Convey("It should fail with a timeout naming what it waited for", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*connectorError).code, ShouldEqual, errTimeout)
+				So(err.Error(), ShouldContainSubstring, "a flow log")
+			})
+		})
+	})
+}
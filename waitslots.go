@@ -0,0 +1,137 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// waitSlots caps how many events bound for long waits run at once, such
+// as deletes waiting for their interfaces and NAT gateways to go away.
+// Events beyond the cap are parked, in order, and resubmitted as soon as
+// a slot is released, so a teardown can't take every worker and hold up
+// creates. A resubmitted event takes the slot again when it reaches the
+// guard, going back to the head of the queue if it was taken meanwhile:
+// the slot isn't reserved for it, as it may be rejected before, when it
+// has gone stale for instance.
+type waitSlots struct {
+	mu      sync.Mutex
+	max     int
+	used    int
+	parked  []*nats.Msg
+	resumed map[*nats.Msg]time.Time
+}
+
+// resumeWindow is how long a resubmitted event keeps its place at the
+// head of the queue
+const resumeWindow = time.Minute
+
+func newWaitSlots(max int) *waitSlots {
+	return &waitSlots{max: max, resumed: make(map[*nats.Msg]time.Time)}
+}
+
+// acquire takes a slot for the event, or parks it and returns false. 0
+// means no cap.
+func (w *waitSlots) acquire(m *nats.Msg) bool {
+	if w.max <= 0 {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, resumed := w.resumed[m]
+	delete(w.resumed, m)
+
+	if w.used < w.max {
+		w.used++
+		return true
+	}
+
+	if resumed {
+		w.parked = append([]*nats.Msg{m}, w.parked...)
+	} else {
+		w.parked = append(w.parked, m)
+	}
+	return false
+}
+
+// release frees a slot and returns the oldest parked event, to be
+// handled again
+func (w *waitSlots) release() *nats.Msg {
+	if w.max <= 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.used--
+
+	now := time.Now()
+	for m, at := range w.resumed {
+		if now.Sub(at) > resumeWindow {
+			delete(w.resumed, m)
+		}
+	}
+
+	if len(w.parked) == 0 {
+		return nil
+	}
+
+	next := w.parked[0]
+	w.parked = w.parked[1:]
+	w.resumed[next] = now
+	return next
+}
+
+// waiting returns how many events are parked for a slot
+func (w *waitSlots) waiting() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.parked)
+}
+
+// longWait tells whether handling the event may sit for long in a wait:
+// deletes wait for their interfaces and NAT gateways to go away, creates
+// with wait_for for their NAT gateways and flow logs to be ready
+func longWait(subject string, r request) bool {
+	switch verb(subject) {
+	case "delete":
+		return true
+	case "create":
+		return len(r.WaitFor) > 0
+	}
+	return false
+}
+
+// waitGuard parks the events bound for long waits beyond MAX_WAITS until
+// a slot is released
+func waitGuard(next eventFunc) eventFunc {
+	return func(e *event) {
+		if !longWait(e.msg.Subject, e.req) || e.req.DryRun || e.req.ProviderType == providerFake || resubmit == nil {
+			next(e)
+			return
+		}
+
+		if !waits.acquire(e.raw) {
+			fmt.Println(fmt.Sprintf("parking %s %s, %d long waits already running", e.msg.Subject, e.req.UUID, cfg.MaxWaits))
+			publishStatus(e.msg.Subject, e.req, statusParked)
+			return
+		}
+		defer func() {
+			if m := waits.release(); m != nil {
+				go resubmit(m)
+			}
+		}()
+
+		next(e)
+	}
+}
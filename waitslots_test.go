@@ -0,0 +1,123 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWaitSlots(t *testing.T) {
+	Convey("Given deletes capped at two at once", t, func() {
+		w := newWaitSlots(2)
+		first, second, third, fourth := &nats.Msg{}, &nats.Msg{}, &nats.Msg{}, &nats.Msg{}
+
+		So(w.acquire(first), ShouldBeTrue)
+		So(w.acquire(second), ShouldBeTrue)
+
+		Convey("When more deletes arrive", func() {
+			Convey("It should park them in order", func() {
+				So(w.acquire(third), ShouldBeFalse)
+				So(w.acquire(fourth), ShouldBeFalse)
+				So(w.waiting(), ShouldEqual, 2)
+			})
+
+			Convey("And a delete finishes", func() {
+				w.acquire(third)
+				w.acquire(fourth)
+				next := w.release()
+
+				Convey("It should hand its slot to the oldest parked one", func() {
+					So(next, ShouldEqual, third)
+					So(w.acquire(third), ShouldBeTrue)
+				})
+
+				Convey("And a new delete takes the slot first", func() {
+					So(w.acquire(&nats.Msg{}), ShouldBeTrue)
+
+					Convey("It should park the resubmitted one back at the head", func() {
+						So(w.acquire(third), ShouldBeFalse)
+						So(w.release(), ShouldEqual, third)
+					})
+				})
+
+				Convey("And the resubmitted delete is rejected before taking it", func() {
+					Convey("It should leave the slot free", func() {
+						So(w.acquire(&nats.Msg{}), ShouldBeTrue)
+						So(w.release(), ShouldEqual, fourth)
+					})
+				})
+			})
+		})
+
+		Convey("When deletes finish with none parked", func() {
+			So(w.release(), ShouldBeNil)
+
+			Convey("It should free their slot", func() {
+				So(w.acquire(third), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given no cap", t, func() {
+		w := newWaitSlots(0)
+
+		Convey("It should never park deletes", func() {
+			for i := 0; i < 100; i++ {
+				So(w.acquire(&nats.Msg{}), ShouldBeTrue)
+			}
+			So(w.release(), ShouldBeNil)
+		})
+	})
+}
+
+func TestWaitGuard(t *testing.T) {
+	testSetup("network.delete.aws")
+
+	Convey("Given a delete parked behind the one long wait allowed", t, func() {
+		saved, savedResubmit, savedAge := waits, resubmit, cfg.MaxEventAge
+		defer func() { waits, resubmit, cfg.MaxEventAge = saved, savedResubmit, savedAge }()
+
+		waits = newWaitSlots(1)
+		resubmit = func(m *nats.Msg) {}
+		cfg.MaxEventAge = time.Hour
+
+		handled := 0
+		p := newPipeline(func(e *event) { handled++ }).use("decode", decode).use("freshness", freshness).use("wait_guard", waitGuard)
+
+		So(waits.acquire(&nats.Msg{}), ShouldBeTrue)
+		data := setField([]byte(`{"_uuid":"parked","network_aws_id":"subnet-00000000"}`), "_timestamp", time.Now().Format(time.RFC3339))
+		p.serve(&nats.Msg{Subject: "network.delete.aws", Data: data})
+		So(waits.waiting(), ShouldEqual, 1)
+
+		Convey("When it has gone stale by the time the slot is freed", func() {
+			m := waits.release()
+			cfg.MaxEventAge = time.Nanosecond
+			p.serve(m)
+
+			Convey("It should be rejected without keeping the slot", func() {
+				So(handled, ShouldEqual, 0)
+				So(waits.acquire(&nats.Msg{}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestLongWait(t *testing.T) {
+	Convey("Given events bound for long waits", t, func() {
+		Convey("It should hold deletes and creates waiting for their dependents to a slot", func() {
+			So(longWait("network.delete.aws", request{}), ShouldBeTrue)
+			So(longWait("network.create.aws", request{WaitFor: []string{waitNATGatewayAvailable}}), ShouldBeTrue)
+		})
+
+		Convey("It should let other events through", func() {
+			So(longWait("network.create.aws", request{}), ShouldBeFalse)
+			So(longWait("network.update.aws", request{WaitFor: []string{waitNATGatewayAvailable}}), ShouldBeFalse)
+		})
+	})
+}
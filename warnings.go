@@ -0,0 +1,79 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	warnZoneSubstituted  = "zone_substituted"
+	warnSharedRouteTable = "shared_route_table"
+	warnReplicaFailed    = "replica_failed"
+	warnCreateDescribed  = "create_described"
+	warnReportIncomplete = "report_incomplete"
+	warnWaitForTimeout   = "wait_for_timeout"
+	warnNotStabilized    = "not_stabilized"
+)
+
+// warning is non fatal information about how an event was handled,
+// reported in the warnings of done responses
+type warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// warn returns the response with a warning appended to its warnings
+func warn(data []byte, code, msg string) []byte {
+	var body struct {
+		Warnings []warning `json:"warnings"`
+	}
+	json.Unmarshal(data, &body)
+
+	return setField(data, "warnings", append(body.Warnings, warning{Code: code, Message: msg}))
+}
+
+// sharedTableWarning warns when the route table the network was routed
+// through, its route_table_id, also routes other subnets, which its routes
+// then apply to
+func sharedTableWarning(client ec2API, data []byte, id string) []byte {
+	var routed struct {
+		RouteTableID string `json:"route_table_id"`
+	}
+	json.Unmarshal(data, &routed)
+	table := routed.RouteTableID
+	if table == "" {
+		return data
+	}
+
+	resp, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		RouteTableIds: []*string{aws.String(table)},
+	})
+	if err != nil {
+		return data
+	}
+
+	for _, t := range resp.RouteTables {
+		if aws.StringValue(t.RouteTableId) != table {
+			continue
+		}
+
+		others := 0
+		for _, a := range t.Associations {
+			if s := aws.StringValue(a.SubnetId); s != "" && s != id {
+				others++
+			}
+		}
+		if others > 0 {
+			return warn(data, warnSharedRouteTable, "Route table "+table+" is shared with "+strconv.Itoa(others)+" other subnets")
+		}
+	}
+
+	return data
+}
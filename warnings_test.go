@@ -0,0 +1,65 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func warnings(data []byte) []warning {
+	var body struct {
+		Warnings []warning `json:"warnings"`
+	}
+	json.Unmarshal(data, &body)
+	return body.Warnings
+}
+
+func TestWarn(t *testing.T) {
+	Convey("Given a done response", t, func() {
+		data := []byte(`{"network_aws_id":"subnet-00000000"}`)
+
+		Convey("When warnings are added", func() {
+			data = warn(data, warnZoneSubstituted, "Network created in eu-west-1b after failing in eu-west-1a")
+			data = warn(data, warnReplicaFailed, "Replica in us-east-1 failed")
+
+			Convey("It should keep them all, in order", func() {
+				w := warnings(data)
+				So(len(w), ShouldEqual, 2)
+				So(w[0].Code, ShouldEqual, warnZoneSubstituted)
+				So(w[1].Code, ShouldEqual, warnReplicaFailed)
+				So(string(data), ShouldContainSubstring, `"network_aws_id":"subnet-00000000"`)
+			})
+		})
+	})
+}
+
+func TestSharedTableWarning(t *testing.T) {
+	Convey("Given a network routed through a route table", t, func() {
+		data := []byte(`{"route_table_id":"rtb-00000000"}`)
+
+		Convey("When the table routes other subnets too", func() {
+			client := &mockEC2{tables: []*ec2.RouteTable{routeTable("rtb-00000000", []string{"subnet-00000000", "subnet-11111111", "subnet-22222222"}, "")}}
+			w := warnings(sharedTableWarning(client, data, "subnet-00000000"))
+
+			Convey("It should warn about it", func() {
+				So(len(w), ShouldEqual, 1)
+				So(w[0].Code, ShouldEqual, warnSharedRouteTable)
+				So(w[0].Message, ShouldEqual, "Route table rtb-00000000 is shared with 2 other subnets")
+			})
+		})
+
+		Convey("When the table is its own", func() {
+			client := &mockEC2{tables: []*ec2.RouteTable{routeTable("rtb-00000000", []string{"subnet-00000000"}, "")}}
+
+			Convey("It should not warn", func() {
+				So(warnings(sharedTableWarning(client, data, "subnet-00000000")), ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,137 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/nats-io/nats"
+)
+
+// workerPool handles events on a bounded number of goroutines. Events
+// wait in a queue per build, taken from in turn, so one large build
+// doesn't hold back the small changes received after it. Submitting
+// blocks while the queues are full, which leaves the backlog pending on
+// the NATS subscriptions.
+type workerPool struct {
+	mu       sync.Mutex
+	wake     *sync.Cond
+	queues   map[string][]*nats.Msg
+	turns    []string
+	queued   int
+	limit    int
+	stopping bool
+	dropped  int
+	wg       sync.WaitGroup
+}
+
+func newWorkerPool(size, limit int, h nats.MsgHandler) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	if limit < 1 {
+		limit = 1
+	}
+
+	p := &workerPool{queues: make(map[string][]*nats.Msg), limit: limit}
+	p.wake = sync.NewCond(&p.mu)
+	for i := 0; i < size; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				m := p.next()
+				if m == nil {
+					return
+				}
+				h(m)
+			}
+		}()
+	}
+
+	return p
+}
+
+// fairnessKey is the queue an event waits in: its build, or its VPC for
+// events sent outside of one
+func fairnessKey(m *nats.Msg) string {
+	r := parseRequest(m.Data)
+	if r.BatchID != "" {
+		return "batch/" + r.BatchID
+	}
+	return "vpc/" + r.VPCID
+}
+
+// submit queues the event for the next free worker. Events submitted once
+// the pool is stopping are dropped.
+func (p *workerPool) submit(m *nats.Msg) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.queued >= p.limit && !p.stopping {
+		p.wake.Wait()
+	}
+	if p.stopping {
+		fmt.Println("dropping event on " + m.Subject + ", shutting down")
+		p.dropped++
+		return
+	}
+
+	key := fairnessKey(m)
+	if len(p.queues[key]) == 0 {
+		p.turns = append(p.turns, key)
+	}
+	p.queues[key] = append(p.queues[key], m)
+	p.queued++
+	p.wake.Broadcast()
+}
+
+// next waits for an event and takes it from the queue whose turn it is,
+// moving that queue to the back. It returns nil once the pool is stopping
+// and every queued event was taken.
+func (p *workerPool) next() *nats.Msg {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.queued == 0 && !p.stopping {
+		p.wake.Wait()
+	}
+	if p.queued == 0 {
+		return nil
+	}
+
+	key := p.turns[0]
+	p.turns = p.turns[1:]
+	m := p.queues[key][0]
+	p.queues[key] = p.queues[key][1:]
+	if len(p.queues[key]) > 0 {
+		p.turns = append(p.turns, key)
+	} else {
+		delete(p.queues, key)
+	}
+
+	p.queued--
+	p.wake.Broadcast()
+	return m
+}
+
+// droppedEvents returns the number of events dropped while stopping
+func (p *workerPool) droppedEvents() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.dropped
+}
+
+// stop waits for the queued events and those being handled to finish
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	p.stopping = true
+	p.wake.Broadcast()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
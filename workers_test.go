@@ -0,0 +1,132 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWorkerPool(t *testing.T) {
+	Convey("Given a pool of two workers", t, func() {
+		var mu sync.Mutex
+		var running, peak, handled int
+
+		pool := newWorkerPool(2, 10, func(m *nats.Msg) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			handled++
+			mu.Unlock()
+		})
+
+		Convey("When more events are submitted than there are workers", func() {
+			for i := 0; i < 6; i++ {
+				pool.submit(&nats.Msg{Subject: "network.create.aws"})
+			}
+			pool.stop()
+
+			Convey("It should never run more than two at once", func() {
+				So(peak, ShouldEqual, 2)
+			})
+
+			Convey("It should finish every event before stopping", func() {
+				So(handled, ShouldEqual, 6)
+			})
+		})
+	})
+}
+
+func TestWorkerPoolFairness(t *testing.T) {
+	Convey("Given a single worker busy with a large build", t, func() {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		var order []string
+
+		pool := newWorkerPool(1, 10, func(m *nats.Msg) {
+			order = append(order, string(m.Reply))
+			if m.Reply == "large-0" {
+				close(started)
+				<-release
+			}
+		})
+
+		event := func(batch, name string) *nats.Msg {
+			return &nats.Msg{Subject: "network.create.aws", Reply: name, Data: []byte(`{"_batch_id":"` + batch + `"}`)}
+		}
+
+		pool.submit(event("large", "large-0"))
+		<-started
+
+		Convey("When a small change is received behind the rest of the build", func() {
+			pool.submit(event("large", "large-1"))
+			pool.submit(event("large", "large-2"))
+			pool.submit(event("large", "large-3"))
+			pool.submit(event("small", "small-1"))
+			close(release)
+			pool.stop()
+
+			Convey("It should take turns between builds", func() {
+				So(order, ShouldResemble, []string{"large-0", "large-1", "small-1", "large-2", "large-3"})
+			})
+		})
+	})
+
+	Convey("Given a pool with a full queue", t, func() {
+		release := make(chan struct{})
+		pool := newWorkerPool(1, 1, func(m *nats.Msg) { <-release })
+
+		pool.submit(&nats.Msg{Subject: "network.create.aws"})
+		pool.submit(&nats.Msg{Subject: "network.create.aws"})
+
+		Convey("When another event is submitted", func() {
+			submitted := make(chan struct{})
+			go func() {
+				pool.submit(&nats.Msg{Subject: "network.create.aws"})
+				close(submitted)
+			}()
+
+			Convey("It should block until the queue has room", func() {
+				select {
+				case <-submitted:
+					t.Fail()
+				case <-time.After(20 * time.Millisecond):
+				}
+
+				close(release)
+				<-submitted
+				pool.stop()
+				So(pool.droppedEvents(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestWorkerPoolStopped(t *testing.T) {
+	Convey("Given a stopped pool", t, func() {
+		pool := newWorkerPool(1, 10, func(m *nats.Msg) {})
+		pool.stop()
+
+		Convey("When an event is submitted", func() {
+			pool.submit(&nats.Msg{Subject: "network.create.aws"})
+
+			Convey("It should count it dropped", func() {
+				So(pool.droppedEvents(), ShouldEqual, 1)
+			})
+		})
+	})
+}
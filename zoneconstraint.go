@@ -0,0 +1,79 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	zoneErrorsStructured = "structured"
+	zoneErrorsRaw        = "raw"
+)
+
+// zoneConstrained reports whether a create failed because the zone it
+// asked for takes no new networks, as older zones closed to new customers
+// do
+func zoneConstrained(data []byte) bool {
+	switch failureCode(data) {
+	case "Unsupported":
+		return true
+	case "InvalidParameterValue":
+		return strings.Contains(failureMessage(data), "availabilityZone")
+	}
+	return false
+}
+
+// openZones returns the zones of the region the account can create
+// networks in: available, opted in or not needing to be, and allowed by
+// the policies of the connector
+func openZones(client ec2API, r request, except string) ([]string, error) {
+	resp, err := client.DescribeAvailabilityZones(&ec2.DescribeAvailabilityZonesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("opt-in-status"), Values: []*string{aws.String("opt-in-not-required"), aws.String("opted-in")}},
+			{Name: aws.String("state"), Values: []*string{aws.String("available")}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	zones := []string{}
+	for _, z := range resp.AvailabilityZones {
+		name := aws.StringValue(z.ZoneName)
+		if name == except || !strings.HasPrefix(name, r.DatacenterRegion) {
+			continue
+		}
+		if checkZone(cfg, r.DatacenterRegion, name) == nil {
+			zones = append(zones, name)
+		}
+	}
+	return zones, nil
+}
+
+// zoneConstraintResponse replaces the AWS message of a create refused in
+// the availability zone it asked for with a zone_unavailable error
+// listing the zones it may use instead. The connector never moves such a
+// create itself. The AWS message is kept in aws_error.
+func zoneConstraintResponse(client ec2API, r request, data []byte) []byte {
+	zones, err := openZones(client, r, r.AvailabilityZone)
+	if err != nil {
+		return data
+	}
+
+	msg := "Availability zone " + r.AvailabilityZone + " doesn't take new networks"
+	if len(zones) > 0 {
+		msg += ", use one of " + strings.Join(zones, ", ")
+	}
+
+	data = setFields(data, map[string]interface{}{
+		"aws_error":                  failureMessage(data),
+		"allowed_availability_zones": zones,
+	})
+	return errorResponse(data, newFieldError(errZoneClosed, "availability_zone", msg))
+}
@@ -0,0 +1,61 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestZoneConstraint(t *testing.T) {
+	Convey("Given a create refused in the zone it asked for", t, func() {
+		data := errorResponse([]byte(`{"availability_zone":"us-east-1e"}`), errors.New("InvalidParameterValue: Value (us-east-1e) for parameter availabilityZone is invalid. Subnets can currently only be created in the following availability zones: us-east-1a, us-east-1b."))
+		r := request{DatacenterRegion: "us-east-1", AvailabilityZone: "us-east-1e"}
+		client := &mockEC2{zones: []*ec2.AvailabilityZone{
+			{ZoneName: aws.String("us-east-1a"), State: aws.String("available")},
+			{ZoneName: aws.String("us-east-1b"), State: aws.String("available")},
+			{ZoneName: aws.String("us-east-1e"), State: aws.String("available")},
+		}}
+
+		Convey("It should be recognised", func() {
+			So(zoneConstrained(data), ShouldBeTrue)
+		})
+
+		Convey("When its error is rewritten", func() {
+			var resp struct {
+				Error      string   `json:"error"`
+				ErrorCode  string   `json:"error_code"`
+				ErrorField string   `json:"error_field"`
+				Allowed    []string `json:"allowed_availability_zones"`
+				AWSError   string   `json:"aws_error"`
+			}
+			json.Unmarshal(zoneConstraintResponse(client, r, data), &resp)
+
+			Convey("It should list the zones the account can use instead", func() {
+				So(resp.ErrorCode, ShouldEqual, errZoneClosed)
+				So(resp.ErrorField, ShouldEqual, "availability_zone")
+				So(resp.Allowed, ShouldResemble, []string{"us-east-1a", "us-east-1b"})
+				So(resp.Error, ShouldEqual, "Availability zone us-east-1e doesn't take new networks, use one of us-east-1a, us-east-1b")
+			})
+
+			Convey("It should keep the AWS message", func() {
+				So(resp.AWSError, ShouldStartWith, "InvalidParameterValue")
+			})
+		})
+	})
+
+	Convey("Given a create failing for other reasons", t, func() {
+		data := errorResponse([]byte(`{}`), errors.New("InvalidParameterValue: The CIDR '10.0.0.0/8' is invalid."))
+
+		Convey("It should be left alone", func() {
+			So(zoneConstrained(data), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,110 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// zonalErrors are the CreateSubnet failures confined to the availability
+// zone of the network
+var zonalErrors = []string{"InsufficientCapacity", "Unsupported", "ServiceUnavailable", "Unavailable"}
+
+// zoneSubstitution reports a create moved to another availability zone
+type zoneSubstitution struct {
+	Requested string   `json:"requested"`
+	Used      string   `json:"used"`
+	Failed    []string `json:"failed"`
+}
+
+// createWithFailover creates the network and, when AZ_FAILOVER is set and
+// the create fails for reasons confined to its availability zone, creates
+// it again in the next allowed zone. Only events leaving the zone to the
+// connector move; the substitution is reported in the response.
+func createWithFailover(m *nats.Msg, r request, create func(*nats.Msg) (string, []byte)) (string, []byte) {
+	subject, data := create(m)
+
+	if !cfg.AZFailover || verb(m.Subject) != "create" || r.AvailabilityZone != "" || r.ProviderType == providerFake {
+		return subject, data
+	}
+	if finalStatus(subject) != statusErrored || !zonalFailure(data) {
+		return subject, data
+	}
+
+	requested := parseRequest(m.Data).AvailabilityZone
+	candidates, err := failoverZones(readClient(r), r, requested)
+	if err != nil {
+		return subject, data
+	}
+
+	failed := []string{requested}
+	for _, az := range candidates {
+		next := &nats.Msg{Subject: m.Subject, Reply: m.Reply, Data: setField(m.Data, "availability_zone", az)}
+		subject, data = create(next)
+
+		if finalStatus(subject) == statusDone {
+			data = setField(data, "availability_zone_substitution", zoneSubstitution{
+				Requested: requested,
+				Used:      az,
+				Failed:    failed,
+			})
+			return subject, warn(data, warnZoneSubstituted, "Network created in "+az+" after failing in "+zoneNames(failed))
+		}
+		if !zonalFailure(data) {
+			return subject, data
+		}
+		failed = append(failed, az)
+	}
+
+	return subject, data
+}
+
+func zoneNames(zones []string) string {
+	var names []string
+	for _, az := range zones {
+		if az == "" {
+			az = "the zone AWS picked"
+		}
+		names = append(names, az)
+	}
+	return strings.Join(names, ", ")
+}
+
+func zonalFailure(data []byte) bool {
+	return contains(zonalErrors, failureCode(data))
+}
+
+// failoverZones returns the zones a create failing in the given one moves
+// to, in order: the default or allowed zones of the region, or else every
+// available zone not excluded, starting after the failed one and leaving
+// the zones recently short of capacity for last
+func failoverZones(client ec2API, r request, failed string) ([]string, error) {
+	zones := cfg.defaultZones(r.DatacenterRegion)
+
+	if len(zones) == 0 {
+		var err error
+		if zones, err = availableZones(client, cfg, r.DatacenterRegion); err != nil {
+			return nil, err
+		}
+	}
+
+	start := 0
+	for i, az := range zones {
+		if az == failed {
+			start = i + 1
+		}
+	}
+
+	var candidates []string
+	for i := range zones {
+		if az := zones[(start+i)%len(zones)]; az != failed {
+			candidates = append(candidates, az)
+		}
+	}
+	return capacity.deprioritize(candidates, time.Now()), nil
+}
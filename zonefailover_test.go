@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFailoverZones(t *testing.T) {
+	Convey("Given a region with three available zones", t, func() {
+		client := &mockEC2{zones: []*ec2.AvailabilityZone{
+			{ZoneName: aws.String("eu-west-1a"), State: aws.String("available")},
+			{ZoneName: aws.String("eu-west-1b"), State: aws.String("available")},
+			{ZoneName: aws.String("eu-west-1c"), State: aws.String("impaired")},
+			{ZoneName: aws.String("eu-west-1d"), State: aws.String("available")},
+		}}
+
+		Convey("When a create fails in one of them", func() {
+			zones, err := failoverZones(client, request{DatacenterRegion: "eu-west-1"}, "eu-west-1b")
+
+			Convey("It should try the other available ones, starting after it", func() {
+				So(err, ShouldBeNil)
+				So(zones, ShouldResemble, []string{"eu-west-1d", "eu-west-1a"})
+			})
+		})
+	})
+}
+
+func TestCreateWithFailover(t *testing.T) {
+	Convey("Given zone failover", t, func() {
+		enabled := cfg.AZFailover
+		cfg.AZFailover = true
+		defer func() { cfg.AZFailover = enabled }()
+
+		var tried []string
+		create := func(m *nats.Msg) (string, []byte) {
+			az := parseRequest(m.Data).AvailabilityZone
+			tried = append(tried, az)
+			if az == "eu-west-1a" {
+				return m.Subject + ".error", []byte(`{"error":"InsufficientCapacity: no capacity in eu-west-1a"}`)
+			}
+			return m.Subject + ".done", m.Data
+		}
+		m := &nats.Msg{Subject: "network.create.aws", Data: []byte(`{"datacenter_region":"eu-west-1","availability_zone":"eu-west-1a"}`)}
+
+		Convey("When a create whose zone was picked fails for lack of capacity", func() {
+			cfg.DefaultAZs = []string{"eu-west-1a", "eu-west-1b"}
+			defer func() { cfg.DefaultAZs = nil }()
+
+			subject, data := createWithFailover(m, request{DatacenterRegion: "eu-west-1"}, create)
+
+			var body struct {
+				Substitution zoneSubstitution `json:"availability_zone_substitution"`
+			}
+			json.Unmarshal(data, &body)
+
+			Convey("It should create it in the next zone and report the substitution", func() {
+				So(subject, ShouldEqual, "network.create.aws.done")
+				So(tried, ShouldResemble, []string{"eu-west-1a", "eu-west-1b"})
+				So(body.Substitution, ShouldResemble, zoneSubstitution{Requested: "eu-west-1a", Used: "eu-west-1b", Failed: []string{"eu-west-1a"}})
+			})
+		})
+
+		Convey("When the event sets its zone", func() {
+			subject, _ := createWithFailover(m, request{DatacenterRegion: "eu-west-1", AvailabilityZone: "eu-west-1a"}, create)
+
+			Convey("It should report the failure", func() {
+				So(subject, ShouldEqual, "network.create.aws.error")
+				So(tried, ShouldResemble, []string{"eu-west-1a"})
+			})
+		})
+	})
+}